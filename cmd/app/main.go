@@ -9,6 +9,7 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 )
 
 func main() {
@@ -18,7 +19,10 @@ func main() {
 	}
 	defer cleanup()
 
-	app := infra.NewApp(deps)
+	app, err := infra.NewApp(deps)
+	if err != nil {
+		log.Fatalf("Failed to initialize application: %v", err)
+	}
 	server := http_server.NewHTTPServer(app)
 
 	if err := server.Start(); err != nil {
@@ -28,6 +32,8 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	app.Scheduler().Start(ctx)
+
 	<-ctx.Done()
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -37,5 +43,9 @@ func main() {
 		log.Fatalf("Shutdown failed: %v", err)
 	}
 
+	if err := app.Scheduler().Stop(shutdownCtx); err != nil {
+		log.Printf("Scheduler shutdown failed: %v", err)
+	}
+
 	log.Println("Server exited cleanly")
 }
@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"time"
+)
+
+type ListUsersQuery struct {
+	Search   string `form:"q" validate:"omitempty,max=255"`
+	Page     int    `form:"page" validate:"omitempty,gte=1"`
+	PageSize int    `form:"page_size" validate:"omitempty,gte=1,lte=100"`
+}
+
+type UserListResponse struct {
+	Users    []user.User `json:"users"`
+	Total    int         `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+}
+
+type LockoutStateResponse struct {
+	UserID                int64      `json:"user_id"`
+	FailedLoginAttempts   int        `json:"failed_login_attempts"`
+	UnlockTime            *time.Time `json:"unlock_time"`
+	Locked                bool       `json:"locked"`
+	DisabledAt            *time.Time `json:"disabled_at"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+}
+
+type RevokeTokensResponse struct {
+	Revoked int64 `json:"revoked"`
+}
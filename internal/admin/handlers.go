@@ -0,0 +1,329 @@
+package admin
+
+import (
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+const defaultPageSize = 20
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+type IntIDPathParam struct {
+	ID int64 `uri:"id" binding:"required" validate:"required,gt=0"`
+}
+
+// ListUsers searches users
+// @Summary List users
+// @Description Admin endpoint to search users by username or email with pagination
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Username or email substring"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} UserListResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/users [get]
+func (h *Handler) ListUsers(c *gin.Context) {
+	query, ok := validation.BindAndValidateQuery[ListUsersQuery](c)
+	if !ok {
+		return
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	users, total, err := h.service.ListUsers(c.Request.Context(), user.ListFilter{
+		Search: query.Search,
+		Limit:  query.PageSize,
+		Offset: (query.Page - 1) * query.PageSize,
+	})
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to list users", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserListResponse{Users: users, Total: total, Page: query.Page, PageSize: query.PageSize})
+}
+
+// GetUser returns user by ID
+// @Summary Get user by ID
+// @Description Admin endpoint to fetch user by ID
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} user.User
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/users/{id} [get]
+func (h *Handler) GetUser(c *gin.Context) {
+	idParam, ok := validation.BindAndValidateURI[IntIDPathParam](c)
+	if !ok {
+		return
+	}
+
+	u, err := h.service.GetUser(c.Request.Context(), idParam.ID)
+	if err != nil {
+		respondError(c, err, "failed to get user")
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+// GetLockoutState returns login lockout state of a user
+// @Summary Get user lockout state
+// @Description Admin endpoint showing failed login attempts, lock expiry and account restrictions
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} LockoutStateResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/users/{id}/lockout [get]
+func (h *Handler) GetLockoutState(c *gin.Context) {
+	idParam, ok := validation.BindAndValidateURI[IntIDPathParam](c)
+	if !ok {
+		return
+	}
+
+	u, err := h.service.GetUser(c.Request.Context(), idParam.ID)
+	if err != nil {
+		respondError(c, err, "failed to get user")
+		return
+	}
+
+	c.JSON(http.StatusOK, LockoutStateResponse{
+		UserID:                u.ID,
+		FailedLoginAttempts:   u.FailedLoginAttempts,
+		UnlockTime:            u.UnlockTime,
+		Locked:                u.UnlockTime != nil && u.UnlockTime.After(time.Now()),
+		DisabledAt:            u.DisabledAt,
+		PasswordResetRequired: u.PasswordResetRequired,
+	})
+}
+
+type UpdateRoleRequest struct {
+	Role auth.Role `json:"role" binding:"required" validate:"required,oneof=user coach admin"`
+}
+
+// UpdateUserRole changes a user's role
+// @Summary Update user role
+// @Description Admin endpoint to assign a role to a user. Changing the role logs the user out everywhere so it takes effect immediately.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body UpdateRoleRequest true "Role payload"
+// @Success 200 {object} user.User
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/users/{id}/role [patch]
+func (h *Handler) UpdateUserRole(c *gin.Context) {
+	actorID, idParam, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	req, ok := validation.BindAndValidate[UpdateRoleRequest](c)
+	if !ok {
+		return
+	}
+
+	u, err := h.service.UpdateRole(c.Request.Context(), actorID, idParam.ID, req.Role)
+	if err != nil {
+		respondError(c, err, "failed to update role")
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+// UnlockUser clears a login lockout
+// @Summary Unlock user
+// @Description Admin endpoint to reset failed login attempts and remove the lockout
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/users/{id}/unlock [post]
+func (h *Handler) UnlockUser(c *gin.Context) {
+	actorID, idParam, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Unlock(c.Request.Context(), actorID, idParam.ID); err != nil {
+		respondError(c, err, "failed to unlock user")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DisableUser disables an account
+// @Summary Disable user
+// @Description Admin endpoint to disable an account. Disabled users cannot log in and their existing tokens stop working immediately.
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/users/{id}/disable [post]
+func (h *Handler) DisableUser(c *gin.Context) {
+	h.setDisabled(c, true)
+}
+
+// EnableUser re-enables a disabled account
+// @Summary Enable user
+// @Description Admin endpoint to re-enable a previously disabled account
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/users/{id}/enable [post]
+func (h *Handler) EnableUser(c *gin.Context) {
+	h.setDisabled(c, false)
+}
+
+func (h *Handler) setDisabled(c *gin.Context, disabled bool) {
+	actorID, idParam, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.SetDisabled(c.Request.Context(), actorID, idParam.ID, disabled); err != nil {
+		respondError(c, err, "failed to update account state")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ForcePasswordReset requires a user to set a new password
+// @Summary Force password reset
+// @Description Admin endpoint that blocks password login, revokes all refresh and access tokens and emails a reset link
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/users/{id}/password-reset [post]
+func (h *Handler) ForcePasswordReset(c *gin.Context) {
+	actorID, idParam, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.ForcePasswordReset(c.Request.Context(), actorID, idParam.ID); err != nil {
+		respondError(c, err, "failed to force password reset")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeUserTokens logs a user out of all devices
+// @Summary Revoke all tokens
+// @Description Admin endpoint to revoke every refresh token and every access token issued so far to a user
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} RevokeTokensResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/users/{id}/revoke-tokens [post]
+func (h *Handler) RevokeUserTokens(c *gin.Context) {
+	actorID, idParam, ok := bindAdminAction(c)
+	if !ok {
+		return
+	}
+
+	revoked, err := h.service.RevokeTokens(c.Request.Context(), actorID, idParam.ID)
+	if err != nil {
+		respondError(c, err, "failed to revoke tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, RevokeTokensResponse{Revoked: revoked})
+}
+
+// bindAdminAction resolves the acting admin and the target user ID
+func bindAdminAction(c *gin.Context) (int64, *IntIDPathParam, bool) {
+	actorID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return 0, nil, false
+	}
+
+	idParam, ok := validation.BindAndValidateURI[IntIDPathParam](c)
+	if !ok {
+		return 0, nil, false
+	}
+	return actorID, idParam, true
+}
+
+func respondError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, apperrors.ErrNotFound):
+		apperrors.GenHTTPError(c, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, apperrors.ErrBadRequest):
+		apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+	default:
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, fallback, nil)
+	}
+}
@@ -0,0 +1,163 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/audit"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"log/slog"
+)
+
+// Service wraps user and auth operations available to administrators and records each of them in the audit log
+type Service interface {
+	ListUsers(ctx context.Context, filter user.ListFilter) ([]user.User, int, error)
+	GetUser(ctx context.Context, id int64) (*user.User, error)
+	UpdateRole(ctx context.Context, actorID, id int64, role auth.Role) (*user.User, error)
+	Unlock(ctx context.Context, actorID, id int64) error
+	SetDisabled(ctx context.Context, actorID, id int64, disabled bool) error
+	ForcePasswordReset(ctx context.Context, actorID, id int64) error
+	RevokeTokens(ctx context.Context, actorID, id int64) (int64, error)
+}
+
+type service struct {
+	userService  user.Service
+	authService  auth.Service
+	auditService audit.Service
+	logger       *slog.Logger
+}
+
+func NewService(userService user.Service, authService auth.Service, auditService audit.Service, logger *slog.Logger) Service {
+	return &service{userService: userService, authService: authService, auditService: auditService, logger: logger}
+}
+
+func (s *service) ListUsers(ctx context.Context, filter user.ListFilter) ([]user.User, int, error) {
+	return s.userService.List(ctx, filter)
+}
+
+func (s *service) GetUser(ctx context.Context, id int64) (*user.User, error) {
+	return s.userService.GetByID(ctx, id)
+}
+
+// UpdateRole changes the user's role and logs them out everywhere so the new role applies right away
+func (s *service) UpdateRole(ctx context.Context, actorID, id int64, role auth.Role) (*user.User, error) {
+	if actorID == id {
+		return nil, fmt.Errorf("cannot change your own role: %w", apperrors.ErrBadRequest)
+	}
+
+	before, err := s.userService.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.userService.UpdateRole(ctx, id, role)
+	if err != nil {
+		return nil, err
+	}
+
+	// access tokens carry the role, so sessions issued before the change would keep the old one
+	var details audit.Details
+	if updated.Role != before.Role {
+		revoked, err := s.authService.RevokeAllSessions(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		details = audit.Details{"revoked_refresh_tokens": revoked}
+	}
+	s.record(ctx, actorID, id, audit.ActionRoleChanged, details, audit.Diff(
+		map[string]any{"role": before.Role},
+		map[string]any{"role": updated.Role},
+	))
+	return updated, nil
+}
+
+func (s *service) Unlock(ctx context.Context, actorID, id int64) error {
+	before, err := s.userService.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.userService.Unlock(ctx, id); err != nil {
+		return err
+	}
+	s.record(ctx, actorID, id, audit.ActionUserUnlocked, nil, audit.Diff(
+		map[string]any{"failed_login_attempts": before.FailedLoginAttempts, "unlock_time": before.UnlockTime},
+		map[string]any{"failed_login_attempts": 0, "unlock_time": nil},
+	))
+	return nil
+}
+
+// SetDisabled disables or re-enables an account. Disabling also logs the user out everywhere.
+func (s *service) SetDisabled(ctx context.Context, actorID, id int64, disabled bool) error {
+	if actorID == id && disabled {
+		return fmt.Errorf("cannot disable your own account: %w", apperrors.ErrBadRequest)
+	}
+
+	before, err := s.userService.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.userService.SetDisabled(ctx, id, disabled); err != nil {
+		return err
+	}
+	changes := audit.Diff(map[string]any{"disabled": before.DisabledAt != nil}, map[string]any{"disabled": disabled})
+
+	if !disabled {
+		s.record(ctx, actorID, id, audit.ActionUserEnabled, nil, changes)
+		return nil
+	}
+
+	revoked, err := s.authService.RevokeAllSessions(ctx, id)
+	if err != nil {
+		return err
+	}
+	s.record(ctx, actorID, id, audit.ActionUserDisabled, audit.Details{"revoked_refresh_tokens": revoked}, changes)
+	return nil
+}
+
+func (s *service) ForcePasswordReset(ctx context.Context, actorID, id int64) error {
+	before, err := s.userService.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.userService.ForcePasswordReset(ctx, id); err != nil {
+		return err
+	}
+
+	revoked, err := s.authService.RevokeAllSessions(ctx, id)
+	if err != nil {
+		return err
+	}
+	s.record(ctx, actorID, id, audit.ActionPasswordResetForced, audit.Details{"revoked_refresh_tokens": revoked}, audit.Diff(
+		map[string]any{"password_reset_required": before.PasswordResetRequired},
+		map[string]any{"password_reset_required": true},
+	))
+	return nil
+}
+
+func (s *service) RevokeTokens(ctx context.Context, actorID, id int64) (int64, error) {
+	if _, err := s.userService.GetByID(ctx, id); err != nil {
+		return 0, err
+	}
+
+	revoked, err := s.authService.RevokeAllSessions(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	s.record(ctx, actorID, id, audit.ActionRefreshTokensRevoked, audit.Details{"revoked_refresh_tokens": revoked}, nil)
+	return revoked, nil
+}
+
+// record never fails the admin action itself: the change has already been applied at this point
+func (s *service) record(ctx context.Context, actorID, targetID int64, action audit.Action, details audit.Details, changes audit.Changes) {
+	entry := audit.Entry{
+		ActorID:      &actorID,
+		TargetUserID: &targetID,
+		Action:       action,
+		Details:      details,
+		Changes:      changes,
+	}
+	if err := s.auditService.Record(ctx, entry); err != nil {
+		s.logger.Error("Admin action was applied but not audited", "action", action, "target_user_id", targetID, "error", err)
+	}
+}
@@ -0,0 +1,119 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/audit"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+type fakeUsers struct {
+	user.Service
+	users map[int64]*user.User
+}
+
+func (f *fakeUsers) GetByID(_ context.Context, id int64) (*user.User, error) {
+	u, ok := f.users[id]
+	if !ok {
+		return nil, apperrors.ErrNotFound
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (f *fakeUsers) UpdateRole(ctx context.Context, id int64, role auth.Role) (*user.User, error) {
+	f.users[id].Role = role
+	return f.GetByID(ctx, id)
+}
+
+type fakeAuth struct {
+	auth.Service
+	revokedFor []int64
+	err        error
+}
+
+func (f *fakeAuth) RevokeAllSessions(_ context.Context, userID int64) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.revokedFor = append(f.revokedFor, userID)
+	return 3, nil
+}
+
+type fakeAudit struct {
+	audit.Service
+	entries []audit.Entry
+}
+
+func (f *fakeAudit) Record(_ context.Context, entry audit.Entry) error {
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func newTestService() (*service, *fakeAuth, *fakeAudit) {
+	users := &fakeUsers{users: map[int64]*user.User{
+		1: {ID: 1, Role: auth.RoleAdmin},
+		2: {ID: 2, Role: auth.RoleUser},
+	}}
+	authService := &fakeAuth{}
+	auditService := &fakeAudit{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewService(users, authService, auditService, logger).(*service), authService, auditService
+}
+
+func TestUpdateRoleRevokesSessions(t *testing.T) {
+	s, authService, auditService := newTestService()
+
+	updated, err := s.UpdateRole(context.Background(), 1, 2, auth.RoleAdmin)
+	if err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	if updated.Role != auth.RoleAdmin {
+		t.Fatalf("role = %q, want admin", updated.Role)
+	}
+	if len(authService.revokedFor) != 1 || authService.revokedFor[0] != 2 {
+		t.Fatalf("revoked sessions of %v, want [2]", authService.revokedFor)
+	}
+	if len(auditService.entries) != 1 || auditService.entries[0].Details["revoked_refresh_tokens"] != int64(3) {
+		t.Fatalf("audit entries = %+v, want one role change with the revoked token count", auditService.entries)
+	}
+}
+
+func TestUpdateRoleToSameRoleKeepsSessions(t *testing.T) {
+	s, authService, _ := newTestService()
+
+	if _, err := s.UpdateRole(context.Background(), 1, 2, auth.RoleUser); err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	if len(authService.revokedFor) != 0 {
+		t.Fatalf("revoked sessions of %v, want none when the role did not change", authService.revokedFor)
+	}
+}
+
+func TestUpdateRoleFailsWhenSessionsCannotBeRevoked(t *testing.T) {
+	s, authService, auditService := newTestService()
+	authService.err = errors.New("redis: connection refused")
+
+	if _, err := s.UpdateRole(context.Background(), 1, 2, auth.RoleCoach); !errors.Is(err, authService.err) {
+		t.Fatalf("UpdateRole = %v, want the revocation error", err)
+	}
+	if len(auditService.entries) != 0 {
+		t.Fatalf("audit entries = %+v, want none", auditService.entries)
+	}
+}
+
+func TestUpdateRoleRejectsOwnRole(t *testing.T) {
+	s, authService, _ := newTestService()
+
+	if _, err := s.UpdateRole(context.Background(), 1, 1, auth.RoleUser); !errors.Is(err, apperrors.ErrBadRequest) {
+		t.Fatalf("UpdateRole = %v, want ErrBadRequest", err)
+	}
+	if len(authService.revokedFor) != 0 {
+		t.Fatalf("revoked sessions of %v, want none", authService.revokedFor)
+	}
+}
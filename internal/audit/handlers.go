@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"encoding/json"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	// exportWriteTimeout replaces the server write timeout for exports, which stream far longer than other responses
+	exportWriteTimeout = time.Minute * 10
+)
+
+type Handler struct {
+	service Service
+	logger  *slog.Logger
+}
+
+func NewHandler(service Service, logger *slog.Logger) *Handler {
+	return &Handler{service: service, logger: logger}
+}
+
+type FilterQuery struct {
+	ActorID      int64      `form:"actor_id" validate:"omitempty,gt=0"`
+	TargetUserID int64      `form:"target_user_id" validate:"omitempty,gt=0"`
+	Action       Action     `form:"action" validate:"omitempty,oneof=user.role_changed user.unlocked user.disabled user.enabled user.password_reset_forced user.refresh_tokens_revoked user.profile_updated user.deletion_scheduled user.deletion_cancelled user.deleted user.privacy_updated"`
+	RequestID    string     `form:"request_id" validate:"omitempty,max=64"`
+	From         *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To           *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+func (q FilterQuery) filter() ListFilter {
+	return ListFilter{
+		ActorID:      q.ActorID,
+		TargetUserID: q.TargetUserID,
+		Action:       q.Action,
+		RequestID:    q.RequestID,
+		From:         q.From,
+		To:           q.To,
+	}
+}
+
+type ListEntriesQuery struct {
+	FilterQuery
+	Page     int `form:"page" validate:"omitempty,gte=1"`
+	PageSize int `form:"page_size" validate:"omitempty,gte=1,lte=200"`
+}
+
+type EntryListResponse struct {
+	Entries  []Entry `json:"entries"`
+	Total    int     `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"page_size"`
+}
+
+// ListEntries searches the audit log
+// @Summary List audit log entries
+// @Description Admin endpoint to search account and administrative changes, newest first
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param actor_id query int false "User who made the change"
+// @Param target_user_id query int false "User the change was made to"
+// @Param action query string false "Action, e.g. user.role_changed"
+// @Param request_id query string false "Request ID from the X-Request-ID header"
+// @Param from query string false "Earliest time, RFC 3339"
+// @Param to query string false "Latest time (exclusive), RFC 3339"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, up to 200"
+// @Success 200 {object} EntryListResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/audit-log [get]
+func (h *Handler) ListEntries(c *gin.Context) {
+	query, ok := validation.BindAndValidateQuery[ListEntriesQuery](c)
+	if !ok {
+		return
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	filter := query.filter()
+	filter.Limit = query.PageSize
+	filter.Offset = (query.Page - 1) * query.PageSize
+
+	entries, total, err := h.service.List(c.Request.Context(), filter)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to list audit log", nil)
+		return
+	}
+	c.JSON(http.StatusOK, EntryListResponse{Entries: entries, Total: total, Page: query.Page, PageSize: query.PageSize})
+}
+
+// ExportEntries streams the audit log as newline-delimited JSON
+// @Summary Export audit log
+// @Description Admin endpoint returning every matching entry as one JSON object per line, oldest first
+// @Tags admin
+// @Produce application/x-ndjson
+// @Security BearerAuth
+// @Param actor_id query int false "User who made the change"
+// @Param target_user_id query int false "User the change was made to"
+// @Param action query string false "Action, e.g. user.role_changed"
+// @Param request_id query string false "Request ID from the X-Request-ID header"
+// @Param from query string false "Earliest time, RFC 3339"
+// @Param to query string false "Latest time (exclusive), RFC 3339"
+// @Success 200 {file} file
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/audit-log/export [get]
+func (h *Handler) ExportEntries(c *gin.Context) {
+	query, ok := validation.BindAndValidateQuery[FilterQuery](c)
+	if !ok {
+		return
+	}
+
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil {
+		h.logger.Warn("Failed to extend write deadline for audit export", "error", err)
+	}
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit-log.ndjson"`)
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	err := h.service.Export(c.Request.Context(), query.filter(), func(entry Entry) error {
+		return encoder.Encode(entry)
+	})
+	if err == nil {
+		return
+	}
+	// headers go out with the first entry, after that a failure can only cut the stream short
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to export audit log", nil)
+		return
+	}
+	h.logger.Error("Audit log export was cut short", "error", err)
+}
@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionRoleChanged          Action = "user.role_changed"
+	ActionUserUnlocked         Action = "user.unlocked"
+	ActionUserDisabled         Action = "user.disabled"
+	ActionUserEnabled          Action = "user.enabled"
+	ActionPasswordResetForced  Action = "user.password_reset_forced"
+	ActionRefreshTokensRevoked Action = "user.refresh_tokens_revoked"
+	ActionProfileUpdated       Action = "user.profile_updated"
+	ActionDeletionScheduled    Action = "user.deletion_scheduled"
+	ActionDeletionCancelled    Action = "user.deletion_cancelled"
+	ActionUserDeleted          Action = "user.deleted"
+	ActionPrivacyUpdated       Action = "user.privacy_updated"
+)
+
+// Actions lists every action that can be used as a filter
+var Actions = []Action{
+	ActionRoleChanged, ActionUserUnlocked, ActionUserDisabled, ActionUserEnabled, ActionPasswordResetForced,
+	ActionRefreshTokensRevoked, ActionProfileUpdated, ActionDeletionScheduled, ActionDeletionCancelled, ActionUserDeleted,
+	ActionPrivacyUpdated,
+}
+
+// Entry is an append-only record of a change to an account. ActorID is nil for background jobs, actor and
+// target become nil once the user is deleted.
+type Entry struct {
+	ID           int64     `json:"id" db:"id"`
+	ActorID      *int64    `json:"actor_id" db:"actor_id"`
+	TargetUserID *int64    `json:"target_user_id" db:"target_user_id"`
+	Action       Action    `json:"action" db:"action"`
+	Details      Details   `json:"details" db:"details"`
+	Changes      Changes   `json:"changes" db:"changes"`
+	RequestID    string    `json:"request_id" db:"request_id"`
+	IP           string    `json:"ip" db:"ip"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// Change is the value of a field before and after an action. Redacted changes only record that the field changed.
+type Change struct {
+	From     any  `json:"from"`
+	To       any  `json:"to"`
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// Changes maps field names to their change, stored as JSONB
+type Changes map[string]Change
+
+// Diff compares the fields of two snapshots and keeps the ones that differ, fields missing from one side are nil
+func Diff(before, after map[string]any) Changes {
+	changes := Changes{}
+	for field, from := range before {
+		if to := after[field]; !equal(from, to) {
+			changes[field] = Change{From: from, To: to}
+		}
+	}
+	for field, to := range after {
+		if _, ok := before[field]; !ok && to != nil {
+			changes[field] = Change{From: nil, To: to}
+		}
+	}
+	return changes
+}
+
+// Redact drops the values of fields holding personal data. Entries are append-only and outlive the account,
+// so they must not keep data that is erased when the account is deleted.
+func (c Changes) Redact(fields ...string) Changes {
+	for _, field := range fields {
+		if _, ok := c[field]; ok {
+			c[field] = Change{Redacted: true}
+		}
+	}
+	return c
+}
+
+// equal compares through JSON, so pointers and values holding the same data are the same
+func equal(a, b any) bool {
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(x) == string(y)
+}
+
+func (c Changes) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c)
+}
+
+func (c *Changes) Scan(src any) error {
+	b, err := jsonBytes(src)
+	if err != nil || b == nil {
+		*c = nil
+		return err
+	}
+	return json.Unmarshal(b, c)
+}
+
+type ListFilter struct {
+	ActorID      int64
+	TargetUserID int64
+	Action       Action
+	RequestID    string
+	From         *time.Time
+	To           *time.Time
+	Limit        int
+	Offset       int
+}
+
+// Details is free-form context stored as JSONB
+type Details map[string]any
+
+func (d Details) Value() (driver.Value, error) {
+	if d == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(d)
+}
+
+func (d *Details) Scan(src any) error {
+	b, err := jsonBytes(src)
+	if err != nil || b == nil {
+		*d = nil
+		return err
+	}
+	return json.Unmarshal(b, d)
+}
+
+func jsonBytes(src any) ([]byte, error) {
+	switch v := src.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported json type %T", src)
+	}
+}
@@ -0,0 +1,37 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiffRedact(t *testing.T) {
+	before := map[string]any{"email": "old@example.com", "activity_level": "light", "weight": 80.0}
+	after := map[string]any{"email": "new@example.com", "activity_level": "active", "weight": 80.0}
+
+	changes := Diff(before, after).Redact("email", "weight")
+
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want email and activity_level: %v", len(changes), changes)
+	}
+	if got := changes["email"]; got != (Change{Redacted: true}) {
+		t.Errorf("email = %+v, want only redacted", got)
+	}
+	if _, ok := changes["weight"]; ok {
+		t.Error("redacting an unchanged field must not add it")
+	}
+	if got := changes["activity_level"]; got.From != "light" || got.To != "active" || got.Redacted {
+		t.Errorf("activity_level = %+v, want light to active", got)
+	}
+
+	stored, err := json.Marshal(changes)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	for _, leaked := range []string{"old@example.com", "new@example.com"} {
+		if strings.Contains(string(stored), leaked) {
+			t.Errorf("stored changes contain %q: %s", leaked, stored)
+		}
+	}
+}
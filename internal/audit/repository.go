@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+)
+
+type Repository interface {
+	Create(ctx context.Context, entry *Entry) error
+	List(ctx context.Context, filter ListFilter) ([]Entry, int, error)
+	// Stream calls fn for every matching entry, oldest first, without loading them all into memory.
+	// Limit and Offset of the filter are ignored.
+	Stream(ctx context.Context, filter ListFilter, fn func(Entry) error) error
+}
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) Create(ctx context.Context, entry *Entry) error {
+	query := `
+		INSERT INTO audit_log (actor_id, target_user_id, action, details, changes, request_id, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	return r.executor.QueryRowxContext(ctx, query, entry.ActorID, entry.TargetUserID, entry.Action, entry.Details, entry.Changes, entry.RequestID, entry.IP).
+		Scan(&entry.ID, &entry.CreatedAt)
+}
+
+const filterClause = `
+	WHERE ($1::BIGINT = 0 OR actor_id = $1)
+	AND ($2::BIGINT = 0 OR target_user_id = $2)
+	AND ($3 = '' OR action = $3)
+	AND ($4 = '' OR request_id = $4)
+	AND ($5::TIMESTAMPTZ IS NULL OR created_at >= $5)
+	AND ($6::TIMESTAMPTZ IS NULL OR created_at < $6)`
+
+func filterArgs(filter ListFilter) []any {
+	return []any{filter.ActorID, filter.TargetUserID, filter.Action, filter.RequestID, filter.From, filter.To}
+}
+
+func (r *repository) List(ctx context.Context, filter ListFilter) ([]Entry, int, error) {
+	args := filterArgs(filter)
+
+	var total int
+	if err := r.executor.GetContext(ctx, &total, "SELECT COUNT(*) FROM audit_log "+filterClause, args...); err != nil {
+		return nil, 0, err
+	}
+
+	entries := []Entry{}
+	query := "SELECT * FROM audit_log " + filterClause + " ORDER BY created_at DESC, id DESC LIMIT $7 OFFSET $8"
+	if err := r.executor.SelectContext(ctx, &entries, query, append(args, filter.Limit, filter.Offset)...); err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+func (r *repository) Stream(ctx context.Context, filter ListFilter, fn func(Entry) error) error {
+	rows, err := r.executor.QueryxContext(ctx, "SELECT * FROM audit_log "+filterClause+" ORDER BY id", filterArgs(filter)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry Entry
+		if err := rows.StructScan(&entry); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/pkg/requestinfo"
+	"log/slog"
+)
+
+type Service interface {
+	// Record stores an entry, the request ID and IP are taken from the request context when not set
+	Record(ctx context.Context, entry Entry) error
+	List(ctx context.Context, filter ListFilter) ([]Entry, int, error)
+	Export(ctx context.Context, filter ListFilter, fn func(Entry) error) error
+}
+
+type service struct {
+	repo   Repository
+	logger *slog.Logger
+}
+
+func NewService(repo Repository, logger *slog.Logger) Service {
+	return &service{repo: repo, logger: logger}
+}
+
+func (s *service) Record(ctx context.Context, entry Entry) error {
+	info := requestinfo.From(ctx)
+	if entry.RequestID == "" {
+		entry.RequestID = info.RequestID
+	}
+	if entry.IP == "" {
+		entry.IP = info.IP
+	}
+
+	if err := s.repo.Create(ctx, &entry); err != nil {
+		s.logger.Error("Failed to record audit entry", "action", entry.Action, "request_id", entry.RequestID, "error", err)
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+func (s *service) List(ctx context.Context, filter ListFilter) ([]Entry, int, error) {
+	return s.repo.List(ctx, filter)
+}
+
+func (s *service) Export(ctx context.Context, filter ListFilter, fn func(Entry) error) error {
+	return s.repo.Stream(ctx, filter, fn)
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"os"
+)
+
+// KeySet holds the keys used to sign and verify access tokens.
+//
+// Tokens are signed with the active key and carry its ID in the "kid" header. Previous keys are
+// only used for verification and are published in the JWKS document alongside the active one.
+// Key IDs are RFC 7638 thumbprints, so every replica derives the same kid from the same file.
+//
+// Rotation without downtime:
+//  1. Generate a new key and add it to JWT_VERIFICATION_KEY_FILES, then deploy. Every replica now
+//     accepts tokens signed by it and publishes it in /.well-known/jwks.json.
+//  2. Wait until JWKS caches of other services have expired.
+//  3. Make the new key JWT_SIGNING_KEY_FILE and move the old one to JWT_VERIFICATION_KEY_FILES, then deploy.
+//  4. After AccessTokenTTL has passed, remove the old key.
+//
+// Refresh tokens are opaque database records, so none of these steps log anyone out.
+// A legacy HS256 secret may be configured to keep accepting tokens issued before the switch.
+type KeySet struct {
+	active     *SigningKey
+	keys       map[string]*SigningKey
+	legacyHMAC []byte
+}
+
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// JWK is a public key in RFC 7517 format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet reads PEM encoded RSA or Ed25519 keys. The active key must be a private key,
+// verification keys may be either private or public. When activePath is empty tokens are
+// signed with the legacy HS256 secret instead.
+func LoadKeySet(activePath string, verificationPaths []string, legacySecret string) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*SigningKey)}
+	if legacySecret != "" {
+		ks.legacyHMAC = []byte(legacySecret)
+	}
+
+	if activePath != "" {
+		key, err := loadKey(activePath)
+		if err != nil {
+			return nil, err
+		}
+		if key.Private == nil {
+			return nil, fmt.Errorf("signing key %s is not a private key", activePath)
+		}
+		ks.active = key
+		ks.keys[key.ID] = key
+	}
+
+	for _, path := range verificationPaths {
+		if path == "" {
+			continue
+		}
+		key, err := loadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := ks.keys[key.ID]; !exists {
+			ks.keys[key.ID] = key
+		}
+	}
+
+	if ks.active == nil && ks.legacyHMAC == nil {
+		return nil, errors.New("no JWT signing key configured: set JWT_SIGNING_KEY_FILE or JWT_KEY")
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	if ks.active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.legacyHMAC)
+	}
+
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.Private)
+}
+
+// keyFunc picks the verification key by kid and refuses tokens whose alg doesn't match that key
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && ks.legacyHMAC != nil {
+			return ks.legacyHMAC, nil
+		}
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public keys other services may use to verify our tokens
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	if ks.active != nil {
+		set.Keys = append(set.Keys, toJWK(ks.active))
+	}
+	for id, key := range ks.keys {
+		if ks.active != nil && id == ks.active.ID {
+			continue
+		}
+		set.Keys = append(set.Keys, toJWK(key))
+	}
+	return set
+}
+
+func loadKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %w", path, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s is not PEM encoded", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s has unsupported PEM type %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %s: %w", path, err)
+	}
+
+	key := &SigningKey{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("key %s has unsupported type %T, only RSA and Ed25519 are supported", path, parsed)
+	}
+
+	key.ID = thumbprint(toJWK(key))
+	return key, nil
+}
+
+func toJWK(key *SigningKey) JWK {
+	jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint over the required members in lexicographic order
+func thumbprint(jwk JWK) string {
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	b, _ := json.Marshal(members)
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,314 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt/v4"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "*.pem")
+	if err != nil {
+		t.Fatalf("CreateTemp: %v", err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		t.Fatalf("pem.Encode: %v", err)
+	}
+	return f.Name()
+}
+
+func writeRSAKey(t *testing.T) (privatePath, publicPath string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	return writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)), writePEM(t, "PUBLIC KEY", public)
+}
+
+func writeEd25519Key(t *testing.T) (privatePath, publicPath string) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	private, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	return writePEM(t, "PRIVATE KEY", private), writePEM(t, "PUBLIC KEY", public)
+}
+
+func loadTestKeySet(t *testing.T, activePath string, verificationPaths []string, legacySecret string) *KeySet {
+	t.Helper()
+	ks, err := LoadKeySet(activePath, verificationPaths, legacySecret)
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	return ks
+}
+
+func testClaims() Claims {
+	return Claims{
+		UserID: 7,
+		Role:   RoleUser,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
+		},
+	}
+}
+
+func verify(ks *KeySet, tokenString string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, &Claims{}, ks.keyFunc)
+}
+
+func TestKeySetSignsAndVerifies(t *testing.T) {
+	rsaPath, _ := writeRSAKey(t)
+	edPath, _ := writeEd25519Key(t)
+
+	tests := []struct {
+		name string
+		path string
+		alg  string
+	}{
+		{"RS256", rsaPath, "RS256"},
+		{"EdDSA", edPath, "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := loadTestKeySet(t, tt.path, nil, "")
+			signed, err := ks.sign(testClaims())
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			token, err := verify(ks, signed)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if token.Header["alg"] != tt.alg || token.Header["kid"] != ks.active.ID {
+				t.Fatalf("header = %v, want alg %s and kid %s", token.Header, tt.alg, ks.active.ID)
+			}
+			if claims := token.Claims.(*Claims); claims.UserID != 7 {
+				t.Fatalf("user_id = %d, want 7", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestKeySetVerifiesWithPublicKeyOnly(t *testing.T) {
+	privatePath, publicPath := writeEd25519Key(t)
+	signer := loadTestKeySet(t, privatePath, nil, "")
+	verifier := loadTestKeySet(t, "", []string{publicPath}, "legacy-secret")
+
+	signed, err := signer.sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := verify(verifier, signed); err != nil {
+		t.Fatalf("verify with the public key: %v", err)
+	}
+}
+
+func TestKeySetRejectsUnknownKeyID(t *testing.T) {
+	trustedPath, _ := writeRSAKey(t)
+	otherPath, _ := writeRSAKey(t)
+	trusted := loadTestKeySet(t, trustedPath, nil, "")
+	other := loadTestKeySet(t, otherPath, nil, "")
+
+	signed, err := other.sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := verify(trusted, signed); err == nil {
+		t.Fatal("token signed by an untrusted key was accepted")
+	}
+
+	// reusing a trusted kid doesn't help, the signature is checked against the trusted key
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims())
+	token.Header["kid"] = trusted.active.ID
+	forged, err := token.SignedString(other.active.Private)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	if _, err := verify(trusted, forged); err == nil {
+		t.Fatal("token with a trusted kid but a foreign signature was accepted")
+	}
+}
+
+func TestKeySetRejectsAlgorithmSwitch(t *testing.T) {
+	rsaPath, rsaPublicPath := writeRSAKey(t)
+	ks := loadTestKeySet(t, rsaPath, nil, "legacy-secret")
+	publicPEM, err := os.ReadFile(rsaPublicPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims())
+	none.Header["kid"] = ks.active.ID
+	unsigned, err := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("SignedString(none): %v", err)
+	}
+
+	hmacWithKid := func(secret []byte) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+		token.Header["kid"] = ks.active.ID
+		signed, err := token.SignedString(secret)
+		if err != nil {
+			t.Fatalf("SignedString(HS256): %v", err)
+		}
+		return signed
+	}
+
+	tests := map[string]string{
+		"none with kid":                       unsigned,
+		"HS256 keyed with the RSA public key": hmacWithKid(publicPEM),
+		"HS256 keyed with the legacy secret":  hmacWithKid([]byte("legacy-secret")),
+	}
+	for name, signed := range tests {
+		if _, err := verify(ks, signed); err == nil {
+			t.Errorf("%s: token was accepted", name)
+		}
+	}
+}
+
+func TestKeySetLegacyHMAC(t *testing.T) {
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	signed, err := legacy.SignedString([]byte("legacy-secret"))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	rsaPath, _ := writeRSAKey(t)
+
+	if _, err := verify(loadTestKeySet(t, rsaPath, nil, "legacy-secret"), signed); err != nil {
+		t.Fatalf("legacy token rejected while the secret is configured: %v", err)
+	}
+	if _, err := verify(loadTestKeySet(t, rsaPath, nil, ""), signed); err == nil {
+		t.Fatal("legacy token accepted after the secret was removed")
+	}
+	if _, err := verify(loadTestKeySet(t, rsaPath, nil, "other-secret"), signed); err == nil {
+		t.Fatal("legacy token accepted with a different secret")
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldPath, _ := writeRSAKey(t)
+	newPath, _ := writeEd25519Key(t)
+
+	before := loadTestKeySet(t, oldPath, nil, "")
+	issuedBefore, err := before.sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	// step 1: the new key is trusted but not used yet
+	staged := loadTestKeySet(t, oldPath, []string{newPath}, "")
+	// step 3: the new key signs and the old one only verifies
+	after := loadTestKeySet(t, newPath, []string{oldPath}, "")
+	issuedAfter, err := after.sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	token, err := verify(after, issuedAfter)
+	if err != nil {
+		t.Fatalf("verify new token: %v", err)
+	}
+	if token.Header["kid"] != after.active.ID || token.Header["alg"] != "EdDSA" {
+		t.Fatalf("new token header = %v, want it signed by the new key", token.Header)
+	}
+	if _, err := verify(after, issuedBefore); err != nil {
+		t.Fatalf("token issued before the rotation rejected: %v", err)
+	}
+	if _, err := verify(staged, issuedAfter); err != nil {
+		t.Fatalf("replica still on step 1 rejected a token from the new key: %v", err)
+	}
+	if _, err := verify(before, issuedAfter); err == nil {
+		t.Fatal("replica that never trusted the new key accepted its token")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	activePath, _ := writeEd25519Key(t)
+	_, verificationPath := writeRSAKey(t)
+	ks := loadTestKeySet(t, activePath, []string{verificationPath, activePath}, "legacy-secret")
+
+	set := ks.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want the active and the verification key", len(set.Keys))
+	}
+	active, previous := set.Keys[0], set.Keys[1]
+	if active.Kid != ks.active.ID || active.Kty != "OKP" || active.Crv != "Ed25519" || active.Alg != "EdDSA" || active.X == "" {
+		t.Fatalf("active JWK = %+v, want the Ed25519 signing key first", active)
+	}
+	if previous.Kty != "RSA" || previous.Alg != "RS256" || previous.N == "" || previous.E != "AQAB" {
+		t.Fatalf("verification JWK = %+v, want the RSA key", previous)
+	}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "sig" || jwk.Kid != thumbprint(jwk) {
+			t.Fatalf("JWK %+v must be a signing key identified by its thumbprint", jwk)
+		}
+	}
+
+	if set := loadTestKeySet(t, "", nil, "legacy-secret").JWKS(); set.Keys == nil || len(set.Keys) != 0 {
+		t.Fatalf("JWKS with only a legacy secret = %+v, want an empty key list", set)
+	}
+}
+
+func TestThumbprintMatchesRFC7638(t *testing.T) {
+	jwk := JWK{
+		Kty: "RSA",
+		E:   "AQAB",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMs" +
+			"tn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91" +
+			"CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+	if got, want := thumbprint(jwk), "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Fatalf("thumbprint = %s, want %s", got, want)
+	}
+}
+
+func TestLoadKeySetRejectsUnusableKeys(t *testing.T) {
+	_, publicPath := writeEd25519Key(t)
+	garbage := filepath.Join(t.TempDir(), "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		active       string
+		verification []string
+		legacy       string
+	}{
+		{"nothing configured", "", nil, ""},
+		{"public signing key", publicPath, nil, ""},
+		{"missing file", filepath.Join(t.TempDir(), "missing.pem"), nil, ""},
+		{"not PEM", garbage, nil, ""},
+		{"bad verification key", "", []string{garbage}, "legacy-secret"},
+		{"unsupported PEM type", writePEM(t, "CERTIFICATE", []byte("x")), nil, ""},
+	}
+	for _, tt := range tests {
+		if _, err := LoadKeySet(tt.active, tt.verification, tt.legacy); err == nil {
+			t.Errorf("%s: LoadKeySet succeeded, want an error", tt.name)
+		}
+	}
+}
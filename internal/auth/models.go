@@ -13,3 +13,17 @@ type RefreshToken struct {
 	UserAgent string `json:"user_agent" db:"user_agent"`
 	IP        string `json:"ip" db:"ip"`
 }
+
+// UserAccess is the subset of user state the auth module needs when issuing tokens
+type UserAccess struct {
+	Role       Role       `db:"role"`
+	DisabledAt *time.Time `db:"disabled_at"`
+}
+
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleCoach Role = "coach"
+	RoleAdmin Role = "admin"
+)
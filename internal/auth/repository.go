@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/Uranury/WorkoutTracker/pkg/database"
 	"github.com/jmoiron/sqlx"
+	"time"
 )
 
 type RefreshTokenRepository interface {
@@ -11,7 +12,10 @@ type RefreshTokenRepository interface {
 	FindByHash(ctx context.Context, tokenHash string) (*RefreshToken, error)
 	FindByHashForUpdate(ctx context.Context, tokenHash string) (*RefreshToken, error)
 	RevokeByHash(ctx context.Context, tokenHash string) error
-	DeleteExpired(ctx context.Context) error
+	RevokeAllForUser(ctx context.Context, userID int64) (int64, error)
+	DeleteExpired(ctx context.Context, revokedBefore time.Time) (int64, error)
+
+	FindUserAccess(ctx context.Context, userID int64) (*UserAccess, error)
 }
 
 type repository struct {
@@ -66,8 +70,27 @@ func (repo *repository) RevokeByHash(ctx context.Context, tokenHash string) erro
 	return err
 }
 
-func (repo *repository) DeleteExpired(ctx context.Context) error {
-	query := `DELETE FROM refresh_tokens WHERE expires_at < NOW()`
-	_, err := repo.executor.ExecContext(ctx, query)
-	return err
+func (repo *repository) RevokeAllForUser(ctx context.Context, userID int64) (int64, error) {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	res, err := repo.executor.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (repo *repository) DeleteExpired(ctx context.Context, revokedBefore time.Time) (int64, error) {
+	query := `DELETE FROM refresh_tokens WHERE expires_at < NOW() OR revoked_at < $1`
+	res, err := repo.executor.ExecContext(ctx, query, revokedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (repo *repository) FindUserAccess(ctx context.Context, userID int64) (*UserAccess, error) {
+	query := `SELECT role, disabled_at FROM users WHERE id = $1`
+	access := &UserAccess{}
+	err := repo.executor.GetContext(ctx, access, query, userID)
+	return access, err
 }
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RevocationStore remembers revoked access tokens until they would have expired anyway. Entries never
+// need to outlive AccessTokenTTL, so the store stays small.
+type RevocationStore interface {
+	// RevokeToken rejects the token with the given jti until expiresAt
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	// SetWatermark rejects every token of the user issued before issuedBefore
+	SetWatermark(ctx context.Context, userID int64, issuedBefore time.Time) error
+	// Watermark returns the zero time when the user has none
+	Watermark(ctx context.Context, userID int64) (time.Time, error)
+}
+
+type redisRevocationStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisRevocationStore(client *redis.Client, prefix string) RevocationStore {
+	return &redisRevocationStore{client: client, prefix: prefix}
+}
+
+func (s *redisRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, s.prefix+"jti:"+jti, 1, ttl).Err()
+}
+
+func (s *redisRevocationStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.prefix+"jti:"+jti).Result()
+	return n > 0, err
+}
+
+func (s *redisRevocationStore) SetWatermark(ctx context.Context, userID int64, issuedBefore time.Time) error {
+	return s.client.Set(ctx, s.watermarkKey(userID), issuedBefore.Unix(), AccessTokenTTL).Err()
+}
+
+func (s *redisRevocationStore) Watermark(ctx context.Context, userID int64) (time.Time, error) {
+	v, err := s.client.Get(ctx, s.watermarkKey(userID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(v, 0), nil
+}
+
+func (s *redisRevocationStore) watermarkKey(userID int64) string {
+	return s.prefix + "user:" + strconv.FormatInt(userID, 10)
+}
+
+// memoryRevocationStore is a per-process fallback used when Redis is not configured.
+// Revocations are not shared between replicas.
+type memoryRevocationStore struct {
+	mu         sync.Mutex
+	tokens     map[string]time.Time
+	watermarks map[int64]time.Time
+	lastSweep  time.Time
+}
+
+func NewMemoryRevocationStore() RevocationStore {
+	return &memoryRevocationStore{
+		tokens:     make(map[string]time.Time),
+		watermarks: make(map[int64]time.Time),
+		lastSweep:  time.Now(),
+	}
+}
+
+func (s *memoryRevocationStore) RevokeToken(_ context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(time.Now())
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *memoryRevocationStore) IsTokenRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.tokens[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (s *memoryRevocationStore) SetWatermark(_ context.Context, userID int64, issuedBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(time.Now())
+	s.watermarks[userID] = issuedBefore
+	return nil
+}
+
+func (s *memoryRevocationStore) Watermark(_ context.Context, userID int64) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.watermarks[userID], nil
+}
+
+// sweep drops entries that can no longer match a live token, at most once a minute
+func (s *memoryRevocationStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for jti, expiresAt := range s.tokens {
+		if !now.Before(expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+	for userID, issuedBefore := range s.watermarks {
+		if now.Sub(issuedBefore) > AccessTokenTTL {
+			delete(s.watermarks, userID)
+		}
+	}
+}
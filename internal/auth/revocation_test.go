@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+func newTestRedisStore(t *testing.T) (RevocationStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedisRevocationStore(client, "revoked:"), mr
+}
+
+func testRevocationStore(t *testing.T, store RevocationStore, expire func(time.Duration)) {
+	ctx := context.Background()
+
+	if err := store.RevokeToken(ctx, "jti-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if revoked, err := store.IsTokenRevoked(ctx, "jti-1"); err != nil || !revoked {
+		t.Fatalf("IsTokenRevoked(jti-1) = %v, %v, want true", revoked, err)
+	}
+	if revoked, err := store.IsTokenRevoked(ctx, "jti-2"); err != nil || revoked {
+		t.Fatalf("IsTokenRevoked(jti-2) = %v, %v, want false", revoked, err)
+	}
+	if err := store.RevokeToken(ctx, "jti-3", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("RevokeToken(expired): %v", err)
+	}
+	if revoked, err := store.IsTokenRevoked(ctx, "jti-3"); err != nil || revoked {
+		t.Fatalf("IsTokenRevoked(jti-3) = %v, %v, want false for an already expired token", revoked, err)
+	}
+
+	if watermark, err := store.Watermark(ctx, 7); err != nil || !watermark.IsZero() {
+		t.Fatalf("Watermark without one set = %v, %v, want zero time", watermark, err)
+	}
+	issuedBefore := time.Unix(time.Now().Unix(), 0)
+	if err := store.SetWatermark(ctx, 7, issuedBefore); err != nil {
+		t.Fatalf("SetWatermark: %v", err)
+	}
+	if watermark, err := store.Watermark(ctx, 7); err != nil || !watermark.Equal(issuedBefore) {
+		t.Fatalf("Watermark = %v, %v, want %v", watermark, err, issuedBefore)
+	}
+	if watermark, err := store.Watermark(ctx, 8); err != nil || !watermark.IsZero() {
+		t.Fatalf("Watermark of another user = %v, %v, want zero time", watermark, err)
+	}
+
+	expire(2 * time.Minute)
+	if revoked, err := store.IsTokenRevoked(ctx, "jti-1"); err != nil || revoked {
+		t.Fatalf("IsTokenRevoked(jti-1) after expiry = %v, %v, want false", revoked, err)
+	}
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	store := NewMemoryRevocationStore().(*memoryRevocationStore)
+	testRevocationStore(t, store, func(d time.Duration) {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		for jti, expiresAt := range store.tokens {
+			store.tokens[jti] = expiresAt.Add(-d)
+		}
+	})
+}
+
+func TestRedisRevocationStore(t *testing.T) {
+	store, mr := newTestRedisStore(t)
+	testRevocationStore(t, store, mr.FastForward)
+}
+
+func TestRedisWatermarkExpiresWithAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	store, mr := newTestRedisStore(t)
+
+	if err := store.SetWatermark(ctx, 7, time.Now()); err != nil {
+		t.Fatalf("SetWatermark: %v", err)
+	}
+	mr.FastForward(AccessTokenTTL + time.Second)
+	if watermark, err := store.Watermark(ctx, 7); err != nil || !watermark.IsZero() {
+		t.Fatalf("Watermark after AccessTokenTTL = %v, %v, want zero time", watermark, err)
+	}
+}
+
+func TestMemoryRevocationStoreSweepsExpiredEntries(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore().(*memoryRevocationStore)
+
+	if err := store.RevokeToken(ctx, "old", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	store.watermarks[7] = time.Now().Add(-AccessTokenTTL - time.Minute)
+	store.lastSweep = time.Now().Add(-2 * time.Minute)
+
+	if err := store.RevokeToken(ctx, "new", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if _, ok := store.tokens["old"]; ok {
+		t.Fatal("expired token was not swept")
+	}
+	if _, ok := store.watermarks[7]; ok {
+		t.Fatal("watermark older than AccessTokenTTL was not swept")
+	}
+	if _, ok := store.tokens["new"]; !ok {
+		t.Fatal("live token was swept")
+	}
+}
+
+func TestIsRevoked(t *testing.T) {
+	ctx := context.Background()
+	watermark := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name     string
+		id       string
+		issuedAt *jwt.NumericDate
+		want     bool
+	}{
+		{"revoked jti", "revoked", jwt.NewNumericDate(watermark.Add(time.Hour)), true},
+		{"issued before watermark", "live", jwt.NewNumericDate(watermark.Add(-time.Second)), true},
+		{"issued in the watermark second", "live", jwt.NewNumericDate(watermark), false},
+		{"issued after watermark", "live", jwt.NewNumericDate(watermark.Add(time.Second)), false},
+		{"without jti before watermark", "", jwt.NewNumericDate(watermark.Add(-time.Second)), true},
+		{"without iat", "live", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryRevocationStore()
+			if err := store.RevokeToken(ctx, "revoked", time.Now().Add(time.Minute)); err != nil {
+				t.Fatalf("RevokeToken: %v", err)
+			}
+			if err := store.SetWatermark(ctx, 7, watermark); err != nil {
+				t.Fatalf("SetWatermark: %v", err)
+			}
+			s := &auth{revocations: store}
+
+			claims := &Claims{UserID: 7, RegisteredClaims: jwt.RegisteredClaims{ID: tt.id, IssuedAt: tt.issuedAt}}
+			got, err := s.IsRevoked(ctx, claims)
+			if err != nil {
+				t.Fatalf("IsRevoked: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("IsRevoked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRevokedWithoutWatermark(t *testing.T) {
+	s := &auth{revocations: NewMemoryRevocationStore()}
+	claims := &Claims{UserID: 7}
+	if revoked, err := s.IsRevoked(context.Background(), claims); err != nil || revoked {
+		t.Fatalf("IsRevoked = %v, %v, want false when the user has no watermark", revoked, err)
+	}
+}
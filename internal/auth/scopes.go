@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scope limits what a delegated credential may do. Interactive sessions are not scoped and have full access.
+type Scope string
+
+const (
+	ScopeProfileRead   Scope = "profile:read"
+	ScopeProfileWrite  Scope = "profile:write"
+	ScopeSessionsRead  Scope = "sessions:read"
+	ScopeSessionsWrite Scope = "sessions:write"
+)
+
+// Scopes lists every scope that can be granted
+var Scopes = []Scope{ScopeProfileRead, ScopeProfileWrite, ScopeSessionsRead, ScopeSessionsWrite}
+
+// ParseScopes validates raw scope names and removes duplicates
+func ParseScopes(raw []string) ([]Scope, error) {
+	scopes := make([]Scope, 0, len(raw))
+	for _, r := range raw {
+		s := Scope(r)
+		if !slices.Contains(Scopes, s) {
+			return nil, fmt.Errorf("unknown scope %q", r)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// SplitScopes parses a space-delimited scope string as used by OAuth2
+func SplitScopes(s string) []Scope {
+	fields := strings.Fields(s)
+	scopes := make([]Scope, len(fields))
+	for i, f := range fields {
+		scopes[i] = Scope(f)
+	}
+	return scopes
+}
+
+func JoinScopes(scopes []Scope) string {
+	parts := make([]string, len(scopes))
+	for i, s := range scopes {
+		parts[i] = string(s)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Principal is the identity behind a delegated credential
+type Principal struct {
+	UserID int64
+	Role   Role
+	Scopes []Scope
+}
@@ -8,62 +8,253 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/jmoiron/sqlx"
 	"log/slog"
+	"strconv"
 	"time"
 )
 
 var (
 	RefreshTokenTTL = time.Hour * 24 * 30
 	AccessTokenTTL  = time.Minute * 5
+	MFATokenTTL     = time.Minute * 5
+	// MFAMaxAttempts is how many codes may be tried with one mfa token before the password step must be repeated
+	MFAMaxAttempts = 5
 )
 
+// purposeMFA marks a token that only proves the password step of a two-step login
+const purposeMFA = "mfa"
+
+var (
+	ErrAccountDisabled = errors.New("account is disabled")
+	ErrInvalidMFAToken = errors.New("invalid or expired mfa token")
+	ErrMFATokenSpent   = errors.New("mfa token is used up, please log in again")
+)
+
+// SessionEvent names a session lifecycle change reported to the security log
+type SessionEvent string
+
+const (
+	SessionRefreshed SessionEvent = "token_refresh"
+	SessionLoggedOut SessionEvent = "logout"
+	SessionsRevoked  SessionEvent = "logout_all"
+)
+
+// DeviceWatcher is told about every new session so it can recognize devices the user has not used before
+type DeviceWatcher interface {
+	SessionStarted(ctx context.Context, userID int64, userAgent, ip string)
+}
+
+// EventRecorder receives session events for the security log. Recording must not fail the session change.
+type EventRecorder interface {
+	RecordSessionEvent(ctx context.Context, userID int64, event SessionEvent, success bool, details map[string]any)
+}
+
 type Service interface {
-	GenerateToken(userID int64) (string, error)
+	GenerateToken(userID int64, role Role) (string, error)
+	// GenerateClientToken issues an access token delegated to a third-party client and limited to scopes
+	GenerateClientToken(userID int64, role Role, clientID string, scopes []Scope) (string, error)
 	ValidateToken(tokenString string) (*Claims, error)
+	JWKS() JWKSet
+
+	// IsRevoked reports whether a validly signed access token has been revoked since it was issued
+	IsRevoked(ctx context.Context, claims *Claims) (bool, error)
+	RevokeAccessToken(ctx context.Context, claims *Claims) error
+
+	GenerateMFAToken(userID int64) (string, error)
+	// ValidateMFAToken checks an mfa token and counts one attempt against it. Counting happens before the code is
+	// checked so concurrent guesses cannot slip past MFAMaxAttempts; the attempt that uses up the token still runs.
+	ValidateMFAToken(ctx context.Context, tokenString string) (*Claims, error)
+	// ConsumeMFAToken invalidates the token once the second factor was accepted
+	ConsumeMFAToken(ctx context.Context, claims *Claims) error
 
 	GenerateRefreshToken(ctx context.Context, userID int64, userAgent string, ip string) (string, error)
 	ValidateRefreshToken(ctx context.Context, tokenString string) (*RefreshToken, error)
 	RefreshAccessToken(ctx context.Context, refreshToken string) (string, string, error)
 	RevokeRefreshToken(ctx context.Context, refreshToken string) error
+	// RevokeAllSessions logs the user out everywhere: every refresh token and every access token issued so far
+	// stop working. It returns the number of revoked refresh tokens.
+	RevokeAllSessions(ctx context.Context, userID int64) (int64, error)
+	PurgeRefreshTokens(ctx context.Context, revokedBefore time.Time) (int64, error)
 }
 
 type auth struct {
-	jwtKey []byte
-	logger *slog.Logger
-	db     *sqlx.DB
-	repo   RefreshTokenRepository
+	keys        *KeySet
+	issuer      string
+	logger      *slog.Logger
+	db          *sqlx.DB
+	repo        RefreshTokenRepository
+	revocations RevocationStore
+	attempts    ratelimit.Counter
+	events      EventRecorder
+	devices     DeviceWatcher
 }
 
-func NewAuth(secret string, db *sqlx.DB, logger *slog.Logger, repo RefreshTokenRepository) Service {
-	return &auth{jwtKey: []byte(secret), db: db, logger: logger, repo: repo}
+func NewAuth(keys *KeySet, issuer string, db *sqlx.DB, logger *slog.Logger, repo RefreshTokenRepository, revocations RevocationStore, attempts ratelimit.Counter, events EventRecorder, devices DeviceWatcher) Service {
+	return &auth{keys: keys, issuer: issuer, db: db, logger: logger, repo: repo, revocations: revocations, attempts: attempts, events: events, devices: devices}
 }
 
 type Claims struct {
-	UserID int64 `json:"user_id"`
+	UserID  int64  `json:"user_id"`
+	Role    Role   `json:"role"`
+	Purpose string `json:"purpose,omitempty"`
+	// ClientID and Scope are only set on tokens delegated to third-party clients (RFC 9068)
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func (s *auth) GenerateToken(userID int64) (string, error) {
+// Scopes returns the space-delimited scope claim as a list
+func (c *Claims) Scopes() []Scope {
+	return SplitScopes(c.Scope)
+}
+
+func (s *auth) GenerateToken(userID int64, role Role) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
 	claims := Claims{
 		UserID: userID,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.issuer,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
+		},
+	}
+	return s.keys.sign(claims)
+}
+
+func (s *auth) GenerateClientToken(userID int64, role Role, clientID string, scopes []Scope) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	claims := Claims{
+		UserID:   userID,
+		Role:     role,
+		ClientID: clientID,
+		Scope:    JoinScopes(scopes),
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.issuer,
+			Subject:   strconv.FormatInt(userID, 10),
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.jwtKey)
+	return s.keys.sign(claims)
 }
 
 func (s *auth) ValidateToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("token is not an access token")
+	}
+	return claims, nil
+}
+
+// IsRevoked checks the token against its own revocation and the user's watermark. Tokens issued before
+// the jti claim existed can only be revoked through the watermark.
+func (s *auth) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	if claims.ID != "" {
+		revoked, err := s.revocations.IsTokenRevoked(ctx, claims.ID)
+		if err != nil || revoked {
+			return revoked, err
 		}
-		return s.jwtKey, nil
-	})
+	}
+
+	watermark, err := s.revocations.Watermark(ctx, claims.UserID)
+	if err != nil || watermark.IsZero() {
+		return false, err
+	}
+	// iat has second precision, a token issued within the same second as the watermark stays valid
+	// so the session issued right after a password change is not rejected
+	return claims.IssuedAt == nil || claims.IssuedAt.Time.Before(watermark), nil
+}
+
+func (s *auth) RevokeAccessToken(ctx context.Context, claims *Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	if err := s.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	return nil
+}
+
+func (s *auth) GenerateMFAToken(userID int64) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	claims := Claims{
+		UserID:  userID,
+		Purpose: purposeMFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.issuer,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFATokenTTL)),
+		},
+	}
+	return s.keys.sign(claims)
+}
+
+func (s *auth) ValidateMFAToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	if claims.Purpose != purposeMFA || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	revoked, err := s.revocations.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check mfa token: %w", err)
+	}
+	if revoked {
+		return nil, ErrMFATokenSpent
+	}
+
+	attempts, err := s.attempts.Incr(ctx, mfaAttemptsKey(claims.ID), time.Until(claims.ExpiresAt.Time))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count mfa attempt: %w", err)
+	}
+	if attempts > int64(MFAMaxAttempts) {
+		return nil, ErrMFATokenSpent
+	}
+	if attempts == int64(MFAMaxAttempts) {
+		if err := s.ConsumeMFAToken(ctx, claims); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+func (s *auth) ConsumeMFAToken(ctx context.Context, claims *Claims) error {
+	if err := s.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return fmt.Errorf("failed to revoke mfa token: %w", err)
+	}
+	return nil
+}
+
+func mfaAttemptsKey(jti string) string {
+	return "mfa:" + jti
+}
+
+func (s *auth) parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keys.keyFunc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
@@ -73,16 +264,16 @@ func (s *auth) ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
+func (s *auth) JWKS() JWKSet {
+	return s.keys.JWKS()
+}
+
 func (s *auth) GenerateRefreshToken(ctx context.Context, userID int64, userAgent string, ip string) (string, error) {
-	b := make([]byte, 32)
-	_, err := rand.Read(b)
+	token, tokenHash, err := GenerateOpaqueToken()
 	if err != nil {
 		return "", err
 	}
 
-	token := base64.URLEncoding.EncodeToString(b)
-	tokenHash := hashToken(token)
-
 	refreshToken := RefreshToken{
 		UserID:    userID,
 		TokenHash: tokenHash,
@@ -93,11 +284,12 @@ func (s *auth) GenerateRefreshToken(ctx context.Context, userID int64, userAgent
 	if err := s.repo.Save(ctx, &refreshToken); err != nil {
 		return "", fmt.Errorf("failed to save refresh token: %w", err)
 	}
+	s.devices.SessionStarted(ctx, userID, userAgent, ip)
 	return token, nil
 }
 
 func (s *auth) ValidateRefreshToken(ctx context.Context, tokenString string) (*RefreshToken, error) {
-	tokenHash := hashToken(tokenString)
+	tokenHash := HashToken(tokenString)
 
 	token, err := s.repo.FindByHash(ctx, tokenHash)
 	if err != nil {
@@ -124,7 +316,7 @@ func (s *auth) RefreshAccessToken(ctx context.Context, refreshToken string) (str
 	}()
 
 	repo := NewRepositoryFromTx(tx)
-	tokenHash := hashToken(refreshToken)
+	tokenHash := HashToken(refreshToken)
 
 	token, err := repo.FindByHashForUpdate(ctx, tokenHash)
 	if err != nil {
@@ -134,7 +326,17 @@ func (s *auth) RefreshAccessToken(ctx context.Context, refreshToken string) (str
 		return "", "", fmt.Errorf("failed to validate refresh token: %w", err)
 	}
 
-	accessToken, err := s.GenerateToken(token.UserID)
+	access, err := repo.FindUserAccess(ctx, token.UserID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get user access: %w", err)
+	}
+	if access.DisabledAt != nil {
+		err = ErrAccountDisabled
+		s.events.RecordSessionEvent(ctx, token.UserID, SessionRefreshed, false, map[string]any{"reason": "account_disabled"})
+		return "", "", err
+	}
+
+	accessToken, err := s.GenerateToken(token.UserID, access.Role)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -143,15 +345,11 @@ func (s *auth) RefreshAccessToken(ctx context.Context, refreshToken string) (str
 		return "", "", fmt.Errorf("failed to revoke refresh token: %w", err)
 	}
 
-	b := make([]byte, 32)
-	_, err = rand.Read(b)
+	newToken, newHash, err := GenerateOpaqueToken()
 	if err != nil {
 		return "", "", err
 	}
 
-	newToken := base64.URLEncoding.EncodeToString(b)
-	newHash := hashToken(newToken)
-
 	newRefreshToken := RefreshToken{
 		UserID:    token.UserID,
 		TokenHash: newHash,
@@ -166,18 +364,67 @@ func (s *auth) RefreshAccessToken(ctx context.Context, refreshToken string) (str
 	if err := tx.Commit(); err != nil {
 		return "", "", fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	s.events.RecordSessionEvent(ctx, token.UserID, SessionRefreshed, true, nil)
 	return accessToken, newToken, nil
 }
 
 func (s *auth) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
-	tokenHash := hashToken(refreshToken)
+	tokenHash := HashToken(refreshToken)
+	token, err := s.repo.FindByHash(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to find refresh token: %w", err)
+	}
 	if err := s.repo.RevokeByHash(ctx, tokenHash); err != nil {
 		return fmt.Errorf("failed to revoke refresh token: %w", err)
 	}
+	s.events.RecordSessionEvent(ctx, token.UserID, SessionLoggedOut, true, nil)
 	return nil
 }
 
-func hashToken(token string) string {
+func (s *auth) RevokeAllSessions(ctx context.Context, userID int64) (int64, error) {
+	revoked, err := s.repo.RevokeAllForUser(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	if err := s.revocations.SetWatermark(ctx, userID, time.Now().Truncate(time.Second)); err != nil {
+		return 0, fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	s.events.RecordSessionEvent(ctx, userID, SessionsRevoked, true, map[string]any{"revoked_refresh_tokens": revoked})
+	return revoked, nil
+}
+
+// PurgeRefreshTokens deletes expired tokens and tokens revoked before the given time
+func (s *auth) PurgeRefreshTokens(ctx context.Context, revokedBefore time.Time) (int64, error) {
+	deleted, err := s.repo.DeleteExpired(ctx, revokedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge refresh tokens: %w", err)
+	}
+	return deleted, nil
+}
+
+// GenerateOpaqueToken returns a random URL-safe token and the hash that should be stored instead of it
+func GenerateOpaqueToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.URLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// newTokenID returns a random jti for an access token
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func HashToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
 	return base64.URLEncoding.EncodeToString(hash[:])
 }
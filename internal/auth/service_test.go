@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
+	"testing"
+)
+
+func newTestAuth(t *testing.T) Service {
+	t.Helper()
+	keys, err := LoadKeySet("", nil, "test-secret")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	return NewAuth(keys, "test", nil, nil, nil, NewMemoryRevocationStore(), ratelimit.NewMemoryCounter(), nil, nil)
+}
+
+func TestMFATokenHasUniqueID(t *testing.T) {
+	ctx := context.Background()
+	s := newTestAuth(t)
+
+	ids := make(map[string]bool)
+	for range 3 {
+		token, err := s.GenerateMFAToken(7)
+		if err != nil {
+			t.Fatalf("GenerateMFAToken: %v", err)
+		}
+		claims, err := s.ValidateMFAToken(ctx, token)
+		if err != nil {
+			t.Fatalf("ValidateMFAToken: %v", err)
+		}
+		if claims.UserID != 7 || claims.ID == "" {
+			t.Fatalf("claims = %+v, want user 7 with a jti", claims)
+		}
+		if ids[claims.ID] {
+			t.Fatalf("jti %q issued twice", claims.ID)
+		}
+		ids[claims.ID] = true
+	}
+}
+
+func TestMFATokenAttemptLimit(t *testing.T) {
+	ctx := context.Background()
+	s := newTestAuth(t)
+
+	token, err := s.GenerateMFAToken(7)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken: %v", err)
+	}
+	for i := range MFAMaxAttempts {
+		if _, err := s.ValidateMFAToken(ctx, token); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+	if _, err := s.ValidateMFAToken(ctx, token); !errors.Is(err, ErrMFATokenSpent) {
+		t.Fatalf("attempt %d: err = %v, want ErrMFATokenSpent", MFAMaxAttempts+1, err)
+	}
+
+	other, err := s.GenerateMFAToken(7)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken: %v", err)
+	}
+	if _, err := s.ValidateMFAToken(ctx, other); err != nil {
+		t.Fatalf("a fresh token must not share the attempt count: %v", err)
+	}
+}
+
+func TestMFATokenIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	s := newTestAuth(t)
+
+	token, err := s.GenerateMFAToken(7)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken: %v", err)
+	}
+	claims, err := s.ValidateMFAToken(ctx, token)
+	if err != nil {
+		t.Fatalf("ValidateMFAToken: %v", err)
+	}
+	if err := s.ConsumeMFAToken(ctx, claims); err != nil {
+		t.Fatalf("ConsumeMFAToken: %v", err)
+	}
+	if _, err := s.ValidateMFAToken(ctx, token); !errors.Is(err, ErrMFATokenSpent) {
+		t.Fatalf("err = %v, want ErrMFATokenSpent", err)
+	}
+}
+
+func TestValidateMFATokenRejectsOtherTokens(t *testing.T) {
+	ctx := context.Background()
+	s := newTestAuth(t)
+
+	access, err := s.GenerateToken(7, RoleUser)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	for name, token := range map[string]string{"access token": access, "garbage": "not-a-token"} {
+		if _, err := s.ValidateMFAToken(ctx, token); !errors.Is(err, ErrInvalidMFAToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidMFAToken", name, err)
+		}
+	}
+}
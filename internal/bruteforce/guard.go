@@ -0,0 +1,183 @@
+package bruteforce
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
+	"log/slog"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Guard interface {
+	Policy() Policy
+	// CheckSource rejects the attempt when the client IP, or the IP for this username, has too many recent failures
+	CheckSource(ctx context.Context, ip, username string) error
+	RecordFailure(ctx context.Context, ip, username string)
+	RecordSuccess(ctx context.Context, ip, username string)
+	// LockoutDuration doubles for every failure past AccountMaxAttempts, capped at AccountMaxLockout
+	LockoutDuration(failedAttempts int) time.Duration
+	ChallengeRequired(failedAttempts int) bool
+	NewChallenge(username string) (*Challenge, error)
+	VerifyChallenge(username, token, solution string) error
+}
+
+type guard struct {
+	counter ratelimit.Counter
+	policy  Policy
+	secret  []byte
+	logger  *slog.Logger
+}
+
+func NewGuard(counter ratelimit.Counter, policy Policy, secret []byte, logger *slog.Logger) Guard {
+	return &guard{counter: counter, policy: policy, secret: secret, logger: logger}
+}
+
+func (g *guard) Policy() Policy {
+	return g.policy
+}
+
+func (g *guard) CheckSource(ctx context.Context, ip, username string) error {
+	ipFailures, err := g.counter.Get(ctx, ipKey(ip))
+	if err != nil {
+		g.logger.Error("Failed to read IP failure counter", "error", err)
+		return nil
+	}
+	if g.policy.IPMaxFailures > 0 && ipFailures >= int64(g.policy.IPMaxFailures) {
+		return ErrTooManyAttempts
+	}
+
+	pairFailures, err := g.counter.Get(ctx, pairKey(ip, username))
+	if err != nil {
+		g.logger.Error("Failed to read IP/username failure counter", "error", err)
+		return nil
+	}
+	if g.policy.IPUserMaxFailures > 0 && pairFailures >= int64(g.policy.IPUserMaxFailures) {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+func (g *guard) RecordFailure(ctx context.Context, ip, username string) {
+	if _, err := g.counter.Incr(ctx, ipKey(ip), g.policy.FailureWindow); err != nil {
+		g.logger.Error("Failed to increment IP failure counter", "error", err)
+	}
+	if _, err := g.counter.Incr(ctx, pairKey(ip, username), g.policy.FailureWindow); err != nil {
+		g.logger.Error("Failed to increment IP/username failure counter", "error", err)
+	}
+}
+
+// RecordSuccess only clears the pair counter: a successful login must not let a spraying IP start over
+func (g *guard) RecordSuccess(ctx context.Context, ip, username string) {
+	if err := g.counter.Reset(ctx, pairKey(ip, username)); err != nil {
+		g.logger.Error("Failed to reset IP/username failure counter", "error", err)
+	}
+}
+
+func (g *guard) LockoutDuration(failedAttempts int) time.Duration {
+	excess := failedAttempts - g.policy.AccountMaxAttempts
+	if excess < 0 {
+		return 0
+	}
+	// compare before shifting, a large excess would overflow into a negative duration
+	if excess >= 63 || g.policy.AccountBaseLockout > g.policy.AccountMaxLockout>>excess {
+		return g.policy.AccountMaxLockout
+	}
+	return g.policy.AccountBaseLockout << excess
+}
+
+func (g *guard) ChallengeRequired(failedAttempts int) bool {
+	return g.policy.ChallengeEnabled && failedAttempts >= g.policy.AccountMaxAttempts
+}
+
+// NewChallenge issues a stateless challenge token bound to the username: "<username>.<expiry>.<nonce>.<difficulty>.<mac>"
+func (g *guard) NewChallenge(username string) (*Challenge, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge nonce: %w", err)
+	}
+
+	expiresAt := time.Now().Add(g.policy.ChallengeTTL)
+	payload := strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString([]byte(normalize(username))),
+		strconv.FormatInt(expiresAt.Unix(), 10),
+		hex.EncodeToString(nonce),
+		strconv.Itoa(g.policy.ChallengeDifficulty),
+	}, ".")
+
+	return &Challenge{
+		Token:      payload + "." + g.sign(payload),
+		Algorithm:  ChallengeAlgorithm,
+		Difficulty: g.policy.ChallengeDifficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+func (g *guard) VerifyChallenge(username, token, solution string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 || solution == "" {
+		return ErrInvalidChallenge
+	}
+
+	payload := strings.Join(parts[:4], ".")
+	if !hmac.Equal([]byte(g.sign(payload)), []byte(parts[4])) {
+		return ErrInvalidChallenge
+	}
+
+	boundUser, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || string(boundUser) != normalize(username) {
+		return ErrInvalidChallenge
+	}
+
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().After(time.Unix(expiry, 0)) {
+		return ErrInvalidChallenge
+	}
+
+	difficulty, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+
+	sum := sha256.Sum256([]byte(token + ":" + solution))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return ErrInvalidChallenge
+	}
+	return nil
+}
+
+func (g *guard) sign(payload string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, v := range b {
+		if v != 0 {
+			return n + bits.LeadingZeros8(v)
+		}
+		n += 8
+	}
+	return n
+}
+
+func normalize(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func pairKey(ip, username string) string {
+	return "ip_user:" + ip + ":" + normalize(username)
+}
@@ -0,0 +1,195 @@
+package bruteforce
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestGuard(policy Policy) Guard {
+	return NewGuard(ratelimit.NewMemoryCounter(), policy, []byte("secret"), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestLockoutDuration(t *testing.T) {
+	g := newTestGuard(Policy{AccountMaxAttempts: 5, AccountBaseLockout: time.Minute, AccountMaxLockout: 24 * time.Hour})
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{8, 8 * time.Minute},
+		{15, 1024 * time.Minute},
+		{16, 24 * time.Hour},
+		// 1m<<28 and beyond overflow int64 when shifted unchecked
+		{5 + 28, 24 * time.Hour},
+		{5 + 30, 24 * time.Hour},
+		{5 + 62, 24 * time.Hour},
+		{5 + 63, 24 * time.Hour},
+		{5 + 1000, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := g.LockoutDuration(tt.attempts); got != tt.want {
+			t.Errorf("LockoutDuration(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestLockoutDurationNeverShrinks(t *testing.T) {
+	g := newTestGuard(Policy{AccountMaxAttempts: 3, AccountBaseLockout: 7 * time.Second, AccountMaxLockout: 1000 * time.Hour})
+
+	prev := time.Duration(0)
+	for attempts := 0; attempts < 200; attempts++ {
+		d := g.LockoutDuration(attempts)
+		if d < prev || d > 1000*time.Hour {
+			t.Fatalf("LockoutDuration(%d) = %s after %s, want a non-decreasing duration up to the maximum", attempts, d, prev)
+		}
+		prev = d
+	}
+}
+
+func TestChallengeRequired(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		attempts int
+		want     bool
+	}{
+		{"disabled", false, 10, false},
+		{"below threshold", true, 4, false},
+		{"at threshold", true, 5, true},
+		{"above threshold", true, 9, true},
+	}
+	for _, tt := range tests {
+		g := newTestGuard(Policy{AccountMaxAttempts: 5, ChallengeEnabled: tt.enabled})
+		if got := g.ChallengeRequired(tt.attempts); got != tt.want {
+			t.Errorf("%s: ChallengeRequired(%d) = %v, want %v", tt.name, tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSource(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGuard(Policy{IPMaxFailures: 5, IPUserMaxFailures: 3, FailureWindow: time.Hour})
+
+	for range 3 {
+		g.RecordFailure(ctx, "198.51.100.7", "Anna")
+	}
+	if err := g.CheckSource(ctx, "198.51.100.7", "anna"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("pair limit: err = %v, want ErrTooManyAttempts", err)
+	}
+	if err := g.CheckSource(ctx, "198.51.100.7", "bob"); err != nil {
+		t.Fatalf("another username from the same IP: err = %v, want nil", err)
+	}
+	if err := g.CheckSource(ctx, "203.0.113.10", "anna"); err != nil {
+		t.Fatalf("the same username from another IP: err = %v, want nil", err)
+	}
+
+	g.RecordFailure(ctx, "198.51.100.7", "bob")
+	g.RecordFailure(ctx, "198.51.100.7", "carol")
+	if err := g.CheckSource(ctx, "198.51.100.7", "dave"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("IP limit: err = %v, want ErrTooManyAttempts", err)
+	}
+}
+
+func TestRecordSuccessOnlyClearsPair(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGuard(Policy{IPMaxFailures: 4, IPUserMaxFailures: 3, FailureWindow: time.Hour})
+
+	for range 3 {
+		g.RecordFailure(ctx, "198.51.100.7", "anna")
+	}
+	g.RecordSuccess(ctx, "198.51.100.7", "anna")
+	if err := g.CheckSource(ctx, "198.51.100.7", "anna"); err != nil {
+		t.Fatalf("after a success: err = %v, want nil", err)
+	}
+
+	g.RecordFailure(ctx, "198.51.100.7", "bob")
+	if err := g.CheckSource(ctx, "198.51.100.7", "anna"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("a success must not reset the IP counter: err = %v", err)
+	}
+}
+
+// solve brute-forces a solution, only feasible for the low difficulty used in tests
+func solve(t *testing.T, challenge *Challenge) string {
+	t.Helper()
+	for i := 0; i < 1<<20; i++ {
+		solution := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(challenge.Token + ":" + solution))
+		if leadingZeroBits(sum[:]) >= challenge.Difficulty {
+			return solution
+		}
+	}
+	t.Fatal("no solution found")
+	return ""
+}
+
+func TestVerifyChallenge(t *testing.T) {
+	g := newTestGuard(Policy{ChallengeDifficulty: 8, ChallengeTTL: time.Minute})
+
+	challenge, err := g.NewChallenge("Anna")
+	if err != nil {
+		t.Fatalf("NewChallenge: %v", err)
+	}
+	solution := solve(t, challenge)
+
+	if err := g.VerifyChallenge("anna", challenge.Token, solution); err != nil {
+		t.Fatalf("valid solution: err = %v", err)
+	}
+
+	parts := strings.Split(challenge.Token, ".")
+	parts[3] = "0"
+	easier := strings.Join(parts, ".")
+
+	tests := []struct {
+		name     string
+		username string
+		token    string
+		solution string
+	}{
+		{"other user", "bob", challenge.Token, solution},
+		{"no solution", "anna", challenge.Token, ""},
+		{"tampered difficulty", "anna", easier, solution},
+		{"malformed token", "anna", "not.a.token", solution},
+	}
+	for _, tt := range tests {
+		if err := g.VerifyChallenge(tt.username, tt.token, tt.solution); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("%s: err = %v, want ErrInvalidChallenge", tt.name, err)
+		}
+	}
+}
+
+func TestVerifyChallengeRejectsExpired(t *testing.T) {
+	g := newTestGuard(Policy{ChallengeDifficulty: 0, ChallengeTTL: -time.Second})
+
+	challenge, err := g.NewChallenge("anna")
+	if err != nil {
+		t.Fatalf("NewChallenge: %v", err)
+	}
+	if err := g.VerifyChallenge("anna", challenge.Token, "1"); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("err = %v, want ErrInvalidChallenge", err)
+	}
+}
+
+func TestVerifyChallengeRejectsForeignSecret(t *testing.T) {
+	policy := Policy{ChallengeDifficulty: 0, ChallengeTTL: time.Minute}
+	other := NewGuard(ratelimit.NewMemoryCounter(), policy, []byte("other secret"), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	challenge, err := other.NewChallenge("anna")
+	if err != nil {
+		t.Fatalf("NewChallenge: %v", err)
+	}
+	if err := newTestGuard(policy).VerifyChallenge("anna", challenge.Token, "1"); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("err = %v, want ErrInvalidChallenge", err)
+	}
+}
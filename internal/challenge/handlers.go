@@ -0,0 +1,340 @@
+package challenge
+
+import (
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const (
+	defaultPageSize            = 20
+	defaultLeaderboardPageSize = 50
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+type ChallengeIDPathParam struct {
+	ID int64 `uri:"id" binding:"required" validate:"required,gt=0"`
+}
+
+type CreateChallengeRequest struct {
+	Name        string  `json:"name" validate:"required,min=1,max=100"`
+	Description *string `json:"description,omitempty" validate:"omitempty,max=2000"`
+	Metric      Metric  `json:"metric" validate:"required,oneof=total_volume session_count relative_lift"`
+	// ExerciseID is required for relative_lift, limits total_volume to one exercise and is not allowed for session_count
+	ExerciseID *int64 `json:"exercise_id,omitempty" validate:"omitempty,gt=0"`
+	// StartsOn and EndsOn are local days of the participants, both included
+	StartsOn *date.Date `json:"starts_on" validate:"required" swaggertype:"string" format:"date"`
+	EndsOn   *date.Date `json:"ends_on" validate:"required" swaggertype:"string" format:"date"`
+}
+
+type ListChallengesQuery struct {
+	Status   Status `form:"status" validate:"omitempty,oneof=upcoming active finished"`
+	Page     int    `form:"page" validate:"omitempty,gte=1"`
+	PageSize int    `form:"page_size" validate:"omitempty,gte=1,lte=100"`
+}
+
+type LeaderboardQuery struct {
+	Page     int `form:"page" validate:"omitempty,gte=1"`
+	PageSize int `form:"page_size" validate:"omitempty,gte=1,lte=100"`
+}
+
+type ChallengeListResponse struct {
+	Challenges []Challenge `json:"challenges"`
+	Total      int         `json:"total"`
+	Page       int         `json:"page"`
+	PageSize   int         `json:"page_size"`
+}
+
+type LeaderboardResponse struct {
+	Leaderboard
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+}
+
+// ListChallenges lists challenges
+// @Summary List challenges
+// @Description Returns challenges, latest start first. Status is relative to the current user's local day.
+// @Tags challenges
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "upcoming, active or finished"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} ChallengeListResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/challenges [get]
+func (h *Handler) ListChallenges(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	query, ok := validation.BindAndValidateQuery[ListChallengesQuery](c)
+	if !ok {
+		return
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	challenges, total, err := h.service.List(c.Request.Context(), userID, ListFilter{
+		Status: query.Status,
+		Limit:  query.PageSize,
+		Offset: (query.Page - 1) * query.PageSize,
+	})
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to list challenges", nil)
+		return
+	}
+	c.JSON(http.StatusOK, ChallengeListResponse{
+		Challenges: challenges,
+		Total:      total,
+		Page:       query.Page,
+		PageSize:   query.PageSize,
+	})
+}
+
+// GetChallenge returns a challenge
+// @Summary Get challenge
+// @Tags challenges
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Challenge ID"
+// @Success 200 {object} Challenge
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/challenges/{id} [get]
+func (h *Handler) GetChallenge(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[ChallengeIDPathParam](c)
+	if !ok {
+		return
+	}
+
+	challenge, err := h.service.Get(c.Request.Context(), userID, params.ID)
+	if err != nil {
+		respondError(c, err, "failed to get challenge")
+		return
+	}
+	c.JSON(http.StatusOK, challenge)
+}
+
+// GetLeaderboard returns the ranked participants of a challenge
+// @Summary Get challenge leaderboard
+// @Description Ranks participants by score, equal scores are ordered by who reached them first. Scores are kg of volume for total_volume, finished sessions for session_count and multiples of bodyweight for relative_lift. Participants whose profile, sessions or, for relative_lift, records and weight the caller may not see are anonymous. Relative lifts of users hiding their weight are not ranked.
+// @Tags challenges
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Challenge ID"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} LeaderboardResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/challenges/{id}/leaderboard [get]
+func (h *Handler) GetLeaderboard(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[ChallengeIDPathParam](c)
+	if !ok {
+		return
+	}
+	query, ok := validation.BindAndValidateQuery[LeaderboardQuery](c)
+	if !ok {
+		return
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultLeaderboardPageSize
+	}
+
+	board, err := h.service.Leaderboard(c.Request.Context(), userID, params.ID, query.PageSize, (query.Page-1)*query.PageSize)
+	if err != nil {
+		respondError(c, err, "failed to get leaderboard")
+		return
+	}
+	c.JSON(http.StatusOK, LeaderboardResponse{Leaderboard: *board, Page: query.Page, PageSize: query.PageSize})
+}
+
+// JoinChallenge joins a challenge
+// @Summary Join challenge
+// @Description Joins a challenge that has not finished yet. Training already logged in the window counts. Participants are listed on the leaderboard, by username and score to users their privacy settings allow and anonymously to everyone else.
+// @Tags challenges
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Challenge ID"
+// @Success 200 {object} Challenge
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 409 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/challenges/{id}/participation [post]
+func (h *Handler) JoinChallenge(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[ChallengeIDPathParam](c)
+	if !ok {
+		return
+	}
+
+	challenge, err := h.service.Join(c.Request.Context(), userID, params.ID)
+	if err != nil {
+		respondError(c, err, "failed to join challenge")
+		return
+	}
+	c.JSON(http.StatusOK, challenge)
+}
+
+// LeaveChallenge leaves a challenge
+// @Summary Leave challenge
+// @Description Removes the current user and their score from the challenge
+// @Tags challenges
+// @Security BearerAuth
+// @Param id path int true "Challenge ID"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/challenges/{id}/participation [delete]
+func (h *Handler) LeaveChallenge(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[ChallengeIDPathParam](c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Leave(c.Request.Context(), userID, params.ID); err != nil {
+		respondError(c, err, "failed to leave challenge")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CreateChallenge creates a challenge
+// @Summary Create challenge (admin)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateChallengeRequest true "Challenge definition"
+// @Success 201 {object} Challenge
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/challenges [post]
+func (h *Handler) CreateChallenge(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	req, ok := validation.BindAndValidate[CreateChallengeRequest](c)
+	if !ok {
+		return
+	}
+
+	challenge, err := h.service.Create(c.Request.Context(), NewChallenge{
+		Name:        req.Name,
+		Description: req.Description,
+		Metric:      req.Metric,
+		ExerciseID:  req.ExerciseID,
+		StartsOn:    *req.StartsOn,
+		EndsOn:      *req.EndsOn,
+		CreatedBy:   userID,
+	})
+	if err != nil {
+		respondError(c, err, "failed to create challenge")
+		return
+	}
+	c.JSON(http.StatusCreated, challenge)
+}
+
+// DeleteChallenge deletes a challenge
+// @Summary Delete challenge (admin)
+// @Description Deletes a challenge with its participants and leaderboard
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "Challenge ID"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/challenges/{id} [delete]
+func (h *Handler) DeleteChallenge(c *gin.Context) {
+	params, ok := validation.BindAndValidateURI[ChallengeIDPathParam](c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), params.ID); err != nil {
+		respondError(c, err, "failed to delete challenge")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, ErrChallengeNotFound), errors.Is(err, ErrExerciseNotFound), errors.Is(err, ErrNotParticipant):
+		apperrors.GenHTTPError(c, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, ErrChallengeFinished):
+		apperrors.GenHTTPError(c, http.StatusConflict, err.Error(), nil)
+	case errors.Is(err, ErrExerciseRequired), errors.Is(err, ErrExerciseNotAllowed), errors.Is(err, ErrInvalidDateRange):
+		apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+	default:
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, message, nil)
+	}
+}
@@ -0,0 +1,81 @@
+package challenge
+
+import (
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"time"
+)
+
+// Metric decides how participants are scored, always from training on the local days of the challenge window
+type Metric string
+
+const (
+	// MetricTotalVolume sums reps times weight in kg, of one exercise when the challenge names one
+	MetricTotalVolume Metric = "total_volume"
+	// MetricSessionCount counts finished sessions
+	MetricSessionCount Metric = "session_count"
+	// MetricRelativeLift is the heaviest set of the exercise divided by the current bodyweight of the participant
+	MetricRelativeLift Metric = "relative_lift"
+)
+
+type Status string
+
+const (
+	StatusUpcoming Status = "upcoming"
+	StatusActive   Status = "active"
+	StatusFinished Status = "finished"
+)
+
+type Challenge struct {
+	ID           int64     `json:"id" db:"id"`
+	Name         string    `json:"name" db:"name"`
+	Description  *string   `json:"description" db:"description"`
+	Metric       Metric    `json:"metric" db:"metric"`
+	ExerciseID   *int64    `json:"exercise_id" db:"exercise_id"`
+	StartsOn     date.Date `json:"starts_on" db:"starts_on" swaggertype:"string" format:"date"`
+	EndsOn       date.Date `json:"ends_on" db:"ends_on" swaggertype:"string" format:"date"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	Participants int       `json:"participants" db:"participants"`
+	// Joined tells whether the viewer takes part
+	Joined bool `json:"joined" db:"joined"`
+}
+
+type NewChallenge struct {
+	Name        string
+	Description *string
+	Metric      Metric
+	ExerciseID  *int64
+	StartsOn    date.Date
+	EndsOn      date.Date
+	CreatedBy   int64
+}
+
+// Standing is the place of a participant on a leaderboard. Equal scores share a rank unless one was reached earlier.
+// Participants the viewer may not see are anonymous, only their rank is shown.
+type Standing struct {
+	Rank      int        `json:"rank" db:"rank"`
+	UserID    *int64     `json:"user_id" db:"user_id"`
+	Username  *string    `json:"username" db:"username"`
+	Score     *float64   `json:"score" db:"score"`
+	ScoredAt  *time.Time `json:"scored_at" db:"scored_at"`
+	Anonymous bool       `json:"anonymous" db:"-"`
+}
+
+func (s *Standing) anonymize() {
+	*s = Standing{Rank: s.Rank, Anonymous: true}
+}
+
+type Leaderboard struct {
+	Challenge *Challenge `json:"challenge"`
+	Standings []Standing `json:"standings"`
+	Total     int        `json:"total"`
+	// Me is the standing of the viewer, also when it is not on the requested page
+	Me *Standing `json:"me"`
+}
+
+type ListFilter struct {
+	Status Status
+	// Today is the local day of the viewer that Status is relative to
+	Today  date.Date
+	Limit  int
+	Offset int
+}
@@ -0,0 +1,228 @@
+package challenge
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	Create(ctx context.Context, challenge NewChallenge) (int64, error)
+	Delete(ctx context.Context, id int64) error
+	// Get returns a challenge with Joined set for viewerID
+	Get(ctx context.Context, id, viewerID int64) (*Challenge, error)
+	List(ctx context.Context, viewerID int64, filter ListFilter) ([]Challenge, int, error)
+
+	Join(ctx context.Context, challengeID, userID int64) error
+	Leave(ctx context.Context, challengeID, userID int64) error
+	// Leaderboard ranks the participants as viewerID sees them, see rankedSelect
+	Leaderboard(ctx context.Context, challengeID, viewerID int64, limit, offset int) ([]Standing, int, error)
+	GetStanding(ctx context.Context, challengeID, userID int64) (*Standing, error)
+
+	// RefreshParticipant rescores one participant of a challenge
+	RefreshParticipant(ctx context.Context, challengeID, userID int64) error
+	// RefreshUser rescores the challenges of userID whose window contains one of days
+	RefreshUser(ctx context.Context, userID int64, days []date.Date) (int64, error)
+	// RefreshEndingSince rescores every participant of challenges that started by startedBy and end on endsSince or later
+	RefreshEndingSince(ctx context.Context, startedBy, endsSince date.Date) (int64, error)
+}
+
+// weightKG and volumeKG normalize sets of workout_session_sets ss to kilograms, like the session repository
+const (
+	weightKG = "ss.weight * CASE WHEN ss.weight_unit = 'lbs' THEN 0.45359237 ELSE 1 END"
+	volumeKG = "ss.reps * " + weightKG
+)
+
+// scoreExpr scores participant p of challenge c, u is the participant's user row
+const scoreExpr = `CASE c.metric
+	WHEN 'total_volume' THEN (
+		SELECT COALESCE(SUM(` + volumeKG + `), 0)
+		FROM workout_sessions s
+		JOIN workout_session_exercises se ON se.session_id = s.id
+		JOIN workout_session_sets ss ON ss.session_exercise_id = se.id
+		WHERE s.user_id = p.user_id AND s.performed_date BETWEEN c.starts_on AND c.ends_on
+		  AND (c.exercise_id IS NULL OR se.exercise_id = c.exercise_id))
+	WHEN 'session_count' THEN (
+		SELECT COUNT(*)
+		FROM workout_sessions s
+		WHERE s.user_id = p.user_id AND s.finished_at IS NOT NULL AND s.performed_date BETWEEN c.starts_on AND c.ends_on)
+	WHEN 'relative_lift' THEN (
+		SELECT COALESCE(MAX(` + weightKG + `) / NULLIF(u.weight, 0), 0)
+		FROM workout_sessions s
+		JOIN workout_session_exercises se ON se.session_id = s.id
+		JOIN workout_session_sets ss ON ss.session_exercise_id = se.id
+		WHERE s.user_id = p.user_id AND s.performed_date BETWEEN c.starts_on AND c.ends_on
+		  AND se.exercise_id = c.exercise_id)
+	END`
+
+// refreshQuery rescores the participants matched by a condition on p and c and only touches rows whose
+// score changed, so scored_at keeps the time a score was first reached
+const refreshQuery = `
+	UPDATE challenge_participants cp
+	SET score = scored.score, scored_at = NOW()
+	FROM (
+		SELECT p.challenge_id, p.user_id, ` + scoreExpr + ` AS score
+		FROM challenge_participants p
+		JOIN challenges c ON c.id = p.challenge_id
+		JOIN users u ON u.id = p.user_id
+		WHERE %s
+	) scored
+	WHERE cp.challenge_id = scored.challenge_id AND cp.user_id = scored.user_id AND cp.score <> scored.score`
+
+// selectChallenges selects challenges c with Joined set for the viewer bound to placeholder viewer
+func selectChallenges(viewer string) string {
+	return `
+	SELECT c.id, c.name, c.description, c.metric, c.exercise_id, c.starts_on, c.ends_on, c.created_at,
+	       (SELECT COUNT(*) FROM challenge_participants p WHERE p.challenge_id = c.id) AS participants,
+	       EXISTS (SELECT 1 FROM challenge_participants p WHERE p.challenge_id = c.id AND p.user_id = ` + viewer + `) AS joined
+	FROM challenges c`
+}
+
+// rankedParticipants are the participants of challenge $1 that viewer $2 may see ranked. Disabled accounts and
+// accounts scheduled for deletion are left out, and so are relative_lift scores of users who hide their weight,
+// a multiple of bodyweight together with their records would reveal it. The viewer always sees their own score.
+const rankedParticipants = `
+	SELECT p.user_id, u.username, p.score, p.scored_at
+	FROM challenge_participants p
+	JOIN challenges c ON c.id = p.challenge_id
+	JOIN users u ON u.id = p.user_id
+	LEFT JOIN privacy_settings ps ON ps.user_id = p.user_id
+	WHERE p.challenge_id = $1 AND u.disabled_at IS NULL AND u.deletion_scheduled_at IS NULL
+	  AND (c.metric <> 'relative_lift' OR COALESCE(ps.show_weight, FALSE) OR p.user_id = $2)`
+
+const rankedSelect = `
+	WITH ranked AS (
+		SELECT user_id, username, score, scored_at,
+		       RANK() OVER (ORDER BY score DESC, scored_at NULLS LAST) AS rank
+		FROM (` + rankedParticipants + `) participants
+	)
+	SELECT rank, user_id, username, score, scored_at FROM ranked`
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) Create(ctx context.Context, challenge NewChallenge) (int64, error) {
+	query := `
+		INSERT INTO challenges (name, description, metric, exercise_id, starts_on, ends_on, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`
+	var id int64
+	err := r.executor.QueryRowxContext(ctx, query, challenge.Name, challenge.Description, challenge.Metric,
+		challenge.ExerciseID, challenge.StartsOn, challenge.EndsOn, challenge.CreatedBy).Scan(&id)
+	return id, err
+}
+
+func (r *repository) Delete(ctx context.Context, id int64) error {
+	return r.execOne(ctx, "DELETE FROM challenges WHERE id = $1", id)
+}
+
+func (r *repository) Get(ctx context.Context, id, viewerID int64) (*Challenge, error) {
+	var challenge Challenge
+	if err := r.executor.GetContext(ctx, &challenge, selectChallenges("$1")+" WHERE c.id = $2", viewerID, id); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *repository) List(ctx context.Context, viewerID int64, filter ListFilter) ([]Challenge, int, error) {
+	where := `WHERE ($1 = '' OR ($1 = 'upcoming' AND c.starts_on > $2)
+	                    OR ($1 = 'active' AND $2 BETWEEN c.starts_on AND c.ends_on)
+	                    OR ($1 = 'finished' AND c.ends_on < $2))`
+	args := []any{filter.Status, filter.Today}
+
+	var total int
+	if err := r.executor.GetContext(ctx, &total, "SELECT COUNT(*) FROM challenges c "+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	challenges := []Challenge{}
+	query := selectChallenges("$3") + " " + where + " ORDER BY c.starts_on DESC, c.id DESC LIMIT $4 OFFSET $5"
+	if err := r.executor.SelectContext(ctx, &challenges, query, append(args, viewerID, filter.Limit, filter.Offset)...); err != nil {
+		return nil, 0, err
+	}
+	return challenges, total, nil
+}
+
+func (r *repository) Join(ctx context.Context, challengeID, userID int64) error {
+	query := `
+		INSERT INTO challenge_participants (challenge_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (challenge_id, user_id) DO NOTHING`
+	_, err := r.executor.ExecContext(ctx, query, challengeID, userID)
+	return err
+}
+
+func (r *repository) Leave(ctx context.Context, challengeID, userID int64) error {
+	return r.execOne(ctx, "DELETE FROM challenge_participants WHERE challenge_id = $1 AND user_id = $2", challengeID, userID)
+}
+
+func (r *repository) Leaderboard(ctx context.Context, challengeID, viewerID int64, limit, offset int) ([]Standing, int, error) {
+	var total int
+	if err := r.executor.GetContext(ctx, &total, "SELECT COUNT(*) FROM ("+rankedParticipants+") participants", challengeID, viewerID); err != nil {
+		return nil, 0, err
+	}
+
+	standings := []Standing{}
+	query := rankedSelect + `
+		ORDER BY rank, user_id
+		LIMIT $3 OFFSET $4`
+	if err := r.executor.SelectContext(ctx, &standings, query, challengeID, viewerID, limit, offset); err != nil {
+		return nil, 0, err
+	}
+	return standings, total, nil
+}
+
+func (r *repository) GetStanding(ctx context.Context, challengeID, userID int64) (*Standing, error) {
+	var standing Standing
+	if err := r.executor.GetContext(ctx, &standing, rankedSelect+" WHERE user_id = $2", challengeID, userID); err != nil {
+		return nil, err
+	}
+	return &standing, nil
+}
+
+func (r *repository) RefreshParticipant(ctx context.Context, challengeID, userID int64) error {
+	query := fmt.Sprintf(refreshQuery, "p.challenge_id = $1 AND p.user_id = $2")
+	_, err := r.executor.ExecContext(ctx, query, challengeID, userID)
+	return err
+}
+
+func (r *repository) RefreshUser(ctx context.Context, userID int64, days []date.Date) (int64, error) {
+	values := make([]string, len(days))
+	for i, d := range days {
+		values[i] = d.String()
+	}
+	query := fmt.Sprintf(refreshQuery, `p.user_id = $1
+		AND EXISTS (SELECT 1 FROM unnest($2::DATE[]) AS d(day) WHERE d.day BETWEEN c.starts_on AND c.ends_on)`)
+	res, err := r.executor.ExecContext(ctx, query, userID, pq.Array(values))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *repository) RefreshEndingSince(ctx context.Context, startedBy, endsSince date.Date) (int64, error) {
+	query := fmt.Sprintf(refreshQuery, "c.starts_on <= $1 AND c.ends_on >= $2")
+	res, err := r.executor.ExecContext(ctx, query, startedBy, endsSince)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *repository) execOne(ctx context.Context, query string, args ...any) error {
+	res, err := r.executor.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
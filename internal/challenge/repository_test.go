@@ -0,0 +1,42 @@
+package challenge
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"regexp"
+	"testing"
+)
+
+func TestLeaderboardRanksForViewer(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	repo := NewRepository(sqlx.NewDb(db, "postgres"))
+
+	hiddenWeight := regexp.QuoteMeta("c.metric <> 'relative_lift' OR COALESCE(ps.show_weight, FALSE) OR p.user_id = $2")
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM .*"+hiddenWeight).
+		WithArgs(int64(9), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(hiddenWeight+".*RANK\\(\\) OVER|RANK\\(\\) OVER.*"+hiddenWeight).
+		WithArgs(int64(9), int64(1), 50, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"rank", "user_id", "username", "score", "scored_at"}).
+			AddRow(1, 2, "anna", 1.8, nil).
+			AddRow(2, 1, "me", 1.5, nil))
+
+	standings, total, err := repo.Leaderboard(context.Background(), 9, 1, 50, 0)
+	if err != nil {
+		t.Fatalf("Leaderboard: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(standings) != 2 {
+		t.Fatalf("got total %d and %d standings, want 2 and 2", total, len(standings))
+	}
+	if *standings[1].Username != "me" || *standings[1].Score != 1.5 {
+		t.Errorf("unexpected standing %+v", standings[1])
+	}
+}
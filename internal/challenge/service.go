@@ -0,0 +1,231 @@
+package challenge
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/profile"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"github.com/lib/pq"
+	"log/slog"
+	"time"
+)
+
+const foreignKeyViolation pq.ErrorCode = "23503"
+
+// lateEntryDays is how long after its end a challenge is still rescored by Reconcile, sessions are often logged late
+const lateEntryDays = 7
+
+var (
+	ErrChallengeNotFound  = errors.New("challenge not found")
+	ErrExerciseNotFound   = errors.New("exercise not found")
+	ErrExerciseRequired   = errors.New("relative_lift challenges need an exercise")
+	ErrExerciseNotAllowed = errors.New("session_count challenges cannot be limited to an exercise")
+	ErrInvalidDateRange   = errors.New("challenge cannot end before it starts")
+	ErrChallengeFinished  = errors.New("challenge has already finished")
+	ErrNotParticipant     = errors.New("you are not taking part in this challenge")
+)
+
+type Service interface {
+	Create(ctx context.Context, challenge NewChallenge) (*Challenge, error)
+	Delete(ctx context.Context, id int64) error
+	Get(ctx context.Context, viewerID, id int64) (*Challenge, error)
+	// List filters by status relative to the local day of the viewer
+	List(ctx context.Context, viewerID int64, filter ListFilter) ([]Challenge, int, error)
+
+	// Join adds the user to a challenge that has not finished yet and scores their training in its window
+	Join(ctx context.Context, userID, id int64) (*Challenge, error)
+	Leave(ctx context.Context, userID, id int64) error
+	Leaderboard(ctx context.Context, viewerID, id int64, limit, offset int) (*Leaderboard, error)
+
+	// RefreshScores rescores the challenges of userID covering one of days, errors are logged
+	RefreshScores(ctx context.Context, userID int64, days ...date.Date)
+	// Reconcile rescores every participant of running and recently finished challenges. It catches what
+	// RefreshScores does not see, such as bodyweight changes, deleted sessions and sessions closed by jobs.
+	Reconcile(ctx context.Context, now time.Time) (int64, error)
+}
+
+type service struct {
+	repo     Repository
+	users    user.Service
+	profiles profile.Service
+	logger   *slog.Logger
+}
+
+// NewService reads the time zone of users through users, challenge windows are local days.
+// Leaderboards only show participants whose profile the viewer may see through profiles.
+func NewService(repo Repository, users user.Service, profiles profile.Service, logger *slog.Logger) Service {
+	return &service{repo: repo, users: users, profiles: profiles, logger: logger}
+}
+
+func (s *service) Create(ctx context.Context, challenge NewChallenge) (*Challenge, error) {
+	switch {
+	case challenge.Metric == MetricRelativeLift && challenge.ExerciseID == nil:
+		return nil, ErrExerciseRequired
+	case challenge.Metric == MetricSessionCount && challenge.ExerciseID != nil:
+		return nil, ErrExerciseNotAllowed
+	case challenge.EndsOn.Before(challenge.StartsOn.Time):
+		return nil, ErrInvalidDateRange
+	}
+
+	id, err := s.repo.Create(ctx, challenge)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return nil, ErrExerciseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create challenge: %w", err)
+	}
+	return s.Get(ctx, challenge.CreatedBy, id)
+}
+
+func (s *service) Delete(ctx context.Context, id int64) error {
+	err := s.repo.Delete(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrChallengeNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete challenge: %w", err)
+	}
+	return nil
+}
+
+func (s *service) Get(ctx context.Context, viewerID, id int64) (*Challenge, error) {
+	challenge, err := s.repo.Get(ctx, id, viewerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+func (s *service) List(ctx context.Context, viewerID int64, filter ListFilter) ([]Challenge, int, error) {
+	today, err := s.today(ctx, viewerID)
+	if err != nil {
+		return nil, 0, err
+	}
+	filter.Today = today
+
+	challenges, total, err := s.repo.List(ctx, viewerID, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list challenges: %w", err)
+	}
+	return challenges, total, nil
+}
+
+func (s *service) Join(ctx context.Context, userID, id int64) (*Challenge, error) {
+	challenge, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.Joined {
+		return challenge, nil
+	}
+	today, err := s.today(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.EndsOn.Before(today.Time) {
+		return nil, ErrChallengeFinished
+	}
+
+	if err := s.repo.Join(ctx, id, userID); err != nil {
+		return nil, fmt.Errorf("failed to join challenge: %w", err)
+	}
+	// training logged before joining counts as long as it is inside the window
+	if err := s.repo.RefreshParticipant(ctx, id, userID); err != nil {
+		return nil, fmt.Errorf("failed to score participant: %w", err)
+	}
+	return s.Get(ctx, userID, id)
+}
+
+func (s *service) Leave(ctx context.Context, userID, id int64) error {
+	if _, err := s.Get(ctx, userID, id); err != nil {
+		return err
+	}
+
+	err := s.repo.Leave(ctx, id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotParticipant
+	}
+	if err != nil {
+		return fmt.Errorf("failed to leave challenge: %w", err)
+	}
+	return nil
+}
+
+func (s *service) Leaderboard(ctx context.Context, viewerID, id int64, limit, offset int) (*Leaderboard, error) {
+	challenge, err := s.Get(ctx, viewerID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	standings, total, err := s.repo.Leaderboard(ctx, id, viewerID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leaderboard: %w", err)
+	}
+	for i := range standings {
+		visible, err := s.visible(ctx, viewerID, challenge.Metric, standings[i])
+		if err != nil {
+			return nil, err
+		}
+		if !visible {
+			standings[i].anonymize()
+		}
+	}
+	board := &Leaderboard{Challenge: challenge, Standings: standings, Total: total}
+
+	if challenge.Joined {
+		me, err := s.repo.GetStanding(ctx, id, viewerID)
+		switch {
+		case err == nil:
+			board.Me = me
+		case !errors.Is(err, sql.ErrNoRows):
+			return nil, fmt.Errorf("failed to get standing: %w", err)
+		}
+	}
+	return board, nil
+}
+
+// visible applies the privacy settings of a participant. Scores come from sessions, relative lifts
+// from records and bodyweight, so the viewer needs access to those as well as to the profile.
+func (s *service) visible(ctx context.Context, viewerID int64, metric Metric, standing Standing) (bool, error) {
+	if standing.UserID == nil {
+		return false, nil
+	}
+	view, err := s.profiles.Access(ctx, viewerID, *standing.UserID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check access: %w", err)
+	}
+	if metric == MetricRelativeLift {
+		return view.Profile && view.Records && view.Weight, nil
+	}
+	return view.Profile && view.Sessions, nil
+}
+
+func (s *service) RefreshScores(ctx context.Context, userID int64, days ...date.Date) {
+	if len(days) == 0 {
+		return
+	}
+	if _, err := s.repo.RefreshUser(ctx, userID, days); err != nil {
+		s.logger.Error("Failed to refresh challenge scores", "user_id", userID, "error", err)
+	}
+}
+
+func (s *service) Reconcile(ctx context.Context, now time.Time) (int64, error) {
+	// windows are local days, the day boundaries of all time zones are at most a day away from UTC
+	today := date.New(now.UTC())
+	return s.repo.RefreshEndingSince(ctx, today.AddDays(1), today.AddDays(-1-lateEntryDays))
+}
+
+func (s *service) today(ctx context.Context, userID int64) (date.Date, error) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return date.Date{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	return date.New(time.Now().In(u.Location())), nil
+}
@@ -0,0 +1,102 @@
+package challenge
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/internal/profile"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+type fakeRepository struct {
+	Repository
+	challenge Challenge
+	standings []Standing
+}
+
+func (r *fakeRepository) Get(_ context.Context, _, _ int64) (*Challenge, error) {
+	c := r.challenge
+	return &c, nil
+}
+
+func (r *fakeRepository) Leaderboard(_ context.Context, _, _ int64, _, _ int) ([]Standing, int, error) {
+	standings := append([]Standing(nil), r.standings...)
+	return standings, len(standings), nil
+}
+
+// fakeProfiles grants the views in views, everything else is hidden
+type fakeProfiles struct {
+	profile.Service
+	views map[int64]profile.View
+}
+
+func (p *fakeProfiles) Access(_ context.Context, viewerID, ownerID int64) (profile.View, error) {
+	if viewerID == ownerID {
+		return profile.FullView, nil
+	}
+	return p.views[ownerID], nil
+}
+
+func standing(rank int, userID int64, username string, score float64) Standing {
+	return Standing{Rank: rank, UserID: &userID, Username: &username, Score: &score}
+}
+
+func TestLeaderboardAppliesPrivacy(t *testing.T) {
+	const viewer = 1
+	public := profile.View{Profile: true, Sessions: true, Records: true}
+
+	tests := []struct {
+		name    string
+		metric  Metric
+		views   map[int64]profile.View
+		visible map[int64]bool
+	}{
+		{
+			name:    "session metrics need the profile and sessions",
+			metric:  MetricTotalVolume,
+			views:   map[int64]profile.View{2: public, 3: {Profile: true, Records: true}},
+			visible: map[int64]bool{viewer: true, 2: true, 3: false, 4: false},
+		},
+		{
+			name:    "relative lift also needs weight",
+			metric:  MetricRelativeLift,
+			views:   map[int64]profile.View{2: public, 3: {Profile: true, Records: true, Weight: true}},
+			visible: map[int64]bool{viewer: true, 2: false, 3: true, 4: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{
+				challenge: Challenge{ID: 9, Metric: tt.metric},
+				standings: []Standing{
+					standing(1, 2, "anna", 900),
+					standing(2, 3, "ben", 800),
+					standing(3, viewer, "me", 700),
+					standing(4, 4, "private", 600),
+				},
+			}
+			svc := NewService(repo, nil, &fakeProfiles{views: tt.views}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			board, err := svc.Leaderboard(context.Background(), viewer, 9, 50, 0)
+			if err != nil {
+				t.Fatalf("Leaderboard: %v", err)
+			}
+			for i, got := range board.Standings {
+				userID := *repo.standings[i].UserID
+				if got.Rank != repo.standings[i].Rank {
+					t.Errorf("rank of user %d = %d, want %d", userID, got.Rank, repo.standings[i].Rank)
+				}
+				if tt.visible[userID] {
+					if got.Anonymous || got.Username == nil || got.Score == nil {
+						t.Errorf("user %d should be visible, got %+v", userID, got)
+					}
+					continue
+				}
+				if !got.Anonymous || got.UserID != nil || got.Username != nil || got.Score != nil || got.ScoredAt != nil {
+					t.Errorf("user %d should be anonymous, got %+v", userID, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Accounts is the part of the user module needed to lock a compromised account
+type Accounts interface {
+	ForcePasswordReset(ctx context.Context, id int64) error
+}
+
+type Handler struct {
+	service     Service
+	authService auth.Service
+	accounts    Accounts
+}
+
+func NewHandler(service Service, authService auth.Service, accounts Accounts) *Handler {
+	return &Handler{service: service, authService: authService, accounts: accounts}
+}
+
+type ReportRequest struct {
+	Token string `json:"token" binding:"required" validate:"required"`
+}
+
+// ReportUnrecognized handles the "this wasn't me" link from a new-device alert
+// @Summary Report an unrecognized sign-in
+// @Description Consumes the token from a new-device alert email, signs the user out of every device and requires a password reset. The reset link is emailed to the account address.
+// @Tags auth
+// @Accept json
+// @Param request body ReportRequest true "Token from the alert email"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 429 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /auth/devices/report [post]
+func (h *Handler) ReportUnrecognized(c *gin.Context) {
+	req, ok := validation.BindAndValidate[ReportRequest](c)
+	if !ok {
+		return
+	}
+
+	userID, err := h.service.ConsumeReport(c.Request.Context(), req.Token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidReportToken) {
+			apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to report sign-in", nil)
+		return
+	}
+
+	if _, err := h.authService.RevokeAllSessions(c.Request.Context(), userID); err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to revoke sessions", nil)
+		return
+	}
+	if err := h.accounts.ForcePasswordReset(c.Request.Context(), userID); err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to require password reset", nil)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
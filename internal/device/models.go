@@ -0,0 +1,25 @@
+package device
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidReportToken = errors.New("invalid or expired link")
+
+type KnownDevice struct {
+	ID          int64     `json:"id" db:"id"`
+	UserID      int64     `json:"user_id" db:"user_id"`
+	Fingerprint string    `json:"-" db:"fingerprint"`
+	Description string    `json:"description" db:"description"`
+	UserAgent   string    `json:"user_agent" db:"user_agent"`
+	LastIP      string    `json:"last_ip" db:"last_ip"`
+	FirstSeenAt time.Time `json:"first_seen_at" db:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at" db:"last_seen_at"`
+}
+
+// Contact is who a new-device alert is sent to
+type Contact struct {
+	Username string `db:"username"`
+	Email    string `db:"email"`
+}
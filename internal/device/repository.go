@@ -0,0 +1,93 @@
+package device
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"time"
+)
+
+type Repository interface {
+	// Touch records a sighting of the device and reports whether it was seen for the first time
+	Touch(ctx context.Context, device *KnownDevice) (bool, error)
+	CountForUser(ctx context.Context, userID int64) (int, error)
+	// HasIP reports whether one of the user's devices was last seen from the IP address
+	HasIP(ctx context.Context, userID int64, ip string) (bool, error)
+	Delete(ctx context.Context, id int64) error
+	FindContact(ctx context.Context, userID int64) (*Contact, error)
+
+	CreateReportToken(ctx context.Context, userID, deviceID int64, tokenHash string, expiresAt time.Time) error
+	// ConsumeReportToken marks a valid token as used and returns the user and device it was issued for
+	ConsumeReportToken(ctx context.Context, tokenHash string) (int64, *int64, error)
+	DeleteExpiredReportTokens(ctx context.Context, before time.Time) (int64, error)
+}
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) Touch(ctx context.Context, device *KnownDevice) (bool, error) {
+	// xmax is only zero for a freshly inserted row, which tells inserts and conflict updates apart
+	query := `
+		INSERT INTO known_devices (user_id, fingerprint, description, user_agent, last_ip)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, fingerprint) DO UPDATE
+		SET user_agent = EXCLUDED.user_agent, last_ip = EXCLUDED.last_ip, last_seen_at = NOW()
+		RETURNING id, first_seen_at, last_seen_at, (xmax = 0) AS inserted
+	`
+	var inserted bool
+	err := r.executor.QueryRowxContext(ctx, query, device.UserID, device.Fingerprint, device.Description, device.UserAgent, device.LastIP).
+		Scan(&device.ID, &device.FirstSeenAt, &device.LastSeenAt, &inserted)
+	return inserted, err
+}
+
+func (r *repository) CountForUser(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.executor.GetContext(ctx, &count, "SELECT COUNT(*) FROM known_devices WHERE user_id = $1", userID)
+	return count, err
+}
+
+func (r *repository) HasIP(ctx context.Context, userID int64, ip string) (bool, error) {
+	var exists bool
+	err := r.executor.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM known_devices WHERE user_id = $1 AND last_ip = $2)", userID, ip)
+	return exists, err
+}
+
+func (r *repository) Delete(ctx context.Context, id int64) error {
+	_, err := r.executor.ExecContext(ctx, "DELETE FROM known_devices WHERE id = $1", id)
+	return err
+}
+
+func (r *repository) FindContact(ctx context.Context, userID int64) (*Contact, error) {
+	contact := &Contact{}
+	err := r.executor.GetContext(ctx, contact, "SELECT username, email FROM users WHERE id = $1", userID)
+	return contact, err
+}
+
+func (r *repository) CreateReportToken(ctx context.Context, userID, deviceID int64, tokenHash string, expiresAt time.Time) error {
+	query := "INSERT INTO device_alert_tokens (user_id, device_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)"
+	_, err := r.executor.ExecContext(ctx, query, userID, deviceID, tokenHash, expiresAt)
+	return err
+}
+
+func (r *repository) ConsumeReportToken(ctx context.Context, tokenHash string) (int64, *int64, error) {
+	query := `
+		UPDATE device_alert_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, device_id`
+	var userID int64
+	var deviceID *int64
+	err := r.executor.QueryRowxContext(ctx, query, tokenHash).Scan(&userID, &deviceID)
+	return userID, deviceID, err
+}
+
+func (r *repository) DeleteExpiredReportTokens(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.executor.ExecContext(ctx, "DELETE FROM device_alert_tokens WHERE expires_at < $1 OR used_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,131 @@
+package device
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/email"
+	"html"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+var ReportTokenTTL = time.Hour * 24 * 7
+
+type Service interface {
+	// SessionStarted remembers the device a session was created from and emails the user the first time a
+	// device shows up. The very first device of an account is remembered silently.
+	SessionStarted(ctx context.Context, userID int64, userAgent, ip string)
+	// IsKnownIP reports whether the user has signed in from the IP address before. Only the IP counts, a user
+	// agent is trivial to copy.
+	IsKnownIP(ctx context.Context, userID int64, ip string) (bool, error)
+	// ConsumeReport validates a "this wasn't me" link, forgets the reported device and returns its owner
+	ConsumeReport(ctx context.Context, token string) (int64, error)
+	PurgeExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type service struct {
+	repo          Repository
+	email         email.Service
+	alertsEnabled bool
+	appBaseURL    string
+	logger        *slog.Logger
+}
+
+func NewService(repo Repository, emailService email.Service, alertsEnabled bool, appBaseURL string, logger *slog.Logger) Service {
+	return &service{repo: repo, email: emailService, alertsEnabled: alertsEnabled, appBaseURL: appBaseURL, logger: logger}
+}
+
+func (s *service) SessionStarted(ctx context.Context, userID int64, userAgent, ip string) {
+	device := &KnownDevice{
+		UserID:      userID,
+		Fingerprint: Fingerprint(userAgent),
+		Description: Describe(userAgent),
+		UserAgent:   userAgent,
+		LastIP:      ip,
+	}
+	isNew, err := s.repo.Touch(ctx, device)
+	if err != nil {
+		s.logger.Error("Failed to record device", "user_id", userID, "error", err)
+		return
+	}
+	if !isNew || !s.alertsEnabled {
+		return
+	}
+
+	count, err := s.repo.CountForUser(ctx, userID)
+	if err != nil {
+		s.logger.Error("Failed to count known devices", "user_id", userID, "error", err)
+		return
+	}
+	if count <= 1 {
+		return
+	}
+	s.sendAlert(ctx, device)
+}
+
+func (s *service) IsKnownIP(ctx context.Context, userID int64, ip string) (bool, error) {
+	known, err := s.repo.HasIP(ctx, userID, ip)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up known devices: %w", err)
+	}
+	return known, nil
+}
+
+func (s *service) sendAlert(ctx context.Context, device *KnownDevice) {
+	contact, err := s.repo.FindContact(ctx, device.UserID)
+	if err != nil {
+		s.logger.Error("Failed to get new device alert recipient", "user_id", device.UserID, "error", err)
+		return
+	}
+
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		s.logger.Error("Failed to generate device report token", "user_id", device.UserID, "error", err)
+		return
+	}
+	if err := s.repo.CreateReportToken(ctx, device.UserID, device.ID, tokenHash, time.Now().Add(ReportTokenTTL)); err != nil {
+		s.logger.Error("Failed to save device report token", "user_id", device.UserID, "error", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/security/not-me?token=%s", s.appBaseURL, url.QueryEscape(token))
+	body := fmt.Sprintf(`<p>Hi %s,</p><p>Your WorkoutTracker account was just signed in to from a new device:</p><ul><li>Device: %s</li><li>IP address: %s</li><li>Time: around %s</li></ul><p>If this was you, there is nothing to do. If it wasn't, secure your account now. This signs you out everywhere and asks you to choose a new password:</p><p><a href="%s">This wasn't me</a></p><p>The link expires in %s.</p>`,
+		html.EscapeString(contact.Username), html.EscapeString(device.Description), html.EscapeString(device.LastIP),
+		device.FirstSeenAt.UTC().Format("2 Jan 2006 15:04 MST"), link, ReportTokenTTL)
+	if err := s.email.Send(ctx, contact.Email, "New sign-in to your WorkoutTracker account", body); err != nil {
+		s.logger.Error("Failed to send new device alert", "user_id", device.UserID, "error", err)
+		return
+	}
+	s.logger.Info("Sent new device alert", "user_id", device.UserID, "device_id", device.ID)
+}
+
+func (s *service) ConsumeReport(ctx context.Context, token string) (int64, error) {
+	userID, deviceID, err := s.repo.ConsumeReportToken(ctx, auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidReportToken
+		}
+		return 0, fmt.Errorf("failed to consume device report token: %w", err)
+	}
+
+	// forgetting the device makes the next sign-in from it raise a new alert
+	if deviceID != nil {
+		if err := s.repo.Delete(ctx, *deviceID); err != nil {
+			s.logger.Error("Failed to forget reported device", "device_id", *deviceID, "error", err)
+		}
+	}
+	s.logger.Warn("User reported an unrecognized sign-in", "user_id", userID)
+	return userID, nil
+}
+
+func (s *service) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	deleted, err := s.repo.DeleteExpiredReportTokens(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge device report tokens: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,68 @@
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Fingerprint identifies a device by browser family and operating system. Versions and the IP address
+// are left out on purpose: they change with every update or network switch and would make every login
+// look like a new device.
+func Fingerprint(userAgent string) string {
+	browser, os := parseUserAgent(userAgent)
+	sum := sha256.Sum256([]byte(browser + "|" + os))
+	return hex.EncodeToString(sum[:])
+}
+
+// Describe returns a human readable device name such as "Firefox on Windows"
+func Describe(userAgent string) string {
+	browser, os := parseUserAgent(userAgent)
+	return browser + " on " + os
+}
+
+func parseUserAgent(ua string) (string, string) {
+	return parseBrowser(ua), parseOS(ua)
+}
+
+func parseBrowser(ua string) string {
+	switch {
+	case ua == "":
+		return "Unknown browser"
+	case strings.Contains(ua, "Edg/"), strings.Contains(ua, "EdgA/"), strings.Contains(ua, "EdgiOS/"):
+		return "Edge"
+	case strings.Contains(ua, "OPR/"), strings.Contains(ua, "Opera"):
+		return "Opera"
+	case strings.Contains(ua, "Firefox/"), strings.Contains(ua, "FxiOS/"):
+		return "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"):
+		return "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		return "Safari"
+	}
+	// API clients such as "curl/8.4.0" or "okhttp/4.12" name themselves first
+	name, _, _ := strings.Cut(ua, "/")
+	if name = strings.TrimSpace(name); name == "" || len(name) > 40 {
+		return "Unknown browser"
+	}
+	return name
+}
+
+func parseOS(ua string) string {
+	switch {
+	case strings.Contains(ua, "Windows"):
+		return "Windows"
+	case strings.Contains(ua, "Android"):
+		return "Android"
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"), strings.Contains(ua, "iOS"):
+		return "iOS"
+	case strings.Contains(ua, "Mac OS X"), strings.Contains(ua, "Macintosh"):
+		return "macOS"
+	case strings.Contains(ua, "CrOS"):
+		return "ChromeOS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	default:
+		return "unknown OS"
+	}
+}
@@ -6,17 +6,22 @@ import (
 )
 
 type Service interface {
-	Send(ctx context.Context, to, from, subject, body string) error
+	Send(ctx context.Context, to, subject, body string) error
 }
 
 type service struct {
 	resend *resend.Client
+	from   string
 }
 
-func (s *service) Send(_ context.Context, to, from, subject, body string) error {
+func NewService(client *resend.Client, from string) Service {
+	return &service{resend: client, from: from}
+}
+
+func (s *service) Send(_ context.Context, to, subject, body string) error {
 	params := &resend.SendEmailRequest{ // <- note: from the package, not s.resend
 		To:      []string{to},
-		From:    from,
+		From:    s.from,
 		Subject: subject,
 		Html:    body,
 	}
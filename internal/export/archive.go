@@ -0,0 +1,155 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"strconv"
+	"time"
+)
+
+// buildArchive writes the snapshot as data.json plus one CSV per table for spreadsheets. CSV rows are flattened,
+// e.g. sets.csv repeats the session and exercise of every set.
+func buildArchive(snapshot *Snapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(zw, "data.json", snapshot.ExportedAt, data); err != nil {
+		return nil, err
+	}
+
+	tables := []struct {
+		name string
+		rows [][]string
+	}{
+		{"profile.csv", profileRows(snapshot.Profile)},
+		{"body_metrics.csv", bodyMetricRows(snapshot.BodyMetrics)},
+		{"templates.csv", templateRows(snapshot.Templates)},
+		{"sessions.csv", sessionRows(snapshot.Sessions)},
+		{"sets.csv", setRows(snapshot.Sessions)},
+	}
+	for _, table := range tables {
+		var csvBuf bytes.Buffer
+		w := csv.NewWriter(&csvBuf)
+		if err := w.WriteAll(table.rows); err != nil {
+			return nil, err
+		}
+		if err := writeFile(zw, table.name, snapshot.ExportedAt, csvBuf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeFile(zw *zip.Writer, name string, modified time.Time, data []byte) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+func profileRows(p Profile) [][]string {
+	return [][]string{
+		{"id", "username", "email", "birthdate", "gender", "activity_level", "time_zone", "role", "created_at", "updated_at"},
+		{
+			formatInt(p.ID), p.Username, p.Email, formatDatePtr(p.Birthdate), formatStringPtr(p.Gender),
+			formatStringPtr(p.ActivityLevel), p.TimeZone, p.Role, formatTime(p.CreatedAt), formatTime(p.UpdatedAt),
+		},
+	}
+}
+
+func bodyMetricRows(metrics []BodyMetric) [][]string {
+	rows := [][]string{{"metric", "value", "recorded_at"}}
+	for _, m := range metrics {
+		rows = append(rows, []string{m.Metric, strconv.FormatFloat(m.Value, 'f', -1, 64), formatTime(m.RecordedAt)})
+	}
+	return rows
+}
+
+// templateRows has one row per planned exercise, templates without exercises get a single row with empty exercise columns
+func templateRows(templates []Template) [][]string {
+	rows := [][]string{{"template_id", "template", "description", "created_at", "order_index", "exercise", "target_sets", "target_reps"}}
+	for _, t := range templates {
+		base := []string{formatInt(t.ID), t.Name, formatStringPtr(t.Description), formatTime(t.CreatedAt)}
+		if len(t.Exercises) == 0 {
+			rows = append(rows, append(base, "", "", "", ""))
+			continue
+		}
+		for _, e := range t.Exercises {
+			row := append([]string{}, base...)
+			rows = append(rows, append(row, strconv.Itoa(e.OrderIndex), e.Exercise, strconv.Itoa(e.TargetSets), strconv.Itoa(e.TargetReps)))
+		}
+	}
+	return rows
+}
+
+func sessionRows(sessions []Session) [][]string {
+	rows := [][]string{{"session_id", "name", "template_id", "performed_date", "started_at", "finished_at", "notes", "created_at"}}
+	for _, s := range sessions {
+		templateID := ""
+		if s.TemplateID != nil {
+			templateID = formatInt(*s.TemplateID)
+		}
+		rows = append(rows, []string{
+			formatInt(s.ID), s.Name, templateID, s.PerformedDate.Format(time.DateOnly),
+			formatTimePtr(s.StartedAt), formatTimePtr(s.FinishedAt), formatStringPtr(s.Notes), formatTime(s.CreatedAt),
+		})
+	}
+	return rows
+}
+
+func setRows(sessions []Session) [][]string {
+	rows := [][]string{{"session_id", "performed_date", "exercise_order", "exercise", "set_number", "reps", "weight", "weight_unit"}}
+	for _, s := range sessions {
+		for _, e := range s.Exercises {
+			for _, set := range e.Sets {
+				rows = append(rows, []string{
+					formatInt(s.ID), s.PerformedDate.Format(time.DateOnly), strconv.Itoa(e.OrderIndex), e.Exercise,
+					strconv.Itoa(set.SetNumber), strconv.Itoa(set.Reps), strconv.FormatFloat(set.Weight, 'f', -1, 64), set.WeightUnit,
+				})
+			}
+		}
+	}
+	return rows
+}
+
+func formatInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+func formatDatePtr(d *date.Date) string {
+	if d == nil {
+		return ""
+	}
+	return d.String()
+}
+
+func formatStringPtr(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatTime(*t)
+}
@@ -0,0 +1,123 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RequestExport queues an export of the current user's data
+// @Summary Export my data
+// @Description Queues a ZIP archive with the profile, body metrics, templates, sessions and sets as JSON and CSV.
+// @Description The archive is built in the background, a signed download link is emailed and listed by GET /api/users/me/exports.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} Export
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 409 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/exports [post]
+func (h *Handler) RequestExport(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	export, err := h.service.Request(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, ErrExportInProgress) {
+			apperrors.GenHTTPError(c, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to request export", nil)
+		return
+	}
+	c.JSON(http.StatusAccepted, export)
+}
+
+// ListExports returns the data exports of the current user
+// @Summary List my data exports
+// @Description Newest first. Ready exports carry a signed download_url until they expire.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} Export
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/exports [get]
+func (h *Handler) ListExports(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	exports, err := h.service.List(c.Request.Context(), userID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to list exports", nil)
+		return
+	}
+	c.JSON(http.StatusOK, exports)
+}
+
+type DownloadURI struct {
+	ID int64 `uri:"id" binding:"required" validate:"required,gt=0"`
+}
+
+type DownloadQuery struct {
+	Expires   int64  `form:"expires" validate:"required"`
+	Signature string `form:"signature" validate:"required"`
+}
+
+// Download serves an export archive through its signed link
+// @Summary Download a data export
+// @Description Signed links are sent by email and listed by GET /api/users/me/exports, they need no other authentication.
+// @Tags users
+// @Produce application/zip
+// @Param id path int true "Export ID"
+// @Param expires query int true "Link expiry as a Unix timestamp"
+// @Param signature query string true "Link signature"
+// @Success 200 {file} file
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /exports/{id}/download [get]
+func (h *Handler) Download(c *gin.Context) {
+	uri, ok := validation.BindAndValidateURI[DownloadURI](c)
+	if !ok {
+		return
+	}
+	query, ok := validation.BindAndValidateQuery[DownloadQuery](c)
+	if !ok {
+		return
+	}
+
+	export, archive, err := h.service.Open(c.Request.Context(), uri.ID, query.Expires, query.Signature)
+	if err != nil {
+		if errors.Is(err, ErrInvalidLink) {
+			apperrors.GenHTTPError(c, http.StatusForbidden, err.Error(), nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to download export", nil)
+		return
+	}
+
+	filename := fmt.Sprintf("workouttracker-export-%s.zip", export.CreatedAt.UTC().Format("2006-01-02"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/zip", archive)
+}
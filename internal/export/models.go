@@ -0,0 +1,111 @@
+package export
+
+import (
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPending    Status = "pending"
+	StatusProcessing Status = "processing"
+	StatusReady      Status = "ready"
+	StatusFailed     Status = "failed"
+)
+
+// Export is a requested copy of all personal data of a user. The archive itself is only loaded for downloads.
+type Export struct {
+	ID          int64      `json:"id" db:"id"`
+	UserID      int64      `json:"user_id" db:"user_id"`
+	Status      Status     `json:"status" db:"status"`
+	SizeBytes   int64      `json:"size_bytes" db:"size_bytes"`
+	Error       string     `json:"error,omitempty" db:"error"`
+	StartedAt   *time.Time `json:"started_at" db:"started_at"`
+	CompletedAt *time.Time `json:"completed_at" db:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	// DownloadURL is a signed link, set while a ready export has not expired
+	DownloadURL string `json:"download_url,omitempty" db:"-"`
+}
+
+type Contact struct {
+	Username string `db:"username"`
+	Email    string `db:"email"`
+}
+
+// Snapshot is everything stored about a user, written to the archive as data.json
+type Snapshot struct {
+	ExportedAt  time.Time    `json:"exported_at"`
+	Profile     Profile      `json:"profile"`
+	BodyMetrics []BodyMetric `json:"body_metrics"`
+	Templates   []Template   `json:"templates"`
+	Sessions    []Session    `json:"sessions"`
+}
+
+type Profile struct {
+	ID            int64      `json:"id" db:"id"`
+	Username      string     `json:"username" db:"username"`
+	Email         string     `json:"email" db:"email"`
+	Birthdate     *date.Date `json:"birthdate" db:"birthdate"`
+	Gender        *string    `json:"gender" db:"gender"`
+	Weight        float64    `json:"-" db:"weight"`
+	HeightCM      *float64   `json:"-" db:"height_cm"`
+	ActivityLevel *string    `json:"activity_level" db:"activity_level"`
+	TimeZone      string     `json:"time_zone" db:"time_zone"`
+	Role          string     `json:"role" db:"role"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+type BodyMetric struct {
+	Metric     string    `json:"metric"`
+	Value      float64   `json:"value"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+type Template struct {
+	ID          int64              `json:"id" db:"id"`
+	Name        string             `json:"name" db:"name"`
+	Description *string            `json:"description" db:"description"`
+	CreatedAt   time.Time          `json:"created_at" db:"created_at"`
+	Exercises   []TemplateExercise `json:"exercises" db:"-"`
+}
+
+type TemplateExercise struct {
+	TemplateID int64  `json:"-" db:"template_id"`
+	ExerciseID int64  `json:"exercise_id" db:"exercise_id"`
+	Exercise   string `json:"exercise" db:"exercise"`
+	OrderIndex int    `json:"order_index" db:"order_index"`
+	TargetSets int    `json:"target_sets" db:"target_sets"`
+	TargetReps int    `json:"target_reps" db:"target_reps"`
+}
+
+type Session struct {
+	ID            int64             `json:"id" db:"id"`
+	TemplateID    *int64            `json:"template_id" db:"template_id"`
+	Name          string            `json:"name" db:"name"`
+	Notes         *string           `json:"notes" db:"notes"`
+	PerformedDate time.Time         `json:"performed_date" db:"performed_date"`
+	StartedAt     *time.Time        `json:"started_at" db:"started_at"`
+	FinishedAt    *time.Time        `json:"finished_at" db:"finished_at"`
+	CreatedAt     time.Time         `json:"created_at" db:"created_at"`
+	Exercises     []SessionExercise `json:"exercises" db:"-"`
+}
+
+type SessionExercise struct {
+	ID         int64  `json:"-" db:"id"`
+	SessionID  int64  `json:"-" db:"session_id"`
+	ExerciseID int64  `json:"exercise_id" db:"exercise_id"`
+	Exercise   string `json:"exercise" db:"exercise"`
+	OrderIndex int    `json:"order_index" db:"order_index"`
+	Sets       []Set  `json:"sets" db:"-"`
+}
+
+type Set struct {
+	SessionExerciseID int64   `json:"-" db:"session_exercise_id"`
+	SetNumber         int     `json:"set_number" db:"set_number"`
+	Reps              int     `json:"reps" db:"reps"`
+	Weight            float64 `json:"weight" db:"weight"`
+	WeightUnit        string  `json:"weight_unit" db:"weight_unit"`
+}
@@ -0,0 +1,184 @@
+package export
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"time"
+)
+
+type Repository interface {
+	Create(ctx context.Context, userID int64) (*Export, error)
+	// FindActive returns the pending or processing export of a user, sql.ErrNoRows when there is none
+	FindActive(ctx context.Context, userID int64) (*Export, error)
+	List(ctx context.Context, userID int64) ([]Export, error)
+	// Claim marks the oldest pending export as processing, including ones stuck in processing since staleBefore
+	Claim(ctx context.Context, staleBefore time.Time) (*Export, error)
+	Complete(ctx context.Context, id int64, archive []byte, expiresAt time.Time) error
+	Fail(ctx context.Context, id int64, reason string) error
+	// GetArchive returns a ready export that has not expired yet together with its archive
+	GetArchive(ctx context.Context, id int64) (*Export, []byte, error)
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+	FindContact(ctx context.Context, userID int64) (*Contact, error)
+
+	GetProfile(ctx context.Context, userID int64) (*Profile, error)
+	ListTemplates(ctx context.Context, userID int64) ([]Template, error)
+	ListTemplateExercises(ctx context.Context, userID int64) ([]TemplateExercise, error)
+	ListSessions(ctx context.Context, userID int64) ([]Session, error)
+	ListSessionExercises(ctx context.Context, userID int64) ([]SessionExercise, error)
+	ListSets(ctx context.Context, userID int64) ([]Set, error)
+}
+
+const exportColumns = "id, user_id, status, size_bytes, error, started_at, completed_at, expires_at, created_at"
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) Create(ctx context.Context, userID int64) (*Export, error) {
+	export := &Export{}
+	query := "INSERT INTO data_exports (user_id) VALUES ($1) RETURNING " + exportColumns
+	err := r.executor.GetContext(ctx, export, query, userID)
+	return export, err
+}
+
+func (r *repository) FindActive(ctx context.Context, userID int64) (*Export, error) {
+	export := &Export{}
+	query := "SELECT " + exportColumns + " FROM data_exports WHERE user_id = $1 AND status IN ('pending', 'processing') LIMIT 1"
+	err := r.executor.GetContext(ctx, export, query, userID)
+	return export, err
+}
+
+func (r *repository) List(ctx context.Context, userID int64) ([]Export, error) {
+	exports := []Export{}
+	query := "SELECT " + exportColumns + " FROM data_exports WHERE user_id = $1 ORDER BY created_at DESC"
+	err := r.executor.SelectContext(ctx, &exports, query, userID)
+	return exports, err
+}
+
+func (r *repository) Claim(ctx context.Context, staleBefore time.Time) (*Export, error) {
+	query := `
+		UPDATE data_exports SET status = 'processing', started_at = NOW()
+		WHERE id = (
+			SELECT id FROM data_exports
+			WHERE status = 'pending' OR (status = 'processing' AND started_at < $1)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + exportColumns
+	export := &Export{}
+	err := r.executor.GetContext(ctx, export, query, staleBefore)
+	return export, err
+}
+
+func (r *repository) Complete(ctx context.Context, id int64, archive []byte, expiresAt time.Time) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'ready', archive = $1, size_bytes = $2, completed_at = NOW(), expires_at = $3
+		WHERE id = $4`
+	_, err := r.executor.ExecContext(ctx, query, archive, len(archive), expiresAt, id)
+	return err
+}
+
+func (r *repository) Fail(ctx context.Context, id int64, reason string) error {
+	query := "UPDATE data_exports SET status = 'failed', error = $1, completed_at = NOW() WHERE id = $2"
+	_, err := r.executor.ExecContext(ctx, query, reason, id)
+	return err
+}
+
+func (r *repository) GetArchive(ctx context.Context, id int64) (*Export, []byte, error) {
+	var row struct {
+		Export
+		Archive []byte `db:"archive"`
+	}
+	query := "SELECT " + exportColumns + ", archive FROM data_exports WHERE id = $1 AND status = 'ready' AND expires_at > NOW()"
+	if err := r.executor.GetContext(ctx, &row, query, id); err != nil {
+		return nil, nil, err
+	}
+	return &row.Export, row.Archive, nil
+}
+
+func (r *repository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	query := "DELETE FROM data_exports WHERE expires_at < $1 OR (status = 'failed' AND completed_at < $1)"
+	res, err := r.executor.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *repository) FindContact(ctx context.Context, userID int64) (*Contact, error) {
+	contact := &Contact{}
+	err := r.executor.GetContext(ctx, contact, "SELECT username, email FROM users WHERE id = $1", userID)
+	return contact, err
+}
+
+func (r *repository) GetProfile(ctx context.Context, userID int64) (*Profile, error) {
+	profile := &Profile{}
+	query := `
+		SELECT id, username, email, birthdate, gender, weight, height_cm, activity_level, time_zone, role, created_at, updated_at
+		FROM users WHERE id = $1`
+	err := r.executor.GetContext(ctx, profile, query, userID)
+	return profile, err
+}
+
+func (r *repository) ListTemplates(ctx context.Context, userID int64) ([]Template, error) {
+	templates := []Template{}
+	query := "SELECT id, name, description, created_at FROM workout_templates WHERE user_id = $1 ORDER BY id"
+	err := r.executor.SelectContext(ctx, &templates, query, userID)
+	return templates, err
+}
+
+func (r *repository) ListTemplateExercises(ctx context.Context, userID int64) ([]TemplateExercise, error) {
+	exercises := []TemplateExercise{}
+	query := `
+		SELECT te.template_id, te.exercise_id, e.name AS exercise, te.order_index, te.target_sets, te.target_reps
+		FROM workout_template_exercises te
+		JOIN workout_templates t ON t.id = te.template_id
+		JOIN exercises e ON e.id = te.exercise_id
+		WHERE t.user_id = $1
+		ORDER BY te.template_id, te.order_index`
+	err := r.executor.SelectContext(ctx, &exercises, query, userID)
+	return exercises, err
+}
+
+func (r *repository) ListSessions(ctx context.Context, userID int64) ([]Session, error) {
+	sessions := []Session{}
+	query := `
+		SELECT id, template_id, name, notes, performed_date, started_at, finished_at, created_at
+		FROM workout_sessions
+		WHERE user_id = $1
+		ORDER BY performed_date, id`
+	err := r.executor.SelectContext(ctx, &sessions, query, userID)
+	return sessions, err
+}
+
+func (r *repository) ListSessionExercises(ctx context.Context, userID int64) ([]SessionExercise, error) {
+	exercises := []SessionExercise{}
+	query := `
+		SELECT se.id, se.session_id, se.exercise_id, e.name AS exercise, se.order_index
+		FROM workout_session_exercises se
+		JOIN workout_sessions s ON s.id = se.session_id
+		JOIN exercises e ON e.id = se.exercise_id
+		WHERE s.user_id = $1
+		ORDER BY se.session_id, se.order_index`
+	err := r.executor.SelectContext(ctx, &exercises, query, userID)
+	return exercises, err
+}
+
+func (r *repository) ListSets(ctx context.Context, userID int64) ([]Set, error) {
+	sets := []Set{}
+	query := `
+		SELECT ss.session_exercise_id, ss.set_number, ss.reps, ss.weight, ss.weight_unit
+		FROM workout_session_sets ss
+		JOIN workout_session_exercises se ON se.id = ss.session_exercise_id
+		JOIN workout_sessions s ON s.id = se.session_id
+		WHERE s.user_id = $1
+		ORDER BY ss.session_exercise_id, ss.set_number`
+	err := r.executor.SelectContext(ctx, &sets, query, userID)
+	return sets, err
+}
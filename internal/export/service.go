@@ -0,0 +1,247 @@
+package export
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/email"
+	"html"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// processingTimeout hands an export to the next run when the replica building it died
+const processingTimeout = time.Minute * 15
+
+var (
+	ErrExportInProgress = errors.New("an export is already in progress")
+	ErrInvalidLink      = errors.New("invalid or expired download link")
+)
+
+type Service interface {
+	// Request queues an export of all data of the user, it is built by ProcessPending in the background
+	Request(ctx context.Context, userID int64) (*Export, error)
+	List(ctx context.Context, userID int64) ([]Export, error)
+	// ProcessPending builds up to limit queued exports and emails their owners a download link
+	ProcessPending(ctx context.Context, limit int) (int, error)
+	// Open checks a signed download link and returns the export with its archive
+	Open(ctx context.Context, id, expires int64, signature string) (*Export, []byte, error)
+	PurgeExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type service struct {
+	repo       Repository
+	email      email.Service
+	secret     []byte
+	ttl        time.Duration
+	apiBaseURL string
+	logger     *slog.Logger
+}
+
+// NewService signs download links with secret, they stay valid for ttl after the archive is built
+func NewService(repo Repository, emailService email.Service, secret []byte, ttl time.Duration, apiBaseURL string, logger *slog.Logger) Service {
+	return &service{repo: repo, email: emailService, secret: secret, ttl: ttl, apiBaseURL: apiBaseURL, logger: logger}
+}
+
+func (s *service) Request(ctx context.Context, userID int64) (*Export, error) {
+	_, err := s.repo.FindActive(ctx, userID)
+	if err == nil {
+		return nil, ErrExportInProgress
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to check running exports: %w", err)
+	}
+
+	export, err := s.repo.Create(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue export: %w", err)
+	}
+	return export, nil
+}
+
+func (s *service) List(ctx context.Context, userID int64) ([]Export, error) {
+	exports, err := s.repo.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range exports {
+		if exports[i].Status == StatusReady && exports[i].ExpiresAt != nil && exports[i].ExpiresAt.After(now) {
+			exports[i].DownloadURL = s.downloadURL(exports[i].ID, *exports[i].ExpiresAt)
+		}
+	}
+	return exports, nil
+}
+
+func (s *service) ProcessPending(ctx context.Context, limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		export, err := s.repo.Claim(ctx, time.Now().Add(-processingTimeout))
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return processed, fmt.Errorf("failed to claim export: %w", err)
+		}
+		s.process(ctx, export)
+		processed++
+	}
+	return processed, nil
+}
+
+func (s *service) process(ctx context.Context, export *Export) {
+	snapshot, err := s.collect(ctx, export.UserID)
+	if err != nil {
+		s.fail(ctx, export, "failed to collect data", err)
+		return
+	}
+	archive, err := buildArchive(snapshot)
+	if err != nil {
+		s.fail(ctx, export, "failed to build archive", err)
+		return
+	}
+
+	expiresAt := time.Now().Add(s.ttl)
+	if err := s.repo.Complete(ctx, export.ID, archive, expiresAt); err != nil {
+		s.logger.Error("Failed to store export", "export_id", export.ID, "user_id", export.UserID, "error", err)
+		return
+	}
+	s.logger.Info("Built data export", "export_id", export.ID, "user_id", export.UserID, "size_bytes", len(archive))
+	s.notify(ctx, export, expiresAt)
+}
+
+func (s *service) fail(ctx context.Context, export *Export, reason string, err error) {
+	s.logger.Error("Data export failed", "export_id", export.ID, "user_id", export.UserID, "reason", reason, "error", err)
+	if err := s.repo.Fail(ctx, export.ID, reason); err != nil {
+		s.logger.Error("Failed to mark export as failed", "export_id", export.ID, "error", err)
+	}
+}
+
+func (s *service) notify(ctx context.Context, export *Export, expiresAt time.Time) {
+	contact, err := s.repo.FindContact(ctx, export.UserID)
+	if err != nil {
+		s.logger.Error("Failed to get export recipient", "user_id", export.UserID, "error", err)
+		return
+	}
+
+	link := s.downloadURL(export.ID, expiresAt)
+	body := fmt.Sprintf(`<p>Hi %s,</p><p>The copy of your WorkoutTracker data you asked for is ready:</p><p><a href="%s">Download your data</a></p><p>The link expires on %s. If you did not ask for this export, change your password.</p>`,
+		html.EscapeString(contact.Username), link, expiresAt.UTC().Format("January 2, 2006 15:04 MST"))
+	if err := s.email.Send(ctx, contact.Email, "Your WorkoutTracker data export is ready", body); err != nil {
+		s.logger.Error("Failed to send export email", "user_id", export.UserID, "error", err)
+	}
+}
+
+// collect loads the data of a user and nests exercises and sets under their templates and sessions
+func (s *service) collect(ctx context.Context, userID int64) (*Snapshot, error) {
+	profile, err := s.repo.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("profile: %w", err)
+	}
+	templates, err := s.repo.ListTemplates(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("templates: %w", err)
+	}
+	templateExercises, err := s.repo.ListTemplateExercises(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("template exercises: %w", err)
+	}
+	sessions, err := s.repo.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("sessions: %w", err)
+	}
+	sessionExercises, err := s.repo.ListSessionExercises(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("session exercises: %w", err)
+	}
+	sets, err := s.repo.ListSets(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("sets: %w", err)
+	}
+
+	setsByExercise := make(map[int64][]Set)
+	for _, set := range sets {
+		setsByExercise[set.SessionExerciseID] = append(setsByExercise[set.SessionExerciseID], set)
+	}
+	exercisesBySession := make(map[int64][]SessionExercise)
+	for _, e := range sessionExercises {
+		e.Sets = setsByExercise[e.ID]
+		if e.Sets == nil {
+			e.Sets = []Set{}
+		}
+		exercisesBySession[e.SessionID] = append(exercisesBySession[e.SessionID], e)
+	}
+	for i := range sessions {
+		sessions[i].Exercises = exercisesBySession[sessions[i].ID]
+		if sessions[i].Exercises == nil {
+			sessions[i].Exercises = []SessionExercise{}
+		}
+	}
+
+	exercisesByTemplate := make(map[int64][]TemplateExercise)
+	for _, e := range templateExercises {
+		exercisesByTemplate[e.TemplateID] = append(exercisesByTemplate[e.TemplateID], e)
+	}
+	for i := range templates {
+		templates[i].Exercises = exercisesByTemplate[templates[i].ID]
+		if templates[i].Exercises == nil {
+			templates[i].Exercises = []TemplateExercise{}
+		}
+	}
+
+	// only current values are stored, a zero weight was never set
+	metrics := []BodyMetric{}
+	if profile.Weight > 0 {
+		metrics = append(metrics, BodyMetric{Metric: "weight", Value: profile.Weight, RecordedAt: profile.UpdatedAt})
+	}
+	if profile.HeightCM != nil {
+		metrics = append(metrics, BodyMetric{Metric: "height_cm", Value: *profile.HeightCM, RecordedAt: profile.UpdatedAt})
+	}
+
+	return &Snapshot{
+		ExportedAt:  time.Now().UTC(),
+		Profile:     *profile,
+		BodyMetrics: metrics,
+		Templates:   templates,
+		Sessions:    sessions,
+	}, nil
+}
+
+func (s *service) Open(ctx context.Context, id, expires int64, signature string) (*Export, []byte, error) {
+	if !hmac.Equal([]byte(s.sign(id, expires)), []byte(signature)) || time.Now().After(time.Unix(expires, 0)) {
+		return nil, nil, ErrInvalidLink
+	}
+	export, archive, err := s.repo.GetArchive(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidLink
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load export: %w", err)
+	}
+	return export, archive, nil
+}
+
+func (s *service) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	return s.repo.DeleteExpired(ctx, before)
+}
+
+// downloadURL is a bearer link: anyone holding it can download the archive until it expires
+func (s *service) downloadURL(id int64, expiresAt time.Time) string {
+	expires := expiresAt.Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.sign(id, expires))
+	return fmt.Sprintf("%s/exports/%d/download?%s", s.apiBaseURL, id, query.Encode())
+}
+
+func (s *service) sign(id, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strconv.FormatInt(id, 10) + "." + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,159 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeRepository struct {
+	Repository
+	exports  map[int64]*Export
+	archives map[int64][]byte
+	err      error
+}
+
+func (f *fakeRepository) List(_ context.Context, userID int64) ([]Export, error) {
+	var exports []Export
+	for _, e := range f.exports {
+		if e.UserID == userID {
+			exports = append(exports, *e)
+		}
+	}
+	return exports, nil
+}
+
+func (f *fakeRepository) GetArchive(_ context.Context, id int64) (*Export, []byte, error) {
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	e, ok := f.exports[id]
+	if !ok || e.Status != StatusReady {
+		return nil, nil, sql.ErrNoRows
+	}
+	export := *e
+	return &export, f.archives[id], nil
+}
+
+func newTestService(repo Repository, secret string) Service {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewService(repo, nil, []byte(secret), time.Hour, "https://api.example.com", logger)
+}
+
+type downloadLink struct {
+	id        int64
+	expires   int64
+	signature string
+}
+
+// parseLink takes the export ID, expiry and signature out of a download URL
+func parseLink(t *testing.T, raw string) downloadLink {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("download url %q: %v", raw, err)
+	}
+	id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(u.Path, "/exports/"), "/download"), 10, 64)
+	if err != nil {
+		t.Fatalf("download url %q: %v", raw, err)
+	}
+	expires, err := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	if err != nil {
+		t.Fatalf("download url %q: %v", raw, err)
+	}
+	return downloadLink{id: id, expires: expires, signature: u.Query().Get("signature")}
+}
+
+func readyExport(id, userID int64, expiresAt time.Time) *Export {
+	return &Export{ID: id, UserID: userID, Status: StatusReady, ExpiresAt: &expiresAt}
+}
+
+func TestOpenChecksSignature(t *testing.T) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+	repo := &fakeRepository{
+		exports:  map[int64]*Export{1: readyExport(1, 7, expiresAt), 2: readyExport(2, 8, expiresAt)},
+		archives: map[int64][]byte{1: []byte("archive 1"), 2: []byte("archive 2")},
+	}
+	s := newTestService(repo, "secret")
+
+	exports, err := s.List(ctx, 7)
+	if err != nil || len(exports) != 1 || exports[0].DownloadURL == "" {
+		t.Fatalf("List = %+v, %v, want one export with a download link", exports, err)
+	}
+	link := parseLink(t, exports[0].DownloadURL)
+
+	export, archive, err := s.Open(ctx, link.id, link.expires, link.signature)
+	if err != nil || export.ID != 1 || string(archive) != "archive 1" {
+		t.Fatalf("Open = %+v, %q, %v, want the archive of export 1", export, archive, err)
+	}
+
+	altered := []byte(link.signature)
+	altered[0] ^= 1
+	tests := []struct {
+		name      string
+		id        int64
+		expires   int64
+		signature string
+	}{
+		{"other export", 2, link.expires, link.signature},
+		{"extended expiry", link.id, link.expires + 3600, link.signature},
+		{"altered signature", link.id, link.expires, string(altered)},
+		{"missing signature", link.id, link.expires, ""},
+	}
+	for _, tt := range tests {
+		if _, _, err := s.Open(ctx, tt.id, tt.expires, tt.signature); !errors.Is(err, ErrInvalidLink) {
+			t.Errorf("%s: err = %v, want ErrInvalidLink", tt.name, err)
+		}
+	}
+
+	// a link signed with another secret, e.g. from before a rotation, is refused
+	if _, _, err := newTestService(repo, "rotated").Open(ctx, link.id, link.expires, link.signature); !errors.Is(err, ErrInvalidLink) {
+		t.Fatalf("other secret: err = %v, want ErrInvalidLink", err)
+	}
+}
+
+func TestOpenChecksExpiry(t *testing.T) {
+	ctx := context.Background()
+	expired := time.Now().Add(-time.Minute)
+	repo := &fakeRepository{
+		exports:  map[int64]*Export{1: readyExport(1, 7, expired)},
+		archives: map[int64][]byte{1: []byte("archive")},
+	}
+	s := newTestService(repo, "secret").(*service)
+
+	exports, err := s.List(ctx, 7)
+	if err != nil || len(exports) != 1 || exports[0].DownloadURL != "" {
+		t.Fatalf("List = %+v, %v, want no download link for an expired export", exports, err)
+	}
+
+	// a correctly signed link stops working once it expires
+	expires := expired.Unix()
+	if _, _, err := s.Open(ctx, 1, expires, s.sign(1, expires)); !errors.Is(err, ErrInvalidLink) {
+		t.Fatalf("expired link: err = %v, want ErrInvalidLink", err)
+	}
+}
+
+func TestOpenMissingArchive(t *testing.T) {
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour).Unix()
+
+	// the archive is gone once PurgeExpired removed it or the export never became ready
+	s := newTestService(&fakeRepository{exports: map[int64]*Export{}}, "secret").(*service)
+	if _, _, err := s.Open(ctx, 1, expires, s.sign(1, expires)); !errors.Is(err, ErrInvalidLink) {
+		t.Fatalf("missing archive: err = %v, want ErrInvalidLink", err)
+	}
+
+	failure := errors.New("connection reset")
+	s = newTestService(&fakeRepository{err: failure}, "secret").(*service)
+	if _, _, err := s.Open(ctx, 1, expires, s.sign(1, expires)); !errors.Is(err, failure) || errors.Is(err, ErrInvalidLink) {
+		t.Fatalf("database error: err = %v, want it passed on", err)
+	}
+}
@@ -0,0 +1,297 @@
+package follow
+
+import (
+	"context"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const (
+	defaultPageSize     = 20
+	defaultFeedPageSize = 20
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+type UsernamePathParam struct {
+	Username string `uri:"username" binding:"required" validate:"required,min=3,max=32"`
+}
+
+type ListConnectionsQuery struct {
+	Status   Status `form:"status" validate:"omitempty,oneof=pending accepted"`
+	Page     int    `form:"page" validate:"omitempty,gte=1"`
+	PageSize int    `form:"page_size" validate:"omitempty,gte=1,lte=100"`
+}
+
+type ConnectionListResponse struct {
+	Connections []Connection `json:"connections"`
+	Total       int          `json:"total"`
+	Page        int          `json:"page"`
+	PageSize    int          `json:"page_size"`
+}
+
+type FeedQuery struct {
+	Cursor string `form:"cursor" validate:"omitempty,max=200"`
+	Limit  int    `form:"limit" validate:"omitempty,gte=1,lte=50"`
+}
+
+// Follow follows a user
+// @Summary Follow user
+// @Description Follows users with a public profile right away, for other profiles a request waits for their approval
+// @Tags follows
+// @Produce json
+// @Security BearerAuth
+// @Param username path string true "Username"
+// @Success 200 {object} Follow
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/profiles/{username}/follow [post]
+func (h *Handler) Follow(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[UsernamePathParam](c)
+	if !ok {
+		return
+	}
+
+	follow, err := h.service.Follow(c.Request.Context(), userID, params.Username)
+	if err != nil {
+		respondError(c, err, "failed to follow user")
+		return
+	}
+	c.JSON(http.StatusOK, follow)
+}
+
+// Unfollow unfollows a user
+// @Summary Unfollow user
+// @Description Stops following a user or withdraws a pending follow request
+// @Tags follows
+// @Security BearerAuth
+// @Param username path string true "Username"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/profiles/{username}/follow [delete]
+func (h *Handler) Unfollow(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[UsernamePathParam](c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Unfollow(c.Request.Context(), userID, params.Username); err != nil {
+		respondError(c, err, "failed to unfollow user")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListFollowers lists followers and follow requests of the current user
+// @Summary List followers
+// @Description Returns approved followers and pending requests, newest first. Filter by status=pending for requests.
+// @Tags follows
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "pending or accepted"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} ConnectionListResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/followers [get]
+func (h *Handler) ListFollowers(c *gin.Context) {
+	h.listConnections(c, h.service.ListFollowers)
+}
+
+// ListFollowing lists users the current user follows or asked to follow
+// @Summary List followed users
+// @Tags follows
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "pending or accepted"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} ConnectionListResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/following [get]
+func (h *Handler) ListFollowing(c *gin.Context) {
+	h.listConnections(c, h.service.ListFollowing)
+}
+
+func (h *Handler) listConnections(c *gin.Context, list func(ctx context.Context, userID int64, filter ListFilter) ([]Connection, int, error)) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	query, ok := validation.BindAndValidateQuery[ListConnectionsQuery](c)
+	if !ok {
+		return
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	connections, total, err := list(c.Request.Context(), userID, ListFilter{
+		Status: query.Status,
+		Limit:  query.PageSize,
+		Offset: (query.Page - 1) * query.PageSize,
+	})
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to list follows", nil)
+		return
+	}
+	c.JSON(http.StatusOK, ConnectionListResponse{Connections: connections, Total: total, Page: query.Page, PageSize: query.PageSize})
+}
+
+// AcceptFollower approves a follow request
+// @Summary Accept follow request
+// @Tags follows
+// @Security BearerAuth
+// @Param username path string true "Username of the follower"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/followers/{username}/accept [post]
+func (h *Handler) AcceptFollower(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[UsernamePathParam](c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.AcceptFollower(c.Request.Context(), userID, params.Username); err != nil {
+		respondError(c, err, "failed to accept follower")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RemoveFollower declines a follow request or removes a follower
+// @Summary Remove follower
+// @Tags follows
+// @Security BearerAuth
+// @Param username path string true "Username of the follower"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/followers/{username} [delete]
+func (h *Handler) RemoveFollower(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[UsernamePathParam](c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveFollower(c.Request.Context(), userID, params.Username); err != nil {
+		respondError(c, err, "failed to remove follower")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetFeed returns the activity feed of the current user
+// @Summary Get feed
+// @Description Returns finished sessions and personal records of followed users, newest first. Pass next_cursor
+// @Description of a page as cursor to get the next one. Users who hide sessions or records from followers are left out.
+// @Tags follows
+// @Produce json
+// @Security BearerAuth
+// @Param cursor query string false "Cursor from the previous page"
+// @Param limit query int false "Page size, 20 by default, up to 50"
+// @Success 200 {object} FeedPage
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/feed [get]
+func (h *Handler) GetFeed(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	query, ok := validation.BindAndValidateQuery[FeedQuery](c)
+	if !ok {
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultFeedPageSize
+	}
+	var cursor *Cursor
+	if query.Cursor != "" {
+		if cursor, err = DecodeCursor(query.Cursor); err != nil {
+			apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+	}
+
+	page, err := h.service.Feed(c.Request.Context(), userID, cursor, query.Limit)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to load feed", nil)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrFollowNotFound):
+		apperrors.GenHTTPError(c, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, ErrCannotFollowSelf):
+		apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+	default:
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, message, nil)
+	}
+}
@@ -0,0 +1,112 @@
+package follow
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/workout/session"
+	"time"
+)
+
+type Status string
+
+const (
+	// StatusPending waits for the followed user to approve, followers of non-public profiles start here
+	StatusPending  Status = "pending"
+	StatusAccepted Status = "accepted"
+)
+
+type Follow struct {
+	FollowerID int64      `json:"follower_id" db:"follower_id"`
+	FolloweeID int64      `json:"followee_id" db:"followee_id"`
+	Status     Status     `json:"status" db:"status"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at" db:"accepted_at"`
+}
+
+// Connection is the other side of a follow, the follower in follower lists and the followed user otherwise
+type Connection struct {
+	UserID     int64      `json:"user_id" db:"user_id"`
+	Username   string     `json:"username" db:"username"`
+	Status     Status     `json:"status" db:"status"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at" db:"accepted_at"`
+}
+
+type ListFilter struct {
+	Status Status
+	Limit  int
+	Offset int
+}
+
+type ItemKind string
+
+const (
+	ItemSession        ItemKind = "session"
+	ItemPersonalRecord ItemKind = "personal_record"
+)
+
+// Entry is a feed row before the session or record it points to is loaded
+type Entry struct {
+	Kind       ItemKind  `db:"kind"`
+	ID         int64     `db:"id"`
+	UserID     int64     `db:"user_id"`
+	Username   string    `db:"username"`
+	OccurredAt time.Time `db:"occurred_at"`
+}
+
+type PersonalRecord struct {
+	ID         int64     `json:"id" db:"id"`
+	ExerciseID int64     `json:"exercise_id" db:"exercise_id"`
+	Exercise   string    `json:"exercise" db:"exercise"`
+	WeightKG   float64   `json:"weight_kg" db:"weight_kg"`
+	Reps       int       `json:"reps" db:"reps"`
+	SessionID  int64     `json:"session_id" db:"session_id"`
+	AchievedAt time.Time `json:"achieved_at" db:"achieved_at"`
+}
+
+type Author struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// Item is a finished session or a new personal record of a followed user
+type Item struct {
+	Kind           ItemKind         `json:"kind"`
+	OccurredAt     time.Time        `json:"occurred_at"`
+	Author         Author           `json:"author"`
+	Session        *session.Summary `json:"session,omitempty"`
+	PersonalRecord *PersonalRecord  `json:"personal_record,omitempty"`
+}
+
+type FeedPage struct {
+	Items []Item `json:"items"`
+	// NextCursor is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of the last item of a page, items are ordered by time, kind and ID, newest first
+type Cursor struct {
+	OccurredAt time.Time `json:"t"`
+	Kind       ItemKind  `json:"k"`
+	ID         int64     `json:"id"`
+}
+
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.OccurredAt.IsZero() || (c.Kind != ItemSession && c.Kind != ItemPersonalRecord) {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
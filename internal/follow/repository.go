@@ -0,0 +1,169 @@
+package follow
+
+import (
+	"context"
+	"database/sql"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"github.com/lib/pq"
+	"time"
+)
+
+type Repository interface {
+	// Create keeps an existing follow as it is and returns it
+	Create(ctx context.Context, followerID, followeeID int64, status Status) (*Follow, error)
+	// Accept approves a pending follow, sql.ErrNoRows when there is none
+	Accept(ctx context.Context, followerID, followeeID int64) error
+	// Delete returns sql.ErrNoRows when there was no follow
+	Delete(ctx context.Context, followerID, followeeID int64) error
+	IsFollowing(ctx context.Context, followerID, followeeID int64) (bool, error)
+	ListFollowers(ctx context.Context, userID int64, filter ListFilter) ([]Connection, int, error)
+	ListFollowing(ctx context.Context, userID int64, filter ListFilter) ([]Connection, int, error)
+
+	// Feed returns the latest entries of users viewerID follows after cursor, nil for the first page.
+	// Entries of users whose privacy settings hide them from followers are left out.
+	Feed(ctx context.Context, viewerID int64, cursor *Cursor, limit int) ([]Entry, error)
+	ListPersonalRecords(ctx context.Context, ids []int64) ([]PersonalRecord, error)
+}
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) Create(ctx context.Context, followerID, followeeID int64, status Status) (*Follow, error) {
+	query := `
+		INSERT INTO follows (follower_id, followee_id, status, accepted_at)
+		VALUES ($1, $2, $3, CASE WHEN $3 = 'accepted' THEN NOW() END)
+		ON CONFLICT (follower_id, followee_id) DO NOTHING`
+	if _, err := r.executor.ExecContext(ctx, query, followerID, followeeID, status); err != nil {
+		return nil, err
+	}
+
+	follow := &Follow{}
+	query = "SELECT follower_id, followee_id, status, created_at, accepted_at FROM follows WHERE follower_id = $1 AND followee_id = $2"
+	err := r.executor.GetContext(ctx, follow, query, followerID, followeeID)
+	return follow, err
+}
+
+func (r *repository) Accept(ctx context.Context, followerID, followeeID int64) error {
+	query := "UPDATE follows SET status = 'accepted', accepted_at = NOW() WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending'"
+	return r.execOne(ctx, query, followerID, followeeID)
+}
+
+func (r *repository) Delete(ctx context.Context, followerID, followeeID int64) error {
+	return r.execOne(ctx, "DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2", followerID, followeeID)
+}
+
+func (r *repository) execOne(ctx context.Context, query string, args ...any) error {
+	res, err := r.executor.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *repository) IsFollowing(ctx context.Context, followerID, followeeID int64) (bool, error) {
+	var following bool
+	query := "SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2 AND status = 'accepted')"
+	err := r.executor.GetContext(ctx, &following, query, followerID, followeeID)
+	return following, err
+}
+
+func (r *repository) ListFollowers(ctx context.Context, userID int64, filter ListFilter) ([]Connection, int, error) {
+	return r.listConnections(ctx, "followee_id", "follower_id", userID, filter)
+}
+
+func (r *repository) ListFollowing(ctx context.Context, userID int64, filter ListFilter) ([]Connection, int, error) {
+	return r.listConnections(ctx, "follower_id", "followee_id", userID, filter)
+}
+
+// listConnections lists follows where column is userID and joins the user on the other side
+func (r *repository) listConnections(ctx context.Context, column, other string, userID int64, filter ListFilter) ([]Connection, int, error) {
+	where := "WHERE f." + column + " = $1 AND ($2 = '' OR f.status = $2)"
+	args := []any{userID, filter.Status}
+
+	var total int
+	if err := r.executor.GetContext(ctx, &total, "SELECT COUNT(*) FROM follows f "+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	connections := []Connection{}
+	query := `
+		SELECT u.id AS user_id, u.username, f.status, f.created_at, f.accepted_at
+		FROM follows f
+		JOIN users u ON u.id = f.` + other + `
+		` + where + `
+		ORDER BY f.created_at DESC, u.id DESC
+		LIMIT $3 OFFSET $4`
+	if err := r.executor.SelectContext(ctx, &connections, query, append(args, filter.Limit, filter.Offset)...); err != nil {
+		return nil, 0, err
+	}
+	return connections, total, nil
+}
+
+// Feed reads at most limit entries per followed user through the (user_id, time DESC, id DESC) indexes and merges
+// them, so the cost grows with the number of followed users times the page size instead of with their history
+func (r *repository) Feed(ctx context.Context, viewerID int64, cursor *Cursor, limit int) ([]Entry, error) {
+	var before *time.Time
+	var kind ItemKind
+	var id int64
+	if cursor != nil {
+		before, kind, id = &cursor.OccurredAt, cursor.Kind, cursor.ID
+	}
+
+	query := `
+		WITH followees AS (
+			SELECT f.followee_id AS user_id, u.username, p.show_sessions, p.show_records
+			FROM follows f
+			JOIN users u ON u.id = f.followee_id
+			JOIN privacy_settings p ON p.user_id = f.followee_id
+			WHERE f.follower_id = $1 AND f.status = 'accepted'
+				AND p.visibility IN ('followers', 'public')
+				AND u.disabled_at IS NULL AND u.deletion_scheduled_at IS NULL
+		)
+		SELECT * FROM (
+			SELECT 'session' AS kind, s.id, fe.user_id, fe.username, s.finished_at AS occurred_at
+			FROM followees fe
+			CROSS JOIN LATERAL (
+				SELECT id, finished_at FROM workout_sessions
+				WHERE user_id = fe.user_id AND finished_at IS NOT NULL
+					AND ($2::TIMESTAMPTZ IS NULL OR (finished_at <= $2 AND (finished_at, 'session', id) < ($2, $3::TEXT, $4)))
+				ORDER BY finished_at DESC, id DESC
+				LIMIT $5
+			) s
+			WHERE fe.show_sessions
+			UNION ALL
+			SELECT 'personal_record' AS kind, pr.id, fe.user_id, fe.username, pr.achieved_at AS occurred_at
+			FROM followees fe
+			CROSS JOIN LATERAL (
+				SELECT id, achieved_at FROM personal_records
+				WHERE user_id = fe.user_id
+					AND ($2::TIMESTAMPTZ IS NULL OR (achieved_at <= $2 AND (achieved_at, 'personal_record', id) < ($2, $3::TEXT, $4)))
+				ORDER BY achieved_at DESC, id DESC
+				LIMIT $5
+			) pr
+			WHERE fe.show_records
+		) items
+		ORDER BY occurred_at DESC, kind DESC, id DESC
+		LIMIT $5`
+	entries := []Entry{}
+	err := r.executor.SelectContext(ctx, &entries, query, viewerID, before, kind, id, limit)
+	return entries, err
+}
+
+func (r *repository) ListPersonalRecords(ctx context.Context, ids []int64) ([]PersonalRecord, error) {
+	records := []PersonalRecord{}
+	query := `
+		SELECT pr.id, pr.exercise_id, e.name AS exercise, pr.weight_kg, pr.reps, pr.session_id, pr.achieved_at
+		FROM personal_records pr
+		JOIN exercises e ON e.id = pr.exercise_id
+		WHERE pr.id = ANY($1)`
+	err := r.executor.SelectContext(ctx, &records, query, pq.Array(ids))
+	return records, err
+}
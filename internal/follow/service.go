@@ -0,0 +1,201 @@
+package follow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/profile"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/internal/workout/session"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+)
+
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrCannotFollowSelf = errors.New("you cannot follow yourself")
+	ErrFollowNotFound   = errors.New("follow not found")
+)
+
+type Service interface {
+	// Follow follows the user right away when their profile is public and sends a follow request otherwise
+	Follow(ctx context.Context, followerID int64, username string) (*Follow, error)
+	// Unfollow also withdraws a pending request
+	Unfollow(ctx context.Context, followerID int64, username string) error
+	ListFollowers(ctx context.Context, userID int64, filter ListFilter) ([]Connection, int, error)
+	ListFollowing(ctx context.Context, userID int64, filter ListFilter) ([]Connection, int, error)
+	AcceptFollower(ctx context.Context, userID int64, followerUsername string) error
+	// RemoveFollower declines a pending request or removes an approved follower
+	RemoveFollower(ctx context.Context, userID int64, followerUsername string) error
+	// Feed returns finished sessions and personal records of followed users, newest first
+	Feed(ctx context.Context, viewerID int64, cursor *Cursor, limit int) (*FeedPage, error)
+}
+
+type service struct {
+	repo     Repository
+	users    user.Service
+	profiles profile.Service
+	sessions session.Repository
+}
+
+func NewService(repo Repository, users user.Service, profiles profile.Service, sessions session.Repository) Service {
+	return &service{repo: repo, users: users, profiles: profiles, sessions: sessions}
+}
+
+func (s *service) Follow(ctx context.Context, followerID int64, username string) (*Follow, error) {
+	followee, err := s.activeUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if followee.ID == followerID {
+		return nil, ErrCannotFollowSelf
+	}
+
+	settings, err := s.profiles.GetSettings(ctx, followee.ID)
+	if err != nil {
+		return nil, err
+	}
+	status := StatusPending
+	if settings.Visibility == profile.VisibilityPublic {
+		status = StatusAccepted
+	}
+
+	follow, err := s.repo.Create(ctx, followerID, followee.ID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to follow: %w", err)
+	}
+	return follow, nil
+}
+
+func (s *service) Unfollow(ctx context.Context, followerID int64, username string) error {
+	followee, err := s.user(ctx, username)
+	if err != nil {
+		return err
+	}
+	return s.delete(ctx, followerID, followee.ID)
+}
+
+func (s *service) ListFollowers(ctx context.Context, userID int64, filter ListFilter) ([]Connection, int, error) {
+	return s.repo.ListFollowers(ctx, userID, filter)
+}
+
+func (s *service) ListFollowing(ctx context.Context, userID int64, filter ListFilter) ([]Connection, int, error) {
+	return s.repo.ListFollowing(ctx, userID, filter)
+}
+
+func (s *service) AcceptFollower(ctx context.Context, userID int64, followerUsername string) error {
+	follower, err := s.user(ctx, followerUsername)
+	if err != nil {
+		return err
+	}
+	err = s.repo.Accept(ctx, follower.ID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrFollowNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to accept follower: %w", err)
+	}
+	return nil
+}
+
+func (s *service) RemoveFollower(ctx context.Context, userID int64, followerUsername string) error {
+	follower, err := s.user(ctx, followerUsername)
+	if err != nil {
+		return err
+	}
+	return s.delete(ctx, follower.ID, userID)
+}
+
+func (s *service) delete(ctx context.Context, followerID, followeeID int64) error {
+	err := s.repo.Delete(ctx, followerID, followeeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrFollowNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete follow: %w", err)
+	}
+	return nil
+}
+
+func (s *service) Feed(ctx context.Context, viewerID int64, cursor *Cursor, limit int) (*FeedPage, error) {
+	// one extra entry tells whether there is a next page
+	entries, err := s.repo.Feed(ctx, viewerID, cursor, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load feed: %w", err)
+	}
+	page := &FeedPage{Items: []Item{}}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		last := entries[limit-1]
+		page.NextCursor = Cursor{OccurredAt: last.OccurredAt, Kind: last.Kind, ID: last.ID}.Encode()
+	}
+
+	var sessionIDs, recordIDs []int64
+	for _, e := range entries {
+		if e.Kind == ItemSession {
+			sessionIDs = append(sessionIDs, e.ID)
+		} else {
+			recordIDs = append(recordIDs, e.ID)
+		}
+	}
+
+	summaries := make(map[int64]*session.Summary, len(sessionIDs))
+	if len(sessionIDs) > 0 {
+		list, err := s.sessions.ListSummariesByIDs(ctx, sessionIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load feed sessions: %w", err)
+		}
+		for i := range list {
+			summaries[list[i].ID] = &list[i]
+		}
+	}
+	records := make(map[int64]*PersonalRecord, len(recordIDs))
+	if len(recordIDs) > 0 {
+		list, err := s.repo.ListPersonalRecords(ctx, recordIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load feed records: %w", err)
+		}
+		for i := range list {
+			records[list[i].ID] = &list[i]
+		}
+	}
+
+	for _, e := range entries {
+		item := Item{Kind: e.Kind, OccurredAt: e.OccurredAt, Author: Author{ID: e.UserID, Username: e.Username}}
+		switch e.Kind {
+		case ItemSession:
+			item.Session = summaries[e.ID]
+		case ItemPersonalRecord:
+			item.PersonalRecord = records[e.ID]
+		}
+		// skip entries deleted between the two queries
+		if item.Session == nil && item.PersonalRecord == nil {
+			continue
+		}
+		page.Items = append(page.Items, item)
+	}
+	return page, nil
+}
+
+func (s *service) user(ctx context.Context, username string) (*user.User, error) {
+	u, err := s.users.GetByUsername(ctx, username)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return u, nil
+}
+
+// activeUser hides disabled accounts and accounts scheduled for deletion
+func (s *service) activeUser(ctx context.Context, username string) (*user.User, error) {
+	u, err := s.user(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if u.DisabledAt != nil || u.DeletionScheduledAt != nil {
+		return nil, ErrUserNotFound
+	}
+	return u, nil
+}
@@ -0,0 +1,238 @@
+package follow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Uranury/WorkoutTracker/internal/profile"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/internal/workout/session"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/jmoiron/sqlx"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fakeRepository keeps follows in memory, its feed lists the sessions of users followed with an approved follow
+type fakeRepository struct {
+	Repository
+	follows  map[[2]int64]Status
+	sessions map[int64][]Entry
+}
+
+func (f *fakeRepository) Create(_ context.Context, followerID, followeeID int64, status Status) (*Follow, error) {
+	key := [2]int64{followerID, followeeID}
+	if _, ok := f.follows[key]; !ok {
+		f.follows[key] = status
+	}
+	return &Follow{FollowerID: followerID, FolloweeID: followeeID, Status: f.follows[key]}, nil
+}
+
+func (f *fakeRepository) Accept(_ context.Context, followerID, followeeID int64) error {
+	key := [2]int64{followerID, followeeID}
+	if f.follows[key] != StatusPending {
+		return sql.ErrNoRows
+	}
+	f.follows[key] = StatusAccepted
+	return nil
+}
+
+func (f *fakeRepository) Delete(_ context.Context, followerID, followeeID int64) error {
+	key := [2]int64{followerID, followeeID}
+	if _, ok := f.follows[key]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(f.follows, key)
+	return nil
+}
+
+func (f *fakeRepository) IsFollowing(_ context.Context, followerID, followeeID int64) (bool, error) {
+	return f.follows[[2]int64{followerID, followeeID}] == StatusAccepted, nil
+}
+
+func (f *fakeRepository) Feed(_ context.Context, viewerID int64, _ *Cursor, limit int) ([]Entry, error) {
+	entries := []Entry{}
+	for key, status := range f.follows {
+		if key[0] == viewerID && status == StatusAccepted {
+			entries = append(entries, f.sessions[key[1]]...)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].OccurredAt.After(entries[j].OccurredAt) })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+type fakeSessions struct {
+	session.Repository
+}
+
+func (fakeSessions) ListSummariesByIDs(_ context.Context, ids []int64) ([]session.Summary, error) {
+	summaries := make([]session.Summary, 0, len(ids))
+	for _, id := range ids {
+		summaries = append(summaries, session.Summary{ID: id})
+	}
+	return summaries, nil
+}
+
+type fakeUsers struct {
+	user.Service
+	users []*user.User
+}
+
+func (f *fakeUsers) GetByUsername(_ context.Context, username string) (*user.User, error) {
+	for _, u := range f.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return nil, apperrors.ErrNotFound
+}
+
+type fakeProfiles struct {
+	profile.Service
+	visibility map[int64]profile.Visibility
+}
+
+func (f *fakeProfiles) GetSettings(_ context.Context, userID int64) (*profile.Settings, error) {
+	settings := profile.DefaultSettings(userID)
+	if v, ok := f.visibility[userID]; ok {
+		settings.Visibility = v
+	}
+	return &settings, nil
+}
+
+const (
+	anna  int64 = 1
+	boris int64 = 2
+	chen  int64 = 3
+)
+
+func newTestService(repo *fakeRepository, visibility map[int64]profile.Visibility) Service {
+	users := &fakeUsers{users: []*user.User{
+		{ID: anna, Username: "anna"},
+		{ID: boris, Username: "boris"},
+		{ID: chen, Username: "chen"},
+	}}
+	return NewService(repo, users, &fakeProfiles{visibility: visibility}, fakeSessions{})
+}
+
+func feedAuthors(t *testing.T, s Service, viewerID int64) []int64 {
+	t.Helper()
+	page, err := s.Feed(context.Background(), viewerID, nil, 20)
+	if err != nil {
+		t.Fatalf("Feed: %v", err)
+	}
+	var authors []int64
+	for _, item := range page.Items {
+		authors = append(authors, item.Author.ID)
+	}
+	return authors
+}
+
+func TestFeedWaitsForApproval(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeRepository{
+		follows: map[[2]int64]Status{},
+		sessions: map[int64][]Entry{
+			anna: {{Kind: ItemSession, ID: 10, UserID: anna, Username: "anna", OccurredAt: time.Now()}},
+		},
+	}
+	s := newTestService(repo, map[int64]profile.Visibility{anna: profile.VisibilityFollowers})
+
+	follow, err := s.Follow(ctx, boris, "anna")
+	if err != nil {
+		t.Fatalf("Follow: %v", err)
+	}
+	if follow.Status != StatusPending {
+		t.Fatalf("status = %s, want a follow request for a non-public profile", follow.Status)
+	}
+	if authors := feedAuthors(t, s, boris); len(authors) != 0 {
+		t.Fatalf("feed authors = %v, want nothing before the request is approved", authors)
+	}
+
+	// following again must not turn the pending request into an approved follow
+	if follow, err := s.Follow(ctx, boris, "anna"); err != nil || follow.Status != StatusPending {
+		t.Fatalf("Follow again = %+v, %v, want the request still pending", follow, err)
+	}
+
+	// only the followed user can approve, a request from someone else to accept is refused
+	if err := s.AcceptFollower(ctx, chen, "boris"); !errors.Is(err, ErrFollowNotFound) {
+		t.Fatalf("AcceptFollower by another user: err = %v, want ErrFollowNotFound", err)
+	}
+	if err := s.AcceptFollower(ctx, anna, "boris"); err != nil {
+		t.Fatalf("AcceptFollower: %v", err)
+	}
+	if authors := feedAuthors(t, s, boris); len(authors) != 1 || authors[0] != anna {
+		t.Fatalf("feed authors = %v, want the session of anna once approved", authors)
+	}
+
+	if err := s.RemoveFollower(ctx, anna, "boris"); err != nil {
+		t.Fatalf("RemoveFollower: %v", err)
+	}
+	if authors := feedAuthors(t, s, boris); len(authors) != 0 {
+		t.Fatalf("feed authors = %v, want nothing after the follower was removed", authors)
+	}
+}
+
+func TestFollowPublicProfileNeedsNoApproval(t *testing.T) {
+	repo := &fakeRepository{follows: map[[2]int64]Status{}}
+	s := newTestService(repo, map[int64]profile.Visibility{anna: profile.VisibilityPublic, chen: profile.VisibilityPrivate})
+
+	follow, err := s.Follow(context.Background(), boris, "anna")
+	if err != nil || follow.Status != StatusAccepted {
+		t.Fatalf("Follow public = %+v, %v, want an approved follow", follow, err)
+	}
+	follow, err = s.Follow(context.Background(), boris, "chen")
+	if err != nil || follow.Status != StatusPending {
+		t.Fatalf("Follow private = %+v, %v, want a follow request", follow, err)
+	}
+}
+
+func TestFollowInactiveUser(t *testing.T) {
+	repo := &fakeRepository{follows: map[[2]int64]Status{}}
+	s := newTestService(repo, nil).(*service)
+	now := time.Now()
+	s.users.(*fakeUsers).users[0].DisabledAt = &now
+
+	if _, err := s.Follow(context.Background(), boris, "anna"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("err = %v, want ErrUserNotFound for a disabled account", err)
+	}
+	if len(repo.follows) != 0 {
+		t.Fatalf("follows = %v, want none", repo.follows)
+	}
+}
+
+func TestFeedQueryReadsOnlyApprovedVisibleFollows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := NewRepository(sqlx.NewDb(db, "postgres"))
+
+	mock.ExpectQuery(`WHERE f\.follower_id = \$1 AND f\.status = 'accepted'\s+`+
+		regexp.QuoteMeta(`AND p.visibility IN ('followers', 'public')`)+`\s+`+
+		regexp.QuoteMeta(`AND u.disabled_at IS NULL AND u.deletion_scheduled_at IS NULL`)+
+		`.*WHERE fe\.show_sessions.*WHERE fe\.show_records`).
+		WithArgs(boris, nil, ItemKind(""), int64(0), 21).
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "id", "user_id", "username", "occurred_at"}))
+	if _, err := repo.Feed(context.Background(), boris, nil, 21); err != nil {
+		t.Fatalf("Feed: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE follower_id = $1 AND followee_id = $2 AND status = 'accepted'")).
+		WithArgs(boris, anna).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	if following, err := repo.IsFollowing(context.Background(), boris, anna); err != nil || following {
+		t.Fatalf("IsFollowing = %v, %v, want false", following, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
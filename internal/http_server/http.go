@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"github.com/Uranury/WorkoutTracker/internal/infra"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/pkg/cookie"
+	"github.com/Uranury/WorkoutTracker/pkg/requestinfo"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -19,12 +22,13 @@ type HTTPServer struct {
 func NewHTTPServer(app *infra.App) *HTTPServer {
 	router := gin.Default()
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173"},
+		AllowOrigins:     app.Config().CORSAllowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", cookie.CSRFHeader, requestinfo.Header},
+		ExposeHeaders:    []string{"Content-Length", cookie.CSRFHeader, requestinfo.Header},
 		AllowCredentials: true,
 	}))
+	router.Use(middleware.RequestInfo())
 
 	server := &HTTPServer{
 		router: router,
@@ -2,6 +2,8 @@ package http_server
 
 import (
 	_ "github.com/Uranury/WorkoutTracker/docs"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -11,24 +13,150 @@ func (h *HTTPServer) setupRoutes() {
 	h.router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	// Public routes
 	authMiddleware := h.app.AuthMiddleware()
+	rateLimiter := h.app.RateLimiter()
+	limits := h.app.Config().RateLimitConfig
+	csrf := middleware.CSRF(h.app.Config().CSRFEnabled)
+
+	loginPolicy := middleware.RatePolicy{Name: "login", Limit: limits.LoginRateLimit, Window: limits.RateLimitWindow, Key: middleware.KeyByIP}
+	signupPolicy := middleware.RatePolicy{Name: "signup", Limit: limits.SignupRateLimit, Window: limits.RateLimitWindow, Key: middleware.KeyByIP}
+	refreshPolicy := middleware.RatePolicy{Name: "refresh", Limit: limits.RefreshRateLimit, Window: limits.RateLimitWindow, Key: middleware.KeyByIP}
+	apiPolicy := middleware.RatePolicy{Name: "api", Limit: limits.APIRateLimit, Window: limits.RateLimitWindow, Key: middleware.KeyByUser}
 
 	h.router.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "pong"})
 		return
 	})
-	auth := h.router.Group("/auth")
-	auth.POST("/signup", h.app.UserHandler().SignUp)
-	auth.POST("/login", h.app.UserHandler().Login)
-	auth.POST("/logout", h.app.UserHandler().Logout)
-	auth.POST("/refresh", h.app.UserHandler().RefreshToken)
+	h.router.GET("/.well-known/jwks.json", h.app.AuthHandler().JWKS)
+	h.router.GET("/.well-known/oauth-authorization-server", h.app.OAuthHandler().Metadata)
+	h.router.GET("/exports/:id/download", rateLimiter.Limit(refreshPolicy), h.app.ExportHandler().Download)
+
+	oauthRoutes := h.router.Group("/oauth", rateLimiter.Limit(refreshPolicy))
+	oauthRoutes.POST("/token", h.app.OAuthHandler().Token)
+	oauthRoutes.POST("/revoke", h.app.OAuthHandler().Revoke)
+	oauthRoutes.POST("/introspect", h.app.OAuthHandler().Introspect)
+
+	authRoutes := h.router.Group("/auth")
+	authRoutes.POST("/signup", rateLimiter.Limit(signupPolicy), h.app.UserHandler().SignUp)
+	authRoutes.POST("/login", rateLimiter.Limit(loginPolicy), h.app.UserHandler().Login)
+	authRoutes.POST("/login/2fa", rateLimiter.Limit(loginPolicy), h.app.UserHandler().LoginSecondFactor)
+	authRoutes.GET("/csrf", h.app.UserHandler().CSRFToken)
+	authRoutes.POST("/logout", csrf, h.app.UserHandler().Logout)
+	authRoutes.POST("/refresh", rateLimiter.Limit(refreshPolicy), csrf, h.app.UserHandler().RefreshToken)
+	authRoutes.POST("/magic-link", rateLimiter.Limit(loginPolicy), h.app.UserHandler().RequestMagicLink)
+	authRoutes.POST("/magic-link/verify", rateLimiter.Limit(loginPolicy), h.app.UserHandler().VerifyMagicLink)
+	authRoutes.POST("/password/reset", rateLimiter.Limit(loginPolicy), h.app.UserHandler().ResetPassword)
+	authRoutes.POST("/devices/report", rateLimiter.Limit(loginPolicy), h.app.DeviceHandler().ReportUnrecognized)
+
+	oidcRoutes := authRoutes.Group("/oidc")
+	oidcRoutes.GET("/providers", h.app.IdentityHandler().ListProviders)
+	oidcRoutes.GET("/:provider/login", rateLimiter.Limit(loginPolicy), h.app.IdentityHandler().Login)
+	oidcRoutes.GET("/:provider/callback", rateLimiter.Limit(loginPolicy), h.app.IdentityHandler().Callback)
 
 	// Protected routes
 	api := h.router.Group("/api")
-	api.Use(authMiddleware.JWTAuth())
+	api.Use(authMiddleware.JWTAuth(), rateLimiter.Limit(apiPolicy))
 	{
 		users := api.Group("/users")
-		users.GET("/me", h.app.UserHandler().GetProfile)
-		users.PATCH("/me", h.app.UserHandler().UpdateProfile)
-		users.GET("/:id", h.app.UserHandler().GetUserByID)
+		users.GET("/me", authMiddleware.RequireScope(auth.ScopeProfileRead), h.app.UserHandler().GetProfile)
+		users.PATCH("/me", authMiddleware.RequireScope(auth.ScopeProfileWrite), h.app.UserHandler().UpdateProfile)
+		users.DELETE("/me", authMiddleware.RequireSession(), h.app.UserHandler().DeleteAccount)
+		users.POST("/me/deletion/cancel", authMiddleware.RequireSession(), h.app.UserHandler().CancelDeletion)
+		users.GET("/me/exports", authMiddleware.RequireSession(), h.app.ExportHandler().ListExports)
+		users.POST("/me/exports", authMiddleware.RequireSession(), h.app.ExportHandler().RequestExport)
+		users.POST("/me/password", authMiddleware.RequireSession(), h.app.UserHandler().ChangePassword)
+		users.POST("/me/logout-all", authMiddleware.RequireSession(), h.app.UserHandler().LogoutAll)
+		users.GET("/me/security-events", authMiddleware.RequireSession(), h.app.SecurityHandler().ListMyEvents)
+		users.GET("/me/privacy", authMiddleware.RequireScope(auth.ScopeProfileRead), h.app.ProfileHandler().GetPrivacy)
+		users.PATCH("/me/privacy", authMiddleware.RequireSession(), h.app.ProfileHandler().UpdatePrivacy)
+		users.GET("/me/followers", authMiddleware.RequireScope(auth.ScopeProfileRead), h.app.FollowHandler().ListFollowers)
+		users.GET("/me/following", authMiddleware.RequireScope(auth.ScopeProfileRead), h.app.FollowHandler().ListFollowing)
+		users.POST("/me/followers/:username/accept", authMiddleware.RequireScope(auth.ScopeProfileWrite), h.app.FollowHandler().AcceptFollower)
+		users.DELETE("/me/followers/:username", authMiddleware.RequireScope(auth.ScopeProfileWrite), h.app.FollowHandler().RemoveFollower)
+		users.GET("/me/notifications", authMiddleware.RequireScope(auth.ScopeProfileRead), h.app.NotificationHandler().ListNotifications)
+		users.POST("/me/notifications/read", authMiddleware.RequireScope(auth.ScopeProfileWrite), h.app.NotificationHandler().MarkRead)
+
+		tokens := users.Group("/me/tokens", authMiddleware.RequireSession())
+		tokens.GET("", h.app.PATHandler().ListTokens)
+		tokens.POST("", h.app.PATHandler().CreateToken)
+		tokens.DELETE("/:id", h.app.PATHandler().RevokeToken)
+
+		twoFactor := users.Group("/me/2fa", authMiddleware.RequireSession())
+		twoFactor.GET("", h.app.TwoFactorHandler().GetStatus)
+		twoFactor.POST("/enroll", h.app.TwoFactorHandler().Enroll)
+		twoFactor.POST("/confirm", h.app.TwoFactorHandler().Confirm)
+		twoFactor.POST("/disable", h.app.TwoFactorHandler().Disable)
+		twoFactor.POST("/recovery-codes", h.app.TwoFactorHandler().RegenerateRecoveryCodes)
+	}
+
+	profiles := api.Group("/profiles/:username")
+	profiles.GET("", authMiddleware.RequireScope(auth.ScopeProfileRead), h.app.ProfileHandler().GetPublicProfile)
+	profiles.POST("/follow", authMiddleware.RequireScope(auth.ScopeProfileWrite), h.app.FollowHandler().Follow)
+	profiles.DELETE("/follow", authMiddleware.RequireScope(auth.ScopeProfileWrite), h.app.FollowHandler().Unfollow)
+
+	api.GET("/feed", authMiddleware.RequireScope(auth.ScopeSessionsRead), h.app.FollowHandler().GetFeed)
+
+	sessions := api.Group("/sessions")
+	{
+		readSessions := authMiddleware.RequireScope(auth.ScopeSessionsRead)
+		writeSessions := authMiddleware.RequireScope(auth.ScopeSessionsWrite)
+
+		sessions.GET("", readSessions, h.app.WorkoutHandler().ListSessions)
+		sessions.POST("", writeSessions, h.app.WorkoutHandler().StartSession)
+		sessions.GET("/stats", readSessions, h.app.WorkoutHandler().GetStats)
+		sessions.GET("/:id", readSessions, h.app.WorkoutHandler().GetSession)
+		sessions.PATCH("/:id", writeSessions, h.app.WorkoutHandler().UpdateSession)
+		sessions.POST("/:id/finish", writeSessions, h.app.WorkoutHandler().FinishSession)
+		sessions.POST("/:id/exercises", writeSessions, h.app.WorkoutHandler().AddExercise)
+		sessions.POST("/:id/exercises/:exercise_id/sets", writeSessions, h.app.WorkoutHandler().RecordSet)
+		sessions.GET("/:id/reactions", readSessions, h.app.SocialHandler().GetReactions)
+		sessions.PUT("/:id/reaction", writeSessions, h.app.SocialHandler().React)
+		sessions.DELETE("/:id/reaction", writeSessions, h.app.SocialHandler().Unreact)
+		sessions.GET("/:id/comments", readSessions, h.app.SocialHandler().ListComments)
+		sessions.POST("/:id/comments", writeSessions, h.app.SocialHandler().CreateComment)
+		sessions.PATCH("/:id/comments/:comment_id", writeSessions, h.app.SocialHandler().UpdateComment)
+		sessions.DELETE("/:id/comments/:comment_id", writeSessions, h.app.SocialHandler().DeleteComment)
+	}
+
+	challenges := api.Group("/challenges")
+	{
+		readChallenges := authMiddleware.RequireScope(auth.ScopeSessionsRead)
+		writeChallenges := authMiddleware.RequireScope(auth.ScopeSessionsWrite)
+
+		challenges.GET("", readChallenges, h.app.ChallengeHandler().ListChallenges)
+		challenges.GET("/:id", readChallenges, h.app.ChallengeHandler().GetChallenge)
+		challenges.GET("/:id/leaderboard", readChallenges, h.app.ChallengeHandler().GetLeaderboard)
+		challenges.POST("/:id/participation", writeChallenges, h.app.ChallengeHandler().JoinChallenge)
+		challenges.DELETE("/:id/participation", writeChallenges, h.app.ChallengeHandler().LeaveChallenge)
+	}
+
+	oauthAPI := api.Group("/oauth", authMiddleware.RequireSession())
+	{
+		oauthAPI.GET("/clients", h.app.OAuthHandler().ListClients)
+		oauthAPI.POST("/clients", h.app.OAuthHandler().RegisterClient)
+		oauthAPI.DELETE("/clients/:id", h.app.OAuthHandler().RevokeClient)
+		oauthAPI.GET("/authorize", h.app.OAuthHandler().GetConsent)
+		oauthAPI.POST("/authorize", h.app.OAuthHandler().Authorize)
+	}
+
+	admin := api.Group("/admin")
+	admin.Use(authMiddleware.RequireSession(), authMiddleware.RequireRole(auth.RoleAdmin))
+	{
+		adminUsers := admin.Group("/users")
+		adminUsers.GET("", h.app.AdminHandler().ListUsers)
+		adminUsers.GET("/:id", h.app.AdminHandler().GetUser)
+		adminUsers.GET("/:id/lockout", h.app.AdminHandler().GetLockoutState)
+		adminUsers.PATCH("/:id/role", h.app.AdminHandler().UpdateUserRole)
+		adminUsers.POST("/:id/unlock", h.app.AdminHandler().UnlockUser)
+		adminUsers.POST("/:id/disable", h.app.AdminHandler().DisableUser)
+		adminUsers.POST("/:id/enable", h.app.AdminHandler().EnableUser)
+		adminUsers.POST("/:id/password-reset", h.app.AdminHandler().ForcePasswordReset)
+		adminUsers.POST("/:id/revoke-tokens", h.app.AdminHandler().RevokeUserTokens)
+
+		admin.GET("/security-events", h.app.SecurityHandler().ListEvents)
+		admin.GET("/audit-log", h.app.AuditHandler().ListEntries)
+		admin.GET("/audit-log/export", h.app.AuditHandler().ExportEntries)
+
+		admin.POST("/challenges", h.app.ChallengeHandler().CreateChallenge)
+		admin.DELETE("/challenges/:id", h.app.ChallengeHandler().DeleteChallenge)
 	}
 }
@@ -0,0 +1,182 @@
+package identity
+
+import (
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/twofactor"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/cookie"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+const (
+	stateCookie     = "oidc_state"
+	stateCookiePath = "/auth/oidc"
+)
+
+type Handler struct {
+	service          Service
+	authService      auth.Service
+	twoFactorService twofactor.Service
+	cookies          *cookie.Jar
+	completeURL      string
+	logger           *slog.Logger
+}
+
+// NewHandler redirects the browser to completeURL once the provider flow is finished
+func NewHandler(service Service, authService auth.Service, twoFactorService twofactor.Service, cookies *cookie.Jar, completeURL string, logger *slog.Logger) *Handler {
+	return &Handler{
+		service:          service,
+		authService:      authService,
+		twoFactorService: twoFactorService,
+		cookies:          cookies,
+		completeURL:      completeURL,
+		logger:           logger,
+	}
+}
+
+type ProviderPathParam struct {
+	Provider string `uri:"provider" binding:"required" validate:"required,max=50"`
+}
+
+type CallbackQuery struct {
+	Code             string `form:"code"`
+	State            string `form:"state"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+type ProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// ListProviders returns configured identity providers
+// @Summary List external identity providers
+// @Tags auth
+// @Produce json
+// @Success 200 {object} ProvidersResponse
+// @Router /auth/oidc/providers [get]
+func (h *Handler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, ProvidersResponse{Providers: h.service.Providers()})
+}
+
+// Login redirects to the identity provider
+// @Summary Sign in with an external provider
+// @Description Starts the OpenID Connect authorization code flow with PKCE and redirects the browser to the provider
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 429 {object} apperrors.HTTPError
+// @Failure 502 {object} apperrors.HTTPError
+// @Router /auth/oidc/{provider}/login [get]
+func (h *Handler) Login(c *gin.Context) {
+	params, ok := validation.BindAndValidateURI[ProviderPathParam](c)
+	if !ok {
+		return
+	}
+
+	redirectURL, state, err := h.service.Begin(c.Request.Context(), params.Provider)
+	if err != nil {
+		if errors.Is(err, ErrUnknownProvider) {
+			apperrors.GenHTTPError(c, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		h.logger.Error("Failed to start oidc login", "provider", params.Provider, "error", err)
+		apperrors.GenHTTPError(c, http.StatusBadGateway, "identity provider is unavailable", nil)
+		return
+	}
+
+	// binds the flow to this browser, Lax so it is sent on the provider's top-level redirect back
+	h.cookies.Set(c.Writer, stateCookie, state, cookie.Options{Path: stateCookiePath, MaxAge: AuthRequestTTL, SameSite: http.SameSiteLaxMode})
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// Callback finishes sign in with an external provider
+// @Summary External provider callback
+// @Description Redirects to the app with a refresh_token cookie set, or with an mfa_token in the fragment when
+// @Description two-factor authentication is enabled, or with an error query parameter
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Param code query string false "Authorization code"
+// @Param state query string false "State"
+// @Success 302
+// @Router /auth/oidc/{provider}/callback [get]
+func (h *Handler) Callback(c *gin.Context) {
+	params, ok := validation.BindAndValidateURI[ProviderPathParam](c)
+	if !ok {
+		return
+	}
+	var query CallbackQuery
+	_ = c.ShouldBindQuery(&query)
+
+	cookieState, _ := c.Cookie(stateCookie)
+	h.cookies.Delete(c.Writer, stateCookie, cookie.Options{Path: stateCookiePath, SameSite: http.SameSiteLaxMode})
+
+	if query.Error != "" {
+		h.logger.Info("Identity provider returned an error", "provider", params.Provider, "error", query.Error, "description", query.ErrorDescription)
+		h.redirectError(c, query.Error)
+		return
+	}
+	if query.State == "" || query.Code == "" || cookieState != query.State {
+		h.redirectError(c, "invalid_state")
+		return
+	}
+
+	u, err := h.service.Complete(c.Request.Context(), params.Provider, query.Code, query.State)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidState), errors.Is(err, ErrUnknownProvider):
+			h.redirectError(c, "invalid_state")
+		case errors.Is(err, user.ErrAccountDisabled):
+			h.redirectError(c, "account_disabled")
+		case errors.Is(err, ErrEmailMissing), errors.Is(err, ErrEmailNotVerified):
+			h.redirectError(c, "email_not_verified")
+		default:
+			h.logger.Error("Failed to complete oidc login", "provider", params.Provider, "error", err)
+			h.redirectError(c, "login_failed")
+		}
+		return
+	}
+
+	mfaEnabled, err := h.twoFactorService.IsEnabled(c.Request.Context(), u.ID)
+	if err != nil {
+		h.logger.Error("Failed to check two-factor status", "user_id", u.ID, "error", err)
+		h.redirectError(c, "login_failed")
+		return
+	}
+	if mfaEnabled {
+		mfaToken, err := h.authService.GenerateMFAToken(u.ID)
+		if err != nil {
+			h.redirectError(c, "login_failed")
+			return
+		}
+		// the fragment never reaches servers or logs, the app finishes with /auth/login/2fa
+		c.Redirect(http.StatusFound, h.completeURL+"#"+url.Values{"mfa_token": {mfaToken}}.Encode())
+		return
+	}
+
+	refreshToken, err := h.authService.GenerateRefreshToken(c.Request.Context(), u.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		h.logger.Error("Failed to issue refresh token", "user_id", u.ID, "error", err)
+		h.redirectError(c, "login_failed")
+		return
+	}
+
+	// the app exchanges the cookie for an access token with /auth/refresh
+	if err := h.cookies.SetSession(c.Writer, refreshToken, auth.RefreshTokenTTL); err != nil {
+		h.logger.Error("Failed to set session cookies", "user_id", u.ID, "error", err)
+		h.redirectError(c, "login_failed")
+		return
+	}
+	c.Redirect(http.StatusFound, h.completeURL)
+}
+
+func (h *Handler) redirectError(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, h.completeURL+"?"+url.Values{"error": {code}}.Encode())
+}
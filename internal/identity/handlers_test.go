@@ -0,0 +1,171 @@
+package identity
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/twofactor"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/cookie"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const completeURL = "https://app.example.com/signed-in"
+
+type fakeTwoFactor struct {
+	twofactor.Service
+	enabled bool
+}
+
+func (f fakeTwoFactor) IsEnabled(context.Context, int64) (bool, error) {
+	return f.enabled, nil
+}
+
+type fakeRefreshTokens struct {
+	auth.RefreshTokenRepository
+}
+
+func (fakeRefreshTokens) Save(context.Context, *auth.RefreshToken) error {
+	return nil
+}
+
+type fakeDevices struct{}
+
+func (fakeDevices) SessionStarted(context.Context, int64, string, string) {}
+
+func newTestRouter(t *testing.T, env *testEnv, mfaEnabled bool) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	keys, err := auth.LoadKeySet("", nil, "test-secret")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	authService := auth.NewAuth(keys, "test", nil, nil, fakeRefreshTokens{}, auth.NewMemoryRevocationStore(), ratelimit.NewMemoryCounter(), nil, fakeDevices{})
+	h := NewHandler(env.service, authService, fakeTwoFactor{enabled: mfaEnabled}, cookie.NewJar(cookie.Settings{}), completeURL, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	r := gin.New()
+	r.GET("/auth/oidc/:provider/login", h.Login)
+	r.GET("/auth/oidc/:provider/callback", h.Callback)
+	return r
+}
+
+func get(r *gin.Engine, target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name && c.Value != "" {
+			return c
+		}
+	}
+	return nil
+}
+
+// startLogin follows the login redirect to the fake provider and returns the callback URL it sends the browser to
+func startLogin(t *testing.T, r *gin.Engine, env *testEnv) (string, *http.Cookie) {
+	t.Helper()
+	w := get(r, "/auth/oidc/acme/login")
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status = %d, want 302", w.Code)
+	}
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, env.provider.server.URL+"/authorize?") {
+		t.Fatalf("login redirects to %q, want the provider", location)
+	}
+	stateCookie := responseCookie(w, stateCookie)
+	if stateCookie == nil {
+		t.Fatal("login must bind the state to the browser with a cookie")
+	}
+
+	code, state := env.provider.Authorize(location, endUser("sub-1", "anna@example.com", true))
+	return "/auth/oidc/acme/callback?" + url.Values{"code": {code}, "state": {state}}.Encode(), stateCookie
+}
+
+func TestLoginAndCallbackSignIn(t *testing.T) {
+	env := newTestEnv(t, &user.User{ID: 7, Username: "anna", Email: "anna@example.com"})
+	r := newTestRouter(t, env, false)
+
+	callback, state := startLogin(t, r, env)
+	w := get(r, callback, state)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != completeURL {
+		t.Fatalf("callback: status = %d, location = %q, want a redirect to %s", w.Code, w.Header().Get("Location"), completeURL)
+	}
+	if responseCookie(w, cookie.RefreshToken) == nil {
+		t.Fatal("callback must set the refresh token cookie")
+	}
+	if len(env.repo.identities) != 1 || env.repo.identities[0].UserID != 7 {
+		t.Fatalf("identities = %+v, want sub-1 linked to user 7", env.repo.identities)
+	}
+}
+
+func TestCallbackAsksForSecondFactor(t *testing.T) {
+	env := newTestEnv(t, &user.User{ID: 7, Username: "anna", Email: "anna@example.com"})
+	r := newTestRouter(t, env, true)
+
+	callback, state := startLogin(t, r, env)
+	w := get(r, callback, state)
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, completeURL+"#mfa_token=") {
+		t.Fatalf("callback redirects to %q, want an mfa_token in the fragment", location)
+	}
+	if responseCookie(w, cookie.RefreshToken) != nil {
+		t.Fatal("no session may be issued before the second factor")
+	}
+}
+
+func TestCallbackRejectsStateNotBoundToBrowser(t *testing.T) {
+	env := newTestEnv(t, &user.User{ID: 7, Username: "anna", Email: "anna@example.com"})
+	r := newTestRouter(t, env, false)
+
+	callback, _ := startLogin(t, r, env)
+	tests := map[string][]*http.Cookie{
+		"no cookie":    nil,
+		"other cookie": {{Name: stateCookie, Value: "someone-elses-state"}},
+	}
+	for name, cookies := range tests {
+		w := get(r, callback, cookies...)
+		if location := w.Header().Get("Location"); location != completeURL+"?error=invalid_state" {
+			t.Errorf("%s: callback redirects to %q, want error=invalid_state", name, location)
+		}
+		if responseCookie(w, cookie.RefreshToken) != nil {
+			t.Errorf("%s: no session may be issued", name)
+		}
+	}
+	if len(env.repo.identities) != 0 {
+		t.Fatalf("identities = %+v, want none", env.repo.identities)
+	}
+}
+
+func TestCallbackPassesProviderErrors(t *testing.T) {
+	env := newTestEnv(t)
+	r := newTestRouter(t, env, false)
+
+	w := get(r, "/auth/oidc/acme/callback?error=access_denied")
+	if location := w.Header().Get("Location"); location != completeURL+"?error=access_denied" {
+		t.Fatalf("callback redirects to %q, want error=access_denied", location)
+	}
+}
+
+func TestLoginUnknownProvider(t *testing.T) {
+	env := newTestEnv(t)
+	r := newTestRouter(t, env, false)
+
+	if w := get(r, "/auth/oidc/nope/login"); w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+}
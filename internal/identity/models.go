@@ -0,0 +1,37 @@
+package identity
+
+import (
+	"errors"
+	"time"
+)
+
+// AuthRequestTTL is how long a user has to finish signing in at the provider
+const AuthRequestTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidState     = errors.New("invalid or expired login state")
+	ErrEmailMissing     = errors.New("identity provider did not share an email address")
+	ErrEmailNotVerified = errors.New("identity provider has not verified the email address")
+)
+
+// Identity links an account at an external provider to a user
+type Identity struct {
+	ID          int64     `db:"id"`
+	UserID      int64     `db:"user_id"`
+	Provider    string    `db:"provider"`
+	Subject     string    `db:"subject"`
+	Email       *string   `db:"email"`
+	CreatedAt   time.Time `db:"created_at"`
+	LastLoginAt time.Time `db:"last_login_at"`
+}
+
+// AuthRequest is a pending authorization code flow, keyed by the hash of its state parameter
+type AuthRequest struct {
+	StateHash    string    `db:"state_hash"`
+	Provider     string    `db:"provider"`
+	Nonce        string    `db:"nonce"`
+	CodeVerifier string    `db:"code_verifier"`
+	ExpiresAt    time.Time `db:"expires_at"`
+	CreatedAt    time.Time `db:"created_at"`
+}
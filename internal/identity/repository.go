@@ -0,0 +1,78 @@
+package identity
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"time"
+)
+
+type Repository interface {
+	Find(ctx context.Context, provider, subject string) (*Identity, error)
+	Create(ctx context.Context, identity *Identity) error
+	TouchLastLogin(ctx context.Context, id int64) error
+
+	SaveAuthRequest(ctx context.Context, req *AuthRequest) error
+	ConsumeAuthRequest(ctx context.Context, stateHash string) (*AuthRequest, error)
+	DeleteExpiredAuthRequests(ctx context.Context, before time.Time) (int64, error)
+}
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) Find(ctx context.Context, provider, subject string) (*Identity, error) {
+	var identity Identity
+	query := `SELECT * FROM user_identities WHERE provider = $1 AND subject = $2`
+	if err := r.executor.GetContext(ctx, &identity, query, provider, subject); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *repository) Create(ctx context.Context, identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, last_login_at
+	`
+	return r.executor.QueryRowxContext(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt, &identity.LastLoginAt)
+}
+
+func (r *repository) TouchLastLogin(ctx context.Context, id int64) error {
+	query := `UPDATE user_identities SET last_login_at = NOW() WHERE id = $1`
+	_, err := r.executor.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *repository) SaveAuthRequest(ctx context.Context, req *AuthRequest) error {
+	query := `
+		INSERT INTO oidc_auth_requests (state_hash, provider, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.executor.ExecContext(ctx, query, req.StateHash, req.Provider, req.Nonce, req.CodeVerifier, req.ExpiresAt)
+	return err
+}
+
+// ConsumeAuthRequest deletes and returns an unexpired request, so each state can be used once
+func (r *repository) ConsumeAuthRequest(ctx context.Context, stateHash string) (*AuthRequest, error) {
+	var req AuthRequest
+	query := `DELETE FROM oidc_auth_requests WHERE state_hash = $1 AND expires_at > NOW() RETURNING *`
+	if err := r.executor.GetContext(ctx, &req, query, stateHash); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (r *repository) DeleteExpiredAuthRequests(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM oidc_auth_requests WHERE expires_at < $1`
+	res, err := r.executor.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,177 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/security"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/oidc"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Service interface {
+	Providers() []string
+	// Begin starts an authorization code flow and returns the provider URL and the state to bind to the browser
+	Begin(ctx context.Context, provider string) (string, string, error)
+	// Complete finishes the flow and returns the linked, possibly newly created, user
+	Complete(ctx context.Context, provider, code, state string) (*user.User, error)
+	PurgeExpiredRequests(ctx context.Context) (int64, error)
+}
+
+type service struct {
+	repo      Repository
+	users     user.Service
+	events    security.Service
+	providers map[string]*oidc.Provider
+	logger    *slog.Logger
+}
+
+func NewService(repo Repository, users user.Service, events security.Service, providers map[string]*oidc.Provider, logger *slog.Logger) Service {
+	return &service{repo: repo, users: users, events: events, providers: providers, logger: logger}
+}
+
+func (s *service) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (s *service) Begin(ctx context.Context, provider string) (string, string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	redirectURL, err := p.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to build authorization url: %w", err)
+	}
+
+	err = s.repo.SaveAuthRequest(ctx, &AuthRequest{
+		StateHash:    auth.HashToken(state),
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(AuthRequestTTL),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to save auth request: %w", err)
+	}
+	return redirectURL, state, nil
+}
+
+func (s *service) Complete(ctx context.Context, provider, code, state string) (*user.User, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	req, err := s.repo.ConsumeAuthRequest(ctx, auth.HashToken(state))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidState
+		}
+		return nil, fmt.Errorf("failed to load auth request: %w", err)
+	}
+	if req.Provider != provider {
+		return nil, ErrInvalidState
+	}
+
+	token, err := p.Exchange(ctx, code, req.CodeVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	claims, err := p.VerifyIDToken(ctx, token.IDToken, req.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.resolveUser(ctx, provider, claims)
+	if err != nil {
+		return nil, err
+	}
+	details := security.Details{"method": "oidc", "provider": provider}
+	if u.DisabledAt != nil {
+		details["reason"] = "account_disabled"
+		s.events.Record(ctx, security.Event{UserID: u.ID, Type: security.EventLogin, Details: details})
+		return nil, user.ErrAccountDisabled
+	}
+	s.events.Record(ctx, security.Event{UserID: u.ID, Type: security.EventLogin, Success: true, Details: details})
+	return u, nil
+}
+
+// resolveUser finds the user linked to the external identity. Unknown identities are linked to the
+// account with the same email, which is only trusted when the provider has verified it.
+func (s *service) resolveUser(ctx context.Context, provider string, claims *oidc.IDTokenClaims) (*user.User, error) {
+	identity, err := s.repo.Find(ctx, provider, claims.Subject)
+	if err == nil {
+		if err := s.repo.TouchLastLogin(ctx, identity.ID); err != nil {
+			s.logger.Warn("Failed to update identity last login", "identity_id", identity.ID, "error", err)
+		}
+		return s.users.GetByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find identity: %w", err)
+	}
+
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" {
+		return nil, ErrEmailMissing
+	}
+	if !claims.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	u, err := s.users.GetByEmail(ctx, email)
+	switch {
+	case errors.Is(err, apperrors.ErrNotFound):
+		hint := claims.PreferredUsername
+		if hint == "" {
+			hint = email
+		}
+		if u, err = s.users.CreateExternal(ctx, email, hint); err != nil {
+			return nil, err
+		}
+		s.logger.Info("Created user from external identity", "user_id", u.ID, "provider", provider)
+	case err != nil:
+		return nil, fmt.Errorf("failed to find user by email: %w", err)
+	}
+
+	err = s.repo.Create(ctx, &Identity{UserID: u.ID, Provider: provider, Subject: claims.Subject, Email: &email})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+	s.logger.Info("Linked external identity", "user_id", u.ID, "provider", provider)
+	return u, nil
+}
+
+func (s *service) PurgeExpiredRequests(ctx context.Context) (int64, error) {
+	deleted, err := s.repo.DeleteExpiredAuthRequests(ctx, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge oidc auth requests: %w", err)
+	}
+	return deleted, nil
+}
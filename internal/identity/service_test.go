@@ -0,0 +1,422 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/security"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/oidc"
+	"github.com/golang-jwt/jwt/v4"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testProvider = "acme"
+	testClientID = "workout-tracker"
+)
+
+// fakeProvider is an OpenID provider serving discovery, its signing keys and the token endpoint.
+// Authorize stands in for the user signing in at the provider and returns the authorization code.
+type fakeProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+type authorization struct {
+	challenge string
+	claims    oidc.IDTokenClaims
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	p := &fakeProvider{t: t, key: key, codes: make(map[string]authorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakeProvider) oidcProvider() *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		Issuer:      p.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://api.example.com/auth/oidc/acme/callback",
+	}, p.server.Client())
+}
+
+// Authorize checks the authorization URL like the provider would and issues a code for the given
+// end user. The nonce of the request goes into the ID token unless claims already set one.
+func (p *fakeProvider) Authorize(authURL string, claims oidc.IDTokenClaims) (code, state string) {
+	p.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatalf("invalid authorization url: %v", err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != testClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		p.t.Fatalf("unexpected authorization request %s", u.RawQuery)
+	}
+	if claims.Nonce == "" {
+		claims.Nonce = q.Get("nonce")
+	}
+
+	code, err = oidc.RandomString(16)
+	if err != nil {
+		p.t.Fatalf("RandomString: %v", err)
+	}
+	p.mu.Lock()
+	p.codes[code] = authorization{challenge: q.Get("code_challenge"), claims: claims}
+	p.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (p *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if clientID, _, _ := r.BasicAuth(); clientID != testClientID {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := grant.claims
+	claims.Issuer = p.server.URL
+	claims.Audience = jwt.ClaimStrings{testClientID}
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &claims)
+	token.Header["kid"] = "test-key"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, oidc.TokenResponse{AccessToken: "access", TokenType: "Bearer", IDToken: idToken, ExpiresIn: 60})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type fakeRepository struct {
+	Repository
+	mu         sync.Mutex
+	requests   map[string]AuthRequest
+	identities []Identity
+	touched    []int64
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{requests: make(map[string]AuthRequest)}
+}
+
+func (f *fakeRepository) SaveAuthRequest(_ context.Context, req *AuthRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[req.StateHash] = *req
+	return nil
+}
+
+func (f *fakeRepository) ConsumeAuthRequest(_ context.Context, stateHash string) (*AuthRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	req, ok := f.requests[stateHash]
+	if !ok || time.Now().After(req.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+	delete(f.requests, stateHash)
+	return &req, nil
+}
+
+func (f *fakeRepository) Find(_ context.Context, provider, subject string) (*Identity, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, identity := range f.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeRepository) Create(_ context.Context, identity *Identity) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	identity.ID = int64(len(f.identities) + 1)
+	f.identities = append(f.identities, *identity)
+	return nil
+}
+
+func (f *fakeRepository) TouchLastLogin(_ context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.touched = append(f.touched, id)
+	return nil
+}
+
+type fakeUsers struct {
+	user.Service
+	users []*user.User
+}
+
+func (f *fakeUsers) GetByID(_ context.Context, id int64) (*user.User, error) {
+	for _, u := range f.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, apperrors.ErrNotFound
+}
+
+func (f *fakeUsers) GetByEmail(_ context.Context, email string) (*user.User, error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, apperrors.ErrNotFound
+}
+
+func (f *fakeUsers) CreateExternal(_ context.Context, email, usernameHint string) (*user.User, error) {
+	u := &user.User{ID: int64(len(f.users) + 100), Username: usernameHint, Email: email}
+	f.users = append(f.users, u)
+	return u, nil
+}
+
+type fakeEvents struct {
+	security.Service
+	mu     sync.Mutex
+	events []security.Event
+}
+
+func (f *fakeEvents) Record(_ context.Context, event security.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+}
+
+type testEnv struct {
+	provider *fakeProvider
+	repo     *fakeRepository
+	users    *fakeUsers
+	events   *fakeEvents
+	service  Service
+}
+
+func newTestEnv(t *testing.T, users ...*user.User) *testEnv {
+	t.Helper()
+	env := &testEnv{
+		provider: newFakeProvider(t),
+		repo:     newFakeRepository(),
+		users:    &fakeUsers{users: users},
+		events:   &fakeEvents{},
+	}
+	providers := map[string]*oidc.Provider{testProvider: env.provider.oidcProvider()}
+	env.service = NewService(env.repo, env.users, env.events, providers, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return env
+}
+
+// signIn runs the whole flow for an end user of the provider
+func (env *testEnv) signIn(t *testing.T, claims oidc.IDTokenClaims) (*user.User, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, state, err := env.service.Begin(ctx, testProvider)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, returnedState := env.provider.Authorize(authURL, claims)
+	if returnedState != state {
+		t.Fatalf("authorization url carries state %q, want %q", returnedState, state)
+	}
+	return env.service.Complete(ctx, testProvider, code, state)
+}
+
+func endUser(subject, email string, verified bool) oidc.IDTokenClaims {
+	return oidc.IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: subject},
+		Email:            email,
+		EmailVerified:    oidc.Bool(verified),
+	}
+}
+
+func TestCompleteCreatesAndLinksNewUser(t *testing.T) {
+	env := newTestEnv(t)
+
+	u, err := env.signIn(t, endUser("sub-1", "Anna@Example.com", true))
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if u.Email != "anna@example.com" {
+		t.Errorf("created user email = %q, want the normalized address", u.Email)
+	}
+	if len(env.repo.identities) != 1 || env.repo.identities[0].UserID != u.ID || env.repo.identities[0].Subject != "sub-1" {
+		t.Fatalf("identities = %+v, want sub-1 linked to user %d", env.repo.identities, u.ID)
+	}
+
+	again, err := env.signIn(t, endUser("sub-1", "anna@example.com", true))
+	if err != nil {
+		t.Fatalf("second sign in: %v", err)
+	}
+	if again.ID != u.ID || len(env.repo.identities) != 1 || len(env.repo.touched) != 1 {
+		t.Fatalf("a linked identity must sign in to the same user, got user %d, %d identities", again.ID, len(env.repo.identities))
+	}
+	if len(env.events.events) != 2 || !env.events.events[1].Success {
+		t.Errorf("events = %+v, want two successful logins", env.events.events)
+	}
+}
+
+func TestCompleteLinksExistingAccountByVerifiedEmail(t *testing.T) {
+	existing := &user.User{ID: 7, Username: "anna", Email: "anna@example.com"}
+	env := newTestEnv(t, existing)
+
+	u, err := env.signIn(t, endUser("sub-1", "anna@example.com", true))
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if u.ID != existing.ID || len(env.users.users) != 1 {
+		t.Fatalf("signed in as user %d with %d users, want the existing account", u.ID, len(env.users.users))
+	}
+	if len(env.repo.identities) != 1 || env.repo.identities[0].UserID != existing.ID {
+		t.Fatalf("identities = %+v, want a link to user 7", env.repo.identities)
+	}
+}
+
+func TestCompleteRefusesToLinkUnverifiedEmail(t *testing.T) {
+	existing := &user.User{ID: 7, Username: "anna", Email: "anna@example.com"}
+	env := newTestEnv(t, existing)
+
+	if _, err := env.signIn(t, endUser("sub-1", "anna@example.com", false)); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("err = %v, want ErrEmailNotVerified", err)
+	}
+	if _, err := env.signIn(t, endUser("sub-1", "", true)); !errors.Is(err, ErrEmailMissing) {
+		t.Fatalf("err = %v, want ErrEmailMissing", err)
+	}
+	if len(env.repo.identities) != 0 {
+		t.Fatalf("identities = %+v, want none", env.repo.identities)
+	}
+}
+
+func TestCompleteRejectsDisabledAccount(t *testing.T) {
+	disabledAt := time.Now()
+	env := newTestEnv(t, &user.User{ID: 7, Username: "anna", Email: "anna@example.com", DisabledAt: &disabledAt})
+
+	if _, err := env.signIn(t, endUser("sub-1", "anna@example.com", true)); !errors.Is(err, user.ErrAccountDisabled) {
+		t.Fatalf("err = %v, want ErrAccountDisabled", err)
+	}
+}
+
+func TestCompleteRejectsNonceMismatch(t *testing.T) {
+	env := newTestEnv(t)
+
+	claims := endUser("sub-1", "anna@example.com", true)
+	claims.Nonce = "replayed-nonce"
+	if _, err := env.signIn(t, claims); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+	}
+	if len(env.repo.identities) != 0 || len(env.users.users) != 0 {
+		t.Fatal("a token with the wrong nonce must not create or link users")
+	}
+}
+
+func TestCompleteRejectsUnknownOrReusedState(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	authURL, state, err := env.service.Begin(ctx, testProvider)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, _ := env.provider.Authorize(authURL, endUser("sub-1", "anna@example.com", true))
+
+	if _, err := env.service.Complete(ctx, testProvider, code, "forged-state"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("forged state: err = %v, want ErrInvalidState", err)
+	}
+	if _, err := env.service.Complete(ctx, testProvider, code, state); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if _, err := env.service.Complete(ctx, testProvider, code, state); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("reused state: err = %v, want ErrInvalidState", err)
+	}
+}
+
+func TestCompleteRejectsStateOfAnotherProvider(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	other := newFakeProvider(t)
+	env.service = NewService(env.repo, env.users, env.events, map[string]*oidc.Provider{
+		testProvider: env.provider.oidcProvider(),
+		"other":      other.oidcProvider(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	authURL, state, err := env.service.Begin(ctx, "other")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, _ := other.Authorize(authURL, endUser("sub-1", "anna@example.com", true))
+	if _, err := env.service.Complete(ctx, testProvider, code, state); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("err = %v, want ErrInvalidState", err)
+	}
+}
+
+func TestBeginRejectsUnknownProvider(t *testing.T) {
+	env := newTestEnv(t)
+	if _, _, err := env.service.Begin(context.Background(), "nope"); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("err = %v, want ErrUnknownProvider", err)
+	}
+}
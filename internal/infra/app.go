@@ -1,75 +1,455 @@
 package infra
 
 import (
+	"crypto/rand"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/admin"
+	"github.com/Uranury/WorkoutTracker/internal/audit"
 	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/bruteforce"
+	"github.com/Uranury/WorkoutTracker/internal/challenge"
+	"github.com/Uranury/WorkoutTracker/internal/device"
+	"github.com/Uranury/WorkoutTracker/internal/email"
+	"github.com/Uranury/WorkoutTracker/internal/export"
+	"github.com/Uranury/WorkoutTracker/internal/follow"
+	"github.com/Uranury/WorkoutTracker/internal/identity"
 	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/internal/notification"
+	"github.com/Uranury/WorkoutTracker/internal/oauth"
+	"github.com/Uranury/WorkoutTracker/internal/pat"
+	"github.com/Uranury/WorkoutTracker/internal/profile"
+	"github.com/Uranury/WorkoutTracker/internal/security"
+	"github.com/Uranury/WorkoutTracker/internal/social"
+	"github.com/Uranury/WorkoutTracker/internal/twofactor"
 	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/internal/workout"
+	"github.com/Uranury/WorkoutTracker/internal/workout/session"
+	"github.com/Uranury/WorkoutTracker/internal/workout/template"
 	"github.com/Uranury/WorkoutTracker/pkg/config"
+	"github.com/Uranury/WorkoutTracker/pkg/cookie"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"github.com/Uranury/WorkoutTracker/pkg/oidc"
+	"github.com/Uranury/WorkoutTracker/pkg/password"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
+	"github.com/Uranury/WorkoutTracker/pkg/scheduler"
 	"log/slog"
+	"strings"
 )
 
 type App struct {
 	deps *Deps
 
 	// Shared services
-	authService auth.Service
+	authService     auth.Service
+	emailService    email.Service
+	auditService    audit.Service
+	securityService security.Service
+	deviceService   device.Service
+	exportService   export.Service
+	workoutService  workout.Service
+	profileService  profile.Service
+	followService   follow.Service
+	notifications   notification.Service
+	socialService   social.Service
+	challenges      challenge.Service
+	loginGuard      bruteforce.Guard
+	failureCounter  ratelimit.Counter
+	cookies         *cookie.Jar
+
+	twoFactorService twofactor.Service
+	patService       pat.Service
+	identityService  identity.Service
+	oauthService     oauth.Service
 
 	// Module services (lazy-loaded or pre-initialized)
 	userService user.Service
 	// ...
-	userHandler    *user.Handler
-	authMiddleware *middleware.Auth
+	authHandler         *auth.Handler
+	userHandler         *user.Handler
+	twoFactorHandler    *twofactor.Handler
+	patHandler          *pat.Handler
+	identityHandler     *identity.Handler
+	oauthHandler        *oauth.Handler
+	adminHandler        *admin.Handler
+	securityHandler     *security.Handler
+	auditHandler        *audit.Handler
+	deviceHandler       *device.Handler
+	exportHandler       *export.Handler
+	workoutHandler      *workout.Handler
+	profileHandler      *profile.Handler
+	followHandler       *follow.Handler
+	notificationHandler *notification.Handler
+	socialHandler       *social.Handler
+	challengeHandler    *challenge.Handler
+	authMiddleware      *middleware.Auth
+	rateLimiter         *middleware.RateLimiter
+
+	scheduler *scheduler.Scheduler
 }
 
-func NewApp(deps *Deps) *App {
+func NewApp(deps *Deps) (*App, error) {
 	app := &App{
 		deps: deps,
 	}
 
-	app.initAuth()
-	app.authMiddleware = middleware.NewAuth(app.authService)
+	app.initShared()
+	if err := app.initCookies(); err != nil {
+		return nil, err
+	}
+	if err := app.initAuth(); err != nil {
+		return nil, err
+	}
+	app.initPAT()
+	app.authMiddleware = middleware.NewAuth(app.authService, app.patService, pat.TokenPrefix, deps.Config.RevocationFailOpen, deps.Logger.With("module", "auth"))
 
 	// Initialize modules in dependency order
-	app.initUser()
-	// app.initWorkout()
-	// ...
+	app.initTwoFactor()
+	if err := app.initUser(); err != nil {
+		return nil, err
+	}
+	if err := app.initIdentity(); err != nil {
+		return nil, err
+	}
+	app.initOAuth()
+	app.initAdmin()
+	app.initExport()
+	app.initProfile()
+	app.initChallenge()
+	app.initWorkout()
+	app.initFollow()
+	app.initSocial()
+
+	if err := app.initJobs(); err != nil {
+		return nil, err
+	}
 
-	return app
+	return app, nil
 }
 
-func (a *App) initAuth() {
+func (a *App) initShared() {
+	a.emailService = email.NewService(a.deps.ResendClient, a.deps.Config.EmailFrom)
+	a.auditService = audit.NewService(audit.NewRepository(a.deps.DBConn), a.deps.Logger.With("module", "audit"))
+	a.auditHandler = audit.NewHandler(a.auditService, a.deps.Logger.With("module", "audit"))
+	a.securityService = security.NewService(security.NewRepository(a.deps.DBConn), a.deps.Logger.With("module", "security"))
+	a.securityHandler = security.NewHandler(a.securityService)
+
+	var limiter ratelimit.Limiter
+	var counter ratelimit.Counter
+	if a.deps.RedisClient != nil {
+		limiter = ratelimit.NewRedisLimiter(a.deps.RedisClient, "ratelimit:")
+		counter = ratelimit.NewRedisCounter(a.deps.RedisClient, "bruteforce:")
+	} else {
+		limiter = ratelimit.NewMemoryLimiter()
+		counter = ratelimit.NewMemoryCounter()
+	}
+	a.rateLimiter = middleware.NewRateLimiter(limiter, a.deps.Logger.With("module", "ratelimit"))
+	a.failureCounter = counter
+	a.initLoginGuard(counter)
+}
+
+func (a *App) initCookies() error {
+	cfg := a.deps.Config.CookieConfig
+	sameSite, err := cookie.ParseSameSite(cfg.CookieSameSite, cfg.CookieSecure)
+	if err != nil {
+		return fmt.Errorf("COOKIE_SAMESITE: %w", err)
+	}
+	if !cfg.CSRFEnabled {
+		a.deps.Logger.Warn("CSRF_ENABLED is off, cookie-authenticated endpoints accept cross-site requests")
+	}
+	a.cookies = cookie.NewJar(cookie.Settings{
+		Secure:      cfg.CookieSecure,
+		Domain:      cfg.CookieDomain,
+		SameSite:    sameSite,
+		RefreshPath: cfg.RefreshCookiePath,
+	})
+	return nil
+}
+
+func (a *App) initLoginGuard(counter ratelimit.Counter) {
+	logger := a.deps.Logger.With("module", "bruteforce")
+	cfg := a.deps.Config.BruteForceConfig
+
+	secret := []byte(cfg.LoginChallengeSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, _ = rand.Read(secret)
+		if cfg.LoginChallengeEnabled {
+			logger.Warn("LOGIN_CHALLENGE_SECRET is not set, login challenges will not be accepted across replicas or restarts")
+		}
+	}
+
+	a.loginGuard = bruteforce.NewGuard(counter, bruteforce.Policy{
+		AccountMaxAttempts:  cfg.LoginMaxAttempts,
+		AccountBaseLockout:  cfg.LoginBaseLockout,
+		AccountMaxLockout:   cfg.LoginMaxLockout,
+		IPMaxFailures:       cfg.LoginIPMaxFailures,
+		IPUserMaxFailures:   cfg.LoginIPUserMaxFailures,
+		FailureWindow:       cfg.LoginFailureWindow,
+		ChallengeEnabled:    cfg.LoginChallengeEnabled,
+		ChallengeDifficulty: cfg.LoginChallengeBits,
+		ChallengeTTL:        cfg.LoginChallengeTTL,
+		NotifyOnLockout:     cfg.LoginLockoutNotify,
+	}, secret, logger)
+}
+
+func (a *App) initAuth() error {
 	logger := a.deps.Logger.With("module", "auth")
+	cfg := a.deps.Config.JWTConfig
+
+	keys, err := auth.LoadKeySet(cfg.JWTSigningKeyFile, cfg.JWTVerificationKeyFiles, cfg.JWTKey)
+	if err != nil {
+		return fmt.Errorf("failed to load JWT keys: %w", err)
+	}
+	if cfg.JWTSigningKeyFile == "" {
+		logger.Warn("JWT_SIGNING_KEY_FILE is not set, signing access tokens with legacy HS256 secret")
+	}
+
 	authRepo := auth.NewRepository(a.deps.DBConn)
-	a.authService = auth.NewAuth(a.deps.Config.JWTKey, a.deps.DBConn, logger, authRepo)
+	var revocations auth.RevocationStore
+	if a.deps.RedisClient != nil {
+		revocations = auth.NewRedisRevocationStore(a.deps.RedisClient, "revoked:")
+	} else {
+		revocations = auth.NewMemoryRevocationStore()
+		logger.Warn("Redis is not configured, access token revocations are not shared between replicas")
+	}
+	a.deviceService = device.NewService(
+		device.NewRepository(a.deps.DBConn),
+		a.emailService,
+		a.deps.Config.NewDeviceAlerts,
+		a.deps.Config.AppBaseURL,
+		a.deps.Logger.With("module", "device"),
+	)
+	a.authService = auth.NewAuth(keys, cfg.JWTIssuer, a.deps.DBConn, logger, authRepo, revocations, a.failureCounter, sessionEvents{events: a.securityService}, a.deviceService)
+	a.authHandler = auth.NewHandler(a.authService)
+	return nil
+}
+
+func (a *App) AuthHandler() *auth.Handler {
+	return a.authHandler
 }
 
-func (a *App) initUser() {
+func (a *App) initUser() error {
+	cfg := a.deps.Config.PasswordHashConfig
+	hasher, err := password.NewHasher(
+		cfg.PasswordHashAlgorithm,
+		password.Argon2Params{
+			Memory:      cfg.Argon2Memory,
+			Iterations:  cfg.Argon2Iterations,
+			Parallelism: cfg.Argon2Parallelism,
+			SaltLength:  password.DefaultArgon2Params.SaltLength,
+			KeyLength:   password.DefaultArgon2Params.KeyLength,
+		},
+		password.BcryptParams{Cost: cfg.BcryptCost},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to configure password hashing: %w", err)
+	}
+
+	policyCfg := a.deps.Config.PasswordPolicyConfig
+	policy := password.Policy{
+		MinLength:            policyCfg.PasswordMinLength,
+		MaxLength:            policyCfg.PasswordMaxLength,
+		MinCharacterClasses:  policyCfg.PasswordMinCharacterClasses,
+		DisallowPersonalInfo: policyCfg.PasswordDisallowPersonal,
+	}
+	if cfg.PasswordHashAlgorithm == password.AlgorithmBcrypt {
+		policy.MaxBytes = password.BcryptMaxBytes
+	}
+	if policyCfg.BreachedPasswordsPath != "" {
+		policy.Breached, err = password.LoadBreachedList(policyCfg.BreachedPasswordsPath)
+		if err != nil {
+			return err
+		}
+		a.deps.Logger.Info("Opened breached password list", "path", policy.Breached.Path())
+	}
+
 	logger := a.deps.Logger.With("module", "user")
 	userRepo := user.NewRepository(a.deps.DBConn, logger)
-	a.userService = user.NewService(userRepo, logger)
-	a.userHandler = user.NewHandler(a.userService, a.authService)
+	a.userService = user.NewService(userRepo, a.emailService, a.loginGuard, a.deviceService, hasher, policy, a.securityService, a.auditService, a.deps.Config.AppBaseURL, logger)
+	a.userHandler = user.NewHandler(a.userService, a.authService, a.twoFactorService, a.cookies)
+	a.twoFactorHandler = twofactor.NewHandler(a.twoFactorService, twoFactorAccounts{users: a.userService})
+	a.deviceHandler = device.NewHandler(a.deviceService, a.authService, a.userService)
+	return nil
 }
 
 func (a *App) UserHandler() *user.Handler {
 	return a.userHandler
 }
 
+func (a *App) initPAT() {
+	logger := a.deps.Logger.With("module", "pat")
+	a.patService = pat.NewService(pat.NewRepository(a.deps.DBConn), logger)
+	a.patHandler = pat.NewHandler(a.patService)
+}
+
+func (a *App) PATHandler() *pat.Handler {
+	return a.patHandler
+}
+
+func (a *App) initTwoFactor() {
+	logger := a.deps.Logger.With("module", "twofactor")
+	repo := twofactor.NewRepository(a.deps.DBConn)
+	a.twoFactorService = twofactor.NewService(repo, database.NewTxProvider(a.deps.DBConn), a.deps.Config.TOTPIssuer, logger)
+}
+
+func (a *App) TwoFactorHandler() *twofactor.Handler {
+	return a.twoFactorHandler
+}
+
+func (a *App) initIdentity() error {
+	logger := a.deps.Logger.With("module", "identity")
+	cfg := a.deps.Config.OIDCConfig
+
+	providers := make(map[string]*oidc.Provider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		if p.Name == "" || p.Issuer == "" || p.ClientID == "" {
+			return fmt.Errorf("oidc provider %q: name, issuer and client_id are required", p.Name)
+		}
+		if _, exists := providers[p.Name]; exists {
+			return fmt.Errorf("oidc provider %q is configured twice", p.Name)
+		}
+		providers[p.Name] = oidc.NewProvider(oidc.Config{
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  strings.TrimSuffix(cfg.APIBaseURL, "/") + "/auth/oidc/" + p.Name + "/callback",
+			Scopes:       p.Scopes,
+		}, nil)
+	}
+
+	repo := identity.NewRepository(a.deps.DBConn)
+	a.identityService = identity.NewService(repo, a.userService, a.securityService, providers, logger)
+	a.identityHandler = identity.NewHandler(a.identityService, a.authService, a.twoFactorService, a.cookies, cfg.OIDCCompleteURL, logger)
+	return nil
+}
+
+func (a *App) IdentityHandler() *identity.Handler {
+	return a.identityHandler
+}
+
+func (a *App) initOAuth() {
+	logger := a.deps.Logger.With("module", "oauth")
+	cfg := a.deps.Config
+
+	repo := oauth.NewRepository(a.deps.DBConn)
+	a.oauthService = oauth.NewService(repo, database.NewTxProvider(a.deps.DBConn), a.authService, a.userService, logger)
+	metadata := oauth.NewServerMetadata(cfg.JWTIssuer, strings.TrimSuffix(cfg.APIBaseURL, "/"), cfg.OAuthAuthorizeURL)
+	a.oauthHandler = oauth.NewHandler(a.oauthService, metadata, logger)
+}
+
+func (a *App) OAuthHandler() *oauth.Handler {
+	return a.oauthHandler
+}
+
+func (a *App) initAdmin() {
+	logger := a.deps.Logger.With("module", "admin")
+	adminService := admin.NewService(a.userService, a.authService, a.auditService, logger)
+	a.adminHandler = admin.NewHandler(adminService)
+}
+
+func (a *App) AdminHandler() *admin.Handler {
+	return a.adminHandler
+}
+
+func (a *App) initExport() {
+	logger := a.deps.Logger.With("module", "export")
+	cfg := a.deps.Config
+
+	secret := []byte(cfg.DataExportSigningSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, _ = rand.Read(secret)
+		logger.Warn("DATA_EXPORT_SIGNING_SECRET is not set, export download links will not work across replicas or restarts")
+	}
+
+	repo := export.NewRepository(a.deps.DBConn)
+	a.exportService = export.NewService(repo, a.emailService, secret, cfg.DataExportTTL, strings.TrimSuffix(cfg.APIBaseURL, "/"), logger)
+	a.exportHandler = export.NewHandler(a.exportService)
+}
+
+func (a *App) ExportHandler() *export.Handler {
+	return a.exportHandler
+}
+
 func (a *App) initWorkout() {
-	// workoutRepo := workout.NewRepository(a.deps.DBConn)
-	// workoutService needs userService - it's already initialized
-	// a.workoutService = workout.NewService(workoutRepo, a.userService)
+	templateRepo := template.NewRepository(a.deps.DBConn)
+	sessionRepo := session.NewRepository(a.deps.DBConn)
+	a.workoutService = workout.NewService(templateRepo, sessionRepo, database.NewTxProvider(a.deps.DBConn), a.userService, a.challenges)
+	a.workoutHandler = workout.NewHandler(a.workoutService)
+}
+
+func (a *App) initChallenge() {
+	repo := challenge.NewRepository(a.deps.DBConn)
+	a.challenges = challenge.NewService(repo, a.userService, a.profileService, a.deps.Logger.With("module", "challenge"))
+	a.challengeHandler = challenge.NewHandler(a.challenges)
+}
+
+func (a *App) ChallengeHandler() *challenge.Handler {
+	return a.challengeHandler
 }
 
-/*
 func (a *App) WorkoutHandler() *workout.Handler {
-	return workout.NewHandler(a.workoutService, a.authService)
+	return a.workoutHandler
+}
+
+func (a *App) initProfile() {
+	logger := a.deps.Logger.With("module", "profile")
+	repo := profile.NewRepository(a.deps.DBConn)
+	sessionRepo := session.NewRepository(a.deps.DBConn)
+	// the follow repository has no dependencies, the follow service needs profiles to approve follows
+	a.profileService = profile.NewService(repo, a.userService, sessionRepo, follow.NewRepository(a.deps.DBConn), a.auditService, logger)
+	a.profileHandler = profile.NewHandler(a.profileService)
+}
+
+func (a *App) ProfileHandler() *profile.Handler {
+	return a.profileHandler
+}
+
+func (a *App) initFollow() {
+	repo := follow.NewRepository(a.deps.DBConn)
+	a.followService = follow.NewService(repo, a.userService, a.profileService, session.NewRepository(a.deps.DBConn))
+	a.followHandler = follow.NewHandler(a.followService)
+}
+
+func (a *App) FollowHandler() *follow.Handler {
+	return a.followHandler
+}
+
+func (a *App) initSocial() {
+	a.notifications = notification.NewService(notification.NewRepository(a.deps.DBConn), a.deps.Logger.With("module", "notification"))
+	a.notificationHandler = notification.NewHandler(a.notifications)
+	a.socialService = social.NewService(social.NewRepository(a.deps.DBConn), session.NewRepository(a.deps.DBConn), a.profileService, a.notifications)
+	a.socialHandler = social.NewHandler(a.socialService)
+}
+
+func (a *App) NotificationHandler() *notification.Handler {
+	return a.notificationHandler
+}
+
+func (a *App) SocialHandler() *social.Handler {
+	return a.socialHandler
+}
+
+func (a *App) DeviceHandler() *device.Handler {
+	return a.deviceHandler
+}
+
+func (a *App) SecurityHandler() *security.Handler {
+	return a.securityHandler
+}
+
+func (a *App) AuditHandler() *audit.Handler {
+	return a.auditHandler
 }
-*/
 
 func (a *App) AuthMiddleware() *middleware.Auth {
 	return a.authMiddleware
 }
 
+func (a *App) RateLimiter() *middleware.RateLimiter {
+	return a.rateLimiter
+}
+
 func (a *App) Logger() *slog.Logger {
 	return a.deps.Logger
 }
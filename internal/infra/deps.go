@@ -1,6 +1,7 @@
 package infra
 
 import (
+	"context"
 	"fmt"
 	"github.com/Uranury/WorkoutTracker/pkg/config"
 	"github.com/Uranury/WorkoutTracker/pkg/database"
@@ -38,13 +39,7 @@ func NewDeps() (*Deps, func(), error) {
 		return nil, nil, err
 	}
 
-	//rdb := redis.NewClient(&redis.Options{
-	//	Addr: cfg.RedisAddr,
-	//})
-
-	//if err := rdb.Ping(context.Background()).Err(); err != nil {
-	//	logger.Warn("Could not connect to redis", "error", err)
-	//}
+	rdb := connectRedis(cfg.RedisAddr, logger)
 
 	httpClient := &http.Client{
 		Timeout: time.Second * 20,
@@ -54,6 +49,7 @@ func NewDeps() (*Deps, func(), error) {
 
 	deps := &Deps{
 		DBConn:       dbConn,
+		RedisClient:  rdb,
 		HTTPClient:   httpClient,
 		ResendClient: resendClient,
 		Logger:       logger,
@@ -64,8 +60,36 @@ func NewDeps() (*Deps, func(), error) {
 		if err := dbConn.Close(); err != nil {
 			logger.Error("Failed to close database connection", "error", err)
 		}
+		if rdb != nil {
+			if err := rdb.Close(); err != nil {
+				logger.Error("Failed to close redis connection", "error", err)
+			}
+		}
 		logger.Info("Infrastructure cleaned up")
 	}
 
 	return deps, cleanup, nil
 }
+
+// connectRedis returns nil when Redis is not configured or unreachable; callers fall back to in-memory implementations
+func connectRedis(addr string, logger *slog.Logger) *redis.Client {
+	if addr == "" {
+		logger.Info("Redis is not configured, using in-memory fallbacks")
+		return nil
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		logger.Warn("Could not connect to redis, using in-memory fallbacks", "error", err)
+		_ = rdb.Close()
+		return nil
+	}
+
+	logger.Info("Redis connection established successfully")
+	return rdb
+}
@@ -0,0 +1,163 @@
+package infra
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"github.com/Uranury/WorkoutTracker/pkg/scheduler"
+	"log/slog"
+	"time"
+)
+
+// dataExportBatchSize caps the archives built per run, so one run does not hold the job lock for long
+const dataExportBatchSize = 10
+
+func (a *App) initJobs() error {
+	logger := a.deps.Logger.With("module", "scheduler")
+	locker := database.NewAdvisoryLocker(a.deps.DBConn, "workout_tracker_jobs")
+	a.scheduler = scheduler.New(locker, database.NewJobRunLog(a.deps.DBConn), logger)
+
+	cfg := a.deps.Config.JobsConfig
+	if !cfg.JobsEnabled {
+		logger.Info("Background jobs are disabled")
+		return nil
+	}
+
+	jobs := []scheduler.Job{
+		{
+			Name:     "purge_refresh_tokens",
+			Interval: cfg.TokenPurgeInterval,
+			Run: func(ctx context.Context, logger *slog.Logger) error {
+				deleted, err := a.authService.PurgeRefreshTokens(ctx, time.Now().Add(-cfg.RevokedTokenRetention))
+				if err != nil {
+					return err
+				}
+				logger.Info("Purged refresh tokens", "deleted", deleted)
+				return nil
+			},
+		},
+		{
+			Name:     "purge_oidc_auth_requests",
+			Interval: cfg.TokenPurgeInterval,
+			Run: func(ctx context.Context, logger *slog.Logger) error {
+				deleted, err := a.identityService.PurgeExpiredRequests(ctx)
+				if err != nil {
+					return err
+				}
+				logger.Info("Purged expired oidc auth requests", "deleted", deleted)
+				return nil
+			},
+		},
+		{
+			Name:     "purge_oauth_grants",
+			Interval: cfg.TokenPurgeInterval,
+			Run: func(ctx context.Context, logger *slog.Logger) error {
+				deleted, err := a.oauthService.PurgeExpired(ctx, time.Now().Add(-cfg.RevokedTokenRetention))
+				if err != nil {
+					return err
+				}
+				logger.Info("Purged oauth grants", "deleted", deleted)
+				return nil
+			},
+		},
+		{
+			Name:     "purge_device_report_tokens",
+			Interval: cfg.TokenPurgeInterval,
+			Run: func(ctx context.Context, logger *slog.Logger) error {
+				deleted, err := a.deviceService.PurgeExpired(ctx, time.Now().Add(-cfg.RevokedTokenRetention))
+				if err != nil {
+					return err
+				}
+				logger.Info("Purged device report tokens", "deleted", deleted)
+				return nil
+			},
+		},
+		{
+			Name:     "purge_security_events",
+			Interval: cfg.SecurityEventInterval,
+			Run: func(ctx context.Context, logger *slog.Logger) error {
+				deleted, err := a.securityService.Purge(ctx, time.Now().Add(-cfg.SecurityEventRetention))
+				if err != nil {
+					return err
+				}
+				logger.Info("Purged security events", "deleted", deleted)
+				return nil
+			},
+		},
+		{
+			Name:     "build_data_exports",
+			Interval: cfg.DataExportInterval,
+			Run: func(ctx context.Context, logger *slog.Logger) error {
+				processed, err := a.exportService.ProcessPending(ctx, dataExportBatchSize)
+				if err != nil {
+					return err
+				}
+				if processed > 0 {
+					logger.Info("Built data exports", "processed", processed)
+				}
+				return nil
+			},
+		},
+		{
+			Name:     "purge_data_exports",
+			Interval: cfg.TokenPurgeInterval,
+			Run: func(ctx context.Context, logger *slog.Logger) error {
+				deleted, err := a.exportService.PurgeExpired(ctx, time.Now())
+				if err != nil {
+					return err
+				}
+				logger.Info("Purged data exports", "deleted", deleted)
+				return nil
+			},
+		},
+		{
+			Name:     "delete_scheduled_accounts",
+			Interval: cfg.AccountDeletionInterval,
+			Run: func(ctx context.Context, logger *slog.Logger) error {
+				deleted, err := a.userService.PurgeDeletedAccounts(ctx, time.Now())
+				if err != nil {
+					return err
+				}
+				logger.Info("Deleted scheduled accounts", "deleted", deleted)
+				return nil
+			},
+		},
+		{
+			Name:     "close_stale_sessions",
+			Interval: cfg.StaleSessionInterval,
+			Run: func(ctx context.Context, logger *slog.Logger) error {
+				closed, err := a.workoutService.CloseStaleSessions(ctx, time.Now().Add(-cfg.StaleSessionAfter))
+				if err != nil {
+					return err
+				}
+				logger.Info("Closed stale sessions", "closed", closed)
+				return nil
+			},
+		},
+		{
+			Name:     "reconcile_challenge_scores",
+			Interval: cfg.ChallengeScoreInterval,
+			Run: func(ctx context.Context, logger *slog.Logger) error {
+				updated, err := a.challenges.Reconcile(ctx, time.Now())
+				if err != nil {
+					return err
+				}
+				if updated > 0 {
+					logger.Info("Reconciled challenge scores", "updated", updated)
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, job := range jobs {
+		job.Jitter = cfg.JobsJitter
+		if err := a.scheduler.Register(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *App) Scheduler() *scheduler.Scheduler {
+	return a.scheduler
+}
@@ -0,0 +1,21 @@
+package infra
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/security"
+)
+
+// sessionEvents adapts security.Service to auth.EventRecorder
+type sessionEvents struct {
+	events security.Service
+}
+
+func (r sessionEvents) RecordSessionEvent(ctx context.Context, userID int64, event auth.SessionEvent, success bool, details map[string]any) {
+	r.events.Record(ctx, security.Event{
+		UserID:  userID,
+		Type:    security.EventType(event),
+		Success: success,
+		Details: details,
+	})
+}
@@ -0,0 +1,23 @@
+package infra
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+)
+
+// twoFactorAccounts adapts user.Service to twofactor.Accounts
+type twoFactorAccounts struct {
+	users user.Service
+}
+
+func (a twoFactorAccounts) AccountName(ctx context.Context, userID int64) (string, error) {
+	u, err := a.users.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return u.Username, nil
+}
+
+func (a twoFactorAccounts) VerifyPassword(ctx context.Context, userID int64, password string) error {
+	return a.users.VerifyPassword(ctx, userID, password)
+}
@@ -1,25 +1,44 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"github.com/Uranury/WorkoutTracker/internal/auth"
 	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
 	"github.com/gin-gonic/gin"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 )
 
+// TokenAuthenticator resolves opaque bearer tokens, such as personal access tokens, that are not JWTs
+type TokenAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (*auth.Principal, error)
+}
+
 type Auth struct {
 	authService auth.Service
+	tokens      TokenAuthenticator
+	tokenPrefix string
+	failOpen    bool
+	logger      *slog.Logger
 }
 
-func NewAuth(authService auth.Service) *Auth {
-	return &Auth{authService: authService}
+// NewAuth accepts bearer tokens starting with tokenPrefix through tokens, everything else must be a JWT.
+// JWTs are rejected with 503 while revocations cannot be checked, unless failOpen is set.
+func NewAuth(authService auth.Service, tokens TokenAuthenticator, tokenPrefix string, failOpen bool, logger *slog.Logger) *Auth {
+	return &Auth{authService: authService, tokens: tokens, tokenPrefix: tokenPrefix, failOpen: failOpen, logger: logger}
 }
 
 type contextKey string
 
-const UserIDKey contextKey = "user_id"
+const (
+	UserIDKey contextKey = "user_id"
+	RoleKey   contextKey = "role"
+	// ScopesKey is only set for scoped credentials, its absence means full access
+	ScopesKey contextKey = "scopes"
+)
 
 func (m *Auth) JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -30,14 +49,94 @@ func (m *Auth) JWTAuth() gin.HandlerFunc {
 			return
 		}
 		tokenString := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+		if m.tokens != nil && strings.HasPrefix(tokenString, m.tokenPrefix) {
+			principal, err := m.tokens.Authenticate(c.Request.Context(), tokenString)
+			if err != nil {
+				apperrors.GenHTTPError(c, http.StatusUnauthorized, "invalid token", nil)
+				c.Abort()
+				return
+			}
+
+			c.Set(UserIDKey, principal.UserID)
+			c.Set(RoleKey, principal.Role)
+			c.Set(ScopesKey, principal.Scopes)
+			c.Next()
+			return
+		}
+
 		claims, err := m.authService.ValidateToken(tokenString)
 		if err != nil {
 			apperrors.GenHTTPError(c, http.StatusUnauthorized, "invalid token", nil)
 			c.Abort()
 			return
 		}
+		revoked, err := m.authService.IsRevoked(c.Request.Context(), claims)
+		if err != nil {
+			if !m.failOpen {
+				m.logger.Error("Token revocation check unavailable, rejecting request", "user_id", claims.UserID, "error", err)
+				apperrors.GenHTTPError(c, http.StatusServiceUnavailable, "authentication is temporarily unavailable", nil)
+				c.Abort()
+				return
+			}
+			m.logger.Error("Token revocation check unavailable, allowing request", "user_id", claims.UserID, "error", err)
+		}
+		if revoked {
+			apperrors.GenHTTPError(c, http.StatusUnauthorized, "token has been revoked", nil)
+			c.Abort()
+			return
+		}
 
 		c.Set(UserIDKey, claims.UserID)
+		c.Set(RoleKey, claims.Role)
+		if claims.ClientID != "" {
+			c.Set(ScopesKey, claims.Scopes())
+		}
+		c.Next()
+	}
+}
+
+// RequireRole must run after JWTAuth. It rejects requests whose role is not in roles with 403.
+func (m *Auth) RequireRole(roles ...auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := GetRole(c)
+		if err != nil {
+			apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+			c.Abort()
+			return
+		}
+
+		if !slices.Contains(roles, role) {
+			apperrors.GenHTTPError(c, http.StatusForbidden, "insufficient permissions", nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope must run after JWTAuth. Scoped credentials without scope are rejected with 403,
+// interactive sessions pass.
+func (m *Auth) RequireScope(scope auth.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, scoped := GetScopes(c)
+		if scoped && !slices.Contains(scopes, scope) {
+			apperrors.GenHTTPError(c, http.StatusForbidden, "token lacks required scope", map[string]any{"scope": scope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession must run after JWTAuth. It keeps scoped credentials away from account management
+// so a leaked token cannot mint new credentials or change security settings.
+func (m *Auth) RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, scoped := GetScopes(c); scoped {
+			apperrors.GenHTTPError(c, http.StatusForbidden, "this endpoint requires an interactive session", nil)
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -55,3 +154,29 @@ func GetUserID(c *gin.Context) (int64, error) {
 
 	return id, nil
 }
+
+func GetRole(c *gin.Context) (auth.Role, error) {
+	role, exists := c.Get(RoleKey)
+	if !exists {
+		return "", errors.New("role not found in context")
+	}
+
+	r, ok := role.(auth.Role)
+	if !ok {
+		return "", errors.New("role has invalid type")
+	}
+
+	return r, nil
+}
+
+// GetScopes returns the scopes of the credential and whether the credential is scoped at all
+func GetScopes(c *gin.Context) ([]auth.Scope, bool) {
+	scopes, exists := c.Get(ScopesKey)
+	if !exists {
+		return nil, false
+	}
+
+	// a value of unexpected type still marks the credential as scoped, granting nothing
+	s, _ := scopes.([]auth.Scope)
+	return s, true
+}
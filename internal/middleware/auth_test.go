@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// unreachableRevocations fails every lookup like a revocation store that lost its Redis connection
+type unreachableRevocations struct {
+	auth.RevocationStore
+}
+
+func (unreachableRevocations) IsTokenRevoked(context.Context, string) (bool, error) {
+	return false, errors.New("redis: connection refused")
+}
+
+func (unreachableRevocations) Watermark(context.Context, int64) (time.Time, error) {
+	return time.Time{}, errors.New("redis: connection refused")
+}
+
+func newTestAuthService(t *testing.T, revocations auth.RevocationStore) auth.Service {
+	t.Helper()
+	keys, err := auth.LoadKeySet("", nil, "test-secret")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	return auth.NewAuth(keys, "test", nil, nil, nil, revocations, ratelimit.NewMemoryCounter(), nil, nil)
+}
+
+func newAuthRouter(authService auth.Service, tokens TokenAuthenticator, failOpen bool) *gin.Engine {
+	m := NewAuth(authService, tokens, "wt_pat_", failOpen, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router := gin.New()
+	router.GET("/me", m.JWTAuth(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	return router
+}
+
+func getWithToken(router *gin.Engine, path, token string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestJWTAuthRejectsRevokedTokens(t *testing.T) {
+	ctx := context.Background()
+	authService := newTestAuthService(t, auth.NewMemoryRevocationStore())
+	router := newAuthRouter(authService, nil, false)
+
+	token, err := authService.GenerateToken(7, auth.RoleUser)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if code := getWithToken(router, "/me", token); code != http.StatusNoContent {
+		t.Fatalf("valid token: status = %d, want 204", code)
+	}
+
+	claims, err := authService.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if err := authService.RevokeAccessToken(ctx, claims); err != nil {
+		t.Fatalf("RevokeAccessToken: %v", err)
+	}
+	if code := getWithToken(router, "/me", token); code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: status = %d, want 401", code)
+	}
+	if code := getWithToken(router, "/me", ""); code != http.StatusUnauthorized {
+		t.Fatalf("no token: status = %d, want 401", code)
+	}
+}
+
+func TestJWTAuthFailsClosedWhenRevocationsAreUnavailable(t *testing.T) {
+	authService := newTestAuthService(t, unreachableRevocations{})
+	token, err := authService.GenerateToken(7, auth.RoleUser)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	if code := getWithToken(newAuthRouter(authService, nil, false), "/me", token); code != http.StatusServiceUnavailable {
+		t.Fatalf("default: status = %d, want 503", code)
+	}
+	if code := getWithToken(newAuthRouter(authService, nil, true), "/me", token); code != http.StatusNoContent {
+		t.Fatalf("fail open: status = %d, want 204", code)
+	}
+}
+
+// fakeTokens authenticates personal access tokens by their exact value
+type fakeTokens map[string]*auth.Principal
+
+func (f fakeTokens) Authenticate(_ context.Context, token string) (*auth.Principal, error) {
+	principal, ok := f[token]
+	if !ok {
+		return nil, errors.New("invalid personal access token")
+	}
+	return principal, nil
+}
+
+func sendWithToken(router *gin.Engine, method, path, token string) int {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRequireScope(t *testing.T) {
+	authService := newTestAuthService(t, auth.NewMemoryRevocationStore())
+	tokens := fakeTokens{
+		"wt_pat_reader":  {UserID: 7, Role: auth.RoleUser, Scopes: []auth.Scope{auth.ScopeProfileRead}},
+		"wt_pat_writer":  {UserID: 7, Role: auth.RoleUser, Scopes: []auth.Scope{auth.ScopeProfileRead, auth.ScopeProfileWrite}},
+		"wt_pat_workout": {UserID: 7, Role: auth.RoleUser, Scopes: []auth.Scope{auth.ScopeSessionsRead}},
+		"wt_pat_none":    {UserID: 7, Role: auth.RoleUser, Scopes: []auth.Scope{}},
+	}
+	m := NewAuth(authService, tokens, "wt_pat_", false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+
+	// the same guards the /users/me routes use
+	router := gin.New()
+	users := router.Group("/users", m.JWTAuth())
+	users.GET("/me", m.RequireScope(auth.ScopeProfileRead), ok)
+	users.PATCH("/me", m.RequireScope(auth.ScopeProfileWrite), ok)
+	users.POST("/me/tokens", m.RequireSession(), ok)
+
+	session, err := authService.GenerateToken(7, auth.RoleUser)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"read scope reads", http.MethodGet, "/users/me", "wt_pat_reader", http.StatusNoContent},
+		{"read scope can't write", http.MethodPatch, "/users/me", "wt_pat_reader", http.StatusForbidden},
+		{"write scope writes", http.MethodPatch, "/users/me", "wt_pat_writer", http.StatusNoContent},
+		{"other scope can't read", http.MethodGet, "/users/me", "wt_pat_workout", http.StatusForbidden},
+		{"no scopes can't read", http.MethodGet, "/users/me", "wt_pat_none", http.StatusForbidden},
+		{"unknown token", http.MethodGet, "/users/me", "wt_pat_unknown", http.StatusUnauthorized},
+		{"scoped token can't mint tokens", http.MethodPost, "/users/me/tokens", "wt_pat_writer", http.StatusForbidden},
+		{"session reads", http.MethodGet, "/users/me", session, http.StatusNoContent},
+		{"session writes", http.MethodPatch, "/users/me", session, http.StatusNoContent},
+		{"session mints tokens", http.MethodPost, "/users/me/tokens", session, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := sendWithToken(router, tt.method, tt.path, tt.token); code != tt.want {
+				t.Fatalf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireScopeOnDelegatedClientTokens(t *testing.T) {
+	authService := newTestAuthService(t, auth.NewMemoryRevocationStore())
+	m := NewAuth(authService, nil, "wt_pat_", false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	router := gin.New()
+	router.GET("/users/me", m.JWTAuth(), m.RequireScope(auth.ScopeProfileRead), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	reader, err := authService.GenerateClientToken(7, auth.RoleUser, "client", []auth.Scope{auth.ScopeProfileRead})
+	if err != nil {
+		t.Fatalf("GenerateClientToken: %v", err)
+	}
+	other, err := authService.GenerateClientToken(7, auth.RoleUser, "client", []auth.Scope{auth.ScopeSessionsRead})
+	if err != nil {
+		t.Fatalf("GenerateClientToken: %v", err)
+	}
+	if code := getWithToken(router, "/users/me", reader); code != http.StatusNoContent {
+		t.Fatalf("client token with profile:read: status = %d, want 204", code)
+	}
+	if code := getWithToken(router, "/users/me", other); code != http.StatusForbidden {
+		t.Fatalf("client token without profile:read: status = %d, want 403", code)
+	}
+}
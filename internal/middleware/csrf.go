@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/cookie"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// CSRF protects endpoints authenticated by the refresh token cookie with a double-submit check: the
+// X-CSRF-Token header must match the csrf_token cookie, which other sites can neither read nor set.
+// Requests without the refresh token cookie carry no ambient credentials and pass.
+func CSRF(enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !enabled {
+			c.Next()
+			return
+		}
+		if _, err := c.Cookie(cookie.RefreshToken); err != nil {
+			c.Next()
+			return
+		}
+
+		expected, _ := c.Cookie(cookie.CSRFToken)
+		provided := c.GetHeader(cookie.CSRFHeader)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(provided)) != 1 {
+			apperrors.GenHTTPError(c, http.StatusForbidden, "missing or invalid csrf token", nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"github.com/Uranury/WorkoutTracker/pkg/cookie"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newCSRFRouter guards /auth/logout and /auth/refresh like the real routes and issues tokens on /auth/csrf
+func newCSRFRouter(enabled bool) *gin.Engine {
+	jar := cookie.NewJar(cookie.Settings{})
+	csrf := CSRF(enabled)
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+
+	router := gin.New()
+	router.GET("/auth/csrf", func(c *gin.Context) {
+		if _, err := jar.SetCSRF(c.Writer, time.Hour); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	router.POST("/auth/logout", csrf, ok)
+	router.POST("/auth/refresh", csrf, ok)
+	return router
+}
+
+type csrfRequest struct {
+	refresh bool
+	cookie  string
+	header  string
+}
+
+func postWithCSRF(router *gin.Engine, path string, r csrfRequest) int {
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	if r.refresh {
+		req.AddCookie(&http.Cookie{Name: cookie.RefreshToken, Value: "refresh"})
+	}
+	if r.cookie != "" {
+		req.AddCookie(&http.Cookie{Name: cookie.CSRFToken, Value: r.cookie})
+	}
+	if r.header != "" {
+		req.Header.Set(cookie.CSRFHeader, r.header)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestCSRF(t *testing.T) {
+	router := newCSRFRouter(true)
+
+	tests := []struct {
+		name string
+		req  csrfRequest
+		want int
+	}{
+		{"no refresh cookie", csrfRequest{}, http.StatusNoContent},
+		{"missing token", csrfRequest{refresh: true}, http.StatusForbidden},
+		{"missing header", csrfRequest{refresh: true, cookie: "token"}, http.StatusForbidden},
+		{"missing cookie", csrfRequest{refresh: true, header: "token"}, http.StatusForbidden},
+		{"mismatched token", csrfRequest{refresh: true, cookie: "token", header: "other"}, http.StatusForbidden},
+		{"matching token", csrfRequest{refresh: true, cookie: "token", header: "token"}, http.StatusNoContent},
+	}
+	for _, path := range []string{"/auth/logout", "/auth/refresh"} {
+		for _, tt := range tests {
+			t.Run(path+" "+tt.name, func(t *testing.T) {
+				if code := postWithCSRF(router, path, tt.req); code != tt.want {
+					t.Fatalf("status = %d, want %d", code, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestCSRFAcceptsIssuedToken(t *testing.T) {
+	router := newCSRFRouter(true)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/csrf", nil))
+	var issued string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == cookie.CSRFToken {
+			issued = c.Value
+		}
+	}
+	if issued == "" || w.Header().Get(cookie.CSRFHeader) != issued {
+		t.Fatalf("issued cookie %q and header %q, want the same token in both", issued, w.Header().Get(cookie.CSRFHeader))
+	}
+
+	if code := postWithCSRF(router, "/auth/refresh", csrfRequest{refresh: true, cookie: issued, header: issued}); code != http.StatusNoContent {
+		t.Fatalf("issued token: status = %d, want 204", code)
+	}
+}
+
+func TestCSRFDisabled(t *testing.T) {
+	router := newCSRFRouter(false)
+	if code := postWithCSRF(router, "/auth/logout", csrfRequest{refresh: true}); code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204 when the check is disabled", code)
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// KeyFunc derives the rate limit bucket of a request
+type KeyFunc func(c *gin.Context) string
+
+// RatePolicy allows Limit requests per Window for each key produced by Key
+type RatePolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    KeyFunc
+}
+
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByUser must run after JWTAuth; unauthenticated requests fall back to the client IP
+func KeyByUser(c *gin.Context) string {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return KeyByIP(c)
+	}
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+func KeyByIPAndUser(c *gin.Context) string {
+	return KeyByIP(c) + ":" + KeyByUser(c)
+}
+
+type RateLimiter struct {
+	limiter ratelimit.Limiter
+	logger  *slog.Logger
+}
+
+func NewRateLimiter(limiter ratelimit.Limiter, logger *slog.Logger) *RateLimiter {
+	return &RateLimiter{limiter: limiter, logger: logger}
+}
+
+// Limit enforces policy and sets RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers and their X- variants.
+// Rejected requests get 429 with Retry-After. Limiter failures fail open so a Redis outage doesn't take the API down.
+func (m *RateLimiter) Limit(policy RatePolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := policy.Name + ":" + policy.Key(c)
+		result, err := m.limiter.Allow(c.Request.Context(), key, policy.Limit, policy.Window)
+		if err != nil {
+			m.logger.Error("Rate limiter unavailable, allowing request", "policy", policy.Name, "error", err)
+			c.Next()
+			return
+		}
+
+		limit, remaining, reset := strconv.Itoa(result.Limit), strconv.Itoa(result.Remaining), strconv.Itoa(ceilSeconds(result.ResetAfter))
+		c.Header("RateLimit-Limit", limit)
+		c.Header("RateLimit-Remaining", remaining)
+		c.Header("RateLimit-Reset", reset)
+		// X-RateLimit-* mirror them for clients that only know the older de facto names
+		c.Header("X-RateLimit-Limit", limit)
+		c.Header("X-RateLimit-Remaining", remaining)
+		c.Header("X-RateLimit-Reset", reset)
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			apperrors.GenHTTPError(c, http.StatusTooManyRequests, "too many requests", nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
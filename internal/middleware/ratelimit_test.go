@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, int, time.Duration) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("redis: connection refused")
+}
+
+func newLimitedRouter(limiter ratelimit.Limiter, policy RatePolicy, userID int64) *gin.Engine {
+	router := gin.New()
+	if userID != 0 {
+		router.Use(func(c *gin.Context) { c.Set(UserIDKey, userID) })
+	}
+	rl := NewRateLimiter(limiter, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router.GET("/limited", rl.Limit(policy), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	return router
+}
+
+func get(router *gin.Engine, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+	req.RemoteAddr = ip + ":40000"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitHeadersAndRejection(t *testing.T) {
+	policy := RatePolicy{Name: "login", Limit: 2, Window: time.Minute, Key: KeyByIP}
+	router := newLimitedRouter(ratelimit.NewMemoryLimiter(), policy, 0)
+
+	for i, remaining := range []string{"1", "0"} {
+		w := get(router, "10.0.0.1")
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status %d, want 204", i+1, w.Code)
+		}
+		for _, prefix := range []string{"", "X-"} {
+			if got := w.Header().Get(prefix + "RateLimit-Limit"); got != "2" {
+				t.Errorf("request %d: %sRateLimit-Limit = %q, want 2", i+1, prefix, got)
+			}
+			if got := w.Header().Get(prefix + "RateLimit-Remaining"); got != remaining {
+				t.Errorf("request %d: %sRateLimit-Remaining = %q, want %s", i+1, prefix, got, remaining)
+			}
+			if got := w.Header().Get(prefix + "RateLimit-Reset"); got != "60" {
+				t.Errorf("request %d: %sRateLimit-Reset = %q, want 60", i+1, prefix, got)
+			}
+		}
+		if got := w.Header().Get("Retry-After"); got != "" {
+			t.Errorf("request %d: Retry-After %q on an allowed request", i+1, got)
+		}
+	}
+
+	w := get(router, "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("3rd request: status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 0", got)
+	}
+
+	if w := get(router, "10.0.0.2"); w.Code != http.StatusNoContent {
+		t.Errorf("another IP: status %d, want 204", w.Code)
+	}
+}
+
+func TestRateLimitByUser(t *testing.T) {
+	policy := RatePolicy{Name: "api", Limit: 1, Window: time.Minute, Key: KeyByUser}
+	limiter := ratelimit.NewMemoryLimiter()
+	alice := newLimitedRouter(limiter, policy, 1)
+	bob := newLimitedRouter(limiter, policy, 2)
+
+	if w := get(alice, "10.0.0.1"); w.Code != http.StatusNoContent {
+		t.Fatalf("alice: status %d, want 204", w.Code)
+	}
+	// a new IP does not reset the budget of a user
+	if w := get(alice, "10.0.0.9"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("alice from another IP: status %d, want 429", w.Code)
+	}
+	if w := get(bob, "10.0.0.1"); w.Code != http.StatusNoContent {
+		t.Fatalf("bob behind the same IP: status %d, want 204", w.Code)
+	}
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	policy := RatePolicy{Name: "login", Limit: 1, Window: time.Minute, Key: KeyByIP}
+	router := newLimitedRouter(failingLimiter{}, policy, 0)
+
+	for i := 0; i < 3; i++ {
+		w := get(router, "10.0.0.1")
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status %d, want 204 while the limiter is down", i+1, w.Code)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "" {
+			t.Errorf("request %d: RateLimit-Limit %q without a limiter result", i+1, got)
+		}
+	}
+}
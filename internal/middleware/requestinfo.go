@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/Uranury/WorkoutTracker/pkg/requestinfo"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestInfo makes the request ID, client IP and user agent available to services through the request context.
+// A request ID sent by the client is kept when it is short and plain, otherwise a new one is generated.
+// Either way it is echoed in the X-Request-ID response header.
+func RequestInfo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestinfo.Header)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(requestinfo.Header, requestID)
+
+		ctx := requestinfo.With(c.Request.Context(), requestinfo.Info{
+			RequestID: requestID,
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '-' && r != '_' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,132 @@
+package notification
+
+import (
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const defaultPageSize = 20
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+type ListNotificationsQuery struct {
+	Unread   bool `form:"unread"`
+	Page     int  `form:"page" validate:"omitempty,gte=1"`
+	PageSize int  `form:"page_size" validate:"omitempty,gte=1,lte=100"`
+}
+
+type NotificationListResponse struct {
+	Notifications []Notification `json:"notifications"`
+	Total         int            `json:"total"`
+	Unread        int            `json:"unread"`
+	Page          int            `json:"page"`
+	PageSize      int            `json:"page_size"`
+}
+
+type MarkReadRequest struct {
+	// IDs to mark as read, every unread notification when empty
+	IDs []int64 `json:"ids" validate:"omitempty,max=100,dive,gt=0"`
+}
+
+type MarkReadResponse struct {
+	Marked int64 `json:"marked"`
+}
+
+// ListNotifications returns notifications of the current user
+// @Summary List notifications
+// @Description Returns reactions and comments on the user's sessions and replies to their comments, newest first
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Param unread query bool false "Only unread notifications"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} NotificationListResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/notifications [get]
+func (h *Handler) ListNotifications(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	query, ok := validation.BindAndValidateQuery[ListNotificationsQuery](c)
+	if !ok {
+		return
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	notifications, total, err := h.service.List(c.Request.Context(), userID, ListFilter{
+		UnreadOnly: query.Unread,
+		Limit:      query.PageSize,
+		Offset:     (query.Page - 1) * query.PageSize,
+	})
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to list notifications", nil)
+		return
+	}
+	unread, err := h.service.CountUnread(c.Request.Context(), userID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to list notifications", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, NotificationListResponse{
+		Notifications: notifications,
+		Total:         total,
+		Unread:        unread,
+		Page:          query.Page,
+		PageSize:      query.PageSize,
+	})
+}
+
+// MarkRead marks notifications as read
+// @Summary Mark notifications as read
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MarkReadRequest true "Notifications to mark, all when ids is empty"
+// @Success 200 {object} MarkReadResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/notifications/read [post]
+func (h *Handler) MarkRead(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	req, ok := validation.BindAndValidate[MarkReadRequest](c)
+	if !ok {
+		return
+	}
+
+	marked, err := h.service.MarkRead(c.Request.Context(), userID, req.IDs)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to mark notifications as read", nil)
+		return
+	}
+	c.JSON(http.StatusOK, MarkReadResponse{Marked: marked})
+}
@@ -0,0 +1,30 @@
+package notification
+
+import "time"
+
+type Type string
+
+const (
+	TypeSessionReaction Type = "session_reaction"
+	TypeSessionComment  Type = "session_comment"
+	TypeCommentReply    Type = "comment_reply"
+)
+
+// Notification tells a user that someone else interacted with their content. ActorUsername is only loaded for lists.
+type Notification struct {
+	ID            int64      `json:"id" db:"id"`
+	UserID        int64      `json:"-" db:"user_id"`
+	Type          Type       `json:"type" db:"type"`
+	ActorID       *int64     `json:"actor_id" db:"actor_id"`
+	ActorUsername *string    `json:"actor_username" db:"actor_username"`
+	SessionID     *int64     `json:"session_id" db:"session_id"`
+	CommentID     *int64     `json:"comment_id" db:"comment_id"`
+	ReadAt        *time.Time `json:"read_at" db:"read_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+type ListFilter struct {
+	UnreadOnly bool
+	Limit      int
+	Offset     int
+}
@@ -0,0 +1,71 @@
+package notification
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	Create(ctx context.Context, n *Notification) error
+	List(ctx context.Context, userID int64, filter ListFilter) ([]Notification, int, error)
+	CountUnread(ctx context.Context, userID int64) (int, error)
+	// MarkRead marks the given notifications of the user as read, all of them when ids is empty
+	MarkRead(ctx context.Context, userID int64, ids []int64) (int64, error)
+}
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) Create(ctx context.Context, n *Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, session_id, comment_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+	return r.executor.QueryRowxContext(ctx, query, n.UserID, n.ActorID, n.Type, n.SessionID, n.CommentID).Scan(&n.ID, &n.CreatedAt)
+}
+
+func (r *repository) List(ctx context.Context, userID int64, filter ListFilter) ([]Notification, int, error) {
+	where := "WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)"
+	args := []any{userID, filter.UnreadOnly}
+
+	var total int
+	if err := r.executor.GetContext(ctx, &total, "SELECT COUNT(*) FROM notifications n "+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	notifications := []Notification{}
+	query := `
+		SELECT n.id, n.user_id, n.type, n.actor_id, u.username AS actor_username, n.session_id, n.comment_id, n.read_at, n.created_at
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_id
+		` + where + `
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $3 OFFSET $4`
+	if err := r.executor.SelectContext(ctx, &notifications, query, append(args, filter.Limit, filter.Offset)...); err != nil {
+		return nil, 0, err
+	}
+	return notifications, total, nil
+}
+
+func (r *repository) CountUnread(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.executor.GetContext(ctx, &count, "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL", userID)
+	return count, err
+}
+
+func (r *repository) MarkRead(ctx context.Context, userID int64, ids []int64) (int64, error) {
+	query := `
+		UPDATE notifications SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL AND (cardinality($2::BIGINT[]) = 0 OR id = ANY($2))`
+	res, err := r.executor.ExecContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
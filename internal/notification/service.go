@@ -0,0 +1,45 @@
+package notification
+
+import (
+	"context"
+	"log/slog"
+)
+
+type Service interface {
+	// Notify stores a notification for n.UserID. It never fails the interaction that caused it,
+	// errors are logged and users are not notified about their own actions.
+	Notify(ctx context.Context, n Notification)
+	List(ctx context.Context, userID int64, filter ListFilter) ([]Notification, int, error)
+	CountUnread(ctx context.Context, userID int64) (int, error)
+	MarkRead(ctx context.Context, userID int64, ids []int64) (int64, error)
+}
+
+type service struct {
+	repo   Repository
+	logger *slog.Logger
+}
+
+func NewService(repo Repository, logger *slog.Logger) Service {
+	return &service{repo: repo, logger: logger}
+}
+
+func (s *service) Notify(ctx context.Context, n Notification) {
+	if n.ActorID != nil && *n.ActorID == n.UserID {
+		return
+	}
+	if err := s.repo.Create(ctx, &n); err != nil {
+		s.logger.Error("Failed to store notification", "user_id", n.UserID, "type", n.Type, "error", err)
+	}
+}
+
+func (s *service) List(ctx context.Context, userID int64, filter ListFilter) ([]Notification, int, error) {
+	return s.repo.List(ctx, userID, filter)
+}
+
+func (s *service) CountUnread(ctx context.Context, userID int64) (int, error) {
+	return s.repo.CountUnread(ctx, userID)
+}
+
+func (s *service) MarkRead(ctx context.Context, userID int64, ids []int64) (int64, error) {
+	return s.repo.MarkRead(ctx, userID, ids)
+}
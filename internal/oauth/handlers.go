@@ -0,0 +1,260 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+)
+
+type Handler struct {
+	service  Service
+	metadata ServerMetadata
+	logger   *slog.Logger
+}
+
+func NewHandler(service Service, metadata ServerMetadata, logger *slog.Logger) *Handler {
+	return &Handler{service: service, metadata: metadata, logger: logger}
+}
+
+type RegisterClientRequest struct {
+	Name         string   `json:"name" binding:"required" validate:"required,min=1,max=100"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required" validate:"required,min=1,max=10,dive,required,max=2000"`
+	Scopes       []string `json:"scopes" binding:"required" validate:"required,min=1,dive,required"`
+	// Confidential clients receive a secret; public clients such as mobile apps authenticate with PKCE only
+	Confidential bool `json:"confidential"`
+}
+
+type RegisterClientResponse struct {
+	Client       Client `json:"client"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type ClientIDPathParam struct {
+	ID string `uri:"id" binding:"required" validate:"required,max=64"`
+}
+
+type AuthorizeQuery struct {
+	ResponseType        string `form:"response_type" json:"response_type" validate:"required"`
+	ClientID            string `form:"client_id" json:"client_id" validate:"required,max=64"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri" validate:"required,max=2000"`
+	Scope               string `form:"scope" json:"scope" validate:"omitempty,max=500"`
+	State               string `form:"state" json:"state" validate:"omitempty,max=500"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge" validate:"omitempty,max=128"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method" validate:"omitempty,max=10"`
+}
+
+type AuthorizeDecisionRequest struct {
+	AuthorizeQuery
+	Approve bool `json:"approve"`
+}
+
+type AuthorizeResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+func (q AuthorizeQuery) toRequest() AuthorizeRequest {
+	return AuthorizeRequest{
+		ResponseType:        q.ResponseType,
+		ClientID:            q.ClientID,
+		RedirectURI:         q.RedirectURI,
+		Scope:               q.Scope,
+		State:               q.State,
+		CodeChallenge:       q.CodeChallenge,
+		CodeChallengeMethod: q.CodeChallengeMethod,
+	}
+}
+
+// RegisterClient registers a third-party application
+// @Summary Register OAuth client
+// @Description Registers an application owned by the current user, the client secret is only returned once
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body RegisterClientRequest true "Client metadata"
+// @Success 201 {object} RegisterClientResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/oauth/clients [post]
+func (h *Handler) RegisterClient(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	req, ok := validation.BindAndValidate[RegisterClientRequest](c)
+	if !ok {
+		return
+	}
+
+	client, secret, err := h.service.RegisterClient(c.Request.Context(), userID, RegisterClientInput{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+		Confidential: req.Confidential,
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidClientMetadata) {
+			apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to register client", nil)
+		return
+	}
+
+	c.JSON(http.StatusCreated, RegisterClientResponse{Client: *client, ClientSecret: secret})
+}
+
+// ListClients lists applications registered by the current user
+// @Summary List OAuth clients
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} Client
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/oauth/clients [get]
+func (h *Handler) ListClients(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	clients, err := h.service.ListClients(c.Request.Context(), userID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to list clients", nil)
+		return
+	}
+	c.JSON(http.StatusOK, clients)
+}
+
+// RevokeClient deletes an application and invalidates its refresh tokens
+// @Summary Revoke OAuth client
+// @Tags oauth
+// @Security BearerAuth
+// @Param id path string true "Client ID"
+// @Success 204
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/oauth/clients/{id} [delete]
+func (h *Handler) RevokeClient(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[ClientIDPathParam](c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RevokeClient(c.Request.Context(), userID, params.ID); err != nil {
+		if errors.Is(err, ErrClientNotFound) {
+			apperrors.GenHTTPError(c, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to revoke client", nil)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetConsent validates an authorization request for the consent screen
+// @Summary Describe an authorization request
+// @Description Called by the consent screen with the query parameters the client sent to the authorization endpoint.
+// @Description Errors that must be reported to the client carry details.redirect_to.
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string false "Space-delimited scopes"
+// @Param state query string false "Opaque client state"
+// @Param code_challenge query string true "PKCE challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 200 {object} Consent
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/oauth/authorize [get]
+func (h *Handler) GetConsent(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	query, ok := validation.BindAndValidateQuery[AuthorizeQuery](c)
+	if !ok {
+		return
+	}
+
+	consent, err := h.service.PrepareConsent(c.Request.Context(), userID, query.toRequest())
+	if err != nil {
+		h.respondAuthorizeError(c, query.toRequest(), err)
+		return
+	}
+	c.JSON(http.StatusOK, consent)
+}
+
+// Authorize records the user's consent decision
+// @Summary Approve or deny an authorization request
+// @Description Returns the client URL the user agent should be sent to, carrying either the code or an error
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body AuthorizeDecisionRequest true "Authorization request and decision"
+// @Success 200 {object} AuthorizeResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/oauth/authorize [post]
+func (h *Handler) Authorize(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	req, ok := validation.BindAndValidate[AuthorizeDecisionRequest](c)
+	if !ok {
+		return
+	}
+
+	redirectTo, err := h.service.Authorize(c.Request.Context(), userID, req.toRequest(), req.Approve)
+	if err != nil {
+		h.respondAuthorizeError(c, req.toRequest(), err)
+		return
+	}
+	c.JSON(http.StatusOK, AuthorizeResponse{RedirectTo: redirectTo})
+}
+
+func (h *Handler) respondAuthorizeError(c *gin.Context, req AuthorizeRequest, err error) {
+	var oauthErr *Error
+	switch {
+	case errors.Is(err, ErrUnknownClient), errors.Is(err, ErrInvalidRedirectURI):
+		// never redirect to an unverified URI
+		apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+	case errors.As(err, &oauthErr):
+		apperrors.GenHTTPError(c, http.StatusBadRequest, oauthErr.Error(), AuthorizeResponse{RedirectTo: ErrorRedirectURL(req, oauthErr)})
+	default:
+		h.logger.Error("Authorization request failed", "client_id", req.ClientID, "error", err)
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to process authorization request", nil)
+	}
+}
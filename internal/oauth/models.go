@@ -0,0 +1,130 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+var (
+	AuthorizationCodeTTL = time.Minute * 5
+	RefreshTokenTTL      = time.Hour * 24 * 30
+)
+
+var (
+	ErrUnknownClient         = errors.New("unknown or revoked client")
+	ErrInvalidRedirectURI    = errors.New("redirect_uri is not registered for this client")
+	ErrClientNotFound        = errors.New("client not found")
+	ErrInvalidClientMetadata = errors.New("invalid client metadata")
+)
+
+// ClientIDPrefix marks client IDs and keeps them distinguishable from other identifiers in logs
+const ClientIDPrefix = "wt_client_"
+
+type Client struct {
+	ID           string         `json:"client_id" db:"id"`
+	OwnerID      int64          `json:"owner_id" db:"owner_id"`
+	Name         string         `json:"name" db:"name"`
+	SecretHash   *string        `json:"-" db:"secret_hash"`
+	RedirectURIs pq.StringArray `json:"redirect_uris" db:"redirect_uris" swaggertype:"array,string"`
+	Scopes       pq.StringArray `json:"scopes" db:"scopes" swaggertype:"array,string"`
+	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
+	RevokedAt    *time.Time     `json:"-" db:"revoked_at"`
+}
+
+// Confidential clients can keep a secret, public clients (mobile, SPA) rely on PKCE alone
+func (c *Client) Confidential() bool {
+	return c.SecretHash != nil
+}
+
+type AuthorizationCode struct {
+	CodeHash      string         `db:"code_hash"`
+	ClientID      string         `db:"client_id"`
+	UserID        int64          `db:"user_id"`
+	RedirectURI   string         `db:"redirect_uri"`
+	Scopes        pq.StringArray `db:"scopes"`
+	CodeChallenge string         `db:"code_challenge"`
+	ExpiresAt     time.Time      `db:"expires_at"`
+	UsedAt        *time.Time     `db:"used_at"`
+	CreatedAt     time.Time      `db:"created_at"`
+}
+
+type RefreshToken struct {
+	ID        int64          `db:"id"`
+	TokenHash string         `db:"token_hash"`
+	ClientID  string         `db:"client_id"`
+	UserID    int64          `db:"user_id"`
+	Scopes    pq.StringArray `db:"scopes"`
+	ExpiresAt time.Time      `db:"expires_at"`
+	RevokedAt *time.Time     `db:"revoked_at"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+type RegisterClientInput struct {
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+	Confidential bool
+}
+
+// AuthorizeRequest holds the parameters of an authorization request (RFC 6749 4.1.1, RFC 7636 4.3)
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// Consent describes what the user is asked to approve
+type Consent struct {
+	Client          ClientInfo `json:"client"`
+	Scopes          []string   `json:"scopes"`
+	PreviouslyGiven bool       `json:"previously_given"`
+}
+
+type ClientInfo struct {
+	ID   string `json:"client_id"`
+	Name string `json:"name"`
+}
+
+// TokenResponse is the successful token endpoint response (RFC 6749 5.1)
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// Introspection is the token introspection response (RFC 7662 2.2)
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+}
+
+// Error is an OAuth2 error response (RFC 6749 5.2). Codes are defined by the spec.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	// status is the HTTP status used when the error is returned from the token endpoints
+	status int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+func newError(status int, code, description string) *Error {
+	return &Error{Code: code, Description: description, status: status}
+}
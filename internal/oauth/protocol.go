@@ -0,0 +1,198 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+)
+
+// ServerMetadata is published as RFC 8414 authorization server metadata
+type ServerMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// NewServerMetadata describes endpoints served under apiBaseURL; authorizeURL is the consent screen of the app
+func NewServerMetadata(issuer, apiBaseURL, authorizeURL string) ServerMetadata {
+	return ServerMetadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             authorizeURL,
+		TokenEndpoint:                     apiBaseURL + "/oauth/token",
+		RevocationEndpoint:                apiBaseURL + "/oauth/revoke",
+		IntrospectionEndpoint:             apiBaseURL + "/oauth/introspect",
+		JWKSURI:                           apiBaseURL + "/.well-known/jwks.json",
+		ScopesSupported:                   scopesToStrings(auth.Scopes),
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+	}
+}
+
+// Metadata returns authorization server metadata
+// @Summary OAuth authorization server metadata
+// @Description RFC 8414 metadata for third-party clients
+// @Tags oauth
+// @Produce json
+// @Success 200 {object} ServerMetadata
+// @Router /.well-known/oauth-authorization-server [get]
+func (h *Handler) Metadata(c *gin.Context) {
+	c.JSON(http.StatusOK, h.metadata)
+}
+
+// Token issues tokens to clients
+// @Summary OAuth token endpoint
+// @Description Exchanges an authorization code (with PKCE verifier) or a refresh token for an access token.
+// @Description Clients authenticate with HTTP Basic or client_id/client_secret form fields, public clients send client_id only.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code or refresh_token"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI used in the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Narrower scope on refresh"
+// @Param client_id formData string false "Client ID"
+// @Param client_secret formData string false "Client secret"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} Error
+// @Failure 401 {object} Error
+// @Router /oauth/token [post]
+func (h *Handler) Token(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	var response *TokenResponse
+	var err error
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		response, err = h.service.ExchangeCode(c.Request.Context(), client, c.PostForm("code"), c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+	case "refresh_token":
+		response, err = h.service.Refresh(c.Request.Context(), client, c.PostForm("refresh_token"), c.PostForm("scope"))
+	default:
+		h.respondError(c, newError(http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token"))
+		return
+	}
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+// Revoke revokes a token
+// @Summary OAuth token revocation
+// @Description RFC 7009. Revoking a refresh token ends the whole grant. Responds 200 for unknown tokens.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "Token to revoke"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Param client_id formData string false "Client ID"
+// @Param client_secret formData string false "Client secret"
+// @Success 200
+// @Failure 400 {object} Error
+// @Failure 401 {object} Error
+// @Router /oauth/revoke [post]
+func (h *Handler) Revoke(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		h.respondError(c, newError(http.StatusBadRequest, "invalid_request", "token is required"))
+		return
+	}
+
+	if err := h.service.Revoke(c.Request.Context(), client, token); err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// Introspect reports the state of a token
+// @Summary OAuth token introspection
+// @Description RFC 7662. Only tokens issued to the authenticated client are reported as active.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token to introspect"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Param client_id formData string false "Client ID"
+// @Param client_secret formData string false "Client secret"
+// @Success 200 {object} Introspection
+// @Failure 400 {object} Error
+// @Failure 401 {object} Error
+// @Router /oauth/introspect [post]
+func (h *Handler) Introspect(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		h.respondError(c, newError(http.StatusBadRequest, "invalid_request", "token is required"))
+		return
+	}
+
+	result, err := h.service.Introspect(c.Request.Context(), client, token)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, result)
+}
+
+// authenticateClient reads client credentials from HTTP Basic auth or the form body (RFC 6749 2.3.1)
+func (h *Handler) authenticateClient(c *gin.Context) (*Client, bool) {
+	clientID, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// credentials are form-encoded before being put in the header
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	client, err := h.service.AuthenticateClient(c.Request.Context(), clientID, secret)
+	if err != nil {
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		h.respondError(c, err)
+		return nil, false
+	}
+	return client, true
+}
+
+// respondError writes errors in the RFC 6749 format rather than apperrors.HTTPError, as clients expect
+func (h *Handler) respondError(c *gin.Context, err error) {
+	var oauthErr *Error
+	if errors.As(err, &oauthErr) {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(oauthErr.status, oauthErr)
+		return
+	}
+	h.logger.Error("OAuth request failed", "path", c.FullPath(), "error", err)
+	c.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, "server_error", "internal error"))
+}
@@ -0,0 +1,190 @@
+package oauth
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"github.com/lib/pq"
+	"time"
+)
+
+type Repository interface {
+	CreateClient(ctx context.Context, client *Client) error
+	GetClient(ctx context.Context, id string) (*Client, error)
+	ListClients(ctx context.Context, ownerID int64) ([]Client, error)
+	RevokeClient(ctx context.Context, ownerID int64, id string) (bool, error)
+
+	CreateCode(ctx context.Context, code *AuthorizationCode) error
+	// ConsumeCode marks the code used and returns it together with whether it had been used before
+	ConsumeCode(ctx context.Context, codeHash string) (*AuthorizationCode, bool, error)
+
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	FindRefreshTokenForUpdate(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	FindRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, id int64) error
+	RevokeGrant(ctx context.Context, userID int64, clientID string) error
+
+	GetConsent(ctx context.Context, userID int64, clientID string) ([]string, error)
+	SaveConsent(ctx context.Context, userID int64, clientID string, scopes []string) error
+
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) CreateClient(ctx context.Context, client *Client) error {
+	query := `
+		INSERT INTO oauth_clients (id, owner_id, name, secret_hash, redirect_uris, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`
+	return r.executor.QueryRowxContext(ctx, query,
+		client.ID, client.OwnerID, client.Name, client.SecretHash, client.RedirectURIs, client.Scopes,
+	).Scan(&client.CreatedAt)
+}
+
+func (r *repository) GetClient(ctx context.Context, id string) (*Client, error) {
+	var client Client
+	query := `SELECT * FROM oauth_clients WHERE id = $1 AND revoked_at IS NULL`
+	if err := r.executor.GetContext(ctx, &client, query, id); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *repository) ListClients(ctx context.Context, ownerID int64) ([]Client, error) {
+	clients := []Client{}
+	query := `SELECT * FROM oauth_clients WHERE owner_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`
+	err := r.executor.SelectContext(ctx, &clients, query, ownerID)
+	return clients, err
+}
+
+// RevokeClient disables the client and every refresh token issued to it
+func (r *repository) RevokeClient(ctx context.Context, ownerID int64, id string) (bool, error) {
+	query := `UPDATE oauth_clients SET revoked_at = NOW() WHERE id = $1 AND owner_id = $2 AND revoked_at IS NULL`
+	res, err := r.executor.ExecContext(ctx, query, id, ownerID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	query = `UPDATE oauth_refresh_tokens SET revoked_at = NOW() WHERE client_id = $1 AND revoked_at IS NULL`
+	_, err = r.executor.ExecContext(ctx, query, id)
+	return true, err
+}
+
+func (r *repository) CreateCode(ctx context.Context, code *AuthorizationCode) error {
+	query := `
+		INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.executor.ExecContext(ctx, query,
+		code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scopes, code.CodeChallenge, code.ExpiresAt,
+	)
+	return err
+}
+
+func (r *repository) ConsumeCode(ctx context.Context, codeHash string) (*AuthorizationCode, bool, error) {
+	var code AuthorizationCode
+	query := `SELECT * FROM oauth_authorization_codes WHERE code_hash = $1 FOR UPDATE`
+	if err := r.executor.GetContext(ctx, &code, query, codeHash); err != nil {
+		return nil, false, err
+	}
+	if code.UsedAt != nil {
+		return &code, true, nil
+	}
+
+	query = `UPDATE oauth_authorization_codes SET used_at = NOW() WHERE code_hash = $1`
+	_, err := r.executor.ExecContext(ctx, query, codeHash)
+	return &code, false, err
+}
+
+func (r *repository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	query := `
+		INSERT INTO oauth_refresh_tokens (token_hash, client_id, user_id, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	return r.executor.QueryRowxContext(ctx, query,
+		token.TokenHash, token.ClientID, token.UserID, token.Scopes, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (r *repository) FindRefreshTokenForUpdate(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	query := `
+		SELECT * FROM oauth_refresh_tokens
+		WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`
+	if err := r.executor.GetContext(ctx, &token, query, tokenHash); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *repository) FindRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	query := `SELECT * FROM oauth_refresh_tokens WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()`
+	if err := r.executor.GetContext(ctx, &token, query, tokenHash); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *repository) RevokeRefreshToken(ctx context.Context, id int64) error {
+	query := `UPDATE oauth_refresh_tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+	_, err := r.executor.ExecContext(ctx, query, id)
+	return err
+}
+
+// RevokeGrant revokes every refresh token the user has given the client
+func (r *repository) RevokeGrant(ctx context.Context, userID int64, clientID string) error {
+	query := `UPDATE oauth_refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND client_id = $2 AND revoked_at IS NULL`
+	_, err := r.executor.ExecContext(ctx, query, userID, clientID)
+	return err
+}
+
+func (r *repository) GetConsent(ctx context.Context, userID int64, clientID string) ([]string, error) {
+	var scopes pq.StringArray
+	query := `SELECT scopes FROM oauth_consents WHERE user_id = $1 AND client_id = $2`
+	err := r.executor.GetContext(ctx, &scopes, query, userID, clientID)
+	return scopes, err
+}
+
+func (r *repository) SaveConsent(ctx context.Context, userID int64, clientID string, scopes []string) error {
+	query := `
+		INSERT INTO oauth_consents (user_id, client_id, scopes) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET scopes = EXCLUDED.scopes, granted_at = NOW()
+	`
+	_, err := r.executor.ExecContext(ctx, query, userID, clientID, pq.StringArray(scopes))
+	return err
+}
+
+// DeleteExpired removes expired codes and refresh tokens that expired or were revoked before the cutoff
+func (r *repository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.executor.ExecContext(ctx, `DELETE FROM oauth_authorization_codes WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	codes, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	query := `DELETE FROM oauth_refresh_tokens WHERE expires_at < $1 OR revoked_at < $1`
+	res, err = r.executor.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	tokens, err := res.RowsAffected()
+	return codes + tokens, err
+}
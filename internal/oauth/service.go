@@ -0,0 +1,530 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Service interface {
+	RegisterClient(ctx context.Context, ownerID int64, input RegisterClientInput) (*Client, string, error)
+	ListClients(ctx context.Context, ownerID int64) ([]Client, error)
+	RevokeClient(ctx context.Context, ownerID int64, clientID string) error
+
+	// PrepareConsent validates an authorization request and describes what the user is asked to approve
+	PrepareConsent(ctx context.Context, userID int64, req AuthorizeRequest) (*Consent, error)
+	// Authorize records the user's decision and returns the client URL to send the user agent to
+	Authorize(ctx context.Context, userID int64, req AuthorizeRequest, approved bool) (string, error)
+
+	AuthenticateClient(ctx context.Context, clientID, secret string) (*Client, error)
+	ExchangeCode(ctx context.Context, client *Client, code, redirectURI, codeVerifier string) (*TokenResponse, error)
+	Refresh(ctx context.Context, client *Client, refreshToken, scope string) (*TokenResponse, error)
+	Revoke(ctx context.Context, client *Client, token string) error
+	Introspect(ctx context.Context, client *Client, token string) (*Introspection, error)
+	PurgeExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type service struct {
+	repo        Repository
+	txProvider  database.TxProvider
+	authService auth.Service
+	users       user.Service
+	logger      *slog.Logger
+}
+
+func NewService(repo Repository, txProvider database.TxProvider, authService auth.Service, users user.Service, logger *slog.Logger) Service {
+	return &service{repo: repo, txProvider: txProvider, authService: authService, users: users, logger: logger}
+}
+
+func (s *service) RegisterClient(ctx context.Context, ownerID int64, input RegisterClientInput) (*Client, string, error) {
+	for _, uri := range input.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrInvalidClientMetadata, err)
+		}
+	}
+	scopes, err := auth.ParseScopes(input.Scopes)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidClientMetadata, err)
+	}
+
+	idBytes := make([]byte, 12)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+
+	client := &Client{
+		ID:           ClientIDPrefix + hex.EncodeToString(idBytes),
+		OwnerID:      ownerID,
+		Name:         input.Name,
+		RedirectURIs: input.RedirectURIs,
+		Scopes:       scopesToStrings(scopes),
+	}
+
+	var secret string
+	if input.Confidential {
+		var secretHash string
+		secret, secretHash, err = auth.GenerateOpaqueToken()
+		if err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = &secretHash
+	}
+
+	if err := s.repo.CreateClient(ctx, client); err != nil {
+		return nil, "", fmt.Errorf("failed to create client: %w", err)
+	}
+	s.logger.Info("OAuth client registered", "client_id", client.ID, "owner_id", ownerID, "confidential", input.Confidential)
+	return client, secret, nil
+}
+
+func (s *service) ListClients(ctx context.Context, ownerID int64) ([]Client, error) {
+	clients, err := s.repo.ListClients(ctx, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clients: %w", err)
+	}
+	return clients, nil
+}
+
+func (s *service) RevokeClient(ctx context.Context, ownerID int64, clientID string) error {
+	var revoked bool
+	err := s.txProvider.RunInTx(ctx, func(exec database.Executor) error {
+		var err error
+		revoked, err = NewRepository(exec).RevokeClient(ctx, ownerID, clientID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke client: %w", err)
+	}
+	if !revoked {
+		return ErrClientNotFound
+	}
+	s.logger.Info("OAuth client revoked", "client_id", clientID, "owner_id", ownerID)
+	return nil
+}
+
+func (s *service) PrepareConsent(ctx context.Context, userID int64, req AuthorizeRequest) (*Consent, error) {
+	client, scopes, err := s.validateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := s.repo.GetConsent(ctx, userID, client.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get consent: %w", err)
+	}
+
+	previouslyGiven := len(granted) > 0
+	for _, scope := range scopes {
+		if !slices.Contains(granted, string(scope)) {
+			previouslyGiven = false
+		}
+	}
+
+	return &Consent{
+		Client:          ClientInfo{ID: client.ID, Name: client.Name},
+		Scopes:          scopesToStrings(scopes),
+		PreviouslyGiven: previouslyGiven,
+	}, nil
+}
+
+func (s *service) Authorize(ctx context.Context, userID int64, req AuthorizeRequest, approved bool) (string, error) {
+	client, scopes, err := s.validateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if !approved {
+		return ErrorRedirectURL(req, newError(http.StatusForbidden, "access_denied", "the user denied the request")), nil
+	}
+
+	code, codeHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.txProvider.RunInTx(ctx, func(exec database.Executor) error {
+		repo := NewRepository(exec)
+		if err := repo.SaveConsent(ctx, userID, client.ID, scopesToStrings(scopes)); err != nil {
+			return err
+		}
+		return repo.CreateCode(ctx, &AuthorizationCode{
+			CodeHash:      codeHash,
+			ClientID:      client.ID,
+			UserID:        userID,
+			RedirectURI:   req.RedirectURI,
+			Scopes:        scopesToStrings(scopes),
+			CodeChallenge: req.CodeChallenge,
+			ExpiresAt:     time.Now().Add(AuthorizationCodeTTL),
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create authorization code: %w", err)
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, params), nil
+}
+
+// validateAuthorizeRequest returns ErrUnknownClient or ErrInvalidRedirectURI when the user agent must not be
+// redirected back to the client, and *Error for every error that is reported to the client's redirect URI
+func (s *service) validateAuthorizeRequest(ctx context.Context, req AuthorizeRequest) (*Client, []auth.Scope, error) {
+	client, err := s.repo.GetClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrUnknownClient
+		}
+		return nil, nil, fmt.Errorf("failed to get client: %w", err)
+	}
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return nil, nil, ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return nil, nil, newError(http.StatusBadRequest, "unsupported_response_type", "only the authorization code flow is supported")
+	}
+	// PKCE is required for every client, as recommended by OAuth 2.0 Security BCP
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return nil, nil, newError(http.StatusBadRequest, "invalid_request", "code_challenge with code_challenge_method S256 is required")
+	}
+
+	scopes, err := s.grantableScopes(client, req.Scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, scopes, nil
+}
+
+// grantableScopes defaults to every scope registered for the client when none are requested
+func (s *service) grantableScopes(client *Client, requested string) ([]auth.Scope, error) {
+	if strings.TrimSpace(requested) == "" {
+		return auth.SplitScopes(strings.Join(client.Scopes, " ")), nil
+	}
+	scopes := auth.SplitScopes(requested)
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, string(scope)) {
+			return nil, newError(http.StatusBadRequest, "invalid_scope", fmt.Sprintf("scope %q is not allowed for this client", scope))
+		}
+	}
+	return scopes, nil
+}
+
+func (s *service) AuthenticateClient(ctx context.Context, clientID, secret string) (*Client, error) {
+	invalid := newError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	if clientID == "" {
+		return nil, invalid
+	}
+
+	client, err := s.repo.GetClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, invalid
+		}
+		return nil, fmt.Errorf("failed to get client: %w", err)
+	}
+
+	if client.Confidential() {
+		if secret == "" || subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(*client.SecretHash)) != 1 {
+			return nil, invalid
+		}
+	} else if secret != "" {
+		return nil, invalid
+	}
+	return client, nil
+}
+
+func (s *service) ExchangeCode(ctx context.Context, client *Client, code, redirectURI, codeVerifier string) (*TokenResponse, error) {
+	invalidGrant := newError(http.StatusBadRequest, "invalid_grant", "authorization code is invalid, expired or was issued to another client")
+
+	var authCode *AuthorizationCode
+	var reused bool
+	err := s.txProvider.RunInTx(ctx, func(exec database.Executor) error {
+		var err error
+		authCode, reused, err = NewRepository(exec).ConsumeCode(ctx, auth.HashToken(code))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, invalidGrant
+		}
+		return nil, fmt.Errorf("failed to consume authorization code: %w", err)
+	}
+
+	if reused {
+		// a replayed code may have been intercepted, revoke what was issued from it (RFC 6749 4.1.2)
+		s.logger.Warn("Authorization code reused, revoking grant", "client_id", authCode.ClientID, "user_id", authCode.UserID)
+		if err := s.repo.RevokeGrant(ctx, authCode.UserID, authCode.ClientID); err != nil {
+			return nil, fmt.Errorf("failed to revoke grant: %w", err)
+		}
+		return nil, invalidGrant
+	}
+	if authCode.ClientID != client.ID || authCode.RedirectURI != redirectURI || time.Now().After(authCode.ExpiresAt) {
+		return nil, invalidGrant
+	}
+	if !verifyPKCE(codeVerifier, authCode.CodeChallenge) {
+		return nil, newError(http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code challenge")
+	}
+
+	return s.issueTokens(ctx, nil, client.ID, authCode.UserID, auth.SplitScopes(strings.Join(authCode.Scopes, " ")))
+}
+
+func (s *service) Refresh(ctx context.Context, client *Client, refreshToken, scope string) (*TokenResponse, error) {
+	invalidGrant := newError(http.StatusBadRequest, "invalid_grant", "refresh token is invalid, expired or was issued to another client")
+
+	var response *TokenResponse
+	err := s.txProvider.RunInTx(ctx, func(exec database.Executor) error {
+		repo := NewRepository(exec)
+		token, err := repo.FindRefreshTokenForUpdate(ctx, auth.HashToken(refreshToken))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return invalidGrant
+			}
+			return err
+		}
+		if token.ClientID != client.ID {
+			return invalidGrant
+		}
+
+		// a refresh may narrow the original grant but never widen it (RFC 6749 6)
+		scopes := auth.SplitScopes(strings.Join(token.Scopes, " "))
+		if strings.TrimSpace(scope) != "" {
+			scopes = auth.SplitScopes(scope)
+			for _, sc := range scopes {
+				if !slices.Contains(token.Scopes, string(sc)) {
+					return newError(http.StatusBadRequest, "invalid_scope", fmt.Sprintf("scope %q was not granted", sc))
+				}
+			}
+		}
+
+		if err := repo.RevokeRefreshToken(ctx, token.ID); err != nil {
+			return err
+		}
+		response, err = s.issueTokens(ctx, repo, client.ID, token.UserID, scopes)
+		return err
+	})
+	if err != nil {
+		var oauthErr *Error
+		if errors.As(err, &oauthErr) {
+			return nil, oauthErr
+		}
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	return response, nil
+}
+
+// issueTokens creates an access token and a refresh token, using repo when running inside a transaction
+func (s *service) issueTokens(ctx context.Context, repo Repository, clientID string, userID int64, scopes []auth.Scope) (*TokenResponse, error) {
+	if repo == nil {
+		repo = s.repo
+	}
+
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if u.DisabledAt != nil {
+		return nil, newError(http.StatusBadRequest, "invalid_grant", "the resource owner's account is disabled")
+	}
+
+	accessToken, err := s.authService.GenerateClientToken(userID, u.Role, clientID, scopes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	refreshToken, refreshHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	err = repo.CreateRefreshToken(ctx, &RefreshToken{
+		TokenHash: refreshHash,
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scopesToStrings(scopes),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        auth.JoinScopes(scopes),
+	}, nil
+}
+
+// Revoke implements RFC 7009. Refresh tokens are revoked together with the rest of their grant.
+// Access tokens are revoked individually; invalid or foreign tokens are ignored as the RFC requires.
+func (s *service) Revoke(ctx context.Context, client *Client, token string) error {
+	refresh, err := s.repo.FindRefreshToken(ctx, auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s.revokeAccessToken(ctx, client, token)
+		}
+		return fmt.Errorf("failed to find refresh token: %w", err)
+	}
+	if refresh.ClientID != client.ID {
+		return nil
+	}
+
+	if err := s.repo.RevokeGrant(ctx, refresh.UserID, client.ID); err != nil {
+		return fmt.Errorf("failed to revoke grant: %w", err)
+	}
+	s.logger.Info("OAuth grant revoked by client", "client_id", client.ID, "user_id", refresh.UserID)
+	return nil
+}
+
+// revokeAccessToken revokes a single access token, leaving the grant and its refresh token intact
+func (s *service) revokeAccessToken(ctx context.Context, client *Client, token string) error {
+	claims, err := s.authService.ValidateToken(token)
+	if err != nil || claims.ClientID != client.ID {
+		return nil
+	}
+	return s.authService.RevokeAccessToken(ctx, claims)
+}
+
+// Introspect implements RFC 7662. Clients may only introspect tokens issued to them.
+func (s *service) Introspect(ctx context.Context, client *Client, token string) (*Introspection, error) {
+	inactive := &Introspection{Active: false}
+
+	var result *Introspection
+	var userID int64
+	if refresh, err := s.repo.FindRefreshToken(ctx, auth.HashToken(token)); err == nil {
+		if refresh.ClientID != client.ID {
+			return inactive, nil
+		}
+		userID = refresh.UserID
+		result = &Introspection{
+			Active:    true,
+			Scope:     strings.Join(refresh.Scopes, " "),
+			ClientID:  refresh.ClientID,
+			TokenType: "refresh_token",
+			Exp:       refresh.ExpiresAt.Unix(),
+			Iat:       refresh.CreatedAt.Unix(),
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find refresh token: %w", err)
+	} else {
+		claims, err := s.authService.ValidateToken(token)
+		if err != nil || claims.ClientID != client.ID {
+			return inactive, nil
+		}
+		if revoked, err := s.authService.IsRevoked(ctx, claims); err != nil || revoked {
+			return inactive, nil
+		}
+		userID = claims.UserID
+		result = &Introspection{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			TokenType: "Bearer",
+			Exp:       claims.ExpiresAt.Unix(),
+			Iat:       claims.IssuedAt.Unix(),
+			Iss:       claims.Issuer,
+		}
+	}
+
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil || u.DisabledAt != nil {
+		return inactive, nil
+	}
+	result.Sub = strconv.FormatInt(userID, 10)
+	result.Username = u.Username
+	return result, nil
+}
+
+func (s *service) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	deleted, err := s.repo.DeleteExpired(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge oauth grants: %w", err)
+	}
+	return deleted, nil
+}
+
+// ErrorRedirectURL reports an authorization error to the client (RFC 6749 4.1.2.1)
+func ErrorRedirectURL(req AuthorizeRequest, err *Error) string {
+	params := url.Values{"error": {err.Code}}
+	if err.Description != "" {
+		params.Set("error_description", err.Description)
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, params)
+}
+
+func appendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func verifyPKCE(verifier, challenge string) bool {
+	// RFC 7636 4.1: 43 to 128 characters
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// validateRedirectURI accepts https URLs, http on loopback addresses and private-use schemes of native apps (RFC 8252)
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("redirect uri %q must be an absolute URL", raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect uri %q must not contain a fragment", raw)
+	}
+
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+		return fmt.Errorf("redirect uri %q must use https", raw)
+	default:
+		if strings.Contains(u.Scheme, ".") {
+			return nil
+		}
+		return fmt.Errorf("redirect uri %q uses an unsupported scheme", raw)
+	}
+}
+
+func scopesToStrings(scopes []auth.Scope) []string {
+	out := make([]string, len(scopes))
+	for i, s := range scopes {
+		out[i] = string(s)
+	}
+	return out
+}
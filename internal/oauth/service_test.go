@@ -0,0 +1,336 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// RFC 7636 appendix B
+const (
+	testVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+const testRedirectURI = "https://app.example.com/callback"
+
+var (
+	testClient  = &Client{ID: ClientIDPrefix + "app", Scopes: []string{"profile:read", "sessions:read"}, RedirectURIs: []string{testRedirectURI}}
+	otherClient = &Client{ID: ClientIDPrefix + "other", Scopes: []string{"profile:read"}, RedirectURIs: []string{"https://other.example.com/callback"}}
+)
+
+type fakeUsers struct {
+	user.Service
+}
+
+func (fakeUsers) GetByID(_ context.Context, id int64) (*user.User, error) {
+	return &user.User{ID: id, Username: "anna", Role: auth.RoleUser}, nil
+}
+
+// txOver runs transactions directly on the mocked connection
+type txOver struct {
+	db *sqlx.DB
+}
+
+func (p txOver) RunInTx(_ context.Context, fn func(database.Executor) error) error {
+	return fn(p.db)
+}
+
+func newTestService(t *testing.T) (Service, sqlmock.Sqlmock, auth.Service) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	keys, err := auth.LoadKeySet("", nil, "test-secret")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	authService := auth.NewAuth(keys, "test", nil, nil, nil, auth.NewMemoryRevocationStore(), ratelimit.NewMemoryCounter(), nil, nil)
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewService(NewRepository(sqlxDB), txOver{db: sqlxDB}, authService, fakeUsers{}, logger), mock, authService
+}
+
+func expectCode(mock sqlmock.Sqlmock, code string, usedAt *time.Time) {
+	mock.ExpectQuery(`SELECT \* FROM oauth_authorization_codes WHERE code_hash = \$1 FOR UPDATE`).
+		WithArgs(auth.HashToken(code)).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"code_hash", "client_id", "user_id", "redirect_uri", "scopes", "code_challenge", "expires_at", "used_at", "created_at",
+		}).AddRow(
+			auth.HashToken(code), testClient.ID, int64(7), testRedirectURI, "{profile:read}", testChallenge,
+			time.Now().Add(AuthorizationCodeTTL), usedAt, time.Now(),
+		))
+	if usedAt == nil {
+		mock.ExpectExec(`UPDATE oauth_authorization_codes SET used_at = NOW\(\) WHERE code_hash = \$1`).
+			WithArgs(auth.HashToken(code)).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+}
+
+func refreshRows(token, clientID, scopes string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"id", "token_hash", "client_id", "user_id", "scopes", "expires_at", "revoked_at", "created_at",
+	}).AddRow(int64(3), auth.HashToken(token), clientID, int64(7), scopes, time.Now().Add(RefreshTokenTTL), nil, time.Now())
+}
+
+func expectRefreshTokenCreated(mock sqlmock.Sqlmock, clientID string, scopes ...string) {
+	mock.ExpectQuery(`INSERT INTO oauth_refresh_tokens`).
+		WithArgs(sqlmock.AnyArg(), clientID, int64(7), scopesArg(scopes), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(int64(4), time.Now()))
+}
+
+// scopesArg matches a scopes array parameter however Postgres quotes it
+type scopesArg []string
+
+func (a scopesArg) Match(v driver.Value) bool {
+	var got pq.StringArray
+	return got.Scan(v) == nil && slices.Equal([]string(got), a)
+}
+
+func assertOAuthError(t *testing.T, err error, code string) {
+	t.Helper()
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != code {
+		t.Fatalf("err = %v, want OAuth error %s", err, code)
+	}
+	if oauthErr.status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", oauthErr.status)
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	s, mock, authService := newTestService(t)
+	expectCode(mock, "code", nil)
+	expectRefreshTokenCreated(mock, testClient.ID, "profile:read")
+
+	tokens, err := s.ExchangeCode(context.Background(), testClient, "code", testRedirectURI, testVerifier)
+	if err != nil {
+		t.Fatalf("ExchangeCode: %v", err)
+	}
+	if tokens.Scope != "profile:read" || tokens.RefreshToken == "" {
+		t.Fatalf("tokens = %+v, want profile:read with a refresh token", tokens)
+	}
+	claims, err := authService.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.UserID != 7 || claims.ClientID != testClient.ID || claims.Scope != "profile:read" {
+		t.Fatalf("claims = %+v, want user 7 delegated to %s with profile:read", claims, testClient.ID)
+	}
+}
+
+func TestExchangeCodeRejectsPKCEMismatch(t *testing.T) {
+	for name, verifier := range map[string]string{
+		"wrong verifier": "a-different-verifier-that-is-long-enough-to-pass-the-length-check",
+		"short verifier": "short",
+		"no verifier":    "",
+		"challenge":      testChallenge,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, mock, _ := newTestService(t)
+			expectCode(mock, "code", nil)
+
+			_, err := s.ExchangeCode(context.Background(), testClient, "code", testRedirectURI, verifier)
+			assertOAuthError(t, err, "invalid_grant")
+		})
+	}
+}
+
+func TestExchangeCodeRejectsRedirectURIMismatch(t *testing.T) {
+	s, mock, _ := newTestService(t)
+	expectCode(mock, "code", nil)
+
+	_, err := s.ExchangeCode(context.Background(), testClient, "code", "https://app.example.com/other", testVerifier)
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestExchangeCodeRejectsOtherClient(t *testing.T) {
+	s, mock, _ := newTestService(t)
+	expectCode(mock, "code", nil)
+
+	_, err := s.ExchangeCode(context.Background(), otherClient, "code", testRedirectURI, testVerifier)
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestExchangeCodeReplayRevokesGrant(t *testing.T) {
+	s, mock, _ := newTestService(t)
+	usedAt := time.Now().Add(-time.Minute)
+	expectCode(mock, "code", &usedAt)
+	mock.ExpectExec(`UPDATE oauth_refresh_tokens SET revoked_at = NOW\(\) WHERE user_id = \$1 AND client_id = \$2 AND revoked_at IS NULL`).
+		WithArgs(int64(7), testClient.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err := s.ExchangeCode(context.Background(), testClient, "code", testRedirectURI, testVerifier)
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestExchangeCodeRejectsUnknownCode(t *testing.T) {
+	s, mock, _ := newTestService(t)
+	mock.ExpectQuery(`SELECT \* FROM oauth_authorization_codes`).WillReturnError(sql.ErrNoRows)
+
+	_, err := s.ExchangeCode(context.Background(), testClient, "code", testRedirectURI, testVerifier)
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestRefreshCannotWidenScope(t *testing.T) {
+	s, mock, _ := newTestService(t)
+	mock.ExpectQuery(`SELECT \* FROM oauth_refresh_tokens\s+WHERE token_hash = \$1 AND revoked_at IS NULL AND expires_at > NOW\(\)\s+FOR UPDATE`).
+		WithArgs(auth.HashToken("refresh")).
+		WillReturnRows(refreshRows("refresh", testClient.ID, "{profile:read}"))
+
+	_, err := s.Refresh(context.Background(), testClient, "refresh", "profile:read sessions:read")
+	assertOAuthError(t, err, "invalid_scope")
+}
+
+func TestRefreshCanNarrowScope(t *testing.T) {
+	s, mock, _ := newTestService(t)
+	mock.ExpectQuery(`SELECT \* FROM oauth_refresh_tokens`).
+		WithArgs(auth.HashToken("refresh")).
+		WillReturnRows(refreshRows("refresh", testClient.ID, "{profile:read,sessions:read}"))
+	mock.ExpectExec(`UPDATE oauth_refresh_tokens SET revoked_at = NOW\(\) WHERE id = \$1`).
+		WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectRefreshTokenCreated(mock, testClient.ID, "sessions:read")
+
+	tokens, err := s.Refresh(context.Background(), testClient, "refresh", "sessions:read")
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if tokens.Scope != "sessions:read" {
+		t.Fatalf("scope = %q, want sessions:read", tokens.Scope)
+	}
+}
+
+func TestRefreshRejectsOtherClientsToken(t *testing.T) {
+	s, mock, _ := newTestService(t)
+	mock.ExpectQuery(`SELECT \* FROM oauth_refresh_tokens`).
+		WithArgs(auth.HashToken("refresh")).
+		WillReturnRows(refreshRows("refresh", testClient.ID, "{profile:read}"))
+
+	_, err := s.Refresh(context.Background(), otherClient, "refresh", "")
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestIntrospectHidesOtherClientsTokens(t *testing.T) {
+	ctx := context.Background()
+	s, mock, authService := newTestService(t)
+
+	mock.ExpectQuery(`SELECT \* FROM oauth_refresh_tokens WHERE token_hash = \$1`).
+		WithArgs(auth.HashToken("refresh")).
+		WillReturnRows(refreshRows("refresh", testClient.ID, "{profile:read}"))
+	result, err := s.Introspect(ctx, otherClient, "refresh")
+	if err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	if result.Active || result.Sub != "" || result.Scope != "" {
+		t.Fatalf("refresh token of another client = %+v, want only active=false", result)
+	}
+
+	access, err := authService.GenerateClientToken(7, auth.RoleUser, testClient.ID, []auth.Scope{auth.ScopeProfileRead})
+	if err != nil {
+		t.Fatalf("GenerateClientToken: %v", err)
+	}
+	mock.ExpectQuery(`SELECT \* FROM oauth_refresh_tokens WHERE token_hash = \$1`).
+		WithArgs(auth.HashToken(access)).WillReturnError(sql.ErrNoRows)
+	if result, err = s.Introspect(ctx, otherClient, access); err != nil || result.Active {
+		t.Fatalf("access token of another client = %+v, %v, want active=false", result, err)
+	}
+
+	mock.ExpectQuery(`SELECT \* FROM oauth_refresh_tokens WHERE token_hash = \$1`).
+		WithArgs(auth.HashToken(access)).WillReturnError(sql.ErrNoRows)
+	result, err = s.Introspect(ctx, testClient, access)
+	if err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	if !result.Active || result.Sub != "7" || result.Username != "anna" || result.Scope != "profile:read" {
+		t.Fatalf("own access token = %+v, want it active for user 7", result)
+	}
+}
+
+func TestIntrospectRejectsInteractiveSessions(t *testing.T) {
+	s, mock, authService := newTestService(t)
+	session, err := authService.GenerateToken(7, auth.RoleUser)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	mock.ExpectQuery(`SELECT \* FROM oauth_refresh_tokens`).WillReturnError(sql.ErrNoRows)
+
+	result, err := s.Introspect(context.Background(), testClient, session)
+	if err != nil || result.Active {
+		t.Fatalf("first-party session token = %+v, %v, want active=false", result, err)
+	}
+}
+
+func TestAuthorizeValidatesRequest(t *testing.T) {
+	valid := AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            testClient.ID,
+		RedirectURI:         testRedirectURI,
+		Scope:               "profile:read",
+		CodeChallenge:       testChallenge,
+		CodeChallengeMethod: "S256",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*AuthorizeRequest)
+		want   error
+		code   string
+	}{
+		{"unregistered redirect_uri", func(r *AuthorizeRequest) { r.RedirectURI = "https://evil.example.com/callback" }, ErrInvalidRedirectURI, ""},
+		{"redirect_uri prefix", func(r *AuthorizeRequest) { r.RedirectURI = testRedirectURI + "/extra" }, ErrInvalidRedirectURI, ""},
+		{"implicit flow", func(r *AuthorizeRequest) { r.ResponseType = "token" }, nil, "unsupported_response_type"},
+		{"no PKCE", func(r *AuthorizeRequest) { r.CodeChallenge = "" }, nil, "invalid_request"},
+		{"plain PKCE", func(r *AuthorizeRequest) { r.CodeChallengeMethod = "plain" }, nil, "invalid_request"},
+		{"unregistered scope", func(r *AuthorizeRequest) { r.Scope = "profile:read sessions:write" }, nil, "invalid_scope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock, _ := newTestService(t)
+			mock.ExpectQuery(`SELECT \* FROM oauth_clients WHERE id = \$1 AND revoked_at IS NULL`).
+				WithArgs(testClient.ID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "name", "secret_hash", "redirect_uris", "scopes", "created_at", "revoked_at"}).
+					AddRow(testClient.ID, int64(1), "App", nil, "{"+testRedirectURI+"}", "{profile:read,sessions:read}", time.Now(), nil))
+
+			req := valid
+			tt.modify(&req)
+			_, err := s.Authorize(context.Background(), 7, req, true)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("Authorize = %v, want %v", err, tt.want)
+				}
+				return
+			}
+			assertOAuthError(t, err, tt.code)
+		})
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	if !verifyPKCE(testVerifier, testChallenge) {
+		t.Fatal("RFC 7636 example verifier was rejected")
+	}
+	if verifyPKCE(testVerifier+"x", testChallenge) {
+		t.Fatal("altered verifier was accepted")
+	}
+}
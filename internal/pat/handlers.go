@@ -0,0 +1,150 @@
+package pat
+
+import (
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+type CreateTokenRequest struct {
+	Name      string     `json:"name" binding:"required" validate:"required,min=1,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required" validate:"required,min=1,dive,required"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type CreateTokenResponse struct {
+	Token      Token  `json:"token"`
+	PlainToken string `json:"plain_token"`
+}
+
+type TokenIDPathParam struct {
+	ID int64 `uri:"id" binding:"required" validate:"required,gt=0"`
+}
+
+// CreateToken issues a personal access token
+// @Summary Create personal access token
+// @Description Creates a long-lived scoped token for scripts and devices, the plain token is only returned once.
+// @Description Available scopes: profile:read, profile:write, sessions:read, sessions:write
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateTokenRequest true "Token payload"
+// @Success 201 {object} CreateTokenResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 409 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/tokens [post]
+func (h *Handler) CreateToken(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	req, ok := validation.BindAndValidate[CreateTokenRequest](c)
+	if !ok {
+		return
+	}
+
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	token, plain, err := h.service.Create(c.Request.Context(), userID, CreateInput{
+		Name:      req.Name,
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrExpiryInPast):
+			apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+		case errors.Is(err, ErrTooManyTokens):
+			apperrors.GenHTTPError(c, http.StatusConflict, err.Error(), nil)
+		default:
+			apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to create token", nil)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateTokenResponse{Token: *token, PlainToken: plain})
+}
+
+// ListTokens lists active personal access tokens
+// @Summary List personal access tokens
+// @Description Returns active tokens of the current user without their secret values
+// @Tags tokens
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} Token
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/tokens [get]
+func (h *Handler) ListTokens(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	tokens, err := h.service.List(c.Request.Context(), userID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to list tokens", nil)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeToken revokes a personal access token
+// @Summary Revoke personal access token
+// @Tags tokens
+// @Security BearerAuth
+// @Param id path int true "Token ID"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/tokens/{id} [delete]
+func (h *Handler) RevokeToken(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[TokenIDPathParam](c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Revoke(c.Request.Context(), userID, params.ID); err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			apperrors.GenHTTPError(c, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to revoke token", nil)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
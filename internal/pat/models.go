@@ -0,0 +1,47 @@
+package pat
+
+import (
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/lib/pq"
+	"time"
+)
+
+// TokenPrefix marks personal access tokens so they can be told apart from JWTs and found by secret scanners
+const TokenPrefix = "wt_pat_"
+
+// MaxTokensPerUser caps active tokens so a leaked session cannot mint tokens without bound
+const MaxTokensPerUser = 50
+
+var (
+	ErrInvalidToken  = errors.New("invalid personal access token")
+	ErrTooManyTokens = errors.New("personal access token limit reached, revoke unused tokens first")
+	ErrExpiryInPast  = errors.New("expiry must be in the future")
+	ErrTokenNotFound = errors.New("personal access token not found")
+)
+
+type Token struct {
+	ID          int64          `json:"id" db:"id"`
+	UserID      int64          `json:"-" db:"user_id"`
+	Name        string         `json:"name" db:"name"`
+	TokenHash   string         `json:"-" db:"token_hash"`
+	TokenPrefix string         `json:"token_prefix" db:"token_prefix"`
+	Scopes      pq.StringArray `json:"scopes" db:"scopes" swaggertype:"array,string"`
+	ExpiresAt   *time.Time     `json:"expires_at" db:"expires_at"`
+	LastUsedAt  *time.Time     `json:"last_used_at" db:"last_used_at"`
+	RevokedAt   *time.Time     `json:"-" db:"revoked_at"`
+	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
+}
+
+// activeToken is a token joined with the state of its owner
+type activeToken struct {
+	Token
+	Role       auth.Role  `db:"role"`
+	DisabledAt *time.Time `db:"disabled_at"`
+}
+
+type CreateInput struct {
+	Name      string
+	Scopes    []auth.Scope
+	ExpiresAt *time.Time
+}
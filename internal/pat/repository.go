@@ -0,0 +1,90 @@
+package pat
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"time"
+)
+
+type Repository interface {
+	Create(ctx context.Context, token *Token) error
+	ListActive(ctx context.Context, userID int64) ([]Token, error)
+	CountActive(ctx context.Context, userID int64) (int, error)
+	FindActiveByHash(ctx context.Context, tokenHash string) (*activeToken, error)
+	Revoke(ctx context.Context, userID, id int64) (bool, error)
+	TouchLastUsed(ctx context.Context, id int64, usedAt time.Time) error
+}
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) Create(ctx context.Context, token *Token) error {
+	query := `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	return r.executor.QueryRowxContext(ctx, query,
+		token.UserID, token.Name, token.TokenHash, token.TokenPrefix, token.Scopes, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (r *repository) ListActive(ctx context.Context, userID int64) ([]Token, error) {
+	tokens := []Token{}
+	query := `
+		SELECT * FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY created_at DESC
+	`
+	err := r.executor.SelectContext(ctx, &tokens, query, userID)
+	return tokens, err
+}
+
+func (r *repository) CountActive(ctx context.Context, userID int64) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*) FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`
+	err := r.executor.GetContext(ctx, &count, query, userID)
+	return count, err
+}
+
+func (r *repository) FindActiveByHash(ctx context.Context, tokenHash string) (*activeToken, error) {
+	var token activeToken
+	query := `
+		SELECT t.*, u.role, u.disabled_at
+		FROM personal_access_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > NOW())
+	`
+	if err := r.executor.GetContext(ctx, &token, query, tokenHash); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *repository) Revoke(ctx context.Context, userID, id int64) (bool, error) {
+	query := `UPDATE personal_access_tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	res, err := r.executor.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// TouchLastUsed only writes when the stored value is stale by a minute, so busy tokens don't update the row on every request
+func (r *repository) TouchLastUsed(ctx context.Context, id int64, usedAt time.Time) error {
+	query := `
+		UPDATE personal_access_tokens SET last_used_at = $2
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2 - INTERVAL '1 minute')
+	`
+	_, err := r.executor.ExecContext(ctx, query, id, usedAt)
+	return err
+}
@@ -0,0 +1,118 @@
+package pat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+type Service interface {
+	// Create returns the stored token and its plaintext value, which is never retrievable again
+	Create(ctx context.Context, userID int64, input CreateInput) (*Token, string, error)
+	List(ctx context.Context, userID int64) ([]Token, error)
+	Revoke(ctx context.Context, userID, id int64) error
+	// Authenticate resolves a presented token to its owner and scopes and records its use
+	Authenticate(ctx context.Context, token string) (*auth.Principal, error)
+}
+
+type service struct {
+	repo   Repository
+	logger *slog.Logger
+}
+
+func NewService(repo Repository, logger *slog.Logger) Service {
+	return &service{repo: repo, logger: logger}
+}
+
+func (s *service) Create(ctx context.Context, userID int64, input CreateInput) (*Token, string, error) {
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, "", ErrExpiryInPast
+	}
+
+	count, err := s.repo.CountActive(ctx, userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to count tokens: %w", err)
+	}
+	if count >= MaxTokensPerUser {
+		return nil, "", ErrTooManyTokens
+	}
+
+	secret, _, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	plaintext := TokenPrefix + secret
+
+	scopes := make([]string, len(input.Scopes))
+	for i, scope := range input.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	token := &Token{
+		UserID:      userID,
+		Name:        input.Name,
+		TokenHash:   auth.HashToken(plaintext),
+		TokenPrefix: plaintext[:len(TokenPrefix)+4],
+		Scopes:      scopes,
+		ExpiresAt:   input.ExpiresAt,
+	}
+	if err := s.repo.Create(ctx, token); err != nil {
+		return nil, "", fmt.Errorf("failed to create token: %w", err)
+	}
+
+	s.logger.Info("Personal access token created", "user_id", userID, "token_id", token.ID, "scopes", scopes)
+	return token, plaintext, nil
+}
+
+func (s *service) List(ctx context.Context, userID int64) ([]Token, error) {
+	tokens, err := s.repo.ListActive(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func (s *service) Revoke(ctx context.Context, userID, id int64) error {
+	revoked, err := s.repo.Revoke(ctx, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	if !revoked {
+		return ErrTokenNotFound
+	}
+	s.logger.Info("Personal access token revoked", "user_id", userID, "token_id", id)
+	return nil
+}
+
+func (s *service) Authenticate(ctx context.Context, token string) (*auth.Principal, error) {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	found, err := s.repo.FindActiveByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to find token: %w", err)
+	}
+	if found.DisabledAt != nil {
+		return nil, auth.ErrAccountDisabled
+	}
+
+	// last-used tracking is best effort and must not fail the request
+	if err := s.repo.TouchLastUsed(ctx, found.ID, time.Now()); err != nil {
+		s.logger.Warn("Failed to update token last use", "token_id", found.ID, "error", err)
+	}
+
+	scopes := make([]auth.Scope, len(found.Scopes))
+	for i, scope := range found.Scopes {
+		scopes[i] = auth.Scope(scope)
+	}
+	return &auth.Principal{UserID: found.UserID, Role: found.Role, Scopes: scopes}, nil
+}
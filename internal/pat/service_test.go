@@ -0,0 +1,211 @@
+package pat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type owner struct {
+	role       auth.Role
+	disabledAt *time.Time
+}
+
+// fakeRepository applies the same filter as FindActiveByHash: unrevoked and unexpired tokens only
+type fakeRepository struct {
+	Repository
+	tokens  []*Token
+	owners  map[int64]*owner
+	touched []int64
+}
+
+func (f *fakeRepository) CountActive(_ context.Context, userID int64) (int, error) {
+	count := 0
+	for _, token := range f.tokens {
+		if token.UserID == userID && isActive(token) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *fakeRepository) Create(_ context.Context, token *Token) error {
+	token.ID = int64(len(f.tokens) + 1)
+	token.CreatedAt = time.Now()
+	f.tokens = append(f.tokens, token)
+	return nil
+}
+
+func (f *fakeRepository) FindActiveByHash(_ context.Context, tokenHash string) (*activeToken, error) {
+	for _, token := range f.tokens {
+		if token.TokenHash == tokenHash && isActive(token) {
+			o := f.owners[token.UserID]
+			return &activeToken{Token: *token, Role: o.role, DisabledAt: o.disabledAt}, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeRepository) Revoke(_ context.Context, userID, id int64) (bool, error) {
+	for _, token := range f.tokens {
+		if token.ID == id && token.UserID == userID && token.RevokedAt == nil {
+			now := time.Now()
+			token.RevokedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeRepository) TouchLastUsed(_ context.Context, id int64, _ time.Time) error {
+	f.touched = append(f.touched, id)
+	return nil
+}
+
+func isActive(token *Token) bool {
+	return token.RevokedAt == nil && (token.ExpiresAt == nil || token.ExpiresAt.After(time.Now()))
+}
+
+func newTestService() (Service, *fakeRepository) {
+	repo := &fakeRepository{owners: map[int64]*owner{
+		7: {role: auth.RoleUser},
+		8: {role: auth.RoleCoach},
+	}}
+	return NewService(repo, slog.New(slog.NewTextHandler(io.Discard, nil))), repo
+}
+
+func createToken(t *testing.T, s Service, userID int64, input CreateInput) (*Token, string) {
+	t.Helper()
+	if input.Name == "" {
+		input.Name = "ci"
+	}
+	token, plaintext, err := s.Create(context.Background(), userID, input)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return token, plaintext
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestService()
+
+	token, plaintext := createToken(t, s, 8, CreateInput{Scopes: []auth.Scope{auth.ScopeSessionsRead}})
+	if !strings.HasPrefix(plaintext, TokenPrefix) || token.TokenHash == plaintext || !strings.HasPrefix(plaintext, token.TokenPrefix) {
+		t.Fatalf("token %+v with plaintext %q: want a prefixed plaintext that is stored hashed", token, plaintext)
+	}
+
+	principal, err := s.Authenticate(ctx, plaintext)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if principal.UserID != 8 || principal.Role != auth.RoleCoach || !slices.Equal(principal.Scopes, []auth.Scope{auth.ScopeSessionsRead}) {
+		t.Fatalf("principal = %+v, want user 8 as coach with sessions:read", principal)
+	}
+	if !slices.Equal(repo.touched, []int64{token.ID}) {
+		t.Fatalf("touched tokens = %v, want [%d]", repo.touched, token.ID)
+	}
+}
+
+func TestAuthenticateRejectsUnusableTokens(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestService()
+
+	_, valid := createToken(t, s, 7, CreateInput{})
+	expiresAt := time.Now().Add(time.Hour)
+	expiring, expired := createToken(t, s, 7, CreateInput{ExpiresAt: &expiresAt})
+	past := time.Now().Add(-time.Minute)
+	expiring.ExpiresAt = &past
+	revokedToken, revoked := createToken(t, s, 7, CreateInput{})
+	if err := s.Revoke(ctx, 7, revokedToken.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"missing prefix", strings.TrimPrefix(valid, TokenPrefix), ErrInvalidToken},
+		{"foreign prefix", "ghp_" + strings.TrimPrefix(valid, TokenPrefix), ErrInvalidToken},
+		{"unknown", TokenPrefix + "unknown", ErrInvalidToken},
+		{"altered", valid + "x", ErrInvalidToken},
+		{"expired", expired, ErrInvalidToken},
+		{"revoked", revoked, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Authenticate(ctx, tt.token); !errors.Is(err, tt.want) {
+				t.Fatalf("Authenticate = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	disabledAt := time.Now()
+	repo.owners[7].disabledAt = &disabledAt
+	if _, err := s.Authenticate(ctx, valid); !errors.Is(err, auth.ErrAccountDisabled) {
+		t.Fatalf("token of a disabled owner: Authenticate = %v, want ErrAccountDisabled", err)
+	}
+	if len(repo.touched) != 0 {
+		t.Fatalf("touched tokens = %v, want none for rejected tokens", repo.touched)
+	}
+}
+
+func TestRevokeOnlyOwnTokens(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService()
+	token, plaintext := createToken(t, s, 7, CreateInput{})
+
+	if err := s.Revoke(ctx, 8, token.ID); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Revoke by another user = %v, want ErrTokenNotFound", err)
+	}
+	if _, err := s.Authenticate(ctx, plaintext); err != nil {
+		t.Fatalf("token revoked by another user stopped working: %v", err)
+	}
+}
+
+func TestCreateLimits(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService()
+
+	past := time.Now().Add(-time.Second)
+	if _, _, err := s.Create(ctx, 7, CreateInput{Name: "ci", ExpiresAt: &past}); !errors.Is(err, ErrExpiryInPast) {
+		t.Fatalf("Create with past expiry = %v, want ErrExpiryInPast", err)
+	}
+	for range MaxTokensPerUser {
+		createToken(t, s, 7, CreateInput{})
+	}
+	if _, _, err := s.Create(ctx, 7, CreateInput{Name: "one too many"}); !errors.Is(err, ErrTooManyTokens) {
+		t.Fatalf("Create over the limit = %v, want ErrTooManyTokens", err)
+	}
+	createToken(t, s, 8, CreateInput{})
+}
+
+func TestFindActiveByHashSkipsRevokedAndExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := NewRepository(sqlx.NewDb(db, "postgres"))
+
+	mock.ExpectQuery(`WHERE t.token_hash = \$1 AND t.revoked_at IS NULL AND \(t.expires_at IS NULL OR t.expires_at > NOW\(\)\)`).
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	if _, err := repo.FindActiveByHash(context.Background(), "hash"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("FindActiveByHash = %v, want sql.ErrNoRows", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,135 @@
+package profile
+
+import (
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+type UpdateSettingsRequest struct {
+	Visibility   *Visibility `json:"visibility,omitempty" validate:"omitempty,oneof=private followers public"`
+	ShowWeight   *bool       `json:"show_weight,omitempty"`
+	ShowAge      *bool       `json:"show_age,omitempty"`
+	ShowSessions *bool       `json:"show_sessions,omitempty"`
+	ShowRecords  *bool       `json:"show_records,omitempty"`
+}
+
+type UsernamePathParam struct {
+	Username string `uri:"username" binding:"required" validate:"required,min=3,max=32"`
+}
+
+// GetPrivacy returns the privacy settings of the current user
+// @Summary Get privacy settings
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Settings
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/privacy [get]
+func (h *Handler) GetPrivacy(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	settings, err := h.service.GetSettings(c.Request.Context(), userID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to get privacy settings", nil)
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdatePrivacy updates the privacy settings of the current user
+// @Summary Update privacy settings
+// @Description Visibility decides who sees the profile at all: only the owner (private), approved followers or everyone signed in (public).
+// @Description The show flags hide bodyweight, age, sessions and personal records even from those who can see the profile.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateSettingsRequest true "Settings to change"
+// @Success 200 {object} Settings
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/privacy [patch]
+func (h *Handler) UpdatePrivacy(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	req, ok := validation.BindAndValidate[UpdateSettingsRequest](c)
+	if !ok {
+		return
+	}
+
+	settings, err := h.service.UpdateSettings(c.Request.Context(), userID, UpdateSettings{
+		Visibility:   req.Visibility,
+		ShowWeight:   req.ShowWeight,
+		ShowAge:      req.ShowAge,
+		ShowSessions: req.ShowSessions,
+		ShowRecords:  req.ShowRecords,
+	})
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to update privacy settings", nil)
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// GetPublicProfile returns the profile of a user as the current user may see it
+// @Summary Get public profile
+// @Description Returns what the privacy settings of the user allow the caller to see. For profiles the caller
+// @Description may not see, only the username and visibility are returned with visible set to false.
+// @Tags profiles
+// @Produce json
+// @Security BearerAuth
+// @Param username path string true "Username"
+// @Success 200 {object} PublicProfile
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/profiles/{username} [get]
+func (h *Handler) GetPublicProfile(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[UsernamePathParam](c)
+	if !ok {
+		return
+	}
+
+	profile, err := h.service.GetPublicProfile(c.Request.Context(), userID, params.Username)
+	if err != nil {
+		if errors.Is(err, ErrProfileNotFound) {
+			apperrors.GenHTTPError(c, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to get profile", nil)
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
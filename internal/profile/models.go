@@ -0,0 +1,80 @@
+package profile
+
+import (
+	"github.com/Uranury/WorkoutTracker/internal/workout/session"
+	"time"
+)
+
+type Visibility string
+
+const (
+	VisibilityPrivate   Visibility = "private"
+	VisibilityFollowers Visibility = "followers"
+	VisibilityPublic    Visibility = "public"
+)
+
+// Settings decide what other users see of an account. Visibility gates the whole profile, the Show flags hide
+// single kinds of data from everyone but the owner even when the profile is visible.
+type Settings struct {
+	UserID       int64      `json:"-" db:"user_id"`
+	Visibility   Visibility `json:"visibility" db:"visibility"`
+	ShowWeight   bool       `json:"show_weight" db:"show_weight"`
+	ShowAge      bool       `json:"show_age" db:"show_age"`
+	ShowSessions bool       `json:"show_sessions" db:"show_sessions"`
+	ShowRecords  bool       `json:"show_records" db:"show_records"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// DefaultSettings apply until a user saves their own, they match the column defaults of privacy_settings
+func DefaultSettings(userID int64) Settings {
+	return Settings{
+		UserID:       userID,
+		Visibility:   VisibilityPrivate,
+		ShowSessions: true,
+		ShowRecords:  true,
+	}
+}
+
+func (s Settings) auditFields() map[string]any {
+	return map[string]any{
+		"visibility":    s.Visibility,
+		"show_weight":   s.ShowWeight,
+		"show_age":      s.ShowAge,
+		"show_sessions": s.ShowSessions,
+		"show_records":  s.ShowRecords,
+	}
+}
+
+type UpdateSettings struct {
+	Visibility   *Visibility
+	ShowWeight   *bool
+	ShowAge      *bool
+	ShowSessions *bool
+	ShowRecords  *bool
+}
+
+// View is what a viewer may see of another user. Every read path that returns data of someone else must check it.
+type View struct {
+	Profile  bool
+	Weight   bool
+	Age      bool
+	Sessions bool
+	Records  bool
+}
+
+// FullView is what owners see of their own data
+var FullView = View{Profile: true, Weight: true, Age: true, Sessions: true, Records: true}
+
+// PublicProfile is another user's profile as the viewer may see it. Hidden data is left out,
+// a profile the viewer may not see at all only has its username and visibility.
+type PublicProfile struct {
+	Username        string                   `json:"username"`
+	Visibility      Visibility               `json:"visibility"`
+	Visible         bool                     `json:"visible"`
+	MemberSince     *time.Time               `json:"member_since,omitempty"`
+	Weight          *float64                 `json:"weight,omitempty"`
+	Age             *int                     `json:"age,omitempty"`
+	SessionCount    *int                     `json:"session_count,omitempty"`
+	RecentSessions  []session.Summary        `json:"recent_sessions,omitempty"`
+	PersonalRecords []session.PersonalRecord `json:"personal_records,omitempty"`
+}
@@ -0,0 +1,43 @@
+package profile
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+)
+
+type Repository interface {
+	// GetSettings returns sql.ErrNoRows for users that never saved their settings
+	GetSettings(ctx context.Context, userID int64) (*Settings, error)
+	SaveSettings(ctx context.Context, settings *Settings) error
+}
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) GetSettings(ctx context.Context, userID int64) (*Settings, error) {
+	settings := &Settings{}
+	query := `SELECT user_id, visibility, show_weight, show_age, show_sessions, show_records, updated_at FROM privacy_settings WHERE user_id = $1`
+	err := r.executor.GetContext(ctx, settings, query, userID)
+	return settings, err
+}
+
+func (r *repository) SaveSettings(ctx context.Context, settings *Settings) error {
+	query := `
+		INSERT INTO privacy_settings (user_id, visibility, show_weight, show_age, show_sessions, show_records)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET
+			visibility = EXCLUDED.visibility,
+			show_weight = EXCLUDED.show_weight,
+			show_age = EXCLUDED.show_age,
+			show_sessions = EXCLUDED.show_sessions,
+			show_records = EXCLUDED.show_records,
+			updated_at = NOW()
+		RETURNING updated_at`
+	return r.executor.QueryRowxContext(ctx, query, settings.UserID, settings.Visibility, settings.ShowWeight,
+		settings.ShowAge, settings.ShowSessions, settings.ShowRecords).Scan(&settings.UpdatedAt)
+}
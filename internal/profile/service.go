@@ -0,0 +1,201 @@
+package profile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/audit"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/internal/workout/session"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"log/slog"
+	"time"
+)
+
+// recentSessionsLimit is how many finished sessions a profile lists
+const recentSessionsLimit = 10
+
+var ErrProfileNotFound = errors.New("profile not found")
+
+// FollowChecker tells whether followerID is an approved follower of followeeID
+type FollowChecker interface {
+	IsFollowing(ctx context.Context, followerID, followeeID int64) (bool, error)
+}
+
+type Service interface {
+	GetSettings(ctx context.Context, userID int64) (*Settings, error)
+	UpdateSettings(ctx context.Context, userID int64, input UpdateSettings) (*Settings, error)
+	// Access resolves what viewerID may see of ownerID, owners see all of their own data.
+	// Disabled accounts and accounts scheduled for deletion show nothing to others.
+	Access(ctx context.Context, viewerID, ownerID int64) (View, error)
+	// GetPublicProfile returns ErrProfileNotFound for unknown, disabled and deleted accounts
+	GetPublicProfile(ctx context.Context, viewerID int64, username string) (*PublicProfile, error)
+}
+
+type service struct {
+	repo     Repository
+	users    user.Service
+	sessions session.Repository
+	follows  FollowChecker
+	auditLog audit.Service
+	logger   *slog.Logger
+}
+
+func NewService(repo Repository, users user.Service, sessions session.Repository, follows FollowChecker, auditLog audit.Service, logger *slog.Logger) Service {
+	return &service{repo: repo, users: users, sessions: sessions, follows: follows, auditLog: auditLog, logger: logger}
+}
+
+func (s *service) GetSettings(ctx context.Context, userID int64) (*Settings, error) {
+	settings, err := s.repo.GetSettings(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		defaults := DefaultSettings(userID)
+		return &defaults, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get privacy settings: %w", err)
+	}
+	return settings, nil
+}
+
+func (s *service) UpdateSettings(ctx context.Context, userID int64, input UpdateSettings) (*Settings, error) {
+	settings, err := s.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	before := settings.auditFields()
+
+	if input.Visibility != nil {
+		settings.Visibility = *input.Visibility
+	}
+	if input.ShowWeight != nil {
+		settings.ShowWeight = *input.ShowWeight
+	}
+	if input.ShowAge != nil {
+		settings.ShowAge = *input.ShowAge
+	}
+	if input.ShowSessions != nil {
+		settings.ShowSessions = *input.ShowSessions
+	}
+	if input.ShowRecords != nil {
+		settings.ShowRecords = *input.ShowRecords
+	}
+
+	if err := s.repo.SaveSettings(ctx, settings); err != nil {
+		return nil, fmt.Errorf("failed to save privacy settings: %w", err)
+	}
+
+	if changes := audit.Diff(before, settings.auditFields()); len(changes) > 0 {
+		entry := audit.Entry{ActorID: &userID, TargetUserID: &userID, Action: audit.ActionPrivacyUpdated, Changes: changes}
+		if err := s.auditLog.Record(ctx, entry); err != nil {
+			s.logger.Error("Privacy change was applied but not audited", "user_id", userID, "error", err)
+		}
+	}
+	return settings, nil
+}
+
+func (s *service) Access(ctx context.Context, viewerID, ownerID int64) (View, error) {
+	if viewerID == ownerID {
+		return FullView, nil
+	}
+	owner, err := s.users.GetByID(ctx, ownerID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return View{}, nil
+	}
+	if err != nil {
+		return View{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !active(owner) {
+		return View{}, nil
+	}
+
+	settings, err := s.GetSettings(ctx, ownerID)
+	if err != nil {
+		return View{}, err
+	}
+	return s.access(ctx, viewerID, settings)
+}
+
+func active(u *user.User) bool {
+	return u.DisabledAt == nil && u.DeletionScheduledAt == nil
+}
+
+func (s *service) access(ctx context.Context, viewerID int64, settings *Settings) (View, error) {
+	switch settings.Visibility {
+	case VisibilityPublic:
+	case VisibilityFollowers:
+		following, err := s.follows.IsFollowing(ctx, viewerID, settings.UserID)
+		if err != nil {
+			return View{}, fmt.Errorf("failed to check follow: %w", err)
+		}
+		if !following {
+			return View{}, nil
+		}
+	default:
+		return View{}, nil
+	}
+
+	return View{
+		Profile:  true,
+		Weight:   settings.ShowWeight,
+		Age:      settings.ShowAge,
+		Sessions: settings.ShowSessions,
+		Records:  settings.ShowRecords,
+	}, nil
+}
+
+func (s *service) GetPublicProfile(ctx context.Context, viewerID int64, username string) (*PublicProfile, error) {
+	owner, err := s.users.GetByUsername(ctx, username)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil, ErrProfileNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if owner.ID != viewerID && !active(owner) {
+		return nil, ErrProfileNotFound
+	}
+
+	settings, err := s.GetSettings(ctx, owner.ID)
+	if err != nil {
+		return nil, err
+	}
+	view := FullView
+	if owner.ID != viewerID {
+		if view, err = s.access(ctx, viewerID, settings); err != nil {
+			return nil, err
+		}
+	}
+
+	profile := &PublicProfile{Username: owner.Username, Visibility: settings.Visibility, Visible: view.Profile}
+	if !view.Profile {
+		return profile, nil
+	}
+	profile.MemberSince = &owner.CreatedAt
+	if view.Weight && owner.Weight > 0 {
+		profile.Weight = &owner.Weight
+	}
+	if view.Age {
+		profile.Age = owner.AgeOn(time.Now())
+	}
+	if view.Sessions {
+		count, err := s.sessions.CountFinishedSessions(ctx, owner.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count sessions: %w", err)
+		}
+		recent, err := s.sessions.ListFinishedSummaries(ctx, owner.ID, recentSessionsLimit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		profile.SessionCount = &count
+		profile.RecentSessions = recent
+	}
+	if view.Records {
+		records, err := s.sessions.ListPersonalRecords(ctx, owner.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list personal records: %w", err)
+		}
+		profile.PersonalRecords = records
+	}
+	return profile, nil
+}
@@ -0,0 +1,165 @@
+package profile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type fakeRepository struct {
+	Repository
+	settings map[int64]*Settings
+}
+
+func (f *fakeRepository) GetSettings(_ context.Context, userID int64) (*Settings, error) {
+	settings, ok := f.settings[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	s := *settings
+	return &s, nil
+}
+
+type fakeUsers struct {
+	user.Service
+	users map[int64]*user.User
+}
+
+func (f *fakeUsers) GetByID(_ context.Context, id int64) (*user.User, error) {
+	u, ok := f.users[id]
+	if !ok {
+		return nil, apperrors.ErrNotFound
+	}
+	return u, nil
+}
+
+func (f *fakeUsers) GetByUsername(_ context.Context, username string) (*user.User, error) {
+	for _, u := range f.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return nil, apperrors.ErrNotFound
+}
+
+// fakeFollows lists approved follows as follower and followee ID pairs
+type fakeFollows map[[2]int64]bool
+
+func (f fakeFollows) IsFollowing(_ context.Context, followerID, followeeID int64) (bool, error) {
+	return f[[2]int64{followerID, followeeID}], nil
+}
+
+type failingFollows struct{}
+
+func (failingFollows) IsFollowing(context.Context, int64, int64) (bool, error) {
+	return false, errors.New("connection reset")
+}
+
+const (
+	owner    int64 = 1
+	follower int64 = 2
+	stranger int64 = 3
+)
+
+func newTestService(ownerUser *user.User, settings *Settings, follows FollowChecker) Service {
+	repo := &fakeRepository{settings: map[int64]*Settings{}}
+	if settings != nil {
+		settings.UserID = ownerUser.ID
+		repo.settings[ownerUser.ID] = settings
+	}
+	users := &fakeUsers{users: map[int64]*user.User{ownerUser.ID: ownerUser}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewService(repo, users, nil, follows, nil, logger)
+}
+
+func TestAccess(t *testing.T) {
+	follows := fakeFollows{{follower, owner}: true}
+	someFields := func(v Visibility) *Settings {
+		return &Settings{Visibility: v, ShowWeight: true, ShowSessions: true}
+	}
+	visible := View{Profile: true, Weight: true, Sessions: true}
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		owner    *user.User
+		settings *Settings
+		viewer   int64
+		want     View
+	}{
+		{"owner of private profile", &user.User{ID: owner}, someFields(VisibilityPrivate), owner, FullView},
+		{"follower of private profile", &user.User{ID: owner}, someFields(VisibilityPrivate), follower, View{}},
+		{"stranger on private profile", &user.User{ID: owner}, someFields(VisibilityPrivate), stranger, View{}},
+		{"follower of followers profile", &user.User{ID: owner}, someFields(VisibilityFollowers), follower, visible},
+		{"stranger on followers profile", &user.User{ID: owner}, someFields(VisibilityFollowers), stranger, View{}},
+		{"follower of public profile", &user.User{ID: owner}, someFields(VisibilityPublic), follower, visible},
+		{"stranger on public profile", &user.User{ID: owner}, someFields(VisibilityPublic), stranger, visible},
+		{"unknown visibility", &user.User{ID: owner}, someFields("friends"), follower, View{}},
+		{"default settings", &user.User{ID: owner}, nil, follower, View{}},
+		{"disabled account", &user.User{ID: owner, DisabledAt: &now}, someFields(VisibilityPublic), follower, View{}},
+		{"account scheduled for deletion", &user.User{ID: owner, DeletionScheduledAt: &now}, someFields(VisibilityPublic), follower, View{}},
+		{"own disabled account", &user.User{ID: owner, DisabledAt: &now}, someFields(VisibilityPrivate), owner, FullView},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(tt.owner, tt.settings, follows)
+			view, err := s.Access(context.Background(), tt.viewer, owner)
+			if err != nil {
+				t.Fatalf("Access: %v", err)
+			}
+			if view != tt.want {
+				t.Fatalf("view = %+v, want %+v", view, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessUnknownOwner(t *testing.T) {
+	s := newTestService(&user.User{ID: owner}, &Settings{Visibility: VisibilityPublic}, fakeFollows{})
+	view, err := s.Access(context.Background(), stranger, 99)
+	if err != nil || view != (View{}) {
+		t.Fatalf("Access = %+v, %v, want nothing visible of an unknown user", view, err)
+	}
+}
+
+func TestAccessFailsClosed(t *testing.T) {
+	s := newTestService(&user.User{ID: owner}, &Settings{Visibility: VisibilityFollowers, ShowSessions: true}, failingFollows{})
+	view, err := s.Access(context.Background(), follower, owner)
+	if err == nil || view != (View{}) {
+		t.Fatalf("Access = %+v, %v, want an error and nothing visible when follows can't be checked", view, err)
+	}
+}
+
+func TestGetPublicProfileLeavesOutHiddenData(t *testing.T) {
+	ctx := context.Background()
+	anna := &user.User{ID: owner, Username: "anna", Weight: 62}
+
+	s := newTestService(anna, &Settings{Visibility: VisibilityFollowers, ShowWeight: true}, fakeFollows{{follower, owner}: true})
+	profile, err := s.GetPublicProfile(ctx, stranger, "anna")
+	if err != nil {
+		t.Fatalf("GetPublicProfile: %v", err)
+	}
+	if profile.Visible || profile.MemberSince != nil || profile.Weight != nil {
+		t.Fatalf("profile = %+v, want only the username and visibility for a stranger", profile)
+	}
+
+	profile, err = s.GetPublicProfile(ctx, follower, "anna")
+	if err != nil {
+		t.Fatalf("GetPublicProfile: %v", err)
+	}
+	if !profile.Visible || profile.Weight == nil || *profile.Weight != 62 || profile.Age != nil || profile.SessionCount != nil || profile.PersonalRecords != nil {
+		t.Fatalf("profile = %+v, want the weight shown and sessions, records and age left out", profile)
+	}
+
+	now := time.Now()
+	anna.DisabledAt = &now
+	if _, err := s.GetPublicProfile(ctx, follower, "anna"); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("disabled account: err = %v, want ErrProfileNotFound", err)
+	}
+}
@@ -0,0 +1,115 @@
+package security
+
+import (
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const defaultPageSize = 20
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+type ListEventsQuery struct {
+	Type     EventType `form:"type" validate:"omitempty,oneof=login account_locked token_refresh logout logout_all password_change password_reset profile_update account_deletion"`
+	Success  *bool     `form:"success"`
+	Page     int       `form:"page" validate:"omitempty,gte=1"`
+	PageSize int       `form:"page_size" validate:"omitempty,gte=1,lte=100"`
+}
+
+type AdminListEventsQuery struct {
+	ListEventsQuery
+	UserID int64 `form:"user_id" validate:"omitempty,gt=0"`
+}
+
+type EventListResponse struct {
+	Events   []Event `json:"events"`
+	Total    int     `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"page_size"`
+}
+
+// ListMyEvents returns the security history of the current user
+// @Summary List my security events
+// @Description Returns logins, failed attempts, lockouts, password and profile changes of the current user, newest first
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param type query string false "Event type"
+// @Param success query bool false "Only successful or only failed events"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} EventListResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/security-events [get]
+func (h *Handler) ListMyEvents(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	query, ok := validation.BindAndValidateQuery[ListEventsQuery](c)
+	if !ok {
+		return
+	}
+	h.list(c, userID, *query)
+}
+
+// ListEvents searches security events of all users
+// @Summary List security events
+// @Description Admin endpoint to search security events, newest first
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query int false "User ID"
+// @Param type query string false "Event type"
+// @Param success query bool false "Only successful or only failed events"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} EventListResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/admin/security-events [get]
+func (h *Handler) ListEvents(c *gin.Context) {
+	query, ok := validation.BindAndValidateQuery[AdminListEventsQuery](c)
+	if !ok {
+		return
+	}
+	h.list(c, query.UserID, query.ListEventsQuery)
+}
+
+func (h *Handler) list(c *gin.Context, userID int64, query ListEventsQuery) {
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	events, total, err := h.service.List(c.Request.Context(), ListFilter{
+		UserID:  userID,
+		Type:    query.Type,
+		Success: query.Success,
+		Limit:   query.PageSize,
+		Offset:  (query.Page - 1) * query.PageSize,
+	})
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to list security events", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, EventListResponse{Events: events, Total: total, Page: query.Page, PageSize: query.PageSize})
+}
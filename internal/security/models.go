@@ -0,0 +1,76 @@
+package security
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventLogin          EventType = "login"
+	EventAccountLocked  EventType = "account_locked"
+	EventTokenRefresh   EventType = "token_refresh"
+	EventLogout         EventType = "logout"
+	EventLogoutAll      EventType = "logout_all"
+	EventPasswordChange EventType = "password_change"
+	EventPasswordReset  EventType = "password_reset"
+	EventProfileUpdate  EventType = "profile_update"
+	// EventAccountDeletion has an action detail of scheduled or cancelled
+	EventAccountDeletion EventType = "account_deletion"
+)
+
+// EventTypes lists every type that can be used as a filter
+var EventTypes = []EventType{
+	EventLogin, EventAccountLocked, EventTokenRefresh, EventLogout, EventLogoutAll,
+	EventPasswordChange, EventPasswordReset, EventProfileUpdate, EventAccountDeletion,
+}
+
+// Event is a security relevant action on an account, shown to its owner as login history
+type Event struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+	Type      EventType `json:"type" db:"event_type"`
+	Success   bool      `json:"success" db:"success"`
+	IP        string    `json:"ip" db:"ip"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	Details   Details   `json:"details" db:"details"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Details is free-form context stored as JSONB
+type Details map[string]any
+
+func (d Details) Value() (driver.Value, error) {
+	if d == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(d)
+}
+
+func (d *Details) Scan(src any) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+		*d = nil
+		return nil
+	default:
+		return fmt.Errorf("unsupported details type %T", src)
+	}
+	return json.Unmarshal(b, d)
+}
+
+// ListFilter narrows event lists, zero values match everything
+type ListFilter struct {
+	UserID  int64
+	Type    EventType
+	Success *bool
+	Limit   int
+	Offset  int
+}
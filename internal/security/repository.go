@@ -0,0 +1,56 @@
+package security
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"time"
+)
+
+type Repository interface {
+	Create(ctx context.Context, event *Event) error
+	List(ctx context.Context, filter ListFilter) ([]Event, int, error)
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) Create(ctx context.Context, event *Event) error {
+	query := `
+		INSERT INTO security_events (user_id, event_type, success, ip, user_agent, details)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	return r.executor.QueryRowxContext(ctx, query, event.UserID, event.Type, event.Success, event.IP, event.UserAgent, event.Details).
+		Scan(&event.ID, &event.CreatedAt)
+}
+
+func (r *repository) List(ctx context.Context, filter ListFilter) ([]Event, int, error) {
+	where := "WHERE ($1::BIGINT = 0 OR user_id = $1) AND ($2 = '' OR event_type = $2) AND ($3::BOOLEAN IS NULL OR success = $3)"
+	args := []any{filter.UserID, filter.Type, filter.Success}
+
+	var total int
+	if err := r.executor.GetContext(ctx, &total, "SELECT COUNT(*) FROM security_events "+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	events := []Event{}
+	query := "SELECT * FROM security_events " + where + " ORDER BY created_at DESC, id DESC LIMIT $4 OFFSET $5"
+	if err := r.executor.SelectContext(ctx, &events, query, append(args, filter.Limit, filter.Offset)...); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+func (r *repository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.executor.ExecContext(ctx, "DELETE FROM security_events WHERE created_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,55 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/pkg/requestinfo"
+	"log/slog"
+	"time"
+)
+
+type Service interface {
+	// Record stores an event, taking IP and user agent from the request context when they are not set.
+	// Recording is best effort and never fails the action being recorded.
+	Record(ctx context.Context, event Event)
+	List(ctx context.Context, filter ListFilter) ([]Event, int, error)
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+type service struct {
+	repo   Repository
+	logger *slog.Logger
+}
+
+func NewService(repo Repository, logger *slog.Logger) Service {
+	return &service{repo: repo, logger: logger}
+}
+
+func (s *service) Record(ctx context.Context, event Event) {
+	info := requestinfo.From(ctx)
+	if event.IP == "" {
+		event.IP = info.IP
+	}
+	if event.UserAgent == "" {
+		event.UserAgent = info.UserAgent
+	}
+	if err := s.repo.Create(ctx, &event); err != nil {
+		s.logger.Error("Failed to record security event", "type", event.Type, "user_id", event.UserID, "error", err)
+	}
+}
+
+func (s *service) List(ctx context.Context, filter ListFilter) ([]Event, int, error) {
+	events, total, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list security events: %w", err)
+	}
+	return events, total, nil
+}
+
+func (s *service) Purge(ctx context.Context, before time.Time) (int64, error) {
+	deleted, err := s.repo.DeleteBefore(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge security events: %w", err)
+	}
+	return deleted, nil
+}
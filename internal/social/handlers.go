@@ -0,0 +1,350 @@
+package social
+
+import (
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const defaultPageSize = 50
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+type SessionIDPathParam struct {
+	ID int64 `uri:"id" binding:"required" validate:"required,gt=0"`
+}
+
+type CommentPathParam struct {
+	SessionIDPathParam
+	CommentID int64 `uri:"comment_id" binding:"required" validate:"required,gt=0"`
+}
+
+type ReactRequest struct {
+	Reaction ReactionType `json:"reaction" validate:"required,oneof=like fire strong clap"`
+}
+
+type CreateCommentRequest struct {
+	Body string `json:"body" validate:"required,max=2000"`
+	// ParentID replies to another comment of the session
+	ParentID *int64 `json:"parent_id,omitempty" validate:"omitempty,gt=0"`
+}
+
+type UpdateCommentRequest struct {
+	Body string `json:"body" validate:"required,max=2000"`
+}
+
+type ListCommentsQuery struct {
+	Page     int `form:"page" validate:"omitempty,gte=1"`
+	PageSize int `form:"page_size" validate:"omitempty,gte=1,lte=100"`
+}
+
+type CommentListResponse struct {
+	Comments []Comment `json:"comments"`
+	Total    int       `json:"total"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+}
+
+// React reacts to a session
+// @Summary React to session
+// @Description Sets the reaction of the current user on a session, replacing an earlier one. Others can react to finished sessions they are allowed to see.
+// @Tags social
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Param request body ReactRequest true "Reaction"
+// @Success 200 {object} Reactions
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id}/reaction [put]
+func (h *Handler) React(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[SessionIDPathParam](c)
+	if !ok {
+		return
+	}
+	req, ok := validation.BindAndValidate[ReactRequest](c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.React(c.Request.Context(), userID, params.ID, req.Reaction); err != nil {
+		respondError(c, err, "failed to react to session")
+		return
+	}
+	reactions, err := h.service.GetReactions(c.Request.Context(), userID, params.ID)
+	if err != nil {
+		respondError(c, err, "failed to get reactions")
+		return
+	}
+	c.JSON(http.StatusOK, reactions)
+}
+
+// Unreact removes the reaction of the current user
+// @Summary Remove reaction
+// @Tags social
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id}/reaction [delete]
+func (h *Handler) Unreact(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[SessionIDPathParam](c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Unreact(c.Request.Context(), userID, params.ID); err != nil {
+		respondError(c, err, "failed to remove reaction")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetReactions returns reactions on a session
+// @Summary Get session reactions
+// @Description Returns reaction counts by type and the reaction of the current user
+// @Tags social
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Success 200 {object} Reactions
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id}/reactions [get]
+func (h *Handler) GetReactions(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[SessionIDPathParam](c)
+	if !ok {
+		return
+	}
+
+	reactions, err := h.service.GetReactions(c.Request.Context(), userID, params.ID)
+	if err != nil {
+		respondError(c, err, "failed to get reactions")
+		return
+	}
+	c.JSON(http.StatusOK, reactions)
+}
+
+// ListComments lists comments on a session
+// @Summary List session comments
+// @Description Returns comments oldest first. Replies reference their parent by parent_id, deleted comments are kept without author and body so threads stay intact.
+// @Tags social
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} CommentListResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id}/comments [get]
+func (h *Handler) ListComments(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[SessionIDPathParam](c)
+	if !ok {
+		return
+	}
+	query, ok := validation.BindAndValidateQuery[ListCommentsQuery](c)
+	if !ok {
+		return
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	comments, total, err := h.service.ListComments(c.Request.Context(), userID, params.ID, ListFilter{
+		Limit:  query.PageSize,
+		Offset: (query.Page - 1) * query.PageSize,
+	})
+	if err != nil {
+		respondError(c, err, "failed to list comments")
+		return
+	}
+	c.JSON(http.StatusOK, CommentListResponse{
+		Comments: comments,
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	})
+}
+
+// CreateComment comments on a session
+// @Summary Comment on session
+// @Description Adds a comment or a reply to another comment. The session owner and the author of the parent comment are notified.
+// @Tags social
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Param request body CreateCommentRequest true "Comment"
+// @Success 201 {object} Comment
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id}/comments [post]
+func (h *Handler) CreateComment(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[SessionIDPathParam](c)
+	if !ok {
+		return
+	}
+	req, ok := validation.BindAndValidate[CreateCommentRequest](c)
+	if !ok {
+		return
+	}
+
+	comment, err := h.service.Comment(c.Request.Context(), NewComment{
+		SessionID: params.ID,
+		UserID:    userID,
+		ParentID:  req.ParentID,
+		Body:      req.Body,
+	})
+	if err != nil {
+		respondError(c, err, "failed to create comment")
+		return
+	}
+	c.JSON(http.StatusCreated, comment)
+}
+
+// UpdateComment edits a comment
+// @Summary Edit comment
+// @Description Only the author can edit a comment
+// @Tags social
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Param comment_id path int true "Comment ID"
+// @Param request body UpdateCommentRequest true "New body"
+// @Success 200 {object} Comment
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id}/comments/{comment_id} [patch]
+func (h *Handler) UpdateComment(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[CommentPathParam](c)
+	if !ok {
+		return
+	}
+	req, ok := validation.BindAndValidate[UpdateCommentRequest](c)
+	if !ok {
+		return
+	}
+
+	comment, err := h.service.EditComment(c.Request.Context(), userID, params.ID, params.CommentID, req.Body)
+	if err != nil {
+		respondError(c, err, "failed to update comment")
+		return
+	}
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteComment deletes a comment
+// @Summary Delete comment
+// @Description The author and the session owner can delete a comment. Replies to it are kept.
+// @Tags social
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Param comment_id path int true "Comment ID"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id}/comments/{comment_id} [delete]
+func (h *Handler) DeleteComment(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[CommentPathParam](c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteComment(c.Request.Context(), userID, params.ID, params.CommentID); err != nil {
+		respondError(c, err, "failed to delete comment")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrCommentNotFound), errors.Is(err, ErrReactionNotFound):
+		apperrors.GenHTTPError(c, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, ErrNotCommentAuthor), errors.Is(err, ErrCannotDelete):
+		apperrors.GenHTTPError(c, http.StatusForbidden, err.Error(), nil)
+	case errors.Is(err, ErrEmptyComment):
+		apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+	default:
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, message, nil)
+	}
+}
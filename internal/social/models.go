@@ -0,0 +1,49 @@
+package social
+
+import "time"
+
+type ReactionType string
+
+const (
+	ReactionLike   ReactionType = "like"
+	ReactionFire   ReactionType = "fire"
+	ReactionStrong ReactionType = "strong"
+	ReactionClap   ReactionType = "clap"
+)
+
+// Reactions counts reactions on a session by type. Mine is the reaction of the viewer, if any.
+type Reactions struct {
+	Total  int                  `json:"total"`
+	Counts map[ReactionType]int `json:"counts"`
+	Mine   *ReactionType        `json:"mine"`
+}
+
+type reactionCount struct {
+	Reaction ReactionType `db:"reaction"`
+	Count    int          `db:"count"`
+}
+
+// Comment on a session. Deleted comments keep their place in the thread without author and body.
+type Comment struct {
+	ID        int64      `json:"id" db:"id"`
+	SessionID int64      `json:"session_id" db:"session_id"`
+	ParentID  *int64     `json:"parent_id" db:"parent_id"`
+	UserID    *int64     `json:"user_id" db:"user_id"`
+	Username  *string    `json:"username" db:"username"`
+	Body      string     `json:"body" db:"body"`
+	Deleted   bool       `json:"deleted" db:"deleted"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	EditedAt  *time.Time `json:"edited_at" db:"edited_at"`
+}
+
+type NewComment struct {
+	SessionID int64
+	UserID    int64
+	ParentID  *int64
+	Body      string
+}
+
+type ListFilter struct {
+	Limit  int
+	Offset int
+}
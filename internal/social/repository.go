@@ -0,0 +1,144 @@
+package social
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+)
+
+type Repository interface {
+	// SetReaction adds or replaces the reaction of userID, created reports whether the user had none before
+	SetReaction(ctx context.Context, sessionID, userID int64, reaction ReactionType) (created bool, err error)
+	DeleteReaction(ctx context.Context, sessionID, userID int64) error
+	GetReactions(ctx context.Context, sessionID, viewerID int64) (*Reactions, error)
+
+	CreateComment(ctx context.Context, comment NewComment) (*Comment, error)
+	GetComment(ctx context.Context, sessionID, commentID int64) (*Comment, error)
+	ListComments(ctx context.Context, sessionID int64, filter ListFilter) ([]Comment, int, error)
+	UpdateComment(ctx context.Context, commentID int64, body string) error
+	// DeleteComment blanks the comment, replies stay in the thread
+	DeleteComment(ctx context.Context, commentID int64) error
+}
+
+const commentColumns = `c.id, c.session_id, c.parent_id, c.user_id, u.username,
+                        c.body, c.deleted_at IS NOT NULL AS deleted, c.created_at, c.edited_at`
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) SetReaction(ctx context.Context, sessionID, userID int64, reaction ReactionType) (bool, error) {
+	// xmax is 0 for a freshly inserted row and set for a row updated by ON CONFLICT
+	query := `
+		INSERT INTO session_reactions (session_id, user_id, reaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (session_id, user_id) DO UPDATE SET reaction = EXCLUDED.reaction
+		RETURNING xmax = 0`
+	var created bool
+	err := r.executor.QueryRowxContext(ctx, query, sessionID, userID, reaction).Scan(&created)
+	return created, err
+}
+
+func (r *repository) DeleteReaction(ctx context.Context, sessionID, userID int64) error {
+	return r.execOne(ctx, "DELETE FROM session_reactions WHERE session_id = $1 AND user_id = $2", sessionID, userID)
+}
+
+func (r *repository) GetReactions(ctx context.Context, sessionID, viewerID int64) (*Reactions, error) {
+	var counts []reactionCount
+	query := "SELECT reaction, COUNT(*) AS count FROM session_reactions WHERE session_id = $1 GROUP BY reaction"
+	if err := r.executor.SelectContext(ctx, &counts, query, sessionID); err != nil {
+		return nil, err
+	}
+
+	reactions := &Reactions{Counts: make(map[ReactionType]int, len(counts))}
+	for _, c := range counts {
+		reactions.Counts[c.Reaction] = c.Count
+		reactions.Total += c.Count
+	}
+
+	var mine ReactionType
+	query = "SELECT reaction FROM session_reactions WHERE session_id = $1 AND user_id = $2"
+	err := r.executor.GetContext(ctx, &mine, query, sessionID, viewerID)
+	switch {
+	case err == nil:
+		reactions.Mine = &mine
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+	return reactions, nil
+}
+
+func (r *repository) CreateComment(ctx context.Context, comment NewComment) (*Comment, error) {
+	query := `
+		WITH c AS (
+			INSERT INTO session_comments (session_id, user_id, parent_id, body)
+			VALUES ($1, $2, $3, $4)
+			RETURNING *
+		)
+		SELECT ` + commentColumns + `
+		FROM c
+		LEFT JOIN users u ON u.id = c.user_id`
+	var created Comment
+	err := r.executor.GetContext(ctx, &created, query, comment.SessionID, comment.UserID, comment.ParentID, comment.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (r *repository) GetComment(ctx context.Context, sessionID, commentID int64) (*Comment, error) {
+	query := `SELECT ` + commentColumns + `
+		FROM session_comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.session_id = $1 AND c.id = $2`
+	var comment Comment
+	if err := r.executor.GetContext(ctx, &comment, query, sessionID, commentID); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+func (r *repository) ListComments(ctx context.Context, sessionID int64, filter ListFilter) ([]Comment, int, error) {
+	var total int
+	if err := r.executor.GetContext(ctx, &total, "SELECT COUNT(*) FROM session_comments WHERE session_id = $1", sessionID); err != nil {
+		return nil, 0, err
+	}
+
+	comments := []Comment{}
+	query := `SELECT ` + commentColumns + `
+		FROM session_comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.session_id = $1
+		ORDER BY c.created_at, c.id
+		LIMIT $2 OFFSET $3`
+	if err := r.executor.SelectContext(ctx, &comments, query, sessionID, filter.Limit, filter.Offset); err != nil {
+		return nil, 0, err
+	}
+	return comments, total, nil
+}
+
+func (r *repository) UpdateComment(ctx context.Context, commentID int64, body string) error {
+	query := "UPDATE session_comments SET body = $2, edited_at = NOW() WHERE id = $1 AND deleted_at IS NULL"
+	return r.execOne(ctx, query, commentID, body)
+}
+
+func (r *repository) DeleteComment(ctx context.Context, commentID int64) error {
+	query := "UPDATE session_comments SET body = '', user_id = NULL, deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL"
+	return r.execOne(ctx, query, commentID)
+}
+
+func (r *repository) execOne(ctx context.Context, query string, args ...any) error {
+	res, err := r.executor.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package social
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/notification"
+	"github.com/Uranury/WorkoutTracker/internal/profile"
+	"github.com/Uranury/WorkoutTracker/internal/workout/session"
+	"strings"
+)
+
+var (
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrCommentNotFound  = errors.New("comment not found")
+	ErrReactionNotFound = errors.New("reaction not found")
+	ErrEmptyComment     = errors.New("comment cannot be empty")
+	ErrNotCommentAuthor = errors.New("only the author can edit a comment")
+	ErrCannotDelete     = errors.New("only the author or the session owner can delete a comment")
+)
+
+type Service interface {
+	// React sets the reaction of userID on a session, replacing an earlier one. Owners are notified of new reactions only.
+	React(ctx context.Context, userID, sessionID int64, reaction ReactionType) error
+	Unreact(ctx context.Context, userID, sessionID int64) error
+	GetReactions(ctx context.Context, userID, sessionID int64) (*Reactions, error)
+
+	// Comment adds a comment, or a reply when comment.ParentID is set, and notifies the session owner and the parent author
+	Comment(ctx context.Context, comment NewComment) (*Comment, error)
+	ListComments(ctx context.Context, userID, sessionID int64, filter ListFilter) ([]Comment, int, error)
+	EditComment(ctx context.Context, userID, sessionID, commentID int64, body string) (*Comment, error)
+	// DeleteComment is allowed to the author and to the owner of the session
+	DeleteComment(ctx context.Context, userID, sessionID, commentID int64) error
+}
+
+type service struct {
+	repo          Repository
+	sessions      session.Repository
+	profiles      profile.Service
+	notifications notification.Service
+}
+
+func NewService(repo Repository, sessions session.Repository, profiles profile.Service, notifications notification.Service) Service {
+	return &service{repo: repo, sessions: sessions, profiles: profiles, notifications: notifications}
+}
+
+func (s *service) React(ctx context.Context, userID, sessionID int64, reaction ReactionType) error {
+	sess, err := s.visibleSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	created, err := s.repo.SetReaction(ctx, sess.ID, userID, reaction)
+	if err != nil {
+		return fmt.Errorf("failed to set reaction: %w", err)
+	}
+	if created {
+		s.notifications.Notify(ctx, notification.Notification{
+			UserID:    sess.UserID,
+			ActorID:   &userID,
+			Type:      notification.TypeSessionReaction,
+			SessionID: &sess.ID,
+		})
+	}
+	return nil
+}
+
+func (s *service) Unreact(ctx context.Context, userID, sessionID int64) error {
+	if _, err := s.visibleSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	err := s.repo.DeleteReaction(ctx, sessionID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrReactionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete reaction: %w", err)
+	}
+	return nil
+}
+
+func (s *service) GetReactions(ctx context.Context, userID, sessionID int64) (*Reactions, error) {
+	if _, err := s.visibleSession(ctx, userID, sessionID); err != nil {
+		return nil, err
+	}
+
+	reactions, err := s.repo.GetReactions(ctx, sessionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reactions: %w", err)
+	}
+	return reactions, nil
+}
+
+func (s *service) Comment(ctx context.Context, comment NewComment) (*Comment, error) {
+	comment.Body = strings.TrimSpace(comment.Body)
+	if comment.Body == "" {
+		return nil, ErrEmptyComment
+	}
+	sess, err := s.visibleSession(ctx, comment.UserID, comment.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var parent *Comment
+	if comment.ParentID != nil {
+		// replies to deleted comments are refused, the thread around them is read-only
+		if parent, err = s.comment(ctx, sess.ID, *comment.ParentID); err != nil {
+			return nil, err
+		}
+		if parent.Deleted {
+			return nil, ErrCommentNotFound
+		}
+	}
+
+	created, err := s.repo.CreateComment(ctx, comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+
+	s.notifications.Notify(ctx, notification.Notification{
+		UserID:    sess.UserID,
+		ActorID:   &comment.UserID,
+		Type:      notification.TypeSessionComment,
+		SessionID: &sess.ID,
+		CommentID: &created.ID,
+	})
+	if parent != nil && parent.UserID != nil && *parent.UserID != sess.UserID {
+		s.notifications.Notify(ctx, notification.Notification{
+			UserID:    *parent.UserID,
+			ActorID:   &comment.UserID,
+			Type:      notification.TypeCommentReply,
+			SessionID: &sess.ID,
+			CommentID: &created.ID,
+		})
+	}
+	return created, nil
+}
+
+func (s *service) ListComments(ctx context.Context, userID, sessionID int64, filter ListFilter) ([]Comment, int, error) {
+	if _, err := s.visibleSession(ctx, userID, sessionID); err != nil {
+		return nil, 0, err
+	}
+
+	comments, total, err := s.repo.ListComments(ctx, sessionID, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list comments: %w", err)
+	}
+	return comments, total, nil
+}
+
+func (s *service) EditComment(ctx context.Context, userID, sessionID, commentID int64, body string) (*Comment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, ErrEmptyComment
+	}
+	if _, err := s.visibleSession(ctx, userID, sessionID); err != nil {
+		return nil, err
+	}
+
+	comment, err := s.comment(ctx, sessionID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.Deleted {
+		return nil, ErrCommentNotFound
+	}
+	if comment.UserID == nil || *comment.UserID != userID {
+		return nil, ErrNotCommentAuthor
+	}
+
+	err = s.repo.UpdateComment(ctx, commentID, body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update comment: %w", err)
+	}
+	return s.comment(ctx, sessionID, commentID)
+}
+
+func (s *service) DeleteComment(ctx context.Context, userID, sessionID, commentID int64) error {
+	sess, err := s.visibleSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	comment, err := s.comment(ctx, sessionID, commentID)
+	if err != nil {
+		return err
+	}
+	if comment.Deleted {
+		return ErrCommentNotFound
+	}
+	isAuthor := comment.UserID != nil && *comment.UserID == userID
+	if !isAuthor && sess.UserID != userID {
+		return ErrCannotDelete
+	}
+
+	err = s.repo.DeleteComment(ctx, commentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCommentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+	return nil
+}
+
+// visibleSession returns a session the viewer may interact with. Owners see all of their sessions,
+// others only finished sessions of profiles that share sessions with them; anything else is not found.
+func (s *service) visibleSession(ctx context.Context, viewerID, sessionID int64) (*session.Session, error) {
+	sess, err := s.sessions.GetSessionByID(ctx, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if sess.UserID == viewerID {
+		return &sess, nil
+	}
+	if sess.FinishedAt == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	view, err := s.profiles.Access(ctx, viewerID, sess.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !view.Sessions {
+		return nil, ErrSessionNotFound
+	}
+	return &sess, nil
+}
+
+func (s *service) comment(ctx context.Context, sessionID, commentID int64) (*Comment, error) {
+	comment, err := s.repo.GetComment(ctx, sessionID, commentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+	return comment, nil
+}
@@ -0,0 +1,231 @@
+package social
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/notification"
+	"github.com/Uranury/WorkoutTracker/internal/profile"
+	"github.com/Uranury/WorkoutTracker/internal/workout/session"
+	"testing"
+	"time"
+)
+
+// fakeRepository counts every call, a session the viewer may not see must never reach it
+type fakeRepository struct {
+	calls    int
+	comments map[int64]*Comment
+}
+
+func (f *fakeRepository) SetReaction(context.Context, int64, int64, ReactionType) (bool, error) {
+	f.calls++
+	return true, nil
+}
+
+func (f *fakeRepository) DeleteReaction(context.Context, int64, int64) error {
+	f.calls++
+	return nil
+}
+
+func (f *fakeRepository) GetReactions(context.Context, int64, int64) (*Reactions, error) {
+	f.calls++
+	return &Reactions{Counts: map[ReactionType]int{}}, nil
+}
+
+func (f *fakeRepository) CreateComment(_ context.Context, c NewComment) (*Comment, error) {
+	f.calls++
+	comment := &Comment{ID: int64(len(f.comments) + 1), SessionID: c.SessionID, ParentID: c.ParentID, UserID: &c.UserID, Body: c.Body}
+	f.comments[comment.ID] = comment
+	return comment, nil
+}
+
+func (f *fakeRepository) GetComment(_ context.Context, sessionID, commentID int64) (*Comment, error) {
+	f.calls++
+	comment, ok := f.comments[commentID]
+	if !ok || comment.SessionID != sessionID {
+		return nil, sql.ErrNoRows
+	}
+	c := *comment
+	return &c, nil
+}
+
+func (f *fakeRepository) ListComments(context.Context, int64, ListFilter) ([]Comment, int, error) {
+	f.calls++
+	return []Comment{}, 0, nil
+}
+
+func (f *fakeRepository) UpdateComment(_ context.Context, commentID int64, body string) error {
+	f.calls++
+	f.comments[commentID].Body = body
+	return nil
+}
+
+func (f *fakeRepository) DeleteComment(_ context.Context, commentID int64) error {
+	f.calls++
+	f.comments[commentID].Deleted = true
+	return nil
+}
+
+type fakeSessions struct {
+	session.Repository
+	sessions map[int64]session.Session
+}
+
+func (f *fakeSessions) GetSessionByID(_ context.Context, sessionID int64) (session.Session, error) {
+	sess, ok := f.sessions[sessionID]
+	if !ok {
+		return session.Session{}, sql.ErrNoRows
+	}
+	return sess, nil
+}
+
+// fakeProfiles gives every viewer the same view of other users
+type fakeProfiles struct {
+	profile.Service
+	view profile.View
+	err  error
+}
+
+func (f *fakeProfiles) Access(context.Context, int64, int64) (profile.View, error) {
+	return f.view, f.err
+}
+
+type fakeNotifications struct {
+	notification.Service
+	sent []notification.Notification
+}
+
+func (f *fakeNotifications) Notify(_ context.Context, n notification.Notification) {
+	f.sent = append(f.sent, n)
+}
+
+const (
+	owner  int64 = 1
+	viewer int64 = 2
+
+	finishedSession   int64 = 10
+	unfinishedSession int64 = 11
+	missingSession    int64 = 12
+)
+
+type testService struct {
+	Service
+	repo          *fakeRepository
+	notifications *fakeNotifications
+}
+
+func newTestService(profiles *fakeProfiles) *testService {
+	finished := time.Now()
+	sessions := &fakeSessions{sessions: map[int64]session.Session{
+		finishedSession:   {ID: finishedSession, UserID: owner, FinishedAt: &finished},
+		unfinishedSession: {ID: unfinishedSession, UserID: owner},
+	}}
+	repo := &fakeRepository{comments: map[int64]*Comment{}}
+	notifications := &fakeNotifications{}
+	return &testService{Service: NewService(repo, sessions, profiles, notifications), repo: repo, notifications: notifications}
+}
+
+// interact calls every operation on sessionID as userID and returns their errors by name
+func interact(s Service, userID, sessionID int64) map[string]error {
+	ctx := context.Background()
+	errs := map[string]error{}
+	errs["React"] = s.React(ctx, userID, sessionID, ReactionLike)
+	errs["Unreact"] = s.Unreact(ctx, userID, sessionID)
+	_, errs["GetReactions"] = s.GetReactions(ctx, userID, sessionID)
+	_, errs["Comment"] = s.Comment(ctx, NewComment{SessionID: sessionID, UserID: userID, Body: "nice"})
+	_, _, errs["ListComments"] = s.ListComments(ctx, userID, sessionID, ListFilter{Limit: 20})
+	_, errs["EditComment"] = s.EditComment(ctx, userID, sessionID, 1, "edited")
+	errs["DeleteComment"] = s.DeleteComment(ctx, userID, sessionID, 1)
+	return errs
+}
+
+func TestInvisibleSessionsAreNotFound(t *testing.T) {
+	tests := []struct {
+		name      string
+		view      profile.View
+		sessionID int64
+	}{
+		{"hidden profile", profile.View{}, finishedSession},
+		{"sessions hidden on visible profile", profile.View{Profile: true, Weight: true, Records: true}, finishedSession},
+		{"unfinished session", profile.View{Profile: true, Sessions: true}, unfinishedSession},
+		{"unknown session", profile.View{Profile: true, Sessions: true}, missingSession},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(&fakeProfiles{view: tt.view})
+			// a comment the viewer would otherwise be allowed to edit and delete
+			author := viewer
+			s.repo.comments[1] = &Comment{ID: 1, SessionID: tt.sessionID, UserID: &author}
+
+			for op, err := range interact(s, viewer, tt.sessionID) {
+				if !errors.Is(err, ErrSessionNotFound) {
+					t.Errorf("%s: err = %v, want ErrSessionNotFound", op, err)
+				}
+			}
+			if s.repo.calls != 0 || len(s.notifications.sent) != 0 {
+				t.Fatalf("%d repository calls and %d notifications, want none", s.repo.calls, len(s.notifications.sent))
+			}
+		})
+	}
+}
+
+func TestAccessFailureBlocksInteraction(t *testing.T) {
+	failure := errors.New("connection reset")
+	s := newTestService(&fakeProfiles{err: failure})
+
+	for op, err := range interact(s, viewer, finishedSession) {
+		if !errors.Is(err, failure) {
+			t.Errorf("%s: err = %v, want the access error", op, err)
+		}
+	}
+	if s.repo.calls != 0 {
+		t.Fatalf("%d repository calls, want none", s.repo.calls)
+	}
+}
+
+func TestVisibleSessionInteractions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(&fakeProfiles{view: profile.View{Profile: true, Sessions: true}})
+
+	if err := s.React(ctx, viewer, finishedSession, ReactionFire); err != nil {
+		t.Fatalf("React: %v", err)
+	}
+	comment, err := s.Comment(ctx, NewComment{SessionID: finishedSession, UserID: viewer, Body: "  nice  "})
+	if err != nil {
+		t.Fatalf("Comment: %v", err)
+	}
+	if comment.Body != "nice" {
+		t.Fatalf("body = %q, want it trimmed", comment.Body)
+	}
+	if len(s.notifications.sent) != 2 || s.notifications.sent[0].UserID != owner || s.notifications.sent[1].Type != notification.TypeSessionComment {
+		t.Fatalf("notifications = %+v, want the owner told about the reaction and the comment", s.notifications.sent)
+	}
+
+	// owners see their own sessions before they are finished
+	if _, err := s.Comment(ctx, NewComment{SessionID: unfinishedSession, UserID: owner, Body: "warming up"}); err != nil {
+		t.Fatalf("owner Comment on unfinished session: %v", err)
+	}
+}
+
+func TestCommentPermissions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(&fakeProfiles{view: profile.View{Profile: true, Sessions: true}})
+	comment, err := s.Comment(ctx, NewComment{SessionID: finishedSession, UserID: viewer, Body: "nice"})
+	if err != nil {
+		t.Fatalf("Comment: %v", err)
+	}
+
+	const third int64 = 3
+	if _, err := s.EditComment(ctx, owner, finishedSession, comment.ID, "rewritten"); !errors.Is(err, ErrNotCommentAuthor) {
+		t.Fatalf("EditComment by owner: err = %v, want ErrNotCommentAuthor", err)
+	}
+	if err := s.DeleteComment(ctx, third, finishedSession, comment.ID); !errors.Is(err, ErrCannotDelete) {
+		t.Fatalf("DeleteComment by another viewer: err = %v, want ErrCannotDelete", err)
+	}
+	if err := s.DeleteComment(ctx, owner, finishedSession, comment.ID); err != nil {
+		t.Fatalf("DeleteComment by session owner: %v", err)
+	}
+	if _, err := s.Comment(ctx, NewComment{SessionID: finishedSession, UserID: third, ParentID: &comment.ID, Body: "reply"}); !errors.Is(err, ErrCommentNotFound) {
+		t.Fatalf("reply to deleted comment: err = %v, want ErrCommentNotFound", err)
+	}
+}
@@ -0,0 +1,215 @@
+package twofactor
+
+import (
+	"context"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Accounts is the part of the user module needed to label enrollments and re-authenticate users
+type Accounts interface {
+	AccountName(ctx context.Context, userID int64) (string, error)
+	VerifyPassword(ctx context.Context, userID int64, password string) error
+}
+
+type Handler struct {
+	service  Service
+	accounts Accounts
+}
+
+func NewHandler(service Service, accounts Accounts) *Handler {
+	return &Handler{service: service, accounts: accounts}
+}
+
+type ConfirmRequest struct {
+	Code string `json:"code" binding:"required" validate:"required,len=6,numeric"`
+}
+
+type ReauthRequest struct {
+	Password string `json:"password" binding:"required" validate:"required"`
+	Code     string `json:"code" binding:"required" validate:"required,min=6,max=16"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// GetStatus returns two-factor state of the current user
+// @Summary Get two-factor status
+// @Description Returns whether TOTP is enabled and how many recovery codes are left
+// @Tags two-factor
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Status
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/2fa [get]
+func (h *Handler) GetStatus(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	status, err := h.service.Status(c.Request.Context(), userID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to get two-factor status", nil)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// Enroll starts TOTP enrollment
+// @Summary Start two-factor enrollment
+// @Description Generates a new TOTP secret and otpauth URI, enrollment is pending until confirmed with a code
+// @Tags two-factor
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Enrollment
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 409 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/2fa/enroll [post]
+func (h *Handler) Enroll(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	account, err := h.accounts.AccountName(c.Request.Context(), userID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to get user", nil)
+		return
+	}
+
+	enrollment, err := h.service.BeginEnrollment(c.Request.Context(), userID, account)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Confirm enables TOTP after the first valid code
+// @Summary Confirm two-factor enrollment
+// @Description Verifies the first code from the authenticator app, enables 2FA and returns one-time recovery codes
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ConfirmRequest true "Code from the authenticator app"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 409 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/2fa/confirm [post]
+func (h *Handler) Confirm(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	req, ok := validation.BindAndValidate[ConfirmRequest](c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.ConfirmEnrollment(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable turns off TOTP
+// @Summary Disable two-factor authentication
+// @Description Requires the current password and a TOTP or recovery code
+// @Tags two-factor
+// @Accept json
+// @Security BearerAuth
+// @Param request body ReauthRequest true "Re-authentication payload"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/2fa/disable [post]
+func (h *Handler) Disable(c *gin.Context) {
+	userID, req, ok := h.reauthenticate(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Disable(c.Request.Context(), userID, req.Code); err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes
+// @Summary Regenerate recovery codes
+// @Description Requires the current password and a TOTP or recovery code, previous recovery codes stop working
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ReauthRequest true "Re-authentication payload"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/2fa/recovery-codes [post]
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, req, ok := h.reauthenticate(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// reauthenticate binds the request and checks the password, the second factor is checked by the service
+func (h *Handler) reauthenticate(c *gin.Context) (int64, *ReauthRequest, bool) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return 0, nil, false
+	}
+
+	req, ok := validation.BindAndValidate[ReauthRequest](c)
+	if !ok {
+		return 0, nil, false
+	}
+
+	if err := h.accounts.VerifyPassword(c.Request.Context(), userID, req.Password); err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, "invalid password", nil)
+		return 0, nil, false
+	}
+	return userID, req, true
+}
+
+func (h *Handler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidCode):
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+	case errors.Is(err, ErrNotEnrolled), errors.Is(err, ErrPendingMissing):
+		apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+	case errors.Is(err, ErrAlreadyEnabled):
+		apperrors.GenHTTPError(c, http.StatusConflict, err.Error(), nil)
+	default:
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "two-factor operation failed", nil)
+	}
+}
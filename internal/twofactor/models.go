@@ -0,0 +1,33 @@
+package twofactor
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotEnrolled    = errors.New("two-factor authentication is not enabled")
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrInvalidCode    = errors.New("invalid authentication code")
+	ErrPendingMissing = errors.New("no pending two-factor enrollment, start enrollment first")
+)
+
+const RecoveryCodesCount = 10
+
+type TOTP struct {
+	UserID       int64      `db:"user_id"`
+	Secret       string     `db:"secret"`
+	ConfirmedAt  *time.Time `db:"confirmed_at"`
+	LastUsedStep int64      `db:"last_used_step"`
+	CreatedAt    time.Time  `db:"created_at"`
+}
+
+type Status struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+type Enrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
@@ -0,0 +1,101 @@
+package twofactor
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+)
+
+type Repository interface {
+	Get(ctx context.Context, userID int64) (*TOTP, error)
+	UpsertPending(ctx context.Context, userID int64, secret string) error
+	Confirm(ctx context.Context, userID int64, step int64) error
+	ConsumeStep(ctx context.Context, userID int64, step int64) (bool, error)
+	Delete(ctx context.Context, userID int64) error
+
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+}
+
+type repository struct {
+	executor database.Executor
+}
+
+func NewRepository(executor database.Executor) Repository {
+	return &repository{executor: executor}
+}
+
+func (r *repository) Get(ctx context.Context, userID int64) (*TOTP, error) {
+	var t TOTP
+	query := `SELECT * FROM user_totp WHERE user_id = $1`
+	if err := r.executor.GetContext(ctx, &t, query, userID); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// UpsertPending starts a new enrollment, replacing any unconfirmed one. Confirmed secrets are left untouched.
+func (r *repository) UpsertPending(ctx context.Context, userID int64, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL
+	`
+	_, err := r.executor.ExecContext(ctx, query, userID, secret)
+	return err
+}
+
+func (r *repository) Confirm(ctx context.Context, userID int64, step int64) error {
+	query := `UPDATE user_totp SET confirmed_at = NOW(), last_used_step = $2 WHERE user_id = $1`
+	_, err := r.executor.ExecContext(ctx, query, userID, step)
+	return err
+}
+
+// ConsumeStep records step as used. It returns false if that step, or a later one, was already used.
+func (r *repository) ConsumeStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	query := `UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`
+	res, err := r.executor.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *repository) Delete(ctx context.Context, userID int64) error {
+	if _, err := r.executor.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_, err := r.executor.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+	return err
+}
+
+func (r *repository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	if _, err := r.executor.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	query := `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	for _, hash := range codeHashes {
+		if _, err := r.executor.ExecContext(ctx, query, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *repository) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	query := `UPDATE user_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	res, err := r.executor.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *repository) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	err := r.executor.GetContext(ctx, &count, query, userID)
+	return count, err
+}
@@ -0,0 +1,218 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"github.com/Uranury/WorkoutTracker/pkg/totp"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// allowedSkew accepts codes from one step before and after the current one to tolerate clock drift
+const allowedSkew = 1
+
+type Service interface {
+	Status(ctx context.Context, userID int64) (*Status, error)
+	IsEnabled(ctx context.Context, userID int64) (bool, error)
+	BeginEnrollment(ctx context.Context, userID int64, account string) (*Enrollment, error)
+	ConfirmEnrollment(ctx context.Context, userID int64, code string) ([]string, error)
+	// Verify accepts either a current TOTP code or an unused recovery code
+	Verify(ctx context.Context, userID int64, code string) error
+	Disable(ctx context.Context, userID int64, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) ([]string, error)
+}
+
+type service struct {
+	repo       Repository
+	txProvider database.TxProvider
+	issuer     string
+	logger     *slog.Logger
+}
+
+func NewService(repo Repository, txProvider database.TxProvider, issuer string, logger *slog.Logger) Service {
+	return &service{repo: repo, txProvider: txProvider, issuer: issuer, logger: logger}
+}
+
+func (s *service) Status(ctx context.Context, userID int64) (*Status, error) {
+	enabled, err := s.IsEnabled(ctx, userID)
+	if err != nil || !enabled {
+		return &Status{}, err
+	}
+
+	remaining, err := s.repo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return &Status{Enabled: true, RecoveryCodesRemaining: remaining}, nil
+}
+
+func (s *service) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	t, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get totp: %w", err)
+	}
+	return t.ConfirmedAt != nil, nil
+}
+
+func (s *service) BeginEnrollment(ctx context.Context, userID int64, account string) (*Enrollment, error) {
+	enabled, err := s.IsEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+	if err := s.repo.UpsertPending(ctx, userID, secret); err != nil {
+		return nil, fmt.Errorf("failed to save totp secret: %w", err)
+	}
+
+	return &Enrollment{Secret: secret, OTPAuthURI: totp.URI(s.issuer, account, secret)}, nil
+}
+
+// ConfirmEnrollment enables 2FA once the user proves their authenticator produces valid codes
+func (s *service) ConfirmEnrollment(ctx context.Context, userID int64, code string) ([]string, error) {
+	t, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPendingMissing
+		}
+		return nil, fmt.Errorf("failed to get totp: %w", err)
+	}
+	if t.ConfirmedAt != nil {
+		return nil, ErrAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(t.Secret, code, time.Now(), allowedSkew)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.txProvider.RunInTx(ctx, func(exec database.Executor) error {
+		repo := NewRepository(exec)
+		if err := repo.Confirm(ctx, userID, step); err != nil {
+			return fmt.Errorf("confirm totp: %w", err)
+		}
+		if err := repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+			return fmt.Errorf("save recovery codes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *service) Verify(ctx context.Context, userID int64, code string) error {
+	t, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotEnrolled
+		}
+		return fmt.Errorf("failed to get totp: %w", err)
+	}
+	if t.ConfirmedAt == nil {
+		return ErrNotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(t.Secret, code, time.Now(), allowedSkew)
+		if !ok {
+			return ErrInvalidCode
+		}
+		// a code is valid for the whole step window, refuse to accept it twice
+		fresh, err := s.repo.ConsumeStep(ctx, userID, step)
+		if err != nil {
+			return fmt.Errorf("failed to record totp step: %w", err)
+		}
+		if !fresh {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	used, err := s.repo.ConsumeRecoveryCode(ctx, userID, auth.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	if !used {
+		return ErrInvalidCode
+	}
+	s.logger.Info("Recovery code used", "user_id", userID)
+	return nil
+}
+
+func (s *service) Disable(ctx context.Context, userID int64, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, userID); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	return nil
+}
+
+func (s *service) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.txProvider.RunInTx(ctx, func(exec database.Executor) error {
+		return NewRepository(exec).ReplaceRecoveryCodes(ctx, userID, hashes)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns codes formatted as "xxxxx-xxxxx" and the hashes to store.
+// Each code carries 50 bits of entropy, so a fast hash is sufficient.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, RecoveryCodesCount)
+	hashes := make([]string, 0, RecoveryCodesCount)
+	for range RecoveryCodesCount {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, auth.HashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,284 @@
+package twofactor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"github.com/Uranury/WorkoutTracker/pkg/totp"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRepository keeps the same rules as the SQL: a step is only consumed when it is later than the last
+// used one and a recovery code only while it is unused
+type fakeRepository struct {
+	Repository
+	totp          map[int64]*TOTP
+	recoveryCodes map[int64]map[string]bool
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{totp: make(map[int64]*TOTP), recoveryCodes: make(map[int64]map[string]bool)}
+}
+
+func (f *fakeRepository) Get(_ context.Context, userID int64) (*TOTP, error) {
+	t, ok := f.totp[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *t
+	return &copied, nil
+}
+
+func (f *fakeRepository) ConsumeStep(_ context.Context, userID int64, step int64) (bool, error) {
+	t, ok := f.totp[userID]
+	if !ok || t.LastUsedStep >= step {
+		return false, nil
+	}
+	t.LastUsedStep = step
+	return true, nil
+}
+
+func (f *fakeRepository) ConsumeRecoveryCode(_ context.Context, userID int64, codeHash string) (bool, error) {
+	used, ok := f.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	f.recoveryCodes[userID][codeHash] = true
+	return true, nil
+}
+
+func (f *fakeRepository) Delete(_ context.Context, userID int64) error {
+	delete(f.totp, userID)
+	delete(f.recoveryCodes, userID)
+	return nil
+}
+
+// enroll confirms a secret for userID with the given recovery codes
+func (f *fakeRepository) enroll(t *testing.T, userID int64, recoveryCodes ...string) string {
+	t.Helper()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	confirmedAt := time.Now()
+	f.totp[userID] = &TOTP{UserID: userID, Secret: secret, ConfirmedAt: &confirmedAt}
+	f.recoveryCodes[userID] = make(map[string]bool)
+	for _, code := range recoveryCodes {
+		f.recoveryCodes[userID][auth.HashToken(normalizeRecoveryCode(code))] = false
+	}
+	return secret
+}
+
+func newTestService(repo Repository) Service {
+	return NewService(repo, nil, "Workout Tracker", slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func codeAt(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, step)
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+	return code
+}
+
+// otherCode changes the first digit, so the result never matches code
+func otherCode(code string) string {
+	return string('0'+(code[0]-'0'+1)%10) + code[1:]
+}
+
+func TestVerifyRejectsReplayedStep(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	secret := repo.enroll(t, 7)
+	s := newTestService(repo)
+
+	code := codeAt(t, secret, totp.Step(time.Now()))
+	if err := s.Verify(ctx, 7, code); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := s.Verify(ctx, 7, code); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("replayed code: Verify = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestVerifyRejectsEarlierStepAfterLaterOne(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	secret := repo.enroll(t, 7)
+	s := newTestService(repo)
+
+	current := totp.Step(time.Now())
+	if err := s.Verify(ctx, 7, codeAt(t, secret, current+1)); err != nil {
+		t.Fatalf("Verify(next step): %v", err)
+	}
+	// still within the skew window, but older than the step already used
+	if err := s.Verify(ctx, 7, codeAt(t, secret, current)); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Verify(current step) = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestVerifyRejectsWrongAndStaleCodes(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	secret := repo.enroll(t, 7)
+	s := newTestService(repo)
+
+	current := totp.Step(time.Now())
+	for _, code := range []string{otherCode(codeAt(t, secret, current)), codeAt(t, secret, current-allowedSkew-1), "12345-67890"} {
+		if err := s.Verify(ctx, 7, code); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("Verify(%q) = %v, want ErrInvalidCode", code, err)
+		}
+	}
+}
+
+func TestVerifyRequiresConfirmedEnrollment(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	secret := repo.enroll(t, 7)
+	repo.totp[7].ConfirmedAt = nil
+	s := newTestService(repo)
+
+	code := codeAt(t, secret, totp.Step(time.Now()))
+	if err := s.Verify(ctx, 7, code); !errors.Is(err, ErrNotEnrolled) {
+		t.Fatalf("pending enrollment: Verify = %v, want ErrNotEnrolled", err)
+	}
+	if err := s.Verify(ctx, 8, code); !errors.Is(err, ErrNotEnrolled) {
+		t.Fatalf("no enrollment: Verify = %v, want ErrNotEnrolled", err)
+	}
+}
+
+func TestRecoveryCodeIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	repo.enroll(t, 7, "abcde-fghij", "klmno-pqrst")
+	repo.enroll(t, 8, "uvwxy-z2345")
+	s := newTestService(repo)
+
+	// codes are accepted however the user types them
+	if err := s.Verify(ctx, 7, " ABCDE FGHIJ "); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := s.Verify(ctx, 7, "abcde-fghij"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("reused recovery code: Verify = %v, want ErrInvalidCode", err)
+	}
+	if err := s.Verify(ctx, 7, "uvwxy-z2345"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("another user's recovery code: Verify = %v, want ErrInvalidCode", err)
+	}
+	if err := s.Verify(ctx, 7, "klmnopqrst"); err != nil {
+		t.Fatalf("second recovery code: Verify = %v", err)
+	}
+}
+
+func TestDisableRequiresValidCode(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	secret := repo.enroll(t, 7)
+	s := newTestService(repo)
+
+	code := codeAt(t, secret, totp.Step(time.Now()))
+	if err := s.Disable(ctx, 7, otherCode(code)); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Disable = %v, want ErrInvalidCode", err)
+	}
+	if _, ok := repo.totp[7]; !ok {
+		t.Fatal("two-factor authentication was disabled without a valid code")
+	}
+	if err := s.Disable(ctx, 7, code); err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	if _, ok := repo.totp[7]; ok {
+		t.Fatal("two-factor authentication is still enabled")
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("generateRecoveryCodes: %v", err)
+	}
+	if len(codes) != RecoveryCodesCount || len(hashes) != RecoveryCodesCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), RecoveryCodesCount)
+	}
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q is not formatted as xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q is repeated", code)
+		}
+		seen[code] = true
+		if hashes[i] != auth.HashToken(normalizeRecoveryCode(strings.ToUpper(code))) {
+			t.Errorf("hash of %q does not match the normalized code", code)
+		}
+	}
+}
+
+// txOver runs transactions directly on a mocked connection
+type txOver struct {
+	db *sqlx.DB
+}
+
+func (p txOver) RunInTx(_ context.Context, fn func(database.Executor) error) error {
+	return fn(p.db)
+}
+
+func TestConfirmEnrollmentStoresStepAndRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := newFakeRepository()
+	secret := repo.enroll(t, 7)
+	repo.totp[7].ConfirmedAt = nil
+	s := NewService(repo, txOver{db: sqlx.NewDb(db, "postgres")}, "Workout Tracker", slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	step := totp.Step(time.Now())
+	mock.ExpectExec(`UPDATE user_totp SET confirmed_at = NOW\(\), last_used_step = \$2 WHERE user_id = \$1`).
+		WithArgs(int64(7), step).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM user_recovery_codes WHERE user_id = \$1`).
+		WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 0))
+	for range RecoveryCodesCount {
+		mock.ExpectExec(`INSERT INTO user_recovery_codes`).
+			WithArgs(int64(7), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	codes, err := s.ConfirmEnrollment(ctx, 7, codeAt(t, secret, step))
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+	if len(codes) != RecoveryCodesCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), RecoveryCodesCount)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfirmEnrollmentRejectsWrongCode(t *testing.T) {
+	repo := newFakeRepository()
+	secret := repo.enroll(t, 7)
+	repo.totp[7].ConfirmedAt = nil
+	s := newTestService(repo)
+
+	code := codeAt(t, secret, totp.Step(time.Now())-allowedSkew-1)
+	if _, err := s.ConfirmEnrollment(context.Background(), 7, code); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("ConfirmEnrollment = %v, want ErrInvalidCode", err)
+	}
+	if _, err := s.ConfirmEnrollment(context.Background(), 8, code); !errors.Is(err, ErrPendingMissing) {
+		t.Fatalf("without enrollment: ConfirmEnrollment = %v, want ErrPendingMissing", err)
+	}
+}
@@ -0,0 +1,26 @@
+package user
+
+import (
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/bruteforce"
+)
+
+var (
+	ErrInvalidPassword       = errors.New("invalid password")
+	ErrAccountLocked         = errors.New("account is locked, please try again later")
+	ErrAccountDisabled       = errors.New("account is disabled")
+	ErrPasswordResetRequired = errors.New("password reset required, check your email")
+	ErrInvalidResetToken     = errors.New("invalid or expired reset token")
+	ErrInvalidMagicLink      = errors.New("invalid or expired sign-in link")
+	ErrInvalidBirthdate      = errors.New("age must be between 13 and 120")
+)
+
+// ChallengeRequiredError is returned when the account has too many failed attempts and the
+// login must include a solved proof-of-work challenge
+type ChallengeRequiredError struct {
+	Challenge *bruteforce.Challenge
+}
+
+func (e *ChallengeRequiredError) Error() string {
+	return "login challenge required"
+}
@@ -3,39 +3,60 @@ package user
 import (
 	"errors"
 	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/bruteforce"
 	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/internal/twofactor"
 	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/cookie"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"github.com/Uranury/WorkoutTracker/pkg/password"
 	"github.com/Uranury/WorkoutTracker/pkg/validation"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strings"
+	"time"
+)
+
+// magicLinkCookie binds a requested sign-in link to the requesting browser
+const (
+	magicLinkCookie     = "magic_link_binding"
+	magicLinkCookiePath = "/auth/magic-link"
 )
 
 type Handler struct {
-	service     Service
-	authService auth.Service
+	service          Service
+	authService      auth.Service
+	twoFactorService twofactor.Service
+	cookies          *cookie.Jar
 }
 
-func NewHandler(service Service, authService auth.Service) *Handler {
-	return &Handler{service: service, authService: authService}
+func NewHandler(service Service, authService auth.Service, twoFactorService twofactor.Service, cookies *cookie.Jar) *Handler {
+	return &Handler{service: service, authService: authService, twoFactorService: twoFactorService, cookies: cookies}
 }
 
 type SignUpRequest struct {
 	Username string `json:"username" binding:"required" validate:"required,min=3,max=32"`
-	Password string `json:"password" binding:"required" validate:"required,min=8"`
+	Password string `json:"password" binding:"required" validate:"required"`
 	Email    string `json:"email" binding:"required" validate:"required,email"`
-	Age      int    `json:"age" binding:"required" validate:"required,gt=0"`
-	Gender   string `json:"gender" binding:"required" validate:"required,oneof=male female"`
+
+	Birthdate     *date.Date     `json:"birthdate" binding:"required" validate:"required" swaggertype:"string" format:"date" example:"1995-04-21"`
+	Gender        Gender         `json:"gender" binding:"required" validate:"required,oneof=female male non_binary other prefer_not_to_say"`
+	HeightCM      *float64       `json:"height_cm" validate:"omitempty,gt=0,lt=300"`
+	ActivityLevel *ActivityLevel `json:"activity_level" validate:"omitempty,oneof=sedentary light moderate active very_active"`
+	// TimeZone defaults to UTC
+	TimeZone string `json:"time_zone" validate:"omitempty,timezone" example:"Europe/Berlin"`
 }
 
 // SignUp registers a new user
 // @Summary Register a new user
-// @Description Creates a new user account
+// @Description Creates a new user account, the password must satisfy the password policy. Users must be 13 or older.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body SignUpRequest true "Sign up payload"
 // @Success 201 {object} User
 // @Failure 400 {object} apperrors.HTTPError
+// @Failure 429 {object} apperrors.HTTPError
 // @Failure 500 {object} apperrors.HTTPError
 // @Router /auth/signup [post]
 func (h *Handler) SignUp(c *gin.Context) {
@@ -45,6 +66,9 @@ func (h *Handler) SignUp(c *gin.Context) {
 	}
 	user, err := h.service.Create(c.Request.Context(), *req)
 	if err != nil {
+		if respondPolicyError(c, err, "Password") || respondBirthdateError(c, err) {
+			return
+		}
 		apperrors.GenHTTPError(c, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
@@ -54,6 +78,10 @@ func (h *Handler) SignUp(c *gin.Context) {
 type LoginRequest struct {
 	Username string `json:"username" binding:"required" validate:"required,min=3,max=32"`
 	Password string `json:"password" binding:"required" validate:"required"`
+
+	// Challenge and ChallengeSolution are required once the account has too many failed attempts
+	Challenge         string `json:"challenge,omitempty"`
+	ChallengeSolution string `json:"challenge_solution,omitempty"`
 }
 
 type LoginResponse struct {
@@ -61,16 +89,27 @@ type LoginResponse struct {
 	User        User   `json:"user"`
 }
 
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
 // Login authenticates a user
 // @Summary Login user
-// @Description Validates credentials and returns access token + sets refresh token cookie
+// @Description Validates credentials and returns access token + sets refresh token cookie.
+// @Description Responds 428 with a proof-of-work challenge in details when the account requires one.
+// @Description Responds 202 with an mfa_token when two-factor authentication is enabled, finish with /auth/login/2fa.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body LoginRequest true "Login payload"
 // @Success 200 {object} LoginResponse
+// @Success 202 {object} MFAChallengeResponse
 // @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
 // @Failure 404 {object} apperrors.HTTPError
+// @Failure 428 {object} apperrors.HTTPError
+// @Failure 429 {object} apperrors.HTTPError
 // @Failure 500 {object} apperrors.HTTPError
 // @Router /auth/login [post]
 func (h *Handler) Login(c *gin.Context) {
@@ -79,17 +118,216 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := h.service.ValidateCredentials(c.Request.Context(), req.Username, req.Password)
+	user, err := h.service.ValidateCredentials(c.Request.Context(), LoginAttempt{
+		Username:          req.Username,
+		Password:          req.Password,
+		IP:                c.ClientIP(),
+		Challenge:         req.Challenge,
+		ChallengeSolution: req.ChallengeSolution,
+	})
 	if err != nil {
-		if errors.Is(err, apperrors.ErrNotFound) {
+		var challengeErr *ChallengeRequiredError
+		if errors.As(err, &challengeErr) {
+			apperrors.GenHTTPError(c, http.StatusPreconditionRequired, err.Error(), challengeErr.Challenge)
+		} else if errors.Is(err, bruteforce.ErrTooManyAttempts) {
+			apperrors.GenHTTPError(c, http.StatusTooManyRequests, err.Error(), nil)
+		} else if errors.Is(err, apperrors.ErrNotFound) {
 			apperrors.GenHTTPError(c, http.StatusNotFound, err.Error(), nil)
+		} else if errors.Is(err, ErrAccountDisabled) || errors.Is(err, ErrPasswordResetRequired) {
+			apperrors.GenHTTPError(c, http.StatusForbidden, err.Error(), nil)
 		} else {
 			apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
 		}
 		return
 	}
 
-	accessToken, err := h.authService.GenerateToken(user.ID)
+	h.completeLogin(c, user)
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required" validate:"required,email"`
+}
+
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token" binding:"required" validate:"required,max=255"`
+}
+
+// RequestMagicLink emails a sign-in link
+// @Summary Request a sign-in link
+// @Description Emails a single-use sign-in link if the address belongs to an active account. Always responds 202 so
+// @Description account existence is not revealed. The link only works in the browser that requested it.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body MagicLinkRequest true "Email address"
+// @Success 202
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 429 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /auth/magic-link [post]
+func (h *Handler) RequestMagicLink(c *gin.Context) {
+	req, ok := validation.BindAndValidate[MagicLinkRequest](c)
+	if !ok {
+		return
+	}
+
+	binding, err := h.service.RequestMagicLink(c.Request.Context(), strings.TrimSpace(req.Email), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, bruteforce.ErrTooManyAttempts) {
+			apperrors.GenHTTPError(c, http.StatusTooManyRequests, err.Error(), nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to send sign-in link", nil)
+		return
+	}
+
+	h.cookies.Set(c.Writer, magicLinkCookie, binding, cookie.Options{Path: magicLinkCookiePath, MaxAge: MagicLinkTTL})
+	c.Status(http.StatusAccepted)
+}
+
+// VerifyMagicLink signs in with a magic link token
+// @Summary Sign in with a magic link
+// @Description Exchanges the token from the emailed link for an access token + refresh token cookie, like /auth/login.
+// @Description Responds 202 with an mfa_token when two-factor authentication is enabled. A locked account responds 401 like /auth/login.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body MagicLinkVerifyRequest true "Token from the link"
+// @Success 200 {object} LoginResponse
+// @Success 202 {object} MFAChallengeResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 429 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /auth/magic-link/verify [post]
+func (h *Handler) VerifyMagicLink(c *gin.Context) {
+	req, ok := validation.BindAndValidate[MagicLinkVerifyRequest](c)
+	if !ok {
+		return
+	}
+
+	binding, _ := c.Cookie(magicLinkCookie)
+	user, err := h.service.LoginWithMagicLink(c.Request.Context(), req.Token, binding, c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, bruteforce.ErrTooManyAttempts):
+			apperrors.GenHTTPError(c, http.StatusTooManyRequests, err.Error(), nil)
+		case errors.Is(err, ErrInvalidMagicLink), errors.Is(err, ErrAccountLocked):
+			// a locked account gets 401 like a password login does
+			apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		case errors.Is(err, ErrAccountDisabled), errors.Is(err, ErrPasswordResetRequired):
+			apperrors.GenHTTPError(c, http.StatusForbidden, err.Error(), nil)
+		default:
+			apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to sign in", nil)
+		}
+		return
+	}
+
+	h.cookies.Delete(c.Writer, magicLinkCookie, cookie.Options{Path: magicLinkCookiePath})
+	h.completeLogin(c, user)
+}
+
+// completeLogin asks for the second factor when the user has one, otherwise it issues the session
+func (h *Handler) completeLogin(c *gin.Context, user *User) {
+	mfaEnabled, err := h.twoFactorService.IsEnabled(c.Request.Context(), user.ID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	if mfaEnabled {
+		mfaToken, err := h.authService.GenerateMFAToken(user.ID)
+		if err != nil {
+			apperrors.GenHTTPError(c, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		c.JSON(http.StatusAccepted, MFAChallengeResponse{MFARequired: true, MFAToken: mfaToken})
+		return
+	}
+
+	h.issueSession(c, user)
+}
+
+type LoginSecondFactorRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required" validate:"required"`
+	Code     string `json:"code" binding:"required" validate:"required,min=6,max=16"`
+}
+
+// LoginSecondFactor completes a two-step login
+// @Summary Complete login with a second factor
+// @Description Exchanges the mfa_token from /auth/login and a TOTP or recovery code for an access token + refresh token cookie.
+// @Description An mfa_token is single use and allows 5 codes, after that it responds 429 and the login must start over.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body LoginSecondFactorRequest true "Second factor payload"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 429 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /auth/login/2fa [post]
+func (h *Handler) LoginSecondFactor(c *gin.Context) {
+	req, ok := validation.BindAndValidate[LoginSecondFactorRequest](c)
+	if !ok {
+		return
+	}
+
+	claims, err := h.authService.ValidateMFAToken(c.Request.Context(), req.MFAToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrMFATokenSpent):
+			apperrors.GenHTTPError(c, http.StatusTooManyRequests, err.Error(), nil)
+		case errors.Is(err, auth.ErrInvalidMFAToken):
+			apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		default:
+			apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to verify code", nil)
+		}
+		return
+	}
+
+	user, err := h.service.GetByID(c.Request.Context(), claims.UserID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	if err := h.service.CheckSecondFactorSource(c.Request.Context(), user, c.ClientIP()); err != nil {
+		apperrors.GenHTTPError(c, http.StatusTooManyRequests, err.Error(), nil)
+		return
+	}
+
+	if err := h.twoFactorService.Verify(c.Request.Context(), user.ID, req.Code); err != nil {
+		if errors.Is(err, twofactor.ErrInvalidCode) || errors.Is(err, twofactor.ErrNotEnrolled) {
+			h.service.RecordSecondFactor(c.Request.Context(), user, c.ClientIP(), false)
+			apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to verify code", nil)
+		return
+	}
+	if err := h.authService.ConsumeMFAToken(c.Request.Context(), claims); err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to verify code", nil)
+		return
+	}
+	h.service.RecordSecondFactor(c.Request.Context(), user, c.ClientIP(), true)
+
+	// an admin may have disabled the account or forced a password reset between the two steps
+	if user.DisabledAt != nil {
+		apperrors.GenHTTPError(c, http.StatusForbidden, ErrAccountDisabled.Error(), nil)
+		return
+	}
+	if user.PasswordResetRequired {
+		apperrors.GenHTTPError(c, http.StatusForbidden, ErrPasswordResetRequired.Error(), nil)
+		return
+	}
+
+	h.issueSession(c, user)
+}
+
+// issueSession responds with a new access token and sets the refresh token cookie
+func (h *Handler) issueSession(c *gin.Context, user *User) {
+	accessToken, err := h.authService.GenerateToken(user.ID, user.Role)
 	if err != nil {
 		apperrors.GenHTTPError(c, http.StatusInternalServerError, err.Error(), nil)
 		return
@@ -101,28 +339,34 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Path:     "/",
-		MaxAge:   int(auth.RefreshTokenTTL.Seconds()),
-		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteStrictMode,
-	})
+	if err := h.cookies.SetSession(c.Writer, refreshToken, auth.RefreshTokenTTL); err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
 	c.JSON(http.StatusOK, LoginResponse{AccessToken: accessToken, User: *user})
 }
 
 // Logout revokes the user's refresh token
 // @Summary Logout user
-// @Description Revokes the refresh token and clears the cookie
+// @Description Revokes the refresh token and clears the cookie. An access token sent in the Authorization header is revoked as well.
+// @Description Requires the X-CSRF-Token header when the refresh token cookie is sent.
 // @Tags auth
 // @Produce json
+// @Param X-CSRF-Token header string false "Value of the csrf_token cookie"
 // @Success 200 {string} string "Logged out successfully"
 // @Failure 500 {object} apperrors.HTTPError
 // @Router /auth/logout [post]
 func (h *Handler) Logout(c *gin.Context) {
-	refreshToken, err := c.Cookie("refresh_token")
+	if bearer, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); found {
+		if claims, err := h.authService.ValidateToken(strings.TrimSpace(bearer)); err == nil {
+			if err := h.authService.RevokeAccessToken(c.Request.Context(), claims); err != nil {
+				apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to log out", nil)
+				return
+			}
+		}
+	}
+
+	refreshToken, err := c.Cookie(cookie.RefreshToken)
 	if err != nil {
 		c.Status(http.StatusOK)
 		return
@@ -133,34 +377,82 @@ func (h *Handler) Logout(c *gin.Context) {
 		return
 	}
 
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteStrictMode,
-	})
+	h.cookies.ClearSession(c.Writer)
 
 	c.Status(http.StatusOK)
 }
 
+type LogoutAllResponse struct {
+	RevokedSessions int64 `json:"revoked_sessions"`
+}
+
+// LogoutAll logs the current user out of every device
+// @Summary Log out everywhere
+// @Description Revokes every refresh token and every access token issued so far, including the one used for this request
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} LogoutAllResponse
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/logout-all [post]
+func (h *Handler) LogoutAll(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	revoked, err := h.authService.RevokeAllSessions(c.Request.Context(), userID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to revoke sessions", nil)
+		return
+	}
+
+	h.cookies.ClearSession(c.Writer)
+	c.JSON(http.StatusOK, LogoutAllResponse{RevokedSessions: revoked})
+}
+
+type CSRFTokenResponse struct {
+	CSRFToken string `json:"csrf_token"`
+}
+
+// CSRFToken issues a new CSRF token
+// @Summary Get a CSRF token
+// @Description Sets a new csrf_token cookie and returns its value. Cookie-authenticated endpoints such as /auth/refresh
+// @Description and /auth/logout expect it back in the X-CSRF-Token header. Login and refresh issue one automatically.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} CSRFTokenResponse
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /auth/csrf [get]
+func (h *Handler) CSRFToken(c *gin.Context) {
+	token, err := h.cookies.SetCSRF(c.Writer, auth.RefreshTokenTTL)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	c.JSON(http.StatusOK, CSRFTokenResponse{CSRFToken: token})
+}
+
 type AccessTokenResponse struct {
 	AccessToken string `json:"access_token"`
 }
 
 // RefreshToken refreshes access token
 // @Summary Refresh access token
-// @Description Rotates refresh token and returns new access token
+// @Description Rotates refresh token and returns new access token. Requires the X-CSRF-Token header matching the csrf_token cookie.
 // @Tags auth
 // @Produce json
+// @Param X-CSRF-Token header string true "Value of the csrf_token cookie"
 // @Success 200 {object} AccessTokenResponse
 // @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 429 {object} apperrors.HTTPError
 // @Failure 500 {object} apperrors.HTTPError
 // @Router /auth/refresh [post]
 func (h *Handler) RefreshToken(c *gin.Context) {
-	refreshToken, err := c.Cookie("refresh_token")
+	refreshToken, err := c.Cookie(cookie.RefreshToken)
 	if err != nil {
 		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
 		return
@@ -168,22 +460,140 @@ func (h *Handler) RefreshToken(c *gin.Context) {
 
 	accessToken, newRefresh, err := h.authService.RefreshAccessToken(c.Request.Context(), refreshToken)
 	if err != nil {
+		if errors.Is(err, auth.ErrAccountDisabled) {
+			apperrors.GenHTTPError(c, http.StatusForbidden, err.Error(), nil)
+			return
+		}
 		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to refresh access token", nil)
 		return
 	}
 
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    newRefresh,
-		Path:     "/",
-		MaxAge:   int(auth.RefreshTokenTTL.Seconds()),
-		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteStrictMode,
-	})
+	if err := h.cookies.SetSession(c.Writer, newRefresh, auth.RefreshTokenTTL); err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
 	c.JSON(http.StatusOK, AccessTokenResponse{AccessToken: accessToken})
 }
 
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required" validate:"required"`
+	NewPassword string `json:"new_password" binding:"required" validate:"required"`
+}
+
+// ResetPassword sets a new password using an emailed reset token
+// @Summary Reset password
+// @Description Consumes a single-use reset token, sets a new password and logs out all devices
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ResetPasswordRequest true "Reset password payload"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 429 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /auth/password/reset [post]
+func (h *Handler) ResetPassword(c *gin.Context) {
+	req, ok := validation.BindAndValidate[ResetPasswordRequest](c)
+	if !ok {
+		return
+	}
+
+	userID, err := h.service.ResetPassword(c.Request.Context(), req.Token, req.NewPassword)
+	if err != nil {
+		if respondPolicyError(c, err, "NewPassword") {
+			return
+		}
+		if errors.Is(err, ErrInvalidResetToken) {
+			apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to reset password", nil)
+		return
+	}
+
+	if _, err := h.authService.RevokeAllSessions(c.Request.Context(), userID); err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to revoke sessions", nil)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required" validate:"required"`
+	NewPassword     string `json:"new_password" binding:"required" validate:"required"`
+}
+
+// ChangePassword sets a new password for the current user
+// @Summary Change password
+// @Description Requires the current password, the new one must satisfy the password policy. Other devices are logged out and a new session is issued for this one.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ChangePasswordRequest true "Change password payload"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/password [post]
+func (h *Handler) ChangePassword(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	req, ok := validation.BindAndValidate[ChangePasswordRequest](c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.ChangePassword(c.Request.Context(), userID, req.CurrentPassword, req.NewPassword); err != nil {
+		if respondPolicyError(c, err, "NewPassword") {
+			return
+		}
+		if errors.Is(err, ErrInvalidPassword) {
+			apperrors.GenHTTPError(c, http.StatusUnauthorized, "invalid current password", nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to change password", nil)
+		return
+	}
+
+	if _, err := h.authService.RevokeAllSessions(c.Request.Context(), userID); err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to revoke sessions", nil)
+		return
+	}
+
+	user, err := h.service.GetByID(c.Request.Context(), userID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to get user", nil)
+		return
+	}
+	h.issueSession(c, user)
+}
+
+// respondPolicyError reports a rejected password in the same shape as request validation errors
+func respondPolicyError(c *gin.Context, err error, field string) bool {
+	var policyErr *password.PolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	apperrors.GenHTTPError(c, http.StatusBadRequest, "validation failed", map[string]string{
+		field: strings.Join(policyErr.Violations, "; "),
+	})
+	return true
+}
+
+func respondBirthdateError(c *gin.Context, err error) bool {
+	if !errors.Is(err, ErrInvalidBirthdate) {
+		return false
+	}
+	apperrors.GenHTTPError(c, http.StatusBadRequest, "validation failed", map[string]string{"Birthdate": err.Error()})
+	return true
+}
+
 // GetProfile returns current user's profile
 // @Summary Get current user profile
 // @Description Returns the authenticated user's profile
@@ -211,16 +621,49 @@ func (h *Handler) GetProfile(c *gin.Context) {
 }
 
 type UpdateUserInput struct {
-	Username *string  `json:"username" validate:"omitempty,min=3,max=32"`
-	Email    *string  `json:"email" validate:"omitempty,email"`
-	Age      *int     `json:"age" validate:"omitempty,gt=0"`
-	Gender   *string  `json:"gender" validate:"omitempty,oneof=male female"`
-	Weight   *float64 `json:"weight" validate:"omitempty,gt=0"`
+	Username      *string        `json:"username" validate:"omitempty,min=3,max=32"`
+	Email         *string        `json:"email" validate:"omitempty,email"`
+	Birthdate     *date.Date     `json:"birthdate" swaggertype:"string" format:"date" example:"1995-04-21"`
+	Gender        *Gender        `json:"gender" validate:"omitempty,oneof=female male non_binary other prefer_not_to_say"`
+	Weight        *float64       `json:"weight" validate:"omitempty,gt=0"`
+	HeightCM      *float64       `json:"height_cm" validate:"omitempty,gt=0,lt=300"`
+	ActivityLevel *ActivityLevel `json:"activity_level" validate:"omitempty,oneof=sedentary light moderate active very_active"`
+	TimeZone      *string        `json:"time_zone" validate:"omitempty,timezone" example:"Europe/Berlin"`
+}
+
+// fieldNames lists the fields an update sets, for the security log
+func (u UpdateUserInput) fieldNames() []string {
+	fields := []string{}
+	if u.Username != nil {
+		fields = append(fields, "username")
+	}
+	if u.Email != nil {
+		fields = append(fields, "email")
+	}
+	if u.Birthdate != nil {
+		fields = append(fields, "birthdate")
+	}
+	if u.Gender != nil {
+		fields = append(fields, "gender")
+	}
+	if u.Weight != nil {
+		fields = append(fields, "weight")
+	}
+	if u.HeightCM != nil {
+		fields = append(fields, "height_cm")
+	}
+	if u.ActivityLevel != nil {
+		fields = append(fields, "activity_level")
+	}
+	if u.TimeZone != nil {
+		fields = append(fields, "time_zone")
+	}
+	return fields
 }
 
 // UpdateProfile updates current user's profile
 // @Summary Update user profile
-// @Description Updates fields of the authenticated user's profile
+// @Description Updates fields of the authenticated user's profile. The age is derived from the birthdate and cannot be set.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -245,6 +688,9 @@ func (h *Handler) UpdateProfile(c *gin.Context) {
 
 	user, err := h.service.Update(c.Request.Context(), userID, *req)
 	if err != nil {
+		if respondBirthdateError(c, err) {
+			return
+		}
 		apperrors.GenHTTPError(c, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
@@ -252,33 +698,80 @@ func (h *Handler) UpdateProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-type IntIDPathParam struct {
-	ID int64 `uri:"id" binding:"required" validate:"required,gt=0"`
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required" validate:"required"`
+}
+
+type DeleteAccountResponse struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
 }
 
-// GetUserByID returns user by ID
-// @Summary Get user by ID
-// @Description Admin endpoint to fetch user by ID
-// @Tags admin
+// DeleteAccount schedules the current user's account for deletion
+// @Summary Delete my account
+// @Description Requires the current password. The account and all of its data are erased after a grace period,
+// @Description until then signing in and calling /api/users/me/deletion/cancel restores it. Every session is revoked.
+// @Description Accounts created through an external provider must set a password with a reset first.
+// @Tags users
+// @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param id path int true "User ID"
-// @Success 200 {object} User
+// @Param request body DeleteAccountRequest true "Password confirmation"
+// @Success 202 {object} DeleteAccountResponse
 // @Failure 400 {object} apperrors.HTTPError
 // @Failure 401 {object} apperrors.HTTPError
 // @Failure 500 {object} apperrors.HTTPError
-// @Router /api/users/{id} [get]
-func (h *Handler) GetUserByID(c *gin.Context) { // todo: roles not implemented yet
-	idParam, ok := validation.BindAndValidateURI[IntIDPathParam](c)
+// @Router /api/users/me [delete]
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	req, ok := validation.BindAndValidate[DeleteAccountRequest](c)
 	if !ok {
 		return
 	}
 
-	user, err := h.service.GetByID(c.Request.Context(), idParam.ID)
+	deleteAt, err := h.service.ScheduleDeletion(c.Request.Context(), userID, req.Password)
 	if err != nil {
-		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to get user", nil)
+		if errors.Is(err, ErrInvalidPassword) {
+			apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+			return
+		}
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to schedule account deletion", nil)
 		return
 	}
 
+	if _, err := h.authService.RevokeAllSessions(c.Request.Context(), userID); err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to revoke sessions", nil)
+		return
+	}
+	h.cookies.ClearSession(c.Writer)
+	c.JSON(http.StatusAccepted, DeleteAccountResponse{DeletionScheduledAt: deleteAt})
+}
+
+// CancelDeletion keeps an account that was scheduled for deletion
+// @Summary Cancel account deletion
+// @Description Restores an account during its deletion grace period. Does nothing when no deletion is scheduled.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} User
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/users/me/deletion/cancel [post]
+func (h *Handler) CancelDeletion(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	user, err := h.service.CancelDeletion(c.Request.Context(), userID)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, "failed to cancel account deletion", nil)
+		return
+	}
 	c.JSON(http.StatusOK, user)
 }
@@ -0,0 +1,290 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/bruteforce"
+	"github.com/Uranury/WorkoutTracker/internal/twofactor"
+	"github.com/Uranury/WorkoutTracker/pkg/cookie"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeService struct {
+	Service
+	user      *User
+	blocked   bool
+	failures  int
+	successes int
+	loginErr  error
+}
+
+func (f *fakeService) ValidateCredentials(_ context.Context, _ LoginAttempt) (*User, error) {
+	return nil, f.loginErr
+}
+
+func (f *fakeService) GetByID(_ context.Context, _ int64) (*User, error) {
+	return f.user, nil
+}
+
+func (f *fakeService) CheckSecondFactorSource(_ context.Context, _ *User, _ string) error {
+	if f.blocked {
+		return bruteforce.ErrTooManyAttempts
+	}
+	return nil
+}
+
+func (f *fakeService) RecordSecondFactor(_ context.Context, _ *User, _ string, success bool) {
+	if success {
+		f.successes++
+	} else {
+		f.failures++
+	}
+}
+
+type fakeTwoFactor struct {
+	twofactor.Service
+	code string
+}
+
+func (f *fakeTwoFactor) Verify(_ context.Context, _ int64, code string) error {
+	if code != f.code {
+		return twofactor.ErrInvalidCode
+	}
+	return nil
+}
+
+type fakeRefreshTokens struct {
+	auth.RefreshTokenRepository
+}
+
+func (fakeRefreshTokens) Save(_ context.Context, _ *auth.RefreshToken) error {
+	return nil
+}
+
+type fakeDevices struct{}
+
+func (fakeDevices) SessionStarted(_ context.Context, _ int64, _, _ string) {}
+
+func newSecondFactorHandler(t *testing.T, service *fakeService) (*gin.Engine, auth.Service) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	keys, err := auth.LoadKeySet("", nil, "test-secret")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	authService := auth.NewAuth(keys, "test", nil, nil, fakeRefreshTokens{}, auth.NewMemoryRevocationStore(), ratelimit.NewMemoryCounter(), nil, fakeDevices{})
+	h := NewHandler(service, authService, &fakeTwoFactor{code: "123456"}, cookie.NewJar(cookie.Settings{}))
+
+	r := gin.New()
+	r.POST("/auth/login/2fa", h.LoginSecondFactor)
+	return r, authService
+}
+
+func postSecondFactor(r *gin.Engine, mfaToken, code string) int {
+	body, _ := json.Marshal(LoginSecondFactorRequest{MFAToken: mfaToken, Code: code})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/login/2fa", bytes.NewReader(body)))
+	return w.Code
+}
+
+func TestLoginSecondFactorLimitsGuessesPerToken(t *testing.T) {
+	service := &fakeService{user: &User{ID: 7, Username: "anna"}}
+	r, authService := newSecondFactorHandler(t, service)
+
+	token, err := authService.GenerateMFAToken(7)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken: %v", err)
+	}
+	for i := range auth.MFAMaxAttempts {
+		if code := postSecondFactor(r, token, "000000"); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: status = %d, want 401", i+1, code)
+		}
+	}
+	if service.failures != auth.MFAMaxAttempts {
+		t.Errorf("failures reported to the login guard = %d, want %d", service.failures, auth.MFAMaxAttempts)
+	}
+
+	if code := postSecondFactor(r, token, "123456"); code != http.StatusTooManyRequests {
+		t.Fatalf("correct code on a used up token: status = %d, want 429", code)
+	}
+	if service.successes != 0 {
+		t.Errorf("successes = %d, want 0", service.successes)
+	}
+}
+
+func TestLoginSecondFactorTokenIsSingleUse(t *testing.T) {
+	service := &fakeService{user: &User{ID: 7, Username: "anna"}}
+	r, authService := newSecondFactorHandler(t, service)
+
+	token, err := authService.GenerateMFAToken(7)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken: %v", err)
+	}
+	if code := postSecondFactor(r, token, "123456"); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if service.successes != 1 {
+		t.Errorf("successes = %d, want 1", service.successes)
+	}
+	if code := postSecondFactor(r, token, "123456"); code != http.StatusTooManyRequests {
+		t.Fatalf("replayed token: status = %d, want 429", code)
+	}
+}
+
+func TestLoginSecondFactorRejectsBlockedSource(t *testing.T) {
+	service := &fakeService{user: &User{ID: 7, Username: "anna"}, blocked: true}
+	r, authService := newSecondFactorHandler(t, service)
+
+	token, err := authService.GenerateMFAToken(7)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken: %v", err)
+	}
+	if code := postSecondFactor(r, token, "123456"); code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", code)
+	}
+}
+
+func TestLoginSecondFactorRejectsInvalidToken(t *testing.T) {
+	r, _ := newSecondFactorHandler(t, &fakeService{user: &User{ID: 7, Username: "anna"}})
+
+	if code := postSecondFactor(r, "not-a-token", "123456"); code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", code)
+	}
+}
+
+func TestLoginSecondFactorRechecksAccountState(t *testing.T) {
+	disabledAt := time.Now()
+	tests := []struct {
+		name string
+		user *User
+	}{
+		{"disabled", &User{ID: 7, Username: "anna", DisabledAt: &disabledAt}},
+		{"password reset required", &User{ID: 7, Username: "anna", PasswordResetRequired: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, authService := newSecondFactorHandler(t, &fakeService{user: tt.user})
+
+			token, err := authService.GenerateMFAToken(7)
+			if err != nil {
+				t.Fatalf("GenerateMFAToken: %v", err)
+			}
+			if code := postSecondFactor(r, token, "123456"); code != http.StatusForbidden {
+				t.Fatalf("status = %d, want 403", code)
+			}
+		})
+	}
+}
+
+func (f *fakeTwoFactor) IsEnabled(_ context.Context, _ int64) (bool, error) {
+	return false, nil
+}
+
+func newMagicLinkHandler(t *testing.T, repo *magicLinkRepository, mailbox *fakeMailbox) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	keys, err := auth.LoadKeySet("", nil, "test-secret")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	authService := auth.NewAuth(keys, "test", nil, nil, fakeRefreshTokens{}, auth.NewMemoryRevocationStore(), ratelimit.NewMemoryCounter(), nil, fakeDevices{})
+	h := NewHandler(newMagicLinkService(repo, mailbox), authService, &fakeTwoFactor{}, cookie.NewJar(cookie.Settings{}))
+
+	r := gin.New()
+	r.POST("/auth/magic-link", h.RequestMagicLink)
+	r.POST("/auth/magic-link/verify", h.VerifyMagicLink)
+	return r
+}
+
+func postJSON(r *gin.Engine, path string, payload any, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func bindingCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == magicLinkCookie {
+			if !c.HttpOnly || c.Path != magicLinkCookiePath || c.Value == "" {
+				t.Fatalf("binding cookie = %+v, want an HttpOnly cookie scoped to %s", c, magicLinkCookiePath)
+			}
+			return c
+		}
+	}
+	t.Fatal("no binding cookie set")
+	return nil
+}
+
+func TestMagicLinkFlow(t *testing.T) {
+	repo := &magicLinkRepository{user: &User{ID: 7, Username: "anna", Email: "anna@example.com"}}
+	mailbox := &fakeMailbox{}
+	r := newMagicLinkHandler(t, repo, mailbox)
+
+	w := postJSON(r, "/auth/magic-link", MagicLinkRequest{Email: "anna@example.com"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("request: status = %d, want 202", w.Code)
+	}
+	binding := bindingCookie(t, w)
+
+	// unknown addresses get the same response and a cookie too
+	unknown := postJSON(r, "/auth/magic-link", MagicLinkRequest{Email: "nobody@example.com"})
+	if unknown.Code != http.StatusAccepted {
+		t.Fatalf("unknown address: status = %d, want 202", unknown.Code)
+	}
+	bindingCookie(t, unknown)
+
+	verify := MagicLinkVerifyRequest{Token: mailbox.tokens[0]}
+	if w := postJSON(r, "/auth/magic-link/verify", verify); w.Code != http.StatusUnauthorized {
+		t.Fatalf("verify without binding: status = %d, want 401", w.Code)
+	}
+	w = postJSON(r, "/auth/magic-link/verify", verify, binding)
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify: status = %d, want 200", w.Code)
+	}
+	var cleared bool
+	for _, c := range w.Result().Cookies() {
+		cleared = cleared || (c.Name == magicLinkCookie && c.MaxAge < 0)
+	}
+	if !cleared {
+		t.Error("binding cookie was not cleared after sign-in")
+	}
+	if w := postJSON(r, "/auth/magic-link/verify", verify, binding); w.Code != http.StatusUnauthorized {
+		t.Fatalf("reused link: status = %d, want 401", w.Code)
+	}
+}
+
+func TestMagicLinkLockedAccountMatchesPasswordLogin(t *testing.T) {
+	repo := &magicLinkRepository{user: &User{ID: 7, Username: "anna", Email: "anna@example.com"}}
+	mailbox := &fakeMailbox{}
+	r := newMagicLinkHandler(t, repo, mailbox)
+
+	binding := bindingCookie(t, postJSON(r, "/auth/magic-link", MagicLinkRequest{Email: "anna@example.com"}))
+	lockedUntil := time.Now().Add(time.Hour)
+	repo.user.UnlockTime = &lockedUntil
+
+	magicLink := postJSON(r, "/auth/magic-link/verify", MagicLinkVerifyRequest{Token: mailbox.tokens[0]}, binding)
+
+	h := NewHandler(&fakeService{loginErr: ErrAccountLocked}, nil, nil, cookie.NewJar(cookie.Settings{}))
+	login := gin.New()
+	login.POST("/auth/login", h.Login)
+	password := postJSON(login, "/auth/login", LoginRequest{Username: "anna", Password: "correct horse"})
+
+	if magicLink.Code != http.StatusUnauthorized || password.Code != http.StatusUnauthorized {
+		t.Fatalf("locked account: magic link status = %d, password status = %d, want both 401", magicLink.Code, password.Code)
+	}
+}
@@ -1,20 +1,116 @@
 package user
 
 import (
+	"encoding/json"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
 	"time"
 )
 
+type Gender string
+
+const (
+	GenderFemale         Gender = "female"
+	GenderMale           Gender = "male"
+	GenderNonBinary      Gender = "non_binary"
+	GenderOther          Gender = "other"
+	GenderPreferNotToSay Gender = "prefer_not_to_say"
+)
+
+type ActivityLevel string
+
+const (
+	ActivitySedentary  ActivityLevel = "sedentary"
+	ActivityLight      ActivityLevel = "light"
+	ActivityModerate   ActivityLevel = "moderate"
+	ActivityActive     ActivityLevel = "active"
+	ActivityVeryActive ActivityLevel = "very_active"
+)
+
+const (
+	MinAge = 13
+	MaxAge = 120
+)
+
 type User struct {
-	ID        int64     `json:"id" db:"id"`
-	Username  string    `json:"username" db:"username"`
-	Email     string    `json:"email" db:"email"`
-	Age       int       `json:"age" db:"age"`
-	Gender    string    `json:"gender" db:"gender"`
-	Weight    float64   `json:"weight" db:"weight"`
+	ID        int64      `json:"id" db:"id"`
+	Username  string     `json:"username" db:"username"`
+	Email     string     `json:"email" db:"email"`
+	Birthdate *date.Date `json:"birthdate" db:"birthdate" swaggertype:"string" format:"date"`
+	// Age is derived from the birthdate in the user's time zone whenever the user is rendered
+	Age           *int           `json:"age" db:"-"`
+	Gender        *Gender        `json:"gender" db:"gender"`
+	Weight        float64        `json:"weight" db:"weight"`
+	HeightCM      *float64       `json:"height_cm" db:"height_cm"`
+	ActivityLevel *ActivityLevel `json:"activity_level" db:"activity_level"`
+	// TimeZone is an IANA name such as Europe/Berlin
+	TimeZone  string    `json:"time_zone" db:"time_zone"`
+	Role      auth.Role `json:"role" db:"role"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 	Password  string    `json:"-" db:"password"`
 
 	FailedLoginAttempts int        `json:"failed_login_attempts" db:"failed_login_attempts"`
 	UnlockTime          *time.Time `json:"unlock_time" db:"unlock_time"`
+
+	DisabledAt            *time.Time `json:"disabled_at" db:"disabled_at"`
+	PasswordResetRequired bool       `json:"password_reset_required" db:"password_reset_required"`
+	// DeletionScheduledAt is when the account and all of its data will be erased, unless the user cancels before
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at" db:"deletion_scheduled_at"`
+}
+
+func (u User) MarshalJSON() ([]byte, error) {
+	type plain User
+	u.Age = u.AgeOn(time.Now())
+	return json.Marshal(plain(u))
+}
+
+// AgeOn returns the age on the calendar day t falls on in the user's time zone, nil without a birthdate
+func (u *User) AgeOn(t time.Time) *int {
+	if u.Birthdate == nil {
+		return nil
+	}
+	age := u.Birthdate.YearsOn(t.In(u.Location()))
+	return &age
+}
+
+// Location falls back to UTC for an unknown time zone
+func (u *User) Location() *time.Location {
+	loc, err := time.LoadLocation(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// personalAuditFields are audited by name only, their values are personal data
+var personalAuditFields = []string{"username", "email", "birthdate", "gender", "weight", "height_cm", "time_zone"}
+
+// auditFields are the profile fields whose changes go to the audit log, see personalAuditFields
+func (u *User) auditFields() map[string]any {
+	return map[string]any{
+		"username":       u.Username,
+		"email":          u.Email,
+		"birthdate":      u.Birthdate,
+		"gender":         u.Gender,
+		"weight":         u.Weight,
+		"height_cm":      u.HeightCM,
+		"activity_level": u.ActivityLevel,
+		"time_zone":      u.TimeZone,
+	}
+}
+
+type ListFilter struct {
+	Search string
+	Limit  int
+	Offset int
+}
+
+// LoginAttempt carries credentials together with the request context used for brute-force protection
+type LoginAttempt struct {
+	Username          string
+	Password          string
+	IP                string
+	Challenge         string
+	ChallengeSolution string
 }
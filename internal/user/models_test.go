@@ -0,0 +1,21 @@
+package user
+
+import "testing"
+
+func TestPersonalAuditFieldsAreAudited(t *testing.T) {
+	fields := (&User{}).auditFields()
+	for _, field := range personalAuditFields {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("personal field %q is not an audit field, a typo would leave its values unredacted", field)
+		}
+	}
+	for _, field := range []string{"email", "birthdate", "gender", "weight", "height_cm", "time_zone"} {
+		found := false
+		for _, personal := range personalAuditFields {
+			found = found || personal == field
+		}
+		if !found {
+			t.Errorf("%q must be redacted in the audit log", field)
+		}
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
 	"github.com/jmoiron/sqlx"
 	"log/slog"
+	"strings"
 	"time"
 )
 
@@ -16,9 +19,29 @@ type Repository interface {
 	GetByUsername(ctx context.Context, username string) (*User, error)
 	Update(ctx context.Context, user *User) error
 	Delete(ctx context.Context, id int64) error
+	UpdateRole(ctx context.Context, id int64, role auth.Role) error
+	UpdatePassword(ctx context.Context, id int64, passwordHash string) error
+	SetPasswordHash(ctx context.Context, id int64, passwordHash string) error
+	List(ctx context.Context, filter ListFilter) ([]User, int, error)
 
-	IncrementFailedAttempts(ctx context.Context, username string, maxAttempts int, lockDuration time.Duration) error
+	IncrementFailedAttempts(ctx context.Context, username string) (int, error)
+	LockUntil(ctx context.Context, username string, until time.Time) error
 	ResetFailedAttempts(ctx context.Context, username string) error
+	Unlock(ctx context.Context, id int64) error
+	SetDisabled(ctx context.Context, id int64, disabled bool) error
+	SetPasswordResetRequired(ctx context.Context, id int64, required bool) error
+
+	ScheduleDeletion(ctx context.Context, id int64, at time.Time) error
+	CancelDeletion(ctx context.Context, id int64) error
+	ListDueForDeletion(ctx context.Context, before time.Time) ([]int64, error)
+
+	CreatePasswordResetToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error
+	GetPasswordResetTokenOwner(ctx context.Context, tokenHash string) (int64, error)
+	ConsumePasswordResetToken(ctx context.Context, tokenHash string) (int64, error)
+
+	CreateMagicLinkToken(ctx context.Context, userID int64, tokenHash, bindingHash string, expiresAt time.Time) error
+	CountMagicLinkTokensSince(ctx context.Context, userID int64, since time.Time) (int, error)
+	ConsumeMagicLinkToken(ctx context.Context, tokenHash, bindingHash string) (int64, error)
 }
 
 type repository struct {
@@ -32,13 +55,13 @@ func NewRepository(db *sqlx.DB, logger *slog.Logger) Repository {
 
 func (r *repository) Create(ctx context.Context, user *User) error {
 	query := `
-        INSERT INTO users (username, email, age, gender, password, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+        INSERT INTO users (username, email, birthdate, gender, height_cm, activity_level, time_zone, password, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
         RETURNING id, created_at, updated_at`
 
 	return r.db.QueryRowContext(
 		ctx, query,
-		user.Username, user.Email, user.Age, user.Gender, user.Password,
+		user.Username, user.Email, user.Birthdate, user.Gender, user.HeightCM, user.ActivityLevel, user.TimeZone, user.Password,
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 }
 
@@ -47,7 +70,7 @@ func (r *repository) GetByID(ctx context.Context, id int64) (*User, error) {
 	query := "SELECT * FROM users WHERE id = $1"
 	err := r.db.GetContext(ctx, &user, query, id)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, fmt.Errorf("user %w", apperrors.ErrNotFound)
 	}
 	if err != nil {
 		return nil, err
@@ -60,7 +83,7 @@ func (r *repository) GetByEmail(ctx context.Context, email string) (*User, error
 	query := "SELECT * FROM users WHERE email = $1"
 	err := r.db.GetContext(ctx, &user, query, email)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, fmt.Errorf("user %w", apperrors.ErrNotFound)
 	}
 	if err != nil {
 		return nil, err
@@ -73,7 +96,7 @@ func (r *repository) GetByUsername(ctx context.Context, username string) (*User,
 	query := "SELECT * FROM users WHERE username = $1"
 	err := r.db.GetContext(ctx, &user, query, username)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, fmt.Errorf("user %w", apperrors.ErrNotFound)
 	}
 	if err != nil {
 		return nil, err
@@ -84,11 +107,13 @@ func (r *repository) GetByUsername(ctx context.Context, username string) (*User,
 func (r *repository) Update(ctx context.Context, user *User) error {
 	query := `
         UPDATE users 
-        SET username = $1, email = $2, age = $3, gender = $4, updated_at = NOW(), weight = $5
-        WHERE id = $6`
+        SET username = $1, email = $2, birthdate = $3, gender = $4, updated_at = NOW(), weight = $5,
+            height_cm = $6, activity_level = $7, time_zone = $8
+        WHERE id = $9`
 
 	_, err := r.db.ExecContext(ctx, query,
-		user.Username, user.Email, user.Age, user.Gender, user.Weight, user.ID,
+		user.Username, user.Email, user.Birthdate, user.Gender, user.Weight,
+		user.HeightCM, user.ActivityLevel, user.TimeZone, user.ID,
 	)
 	return err
 }
@@ -99,17 +124,67 @@ func (r *repository) Delete(ctx context.Context, id int64) error {
 	return err
 }
 
-func (r *repository) IncrementFailedAttempts(ctx context.Context, username string, maxAttempts int, lockDuration time.Duration) error {
+func (r *repository) UpdateRole(ctx context.Context, id int64, role auth.Role) error {
+	query := "UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2"
+	return r.execAffectingUser(ctx, query, role, id)
+}
+
+// UpdatePassword sets a new password hash and clears the forced reset flag and any lockout
+func (r *repository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	query := `
+        UPDATE users
+        SET password = $1, password_reset_required = FALSE, failed_login_attempts = 0, unlock_time = NULL, updated_at = NOW()
+        WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, passwordHash, id)
+	return err
+}
+
+// SetPasswordHash replaces the stored hash of an unchanged password, e.g. after a hashing upgrade
+func (r *repository) SetPasswordHash(ctx context.Context, id int64, passwordHash string) error {
+	query := "UPDATE users SET password = $1 WHERE id = $2"
+	return r.execAffectingUser(ctx, query, passwordHash, id)
+}
+
+func (r *repository) List(ctx context.Context, filter ListFilter) ([]User, int, error) {
+	where := `WHERE $1 = '' OR username ILIKE '%' || $1 || '%' ESCAPE '\' OR email ILIKE '%' || $1 || '%' ESCAPE '\'`
+	search := escapeLike(filter.Search)
+
+	var total int
+	if err := r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM users "+where, search); err != nil {
+		return nil, 0, err
+	}
+
+	users := []User{}
+	query := "SELECT * FROM users " + where + " ORDER BY id LIMIT $2 OFFSET $3"
+	if err := r.db.SelectContext(ctx, &users, query, search, filter.Limit, filter.Offset); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// likeEscaper makes a search term match literally inside a LIKE pattern with ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// IncrementFailedAttempts returns the new number of consecutive failed logins
+func (r *repository) IncrementFailedAttempts(ctx context.Context, username string) (int, error) {
 	query := `
         UPDATE users
-        SET failed_login_attempts = failed_login_attempts + 1,
-            unlock_time = CASE
-                WHEN failed_login_attempts + 1 >= $2 THEN NOW() + $3 * INTERVAL '1 second'
-                ELSE unlock_time
-            END
+        SET failed_login_attempts = failed_login_attempts + 1
         WHERE username = $1
+        RETURNING failed_login_attempts
     `
-	_, err := r.db.ExecContext(ctx, query, username, maxAttempts, int(lockDuration.Seconds()))
+	var attempts int
+	err := r.db.QueryRowxContext(ctx, query, username).Scan(&attempts)
+	return attempts, err
+}
+
+func (r *repository) LockUntil(ctx context.Context, username string, until time.Time) error {
+	query := "UPDATE users SET unlock_time = $1 WHERE username = $2"
+	_, err := r.db.ExecContext(ctx, query, until, username)
 	return err
 }
 
@@ -118,3 +193,96 @@ func (r *repository) ResetFailedAttempts(ctx context.Context, username string) e
 	_, err := r.db.ExecContext(ctx, query, username)
 	return err
 }
+
+func (r *repository) Unlock(ctx context.Context, id int64) error {
+	query := "UPDATE users SET failed_login_attempts = 0, unlock_time = NULL WHERE id = $1"
+	return r.execAffectingUser(ctx, query, id)
+}
+
+func (r *repository) SetDisabled(ctx context.Context, id int64, disabled bool) error {
+	query := "UPDATE users SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, NOW()) END, updated_at = NOW() WHERE id = $2"
+	return r.execAffectingUser(ctx, query, disabled, id)
+}
+
+func (r *repository) SetPasswordResetRequired(ctx context.Context, id int64, required bool) error {
+	query := "UPDATE users SET password_reset_required = $1, updated_at = NOW() WHERE id = $2"
+	return r.execAffectingUser(ctx, query, required, id)
+}
+
+func (r *repository) ScheduleDeletion(ctx context.Context, id int64, at time.Time) error {
+	query := "UPDATE users SET deletion_scheduled_at = $1, updated_at = NOW() WHERE id = $2"
+	return r.execAffectingUser(ctx, query, at, id)
+}
+
+func (r *repository) CancelDeletion(ctx context.Context, id int64) error {
+	query := "UPDATE users SET deletion_scheduled_at = NULL, updated_at = NOW() WHERE id = $1"
+	return r.execAffectingUser(ctx, query, id)
+}
+
+func (r *repository) ListDueForDeletion(ctx context.Context, before time.Time) ([]int64, error) {
+	ids := []int64{}
+	query := "SELECT id FROM users WHERE deletion_scheduled_at <= $1 ORDER BY deletion_scheduled_at"
+	err := r.db.SelectContext(ctx, &ids, query, before)
+	return ids, err
+}
+
+func (r *repository) CreatePasswordResetToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	query := "INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)"
+	_, err := r.db.ExecContext(ctx, query, userID, tokenHash, expiresAt)
+	return err
+}
+
+// GetPasswordResetTokenOwner returns the owner of a valid token without using it up
+func (r *repository) GetPasswordResetTokenOwner(ctx context.Context, tokenHash string) (int64, error) {
+	query := "SELECT user_id FROM password_reset_tokens WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()"
+	var userID int64
+	err := r.db.GetContext(ctx, &userID, query, tokenHash)
+	return userID, err
+}
+
+// ConsumePasswordResetToken marks a valid token as used and returns its owner. Single use is enforced by the UPDATE itself.
+func (r *repository) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (int64, error) {
+	query := `
+        UPDATE password_reset_tokens SET used_at = NOW()
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id`
+	var userID int64
+	err := r.db.QueryRowxContext(ctx, query, tokenHash).Scan(&userID)
+	return userID, err
+}
+
+func (r *repository) CreateMagicLinkToken(ctx context.Context, userID int64, tokenHash, bindingHash string, expiresAt time.Time) error {
+	query := "INSERT INTO magic_link_tokens (user_id, token_hash, binding_hash, expires_at) VALUES ($1, $2, $3, $4)"
+	_, err := r.db.ExecContext(ctx, query, userID, tokenHash, bindingHash, expiresAt)
+	return err
+}
+
+func (r *repository) CountMagicLinkTokensSince(ctx context.Context, userID int64, since time.Time) (int, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM magic_link_tokens WHERE user_id = $1 AND created_at > $2"
+	err := r.db.GetContext(ctx, &count, query, userID, since)
+	return count, err
+}
+
+// ConsumeMagicLinkToken marks a valid token as used and returns its owner. The token is only usable
+// from the browser holding the binding it was requested with.
+func (r *repository) ConsumeMagicLinkToken(ctx context.Context, tokenHash, bindingHash string) (int64, error) {
+	query := `
+        UPDATE magic_link_tokens SET used_at = NOW()
+        WHERE token_hash = $1 AND binding_hash = $2 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id`
+	var userID int64
+	err := r.db.QueryRowxContext(ctx, query, tokenHash, bindingHash).Scan(&userID)
+	return userID, err
+}
+
+func (r *repository) execAffectingUser(ctx context.Context, query string, args ...any) error {
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("user %w", apperrors.ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package user
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"anna":       "anna",
+		"100%":       `100\%`,
+		"a_b":        `a\_b`,
+		`back\slash`: `back\\slash`,
+		`%_\`:        `\%\_\\`,
+		"":           "",
+	}
+	for in, want := range tests {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestListMatchesSearchLiterally(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := NewRepository(sqlx.NewDb(db, "postgres"), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	escape := regexp.QuoteMeta(`ESCAPE '\'`)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE .*username ILIKE .*` + escape + `.*email ILIKE .*` + escape).
+		WithArgs(`a\_b\%`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT \* FROM users WHERE .*`+escape+`.*ORDER BY id`).
+		WithArgs(`a\_b\%`, 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	if _, _, err := repo.List(context.Background(), ListFilter{Search: "a_b%", Limit: 20, Offset: 0}); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListDueForDeletionSkipsAccountsInGracePeriod(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := NewRepository(sqlx.NewDb(db, "postgres"), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// accounts that were never scheduled have a NULL deletion time and never match
+	before := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM users WHERE deletion_scheduled_at <= $1")).
+		WithArgs(before).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4).AddRow(9))
+
+	ids, err := repo.ListDueForDeletion(context.Background(), before)
+	if err != nil {
+		t.Fatalf("ListDueForDeletion: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 4 || ids[1] != 9 {
+		t.Fatalf("ids = %v, want [4 9]", ids)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,30 +2,90 @@ package user
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/audit"
+	"github.com/Uranury/WorkoutTracker/internal/auth"
+	"github.com/Uranury/WorkoutTracker/internal/bruteforce"
+	"github.com/Uranury/WorkoutTracker/internal/email"
+	"github.com/Uranury/WorkoutTracker/internal/security"
 	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"github.com/Uranury/WorkoutTracker/pkg/password"
+	"html"
 	"log/slog"
+	"math/big"
+	"net/url"
 	"strings"
 	"time"
 )
 
+var (
+	PasswordResetTokenTTL = time.Hour
+	MagicLinkTTL          = time.Minute * 15
+	// DeletionGracePeriod is how long a deleted account can still be restored by signing in and cancelling
+	DeletionGracePeriod = time.Hour * 24 * 30
+)
+
+// maxMagicLinksPerTTL limits sign-in emails per account so the endpoint cannot be used to flood an inbox
+const maxMagicLinksPerTTL = 3
+
 type Service interface {
 	Create(ctx context.Context, request SignUpRequest) (*User, error)
-	ValidateCredentials(ctx context.Context, username, password string) (*User, error)
+	CreateExternal(ctx context.Context, email, usernameHint string) (*User, error)
+	ValidateCredentials(ctx context.Context, attempt LoginAttempt) (*User, error)
+	// CheckSecondFactorSource applies the login guard's IP limits to the second step of a two-step login
+	CheckSecondFactorSource(ctx context.Context, user *User, ip string) error
+	// RecordSecondFactor reports the outcome of the second login step to the login guard and the security log
+	RecordSecondFactor(ctx context.Context, user *User, ip string, success bool)
+	VerifyPassword(ctx context.Context, id int64, password string) error
 	GetByID(ctx context.Context, id int64) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetByUsername(ctx context.Context, username string) (*User, error)
 	Update(ctx context.Context, id int64, updates UpdateUserInput) (*User, error)
+	UpdateRole(ctx context.Context, id int64, role auth.Role) (*User, error)
+
+	List(ctx context.Context, filter ListFilter) ([]User, int, error)
+	Unlock(ctx context.Context, id int64) error
+	SetDisabled(ctx context.Context, id int64, disabled bool) error
+	ForcePasswordReset(ctx context.Context, id int64) error
+	ResetPassword(ctx context.Context, token, newPassword string) (int64, error)
+	ChangePassword(ctx context.Context, id int64, currentPassword, newPassword string) error
+
+	// RequestMagicLink emails a sign-in link if the address belongs to an active account and returns the
+	// browser binding the link is tied to. It reveals nothing about whether the account exists.
+	RequestMagicLink(ctx context.Context, email, ip string) (string, error)
+	LoginWithMagicLink(ctx context.Context, token, binding, ip string) (*User, error)
+
+	// ScheduleDeletion re-checks the password and erases the account after DeletionGracePeriod
+	ScheduleDeletion(ctx context.Context, id int64, password string) (time.Time, error)
+	CancelDeletion(ctx context.Context, id int64) (*User, error)
+	// PurgeDeletedAccounts erases accounts whose grace period ended before the given time
+	PurgeDeletedAccounts(ctx context.Context, before time.Time) (int64, error)
+}
+
+// KnownSources tells whether a login comes from an IP address the account has signed in from before
+type KnownSources interface {
+	IsKnownIP(ctx context.Context, userID int64, ip string) (bool, error)
 }
 
 type service struct {
-	repo   Repository
-	logger *slog.Logger
+	repo       Repository
+	email      email.Service
+	guard      bruteforce.Guard
+	sources    KnownSources
+	hasher     password.Hasher
+	policy     password.Policy
+	events     security.Service
+	auditLog   audit.Service
+	appBaseURL string
+	logger     *slog.Logger
 }
 
-func NewService(repo Repository, logger *slog.Logger) Service {
-	return &service{repo: repo, logger: logger}
+func NewService(repo Repository, emailService email.Service, guard bruteforce.Guard, sources KnownSources, hasher password.Hasher, policy password.Policy, events security.Service, auditLog audit.Service, appBaseURL string, logger *slog.Logger) Service {
+	return &service{repo: repo, email: emailService, guard: guard, sources: sources, hasher: hasher, policy: policy, events: events, auditLog: auditLog, appBaseURL: appBaseURL, logger: logger}
 }
 
 func (s *service) Create(ctx context.Context, request SignUpRequest) (*User, error) {
@@ -39,17 +99,31 @@ func (s *service) Create(ctx context.Context, request SignUpRequest) (*User, err
 		return nil, errors.New("username already taken")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err := s.policy.Check(request.Password, request.Username, request.Email); err != nil {
+		return nil, err
+	}
+	timeZone := request.TimeZone
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+	if err := checkBirthdate(*request.Birthdate, timeZone); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.hasher.Hash(request.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
 	user := &User{
-		Username: request.Username,
-		Email:    request.Email,
-		Password: string(hashedPassword),
-		Age:      request.Age,
-		Gender:   request.Gender,
+		Username:      request.Username,
+		Email:         request.Email,
+		Password:      hashedPassword,
+		Birthdate:     request.Birthdate,
+		Gender:        &request.Gender,
+		HeightCM:      request.HeightCM,
+		ActivityLevel: request.ActivityLevel,
+		TimeZone:      timeZone,
 	}
 
 	if err := s.repo.Create(ctx, user); err != nil {
@@ -59,50 +133,275 @@ func (s *service) Create(ctx context.Context, request SignUpRequest) (*User, err
 	return user, nil
 }
 
-func (s *service) ValidateCredentials(ctx context.Context, username string, password string) (*User, error) {
-	user, err := s.repo.GetByUsername(ctx, username)
+// CreateExternal creates an account for a user signing in through an external identity provider.
+// The account has no password until the user sets one through a password reset.
+func (s *service) CreateExternal(ctx context.Context, email, usernameHint string) (*User, error) {
+	existing, _ := s.repo.GetByEmail(ctx, email)
+	if existing != nil {
+		return nil, errors.New("email already registered")
+	}
+
+	base := usernameFromHint(usernameHint)
+	username := base
+	for attempt := 0; ; attempt++ {
+		existing, err := s.repo.GetByUsername(ctx, username)
+		if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+			return nil, fmt.Errorf("failed to check username: %w", err)
+		}
+		if existing == nil {
+			break
+		}
+		if attempt == 5 {
+			return nil, errors.New("failed to find a free username")
+		}
+		suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return nil, err
+		}
+		username = fmt.Sprintf("%s_%04d", base, suffix.Int64())
+	}
+
+	user := &User{Username: username, Email: email, TimeZone: "UTC"}
+	if err := s.repo.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+// checkBirthdate enforces the age limits on the current day in the given time zone
+func checkBirthdate(birthdate date.Date, timeZone string) error {
+	user := User{Birthdate: &birthdate, TimeZone: timeZone}
+	if age := *user.AgeOn(time.Now()); age < MinAge || age > MaxAge {
+		return ErrInvalidBirthdate
+	}
+	return nil
+}
+
+// usernameFromHint keeps letters, digits, dots, dashes and underscores of a preferred username or email local part
+func usernameFromHint(hint string) string {
+	hint, _, _ = strings.Cut(strings.ToLower(hint), "@")
+	var b strings.Builder
+	for _, r := range hint {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '-' || r == '_' {
+			b.WriteRune(r)
+		}
+		if b.Len() == 24 {
+			break
+		}
+	}
+	if b.Len() < 3 {
+		return "athlete"
+	}
+	return b.String()
+}
+
+func (s *service) ValidateCredentials(ctx context.Context, attempt LoginAttempt) (*User, error) {
+	if err := s.guard.CheckSource(ctx, attempt.IP, attempt.Username); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetByUsername(ctx, attempt.Username)
 	if err != nil {
+		s.guard.RecordFailure(ctx, attempt.IP, attempt.Username)
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, apperrors.ErrNotFound
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	if user.UnlockTime != nil && user.UnlockTime.After(time.Now()) {
-		return nil, fmt.Errorf("account is locked, please try again later")
+	// an account lock only stops unknown sources, otherwise anyone who knows the username could lock the owner out.
+	// Guessing from a known IP is still cut off by the guard's per-IP limits.
+	knownSource := s.isKnownSource(ctx, user.ID, attempt.IP)
+	if !knownSource && user.UnlockTime != nil && user.UnlockTime.After(time.Now()) {
+		s.recordLogin(ctx, user.ID, loginMethodPassword, "account_locked")
+		return nil, ErrAccountLocked
 	}
 
-	if user.UnlockTime != nil && user.UnlockTime.Before(time.Now()) {
-		if err := s.repo.ResetFailedAttempts(ctx, user.Username); err != nil {
-			s.logger.Error("Failed to reset expired lock", "err", err.Error())
+	if s.guard.ChallengeRequired(user.FailedLoginAttempts) {
+		if err := s.guard.VerifyChallenge(user.Username, attempt.Challenge, attempt.ChallengeSolution); err != nil {
+			s.recordLogin(ctx, user.ID, loginMethodPassword, "challenge_required")
+			return nil, s.challengeRequired(user.Username)
 		}
-		user.FailedLoginAttempts = 0
-		user.UnlockTime = nil
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		if err := s.repo.IncrementFailedAttempts(ctx, user.Username, 3, time.Minute*15); err != nil {
-			s.logger.Error("Failed to increment failed attempts", "err", err.Error())
+	matches, err := s.hasher.Verify(attempt.Password, user.Password)
+	if err != nil {
+		s.logger.Error("Failed to verify password hash", "user_id", user.ID, "err", err.Error())
+	}
+	if !matches {
+		s.guard.RecordFailure(ctx, attempt.IP, user.Username)
+		s.recordLogin(ctx, user.ID, loginMethodPassword, "invalid_password")
+		if !knownSource {
+			s.registerFailedAttempt(ctx, user, attempt.IP)
 		}
-		return nil, fmt.Errorf("invalid password")
+		return nil, ErrInvalidPassword
 	}
+	s.upgradePasswordHash(ctx, user, attempt.Password)
 
+	s.guard.RecordSuccess(ctx, attempt.IP, user.Username)
 	if err := s.repo.ResetFailedAttempts(ctx, user.Username); err != nil {
 		s.logger.Error("Failed to reset failed attempts", "err", err.Error())
 	}
 
+	if user.DisabledAt != nil {
+		s.recordLogin(ctx, user.ID, loginMethodPassword, "account_disabled")
+		return nil, ErrAccountDisabled
+	}
+	if user.PasswordResetRequired {
+		s.recordLogin(ctx, user.ID, loginMethodPassword, "password_reset_required")
+		return nil, ErrPasswordResetRequired
+	}
+
+	s.recordLogin(ctx, user.ID, loginMethodPassword, "")
 	return user, nil
 }
 
+// isKnownSource treats the IP as unknown when the lookup fails so the lockout still applies
+func (s *service) isKnownSource(ctx context.Context, userID int64, ip string) bool {
+	known, err := s.sources.IsKnownIP(ctx, userID, ip)
+	if err != nil {
+		s.logger.Error("Failed to check login source", "user_id", userID, "err", err.Error())
+		return false
+	}
+	return known
+}
+
+func (s *service) CheckSecondFactorSource(ctx context.Context, user *User, ip string) error {
+	return s.guard.CheckSource(ctx, ip, user.Username)
+}
+
+func (s *service) RecordSecondFactor(ctx context.Context, user *User, ip string, success bool) {
+	if !success {
+		s.guard.RecordFailure(ctx, ip, user.Username)
+		s.recordLogin(ctx, user.ID, loginMethodSecondFactor, "invalid_code")
+		return
+	}
+	s.guard.RecordSuccess(ctx, ip, user.Username)
+	s.recordLogin(ctx, user.ID, loginMethodSecondFactor, "")
+}
+
+const (
+	loginMethodPassword     = "password"
+	loginMethodMagicLink    = "magic_link"
+	loginMethodSecondFactor = "second_factor"
+)
+
+// recordLogin adds a login to the security log, an empty failure reason means the login succeeded.
+// With two-factor authentication enabled a successful password login is only the first step.
+func (s *service) recordLogin(ctx context.Context, userID int64, method, failureReason string) {
+	details := security.Details{"method": method}
+	if failureReason != "" {
+		details["reason"] = failureReason
+	}
+	s.events.Record(ctx, security.Event{UserID: userID, Type: security.EventLogin, Success: failureReason == "", Details: details})
+}
+
+// VerifyPassword re-authenticates an already logged in user before sensitive changes
+func (s *service) VerifyPassword(ctx context.Context, id int64, password string) error {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	matches, err := s.hasher.Verify(password, user.Password)
+	if err != nil {
+		s.logger.Error("Failed to verify password hash", "user_id", user.ID, "err", err.Error())
+	}
+	if !matches {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// upgradePasswordHash rehashes a verified password when its hash uses an outdated algorithm or parameters.
+// Failing to upgrade does not fail the login, the next one retries.
+func (s *service) upgradePasswordHash(ctx context.Context, user *User, plain string) {
+	if !s.hasher.NeedsRehash(user.Password) {
+		return
+	}
+	hashed, err := s.hasher.Hash(plain)
+	if errors.Is(err, password.ErrPasswordTooLong) {
+		// the current hash stays, it still covers the whole password
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to rehash password", "user_id", user.ID, "err", err.Error())
+		return
+	}
+	if err := s.repo.SetPasswordHash(ctx, user.ID, hashed); err != nil {
+		s.logger.Error("Failed to store rehashed password", "user_id", user.ID, "err", err.Error())
+		return
+	}
+	user.Password = hashed
+	s.logger.Info("Upgraded password hash", "user_id", user.ID)
+}
+
+// registerFailedAttempt counts the failure against the account and applies the lockout policy.
+// Attempts are only reset by a successful login, so each lock after an expired one lasts twice as long.
+func (s *service) registerFailedAttempt(ctx context.Context, user *User, ip string) {
+	attempts, err := s.repo.IncrementFailedAttempts(ctx, user.Username)
+	if err != nil {
+		s.logger.Error("Failed to increment failed attempts", "err", err.Error())
+		return
+	}
+
+	policy := s.guard.Policy()
+	if attempts < policy.AccountMaxAttempts {
+		return
+	}
+
+	if !policy.ChallengeEnabled {
+		lockout := s.guard.LockoutDuration(attempts)
+		if err := s.repo.LockUntil(ctx, user.Username, time.Now().Add(lockout)); err != nil {
+			s.logger.Error("Failed to lock account", "err", err.Error())
+			return
+		}
+		s.events.Record(ctx, security.Event{
+			UserID:  user.ID,
+			Type:    security.EventAccountLocked,
+			Success: true,
+			Details: security.Details{"failed_attempts": attempts, "locked_for": lockout.String()},
+		})
+	}
+
+	if attempts == policy.AccountMaxAttempts && policy.NotifyOnLockout {
+		s.sendLockoutNotification(ctx, user, ip)
+	}
+}
+
+func (s *service) challengeRequired(username string) error {
+	challenge, err := s.guard.NewChallenge(username)
+	if err != nil {
+		return fmt.Errorf("failed to issue login challenge: %w", err)
+	}
+	return &ChallengeRequiredError{Challenge: challenge}
+}
+
+func (s *service) sendLockoutNotification(ctx context.Context, user *User, ip string) {
+	body := fmt.Sprintf(`<p>Hi %s,</p><p>We blocked sign-in to your account after several failed password attempts, most recently from IP address %s.</p><p>If this was you, wait a few minutes and try again. If it wasn't, consider changing your password.</p>`,
+		html.EscapeString(user.Username), html.EscapeString(ip))
+	if err := s.email.Send(ctx, user.Email, "Sign-in attempts to your WorkoutTracker account were blocked", body); err != nil {
+		s.logger.Error("Failed to send lockout notification", "user_id", user.ID, "err", err.Error())
+	}
+}
+
 func (s *service) GetByID(ctx context.Context, id int64) (*User, error) {
 	return s.repo.GetByID(ctx, id)
 }
 
+func (s *service) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return s.repo.GetByUsername(ctx, username)
+}
+
+func (s *service) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return s.repo.GetByEmail(ctx, email)
+}
+
 func (s *service) Update(ctx context.Context, id int64, updates UpdateUserInput) (*User, error) {
 	user, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	before := user.auditFields()
 
 	if updates.Username != nil {
 		user.Username = *updates.Username
@@ -110,19 +409,341 @@ func (s *service) Update(ctx context.Context, id int64, updates UpdateUserInput)
 	if updates.Email != nil {
 		user.Email = *updates.Email
 	}
-	if updates.Age != nil {
-		user.Age = *updates.Age
+	if updates.Birthdate != nil {
+		user.Birthdate = updates.Birthdate
 	}
 	if updates.Gender != nil {
-		user.Gender = strings.ToLower(*updates.Gender)
+		user.Gender = updates.Gender
 	}
 	if updates.Weight != nil {
 		user.Weight = *updates.Weight
 	}
+	if updates.HeightCM != nil {
+		user.HeightCM = updates.HeightCM
+	}
+	if updates.ActivityLevel != nil {
+		user.ActivityLevel = updates.ActivityLevel
+	}
+	if updates.TimeZone != nil {
+		user.TimeZone = *updates.TimeZone
+	}
+	if updates.Birthdate != nil || updates.TimeZone != nil {
+		if user.Birthdate != nil {
+			if err := checkBirthdate(*user.Birthdate, user.TimeZone); err != nil {
+				return nil, err
+			}
+		}
+	}
 
 	if err := s.repo.Update(ctx, user); err != nil {
 		return nil, err
 	}
 
+	s.events.Record(ctx, security.Event{
+		UserID:  id,
+		Type:    security.EventProfileUpdate,
+		Success: true,
+		Details: security.Details{"fields": updates.fieldNames()},
+	})
+	if changes := audit.Diff(before, user.auditFields()).Redact(personalAuditFields...); len(changes) > 0 {
+		s.recordAudit(ctx, &id, &id, audit.ActionProfileUpdated, nil, changes)
+	}
+	return user, nil
+}
+
+// recordAudit adds an entry to the audit log, the change it describes has already been applied
+func (s *service) recordAudit(ctx context.Context, actorID, targetID *int64, action audit.Action, details audit.Details, changes audit.Changes) {
+	entry := audit.Entry{ActorID: actorID, TargetUserID: targetID, Action: action, Details: details, Changes: changes}
+	if err := s.auditLog.Record(ctx, entry); err != nil {
+		s.logger.Error("Account change was applied but not audited", "action", action, "err", err.Error())
+	}
+}
+
+func (s *service) UpdateRole(ctx context.Context, id int64, role auth.Role) (*User, error) {
+	if err := s.repo.UpdateRole(ctx, id, role); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *service) List(ctx context.Context, filter ListFilter) ([]User, int, error) {
+	users, total, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, total, nil
+}
+
+func (s *service) Unlock(ctx context.Context, id int64) error {
+	return s.repo.Unlock(ctx, id)
+}
+
+func (s *service) SetDisabled(ctx context.Context, id int64, disabled bool) error {
+	return s.repo.SetDisabled(ctx, id, disabled)
+}
+
+// ForcePasswordReset blocks password login until the user sets a new password via the emailed reset link
+func (s *service) ForcePasswordReset(ctx context.Context, id int64) error {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.SetPasswordResetRequired(ctx, id, true); err != nil {
+		return fmt.Errorf("failed to require password reset: %w", err)
+	}
+
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	if err := s.repo.CreatePasswordResetToken(ctx, id, tokenHash, time.Now().Add(PasswordResetTokenTTL)); err != nil {
+		return fmt.Errorf("failed to save reset token: %w", err)
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.appBaseURL, url.QueryEscape(token))
+	body := fmt.Sprintf(`<p>Hi %s,</p><p>A password reset is required for your account. Set a new password here:</p><p><a href="%s">%s</a></p><p>The link expires in %s.</p>`,
+		html.EscapeString(user.Username), link, link, PasswordResetTokenTTL)
+	if err := s.email.Send(ctx, user.Email, "Reset your WorkoutTracker password", body); err != nil {
+		s.logger.Error("Failed to send password reset email", "user_id", id, "err", err.Error())
+	}
+	return nil
+}
+
+// ResetPassword consumes a reset token and sets a new password, returning the ID of the affected user.
+// The token stays valid when the new password is rejected by the policy, so the user can pick another one.
+func (s *service) ResetPassword(ctx context.Context, token, newPassword string) (int64, error) {
+	tokenHash := auth.HashToken(token)
+	ownerID, err := s.repo.GetPasswordResetTokenOwner(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, fmt.Errorf("failed to look up reset token: %w", err)
+	}
+	owner, err := s.repo.GetByID(ctx, ownerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := s.policy.Check(newPassword, owner.Username, owner.Email); err != nil {
+		return 0, err
+	}
+
+	userID, err := s.repo.ConsumePasswordResetToken(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, fmt.Errorf("failed to consume reset token: %w", err)
+	}
+
+	hashedPassword, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return 0, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := s.repo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return 0, fmt.Errorf("failed to update password: %w", err)
+	}
+	s.events.Record(ctx, security.Event{UserID: userID, Type: security.EventPasswordReset, Success: true})
+	return userID, nil
+}
+
+// ChangePassword replaces the password of a logged in user after re-checking the current one
+func (s *service) ChangePassword(ctx context.Context, id int64, currentPassword, newPassword string) error {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if matches, _ := s.hasher.Verify(currentPassword, user.Password); !matches {
+		s.events.Record(ctx, security.Event{
+			UserID:  id,
+			Type:    security.EventPasswordChange,
+			Details: security.Details{"reason": "invalid_password"},
+		})
+		return ErrInvalidPassword
+	}
+
+	if err := s.policy.Check(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+	if currentPassword == newPassword {
+		return &password.PolicyError{Violations: []string{"must differ from the current password"}}
+	}
+
+	hashedPassword, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.repo.UpdatePassword(ctx, id, hashedPassword); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	s.events.Record(ctx, security.Event{UserID: id, Type: security.EventPasswordChange, Success: true})
+	return nil
+}
+
+func (s *service) ScheduleDeletion(ctx context.Context, id int64, password string) (time.Time, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if matches, _ := s.hasher.Verify(password, user.Password); !matches {
+		s.events.Record(ctx, security.Event{
+			UserID:  id,
+			Type:    security.EventAccountDeletion,
+			Details: security.Details{"action": "scheduled", "reason": "invalid_password"},
+		})
+		return time.Time{}, ErrInvalidPassword
+	}
+
+	deleteAt := time.Now().Add(DeletionGracePeriod)
+	if err := s.repo.ScheduleDeletion(ctx, id, deleteAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to schedule deletion: %w", err)
+	}
+	s.events.Record(ctx, security.Event{
+		UserID:  id,
+		Type:    security.EventAccountDeletion,
+		Success: true,
+		Details: security.Details{"action": "scheduled", "delete_at": deleteAt},
+	})
+	s.recordAudit(ctx, &id, &id, audit.ActionDeletionScheduled, nil, audit.Diff(
+		map[string]any{"deletion_scheduled_at": user.DeletionScheduledAt},
+		map[string]any{"deletion_scheduled_at": deleteAt},
+	))
+
+	body := fmt.Sprintf(`<p>Hi %s,</p><p>Your WorkoutTracker account and all of its data will be permanently deleted on %s.</p><p>Changed your mind? Sign in at <a href="%s">%s</a> and cancel the deletion before then.</p>`,
+		html.EscapeString(user.Username), deleteAt.UTC().Format("January 2, 2006 15:04 MST"), s.appBaseURL, s.appBaseURL)
+	if err := s.email.Send(ctx, user.Email, "Your WorkoutTracker account will be deleted", body); err != nil {
+		s.logger.Error("Failed to send account deletion email", "user_id", id, "err", err.Error())
+	}
+	return deleteAt, nil
+}
+
+func (s *service) CancelDeletion(ctx context.Context, id int64) (*User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletionScheduledAt == nil {
+		return user, nil
+	}
+	if err := s.repo.CancelDeletion(ctx, id); err != nil {
+		return nil, err
+	}
+	s.events.Record(ctx, security.Event{
+		UserID:  id,
+		Type:    security.EventAccountDeletion,
+		Success: true,
+		Details: security.Details{"action": "cancelled"},
+	})
+	s.recordAudit(ctx, &id, &id, audit.ActionDeletionCancelled, nil, audit.Diff(
+		map[string]any{"deletion_scheduled_at": user.DeletionScheduledAt},
+		map[string]any{"deletion_scheduled_at": nil},
+	))
+	user.DeletionScheduledAt = nil
+	return user, nil
+}
+
+// PurgeDeletedAccounts deletes accounts one by one, so a failure leaves the remaining ones for the next run.
+// Everything owned by a user is removed by ON DELETE CASCADE, the audit log keeps entries with the user unset.
+func (s *service) PurgeDeletedAccounts(ctx context.Context, before time.Time) (int64, error) {
+	ids, err := s.repo.ListDueForDeletion(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list accounts due for deletion: %w", err)
+	}
+
+	var deleted int64
+	for _, id := range ids {
+		if err := s.repo.Delete(ctx, id); err != nil {
+			s.logger.Error("Failed to delete account", "user_id", id, "err", err.Error())
+			continue
+		}
+		s.logger.Info("Deleted account after grace period", "user_id", id)
+		// the user row is gone, so the ID can only be kept in the details
+		s.recordAudit(ctx, nil, nil, audit.ActionUserDeleted, audit.Details{"user_id": id}, nil)
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (s *service) RequestMagicLink(ctx context.Context, emailAddress, ip string) (string, error) {
+	if err := s.guard.CheckSource(ctx, ip, emailAddress); err != nil {
+		return "", err
+	}
+
+	binding, bindingHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate binding: %w", err)
+	}
+
+	user, err := s.repo.GetByEmail(ctx, emailAddress)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return binding, nil
+		}
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.DisabledAt != nil || (user.UnlockTime != nil && user.UnlockTime.After(time.Now())) {
+		s.logger.Info("Magic link not sent to inactive account", "user_id", user.ID)
+		return binding, nil
+	}
+
+	recent, err := s.repo.CountMagicLinkTokensSince(ctx, user.ID, time.Now().Add(-MagicLinkTTL))
+	if err != nil {
+		return "", fmt.Errorf("failed to count magic links: %w", err)
+	}
+	if recent >= maxMagicLinksPerTTL {
+		s.logger.Info("Magic link limit reached", "user_id", user.ID)
+		return binding, nil
+	}
+
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate magic link token: %w", err)
+	}
+	if err := s.repo.CreateMagicLinkToken(ctx, user.ID, tokenHash, bindingHash, time.Now().Add(MagicLinkTTL)); err != nil {
+		return "", fmt.Errorf("failed to save magic link token: %w", err)
+	}
+
+	link := fmt.Sprintf("%s/magic-link?token=%s", s.appBaseURL, url.QueryEscape(token))
+	body := fmt.Sprintf(`<p>Hi %s,</p><p>Use this link to sign in to WorkoutTracker:</p><p><a href="%s">%s</a></p><p>The link expires in %s, can be used once and only works in the browser it was requested from. If you did not request it, you can ignore this email.</p>`,
+		html.EscapeString(user.Username), link, link, MagicLinkTTL)
+	if err := s.email.Send(ctx, user.Email, "Your WorkoutTracker sign-in link", body); err != nil {
+		s.logger.Error("Failed to send magic link email", "user_id", user.ID, "err", err.Error())
+	}
+	return binding, nil
+}
+
+func (s *service) LoginWithMagicLink(ctx context.Context, token, binding, ip string) (*User, error) {
+	if err := s.guard.CheckSource(ctx, ip, ""); err != nil {
+		return nil, err
+	}
+
+	userID, err := s.repo.ConsumeMagicLinkToken(ctx, auth.HashToken(token), auth.HashToken(binding))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.guard.RecordFailure(ctx, ip, "")
+			return nil, ErrInvalidMagicLink
+		}
+		return nil, fmt.Errorf("failed to consume magic link token: %w", err)
+	}
+
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.UnlockTime != nil && user.UnlockTime.After(time.Now()) {
+		s.recordLogin(ctx, user.ID, loginMethodMagicLink, "account_locked")
+		return nil, ErrAccountLocked
+	}
+	if user.DisabledAt != nil {
+		s.recordLogin(ctx, user.ID, loginMethodMagicLink, "account_disabled")
+		return nil, ErrAccountDisabled
+	}
+	if user.PasswordResetRequired {
+		s.recordLogin(ctx, user.ID, loginMethodMagicLink, "password_reset_required")
+		return nil, ErrPasswordResetRequired
+	}
+	s.recordLogin(ctx, user.ID, loginMethodMagicLink, "")
 	return user, nil
 }
@@ -0,0 +1,492 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/audit"
+	"github.com/Uranury/WorkoutTracker/internal/bruteforce"
+	"github.com/Uranury/WorkoutTracker/internal/security"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/password"
+	"github.com/Uranury/WorkoutTracker/pkg/ratelimit"
+	"io"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type fakeRepository struct {
+	Repository
+	user *User
+}
+
+func (f *fakeRepository) GetByUsername(_ context.Context, _ string) (*User, error) {
+	u := *f.user
+	return &u, nil
+}
+
+func (f *fakeRepository) IncrementFailedAttempts(_ context.Context, _ string) (int, error) {
+	f.user.FailedLoginAttempts++
+	return f.user.FailedLoginAttempts, nil
+}
+
+func (f *fakeRepository) LockUntil(_ context.Context, _ string, until time.Time) error {
+	f.user.UnlockTime = &until
+	return nil
+}
+
+func (f *fakeRepository) ResetFailedAttempts(_ context.Context, _ string) error {
+	f.user.FailedLoginAttempts = 0
+	f.user.UnlockTime = nil
+	return nil
+}
+
+type fakeSources map[string]bool
+
+func (f fakeSources) IsKnownIP(_ context.Context, _ int64, ip string) (bool, error) {
+	return f[ip], nil
+}
+
+// plainHasher stores passwords as they are
+type plainHasher struct{}
+
+func (plainHasher) Hash(password string) (string, error) { return password, nil }
+
+func (plainHasher) Verify(password, encoded string) (bool, error) { return password == encoded, nil }
+
+func (plainHasher) NeedsRehash(string) bool { return false }
+
+type fakeEvents struct {
+	security.Service
+}
+
+func (fakeEvents) Record(context.Context, security.Event) {}
+
+const (
+	knownIP    = "203.0.113.10"
+	attackerIP = "198.51.100.7"
+)
+
+func newLockoutService(repo *fakeRepository) Service {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	guard := bruteforce.NewGuard(ratelimit.NewMemoryCounter(), bruteforce.Policy{
+		AccountMaxAttempts: 3,
+		AccountBaseLockout: time.Minute,
+		AccountMaxLockout:  time.Hour,
+		IPMaxFailures:      100,
+		IPUserMaxFailures:  100,
+		FailureWindow:      time.Hour,
+	}, []byte("secret"), logger)
+	return NewService(repo, nil, guard, fakeSources{knownIP: true}, plainHasher{}, password.Policy{}, fakeEvents{}, nil, "", logger)
+}
+
+func login(s Service, ip, password string) error {
+	_, err := s.ValidateCredentials(context.Background(), LoginAttempt{Username: "anna", Password: password, IP: ip})
+	return err
+}
+
+func TestLockoutSparesKnownSources(t *testing.T) {
+	repo := &fakeRepository{user: &User{ID: 7, Username: "anna", Password: "correct horse"}}
+	s := newLockoutService(repo)
+
+	for range 3 {
+		if err := login(s, attackerIP, "guess"); !errors.Is(err, ErrInvalidPassword) {
+			t.Fatalf("err = %v, want ErrInvalidPassword", err)
+		}
+	}
+	if repo.user.UnlockTime == nil {
+		t.Fatal("guesses from an unknown IP must lock the account")
+	}
+	if err := login(s, attackerIP, "correct horse"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("unknown IP: err = %v, want ErrAccountLocked", err)
+	}
+
+	if err := login(s, knownIP, "correct horse"); err != nil {
+		t.Fatalf("known IP: err = %v, want the owner to get in", err)
+	}
+	if repo.user.UnlockTime != nil || repo.user.FailedLoginAttempts != 0 {
+		t.Errorf("a successful login must clear the lock, got unlock_time=%v attempts=%d", repo.user.UnlockTime, repo.user.FailedLoginAttempts)
+	}
+}
+
+func TestKnownSourceFailuresDoNotLock(t *testing.T) {
+	repo := &fakeRepository{user: &User{ID: 7, Username: "anna", Password: "correct horse"}}
+	s := newLockoutService(repo)
+
+	for range 5 {
+		if err := login(s, knownIP, "typo"); !errors.Is(err, ErrInvalidPassword) {
+			t.Fatalf("err = %v, want ErrInvalidPassword", err)
+		}
+	}
+	if repo.user.UnlockTime != nil || repo.user.FailedLoginAttempts != 0 {
+		t.Fatalf("failures from a known IP must not count towards the lockout, got unlock_time=%v attempts=%d", repo.user.UnlockTime, repo.user.FailedLoginAttempts)
+	}
+}
+
+type magicLink struct {
+	tokenHash   string
+	bindingHash string
+	createdAt   time.Time
+	expiresAt   time.Time
+	used        bool
+}
+
+// magicLinkRepository consumes tokens with the same conditions as the SQL: matching binding, unused, unexpired
+type magicLinkRepository struct {
+	Repository
+	user  *User
+	links []*magicLink
+}
+
+func (f *magicLinkRepository) GetByEmail(_ context.Context, email string) (*User, error) {
+	if email != f.user.Email {
+		return nil, apperrors.ErrNotFound
+	}
+	u := *f.user
+	return &u, nil
+}
+
+func (f *magicLinkRepository) GetByID(_ context.Context, _ int64) (*User, error) {
+	u := *f.user
+	return &u, nil
+}
+
+func (f *magicLinkRepository) CountMagicLinkTokensSince(_ context.Context, _ int64, since time.Time) (int, error) {
+	count := 0
+	for _, link := range f.links {
+		if link.createdAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *magicLinkRepository) CreateMagicLinkToken(_ context.Context, _ int64, tokenHash, bindingHash string, expiresAt time.Time) error {
+	f.links = append(f.links, &magicLink{tokenHash: tokenHash, bindingHash: bindingHash, createdAt: time.Now(), expiresAt: expiresAt})
+	return nil
+}
+
+func (f *magicLinkRepository) ConsumeMagicLinkToken(_ context.Context, tokenHash, bindingHash string) (int64, error) {
+	for _, link := range f.links {
+		if link.tokenHash == tokenHash && link.bindingHash == bindingHash && !link.used && link.expiresAt.After(time.Now()) {
+			link.used = true
+			return f.user.ID, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+// fakeMailbox keeps the tokens of every sign-in link sent
+type fakeMailbox struct {
+	tokens []string
+}
+
+var magicLinkToken = regexp.MustCompile(`/magic-link\?token=([^"&]+)`)
+
+func (f *fakeMailbox) Send(_ context.Context, _, _, body string) error {
+	match := magicLinkToken.FindStringSubmatch(body)
+	if match == nil {
+		return errors.New("no sign-in link in the email")
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		return err
+	}
+	f.tokens = append(f.tokens, token)
+	return nil
+}
+
+func newMagicLinkService(repo *magicLinkRepository, mailbox *fakeMailbox) Service {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	guard := bruteforce.NewGuard(ratelimit.NewMemoryCounter(), bruteforce.Policy{
+		AccountMaxAttempts: 3,
+		AccountBaseLockout: time.Minute,
+		AccountMaxLockout:  time.Hour,
+		IPMaxFailures:      100,
+		IPUserMaxFailures:  100,
+		FailureWindow:      time.Hour,
+	}, []byte("secret"), logger)
+	return NewService(repo, mailbox, guard, fakeSources{}, plainHasher{}, password.Policy{}, fakeEvents{}, nil, "https://app.example.com", logger)
+}
+
+func TestMagicLinkIsBoundToRequestingBrowser(t *testing.T) {
+	ctx := context.Background()
+	repo := &magicLinkRepository{user: &User{ID: 7, Username: "anna", Email: "anna@example.com"}}
+	mailbox := &fakeMailbox{}
+	s := newMagicLinkService(repo, mailbox)
+
+	binding, err := s.RequestMagicLink(ctx, "anna@example.com", knownIP)
+	if err != nil {
+		t.Fatalf("RequestMagicLink: %v", err)
+	}
+	if len(mailbox.tokens) != 1 {
+		t.Fatalf("sent %d links, want 1", len(mailbox.tokens))
+	}
+	token := mailbox.tokens[0]
+
+	// a link forwarded to, or intercepted by, another browser is useless without its binding
+	otherBinding, err := s.RequestMagicLink(ctx, "nobody@example.com", attackerIP)
+	if err != nil {
+		t.Fatalf("RequestMagicLink: %v", err)
+	}
+	for _, b := range []string{"", otherBinding} {
+		if _, err := s.LoginWithMagicLink(ctx, token, b, attackerIP); !errors.Is(err, ErrInvalidMagicLink) {
+			t.Fatalf("binding %q: err = %v, want ErrInvalidMagicLink", b, err)
+		}
+	}
+
+	u, err := s.LoginWithMagicLink(ctx, token, binding, knownIP)
+	if err != nil {
+		t.Fatalf("LoginWithMagicLink: %v", err)
+	}
+	if u.ID != 7 {
+		t.Fatalf("signed in as %d, want 7", u.ID)
+	}
+}
+
+func TestMagicLinkIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	repo := &magicLinkRepository{user: &User{ID: 7, Username: "anna", Email: "anna@example.com"}}
+	mailbox := &fakeMailbox{}
+	s := newMagicLinkService(repo, mailbox)
+
+	binding, err := s.RequestMagicLink(ctx, "anna@example.com", knownIP)
+	if err != nil {
+		t.Fatalf("RequestMagicLink: %v", err)
+	}
+	if _, err := s.LoginWithMagicLink(ctx, mailbox.tokens[0], binding, knownIP); err != nil {
+		t.Fatalf("LoginWithMagicLink: %v", err)
+	}
+	if _, err := s.LoginWithMagicLink(ctx, mailbox.tokens[0], binding, knownIP); !errors.Is(err, ErrInvalidMagicLink) {
+		t.Fatalf("reused link: err = %v, want ErrInvalidMagicLink", err)
+	}
+}
+
+func TestMagicLinkExpires(t *testing.T) {
+	ctx := context.Background()
+	repo := &magicLinkRepository{user: &User{ID: 7, Username: "anna", Email: "anna@example.com"}}
+	mailbox := &fakeMailbox{}
+	s := newMagicLinkService(repo, mailbox)
+
+	binding, err := s.RequestMagicLink(ctx, "anna@example.com", knownIP)
+	if err != nil {
+		t.Fatalf("RequestMagicLink: %v", err)
+	}
+	if got := time.Until(repo.links[0].expiresAt); got <= MagicLinkTTL-time.Minute || got > MagicLinkTTL {
+		t.Fatalf("link expires in %s, want %s", got, MagicLinkTTL)
+	}
+	repo.links[0].expiresAt = time.Now().Add(-time.Second)
+	if _, err := s.LoginWithMagicLink(ctx, mailbox.tokens[0], binding, knownIP); !errors.Is(err, ErrInvalidMagicLink) {
+		t.Fatalf("expired link: err = %v, want ErrInvalidMagicLink", err)
+	}
+}
+
+func TestMagicLinksAreCappedPerTTL(t *testing.T) {
+	ctx := context.Background()
+	repo := &magicLinkRepository{user: &User{ID: 7, Username: "anna", Email: "anna@example.com"}}
+	mailbox := &fakeMailbox{}
+	s := newMagicLinkService(repo, mailbox)
+
+	for i := range maxMagicLinksPerTTL + 2 {
+		if _, err := s.RequestMagicLink(ctx, "anna@example.com", knownIP); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	if len(mailbox.tokens) != maxMagicLinksPerTTL {
+		t.Fatalf("sent %d links, want %d", len(mailbox.tokens), maxMagicLinksPerTTL)
+	}
+
+	// once the oldest links fall out of the window new ones are sent again
+	for _, link := range repo.links {
+		link.createdAt = link.createdAt.Add(-MagicLinkTTL)
+	}
+	if _, err := s.RequestMagicLink(ctx, "anna@example.com", knownIP); err != nil {
+		t.Fatalf("RequestMagicLink: %v", err)
+	}
+	if len(mailbox.tokens) != maxMagicLinksPerTTL+1 {
+		t.Fatalf("sent %d links, want %d after the window passed", len(mailbox.tokens), maxMagicLinksPerTTL+1)
+	}
+}
+
+func TestMagicLinkSkipsInactiveAccounts(t *testing.T) {
+	ctx := context.Background()
+	disabledAt := time.Now()
+	lockedUntil := time.Now().Add(time.Hour)
+
+	for name, u := range map[string]*User{
+		"disabled": {ID: 7, Username: "anna", Email: "anna@example.com", DisabledAt: &disabledAt},
+		"locked":   {ID: 7, Username: "anna", Email: "anna@example.com", UnlockTime: &lockedUntil},
+	} {
+		mailbox := &fakeMailbox{}
+		s := newMagicLinkService(&magicLinkRepository{user: u}, mailbox)
+
+		binding, err := s.RequestMagicLink(ctx, "anna@example.com", knownIP)
+		if err != nil || binding == "" {
+			t.Fatalf("%s: RequestMagicLink = %q, %v, want a binding like for any other address", name, binding, err)
+		}
+		if len(mailbox.tokens) != 0 {
+			t.Fatalf("%s: sent %d links, want none", name, len(mailbox.tokens))
+		}
+	}
+}
+
+func TestMagicLinkRechecksAccountOnSignIn(t *testing.T) {
+	ctx := context.Background()
+	disabledAt := time.Now()
+	lockedUntil := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		apply func(*User)
+		want  error
+	}{
+		{"locked", func(u *User) { u.UnlockTime = &lockedUntil }, ErrAccountLocked},
+		{"disabled", func(u *User) { u.DisabledAt = &disabledAt }, ErrAccountDisabled},
+		{"password reset required", func(u *User) { u.PasswordResetRequired = true }, ErrPasswordResetRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &magicLinkRepository{user: &User{ID: 7, Username: "anna", Email: "anna@example.com"}}
+			mailbox := &fakeMailbox{}
+			s := newMagicLinkService(repo, mailbox)
+
+			binding, err := s.RequestMagicLink(ctx, "anna@example.com", knownIP)
+			if err != nil {
+				t.Fatalf("RequestMagicLink: %v", err)
+			}
+			tt.apply(repo.user)
+			if _, err := s.LoginWithMagicLink(ctx, mailbox.tokens[0], binding, knownIP); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// deletionRepository lists accounts due for deletion like the SQL query, accounts never scheduled are skipped
+type deletionRepository struct {
+	Repository
+	users map[int64]*User
+	// failDelete is refused by Delete
+	failDelete int64
+}
+
+func (f *deletionRepository) GetByID(_ context.Context, id int64) (*User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return nil, apperrors.ErrNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+func (f *deletionRepository) ScheduleDeletion(_ context.Context, id int64, at time.Time) error {
+	f.users[id].DeletionScheduledAt = &at
+	return nil
+}
+
+func (f *deletionRepository) CancelDeletion(_ context.Context, id int64) error {
+	f.users[id].DeletionScheduledAt = nil
+	return nil
+}
+
+func (f *deletionRepository) ListDueForDeletion(_ context.Context, before time.Time) ([]int64, error) {
+	var ids []int64
+	for id, user := range f.users {
+		if user.DeletionScheduledAt != nil && !user.DeletionScheduledAt.After(before) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (f *deletionRepository) Delete(_ context.Context, id int64) error {
+	if id == f.failDelete {
+		return errors.New("connection reset")
+	}
+	delete(f.users, id)
+	return nil
+}
+
+type fakeAuditLog struct {
+	audit.Service
+	entries []audit.Entry
+}
+
+func (f *fakeAuditLog) Record(_ context.Context, entry audit.Entry) error {
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func newDeletionService(repo *deletionRepository, auditLog *fakeAuditLog) Service {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewService(repo, &fakeMailbox{}, nil, fakeSources{}, plainHasher{}, password.Policy{}, fakeEvents{}, auditLog, "https://app.example.com", logger)
+}
+
+func TestPurgeDeletedAccountsWaitsForGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	repo := &deletionRepository{users: map[int64]*User{
+		1: {ID: 1, Username: "anna", Password: "secret"},
+		2: {ID: 2, Username: "boris"},
+		3: {ID: 3, Username: "chen", Password: "secret"},
+	}}
+	s := newDeletionService(repo, &fakeAuditLog{})
+
+	deleteAt, err := s.ScheduleDeletion(ctx, 1, "secret")
+	if err != nil {
+		t.Fatalf("ScheduleDeletion: %v", err)
+	}
+	if _, err := s.ScheduleDeletion(ctx, 3, "secret"); err != nil {
+		t.Fatalf("ScheduleDeletion: %v", err)
+	}
+	if _, err := s.CancelDeletion(ctx, 3); err != nil {
+		t.Fatalf("CancelDeletion: %v", err)
+	}
+
+	for _, before := range []time.Time{time.Now(), deleteAt.Add(-time.Minute)} {
+		deleted, err := s.PurgeDeletedAccounts(ctx, before)
+		if err != nil {
+			t.Fatalf("PurgeDeletedAccounts: %v", err)
+		}
+		if deleted != 0 || len(repo.users) != 3 {
+			t.Fatalf("purge at %v deleted %d accounts, want none inside the grace period", before, deleted)
+		}
+	}
+
+	deleted, err := s.PurgeDeletedAccounts(ctx, deleteAt.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("PurgeDeletedAccounts: %v", err)
+	}
+	if deleted != 1 || repo.users[1] != nil {
+		t.Fatalf("deleted %d accounts, want only the one whose grace period ended", deleted)
+	}
+	if repo.users[2] == nil || repo.users[3] == nil {
+		t.Fatal("accounts that were never scheduled or cancelled their deletion must be kept")
+	}
+}
+
+func TestPurgeDeletedAccountsContinuesAfterFailure(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	repo := &deletionRepository{
+		users: map[int64]*User{
+			1: {ID: 1, DeletionScheduledAt: &past},
+			2: {ID: 2, DeletionScheduledAt: &past},
+		},
+		failDelete: 1,
+	}
+	auditLog := &fakeAuditLog{}
+	s := newDeletionService(repo, auditLog)
+
+	deleted, err := s.PurgeDeletedAccounts(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("PurgeDeletedAccounts: %v", err)
+	}
+	if deleted != 1 || repo.users[1] == nil || repo.users[2] != nil {
+		t.Fatalf("deleted %d accounts, want the failed one left for the next run", deleted)
+	}
+	if len(auditLog.entries) != 1 || auditLog.entries[0].Action != audit.ActionUserDeleted || auditLog.entries[0].Details["user_id"] != int64(2) {
+		t.Fatalf("audit entries = %+v, want one deletion of user 2", auditLog.entries)
+	}
+}
@@ -0,0 +1,49 @@
+package workout
+
+import (
+	"github.com/Uranury/WorkoutTracker/internal/workout/session"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"time"
+)
+
+type StartSession struct {
+	Name       string
+	TemplateID *int64
+	// PerformedDate is the local day picked by the client, e.g. when logging a past workout
+	PerformedDate *date.Date
+	// UTCOffsetMinutes is the offset of the client clock, it decides the day instead of the profile time zone while travelling
+	UTCOffsetMinutes *int
+}
+
+type UpdateSession struct {
+	ID            int64      `json:"session_id"`
+	PerformedDate *date.Date `json:"performed_date,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	Notes         *string    `json:"notes,omitempty"`
+	Name          *string    `json:"name,omitempty"`
+}
+
+type RecordSet struct {
+	SessionExerciseID int64
+	// SetNumber 0 appends after the last recorded set
+	SetNumber  int
+	Reps       int
+	Weight     float64
+	WeightUnit session.WeightUnit
+}
+
+type RecordedSet struct {
+	ID int64 `json:"id"`
+	// PersonalRecord is set when the set is heavier than every earlier set of the exercise
+	PersonalRecord bool `json:"personal_record"`
+}
+
+// Stats are bucketed by calendar days in the user's time zone
+type Stats struct {
+	TimeZone      string                `json:"time_zone"`
+	Today         date.Date             `json:"today" swaggertype:"string" format:"date"`
+	CurrentStreak int                   `json:"current_streak_days"`
+	LongestStreak int                   `json:"longest_streak_days"`
+	Weeks         []session.WeekSummary `json:"weeks"`
+}
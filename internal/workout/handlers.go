@@ -1,6 +1,18 @@
 package workout
 
-import "time"
+import (
+	"errors"
+	"github.com/Uranury/WorkoutTracker/internal/middleware"
+	"github.com/Uranury/WorkoutTracker/internal/workout/session"
+	"github.com/Uranury/WorkoutTracker/pkg/apperrors"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"github.com/Uranury/WorkoutTracker/pkg/validation"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+const defaultStatsWeeks = 12
 
 type Handler struct {
 	service Service
@@ -10,11 +22,398 @@ func NewHandler(service Service) *Handler {
 	return &Handler{service: service}
 }
 
-type UpdateSession struct {
-	ID            int64      `json:"session_id"`
-	PerformedDate *time.Time `json:"performed_date,omitempty"`
+type StartSessionRequest struct {
+	Name       string `json:"name" validate:"required,min=1,max=100"`
+	TemplateID *int64 `json:"template_id,omitempty" validate:"omitempty,gt=0"`
+	// PerformedDate is the local day of the workout, today in the user's time zone when omitted
+	PerformedDate *date.Date `json:"performed_date,omitempty" swaggertype:"string" format:"date"`
+	// UTCOffsetMinutes is the offset of the device clock, e.g. 300 for UTC+5, it overrides the profile time zone
+	UTCOffsetMinutes *int `json:"utc_offset_minutes,omitempty" validate:"omitempty,gte=-720,lte=840"`
+}
+
+type UpdateSessionRequest struct {
+	Name          *string    `json:"name,omitempty" validate:"omitempty,min=1,max=100"`
+	Notes         *string    `json:"notes,omitempty" validate:"omitempty,max=2000"`
+	PerformedDate *date.Date `json:"performed_date,omitempty" swaggertype:"string" format:"date"`
 	StartedAt     *time.Time `json:"started_at,omitempty"`
-	FinishedAt    *time.Time `json:"finished_at,omitempty"`
-	Notes         *string    `json:"notes,omitempty"`
-	Name          *string    `json:"name,omitempty"`
+}
+
+type FinishSessionRequest struct {
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type AddExerciseRequest struct {
+	ExerciseID int64 `json:"exercise_id" validate:"required,gt=0"`
+	// OrderIndex 0 appends the exercise after the last one
+	OrderIndex int `json:"order_index" validate:"gte=0"`
+}
+
+type RecordSetRequest struct {
+	// SetNumber 0 appends after the last recorded set
+	SetNumber  int                `json:"set_number" validate:"gte=0"`
+	Reps       int                `json:"reps" validate:"required,gt=0"`
+	Weight     float64            `json:"weight" validate:"gte=0"`
+	WeightUnit session.WeightUnit `json:"weight_unit" validate:"required,oneof=kg lbs"`
+}
+
+type ListSessionsQuery struct {
+	From *date.Date `form:"from"`
+	To   *date.Date `form:"to"`
+}
+
+type StatsQuery struct {
+	Weeks int `form:"weeks" validate:"omitempty,gte=1,lte=52"`
+}
+
+type SessionIDPathParam struct {
+	ID int64 `uri:"id" binding:"required" validate:"required,gt=0"`
+}
+
+type SessionExercisePathParam struct {
+	SessionIDPathParam
+	ExerciseID int64 `uri:"exercise_id" binding:"required" validate:"required,gt=0"`
+}
+
+type CreatedResponse struct {
+	ID int64 `json:"id"`
+}
+
+// StartSession starts a workout session
+// @Summary Start session
+// @Description Starts a session now, copying the exercises of the template when one is given.
+// @Description The performed date is the current day in the user's time zone unless the client sends its own date or UTC offset.
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body StartSessionRequest true "Session payload"
+// @Success 201 {object} session.Session
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions [post]
+func (h *Handler) StartSession(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	req, ok := validation.BindAndValidate[StartSessionRequest](c)
+	if !ok {
+		return
+	}
+
+	sess, err := h.service.StartSession(c.Request.Context(), userID, StartSession{
+		Name:             req.Name,
+		TemplateID:       req.TemplateID,
+		PerformedDate:    req.PerformedDate,
+		UTCOffsetMinutes: req.UTCOffsetMinutes,
+	})
+	if err != nil {
+		respondError(c, err, "failed to start session")
+		return
+	}
+	c.JSON(http.StatusCreated, sess)
+}
+
+// ListSessions returns the workout history
+// @Summary List sessions
+// @Description Returns sessions performed between two local days, newest first. Without dates the last 30 days
+// @Description in the user's time zone are returned, a range can span up to 366 days.
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "First day, YYYY-MM-DD"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Success 200 {array} session.Session
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions [get]
+func (h *Handler) ListSessions(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	query, ok := validation.BindAndValidateQuery[ListSessionsQuery](c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.service.ListSessions(c.Request.Context(), userID, query.From, query.To)
+	if err != nil {
+		respondError(c, err, "failed to list sessions")
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// GetStats returns streaks and weekly totals
+// @Summary Get session stats
+// @Description Returns the current and longest streak of days with sessions and totals per week starting on Monday.
+// @Description Days and weeks follow the user's time zone.
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Param weeks query int false "Number of weeks up to the current one, 12 by default, up to 52"
+// @Success 200 {object} Stats
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/stats [get]
+func (h *Handler) GetStats(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	query, ok := validation.BindAndValidateQuery[StatsQuery](c)
+	if !ok {
+		return
+	}
+	if query.Weeks == 0 {
+		query.Weeks = defaultStatsWeeks
+	}
+
+	stats, err := h.service.Stats(c.Request.Context(), userID, query.Weeks)
+	if err != nil {
+		respondError(c, err, "failed to get stats")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetSession returns a session with its exercises and sets
+// @Summary Get session
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Success 200 {object} session.Session
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id} [get]
+func (h *Handler) GetSession(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[SessionIDPathParam](c)
+	if !ok {
+		return
+	}
+
+	sess, err := h.service.GetSession(c.Request.Context(), userID, params.ID)
+	if err != nil {
+		respondError(c, err, "failed to get session")
+		return
+	}
+	c.JSON(http.StatusOK, sess)
+}
+
+// UpdateSession updates a session
+// @Summary Update session
+// @Description Updates the name, notes, local performed date or start time of a session
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Param request body UpdateSessionRequest true "Fields to update"
+// @Success 200 {object} session.Session
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id} [patch]
+func (h *Handler) UpdateSession(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[SessionIDPathParam](c)
+	if !ok {
+		return
+	}
+	req, ok := validation.BindAndValidate[UpdateSessionRequest](c)
+	if !ok {
+		return
+	}
+
+	err = h.service.UpdateSession(c.Request.Context(), userID, UpdateSession{
+		ID:            params.ID,
+		PerformedDate: req.PerformedDate,
+		StartedAt:     req.StartedAt,
+		Notes:         req.Notes,
+		Name:          req.Name,
+	})
+	if err != nil {
+		respondError(c, err, "failed to update session")
+		return
+	}
+
+	sess, err := h.service.GetSession(c.Request.Context(), userID, params.ID)
+	if err != nil {
+		respondError(c, err, "failed to get session")
+		return
+	}
+	c.JSON(http.StatusOK, sess)
+}
+
+// FinishSession finishes a session
+// @Summary Finish session
+// @Description Sets the finish time of a session, now when the body is empty
+// @Tags sessions
+// @Accept json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Param request body FinishSessionRequest false "Finish time"
+// @Success 204
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id}/finish [post]
+func (h *Handler) FinishSession(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[SessionIDPathParam](c)
+	if !ok {
+		return
+	}
+	req := &FinishSessionRequest{}
+	if c.Request.ContentLength != 0 {
+		if req, ok = validation.BindAndValidate[FinishSessionRequest](c); !ok {
+			return
+		}
+	}
+
+	if err := h.service.SetSessionFinishTime(c.Request.Context(), userID, params.ID, req.FinishedAt); err != nil {
+		respondError(c, err, "failed to finish session")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// AddExercise adds an exercise to a session
+// @Summary Add exercise to session
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Param request body AddExerciseRequest true "Exercise payload"
+// @Success 201 {object} CreatedResponse
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 409 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id}/exercises [post]
+func (h *Handler) AddExercise(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[SessionIDPathParam](c)
+	if !ok {
+		return
+	}
+	req, ok := validation.BindAndValidate[AddExerciseRequest](c)
+	if !ok {
+		return
+	}
+
+	id, err := h.service.AddExerciseToSession(c.Request.Context(), userID, params.ID, req.ExerciseID, req.OrderIndex)
+	if err != nil {
+		respondError(c, err, "failed to add exercise")
+		return
+	}
+	c.JSON(http.StatusCreated, CreatedResponse{ID: id})
+}
+
+// RecordSet records a set of a session exercise
+// @Summary Record set
+// @Description Records a set and reports whether it is a new personal record, records show up in the feeds of followers
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Param exercise_id path int true "Session exercise ID"
+// @Param request body RecordSetRequest true "Set payload"
+// @Success 201 {object} RecordedSet
+// @Failure 400 {object} apperrors.HTTPError
+// @Failure 401 {object} apperrors.HTTPError
+// @Failure 403 {object} apperrors.HTTPError
+// @Failure 404 {object} apperrors.HTTPError
+// @Failure 409 {object} apperrors.HTTPError
+// @Failure 500 {object} apperrors.HTTPError
+// @Router /api/sessions/{id}/exercises/{exercise_id}/sets [post]
+func (h *Handler) RecordSet(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		apperrors.GenHTTPError(c, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	params, ok := validation.BindAndValidateURI[SessionExercisePathParam](c)
+	if !ok {
+		return
+	}
+	req, ok := validation.BindAndValidate[RecordSetRequest](c)
+	if !ok {
+		return
+	}
+
+	recorded, err := h.service.RecordSetToSessionExercise(c.Request.Context(), userID, params.ID, RecordSet{
+		SessionExerciseID: params.ExerciseID,
+		SetNumber:         req.SetNumber,
+		Reps:              req.Reps,
+		Weight:            req.Weight,
+		WeightUnit:        req.WeightUnit,
+	})
+	if err != nil {
+		respondError(c, err, "failed to record set")
+		return
+	}
+	c.JSON(http.StatusCreated, recorded)
+}
+
+func respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrTemplateNotFound),
+		errors.Is(err, ErrExerciseNotFound), errors.Is(err, ErrSessionExerciseNotFound):
+		apperrors.GenHTTPError(c, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, ErrExerciseAlreadyAdded), errors.Is(err, ErrSetAlreadyRecorded):
+		apperrors.GenHTTPError(c, http.StatusConflict, err.Error(), nil)
+	case errors.Is(err, ErrFutureDate), errors.Is(err, ErrInvalidDateRange), errors.Is(err, ErrInvalidTimes):
+		apperrors.GenHTTPError(c, http.StatusBadRequest, err.Error(), nil)
+	default:
+		apperrors.GenHTTPError(c, http.StatusInternalServerError, message, nil)
+	}
 }
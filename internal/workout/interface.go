@@ -3,15 +3,28 @@ package workout
 import (
 	"context"
 	"github.com/Uranury/WorkoutTracker/internal/workout/session"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
 	"time"
 )
 
 type Service interface {
 	CreateTemplate(ctx context.Context, userID int64, name, description string) (int64, error)
 	AddExerciseToTemplate(ctx context.Context, templateID, exerciseID int64, orderIndex, targetSets, targetReps int) (int64, error)
-	StartSession(ctx context.Context, userId int64, name string, templateID *int64) (int64, error)
-	AddExerciseToSession(ctx context.Context, sessionID, exerciseID int64, orderIndex int) (int64, error)
-	SetSessionFinishTime(ctx context.Context, sessionID int64, finishedAt *time.Time) error
-	UpdateSession(ctx context.Context, session UpdateSession) error
-	RecordSetToSessionExercise(ctx context.Context, sessionExerciseID int64, setNumber, reps int, weight float64, weightUnit session.WeightUnit) (int64, error)
+	// StartSession dates the session by the local day of the user, see StartSession for client overrides
+	StartSession(ctx context.Context, userID int64, input StartSession) (*session.Session, error)
+	// GetSession returns a session of userID with its exercises and sets
+	GetSession(ctx context.Context, userID, sessionID int64) (*session.Session, error)
+	// ListSessions returns sessions between two local days, the last 30 days of the user when both are nil
+	ListSessions(ctx context.Context, userID int64, from, to *date.Date) ([]session.Session, error)
+	AddExerciseToSession(ctx context.Context, userID, sessionID, exerciseID int64, orderIndex int) (int64, error)
+	// SetSessionFinishTime finishes a session at finishedAt, now when nil
+	SetSessionFinishTime(ctx context.Context, userID, sessionID int64, finishedAt *time.Time) error
+	UpdateSession(ctx context.Context, userID int64, session UpdateSession) error
+	RecordSetToSessionExercise(ctx context.Context, userID, sessionID int64, input RecordSet) (*RecordedSet, error)
+	// Stats returns the session streaks of the user and totals of the last weeks
+	Stats(ctx context.Context, userID int64, weeks int) (*Stats, error)
+	// CloseStaleSessions marks sessions left open since before startedBefore as abandoned and returns how many.
+	// Abandoned sessions get no finish time, so a forgotten session does not count as hours of training in
+	// durations, the feed, profile stats or challenges. Finishing one later still works.
+	CloseStaleSessions(ctx context.Context, startedBefore time.Time) (int64, error)
 }
@@ -2,22 +2,56 @@ package workout
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/Uranury/WorkoutTracker/internal/user"
 	"github.com/Uranury/WorkoutTracker/internal/workout/session"
 	"github.com/Uranury/WorkoutTracker/internal/workout/template"
 	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
 	"github.com/Uranury/WorkoutTracker/pkg/utils"
+	"github.com/lib/pq"
 	"time"
 )
 
+const (
+	// maxUTCOffset is the zone furthest ahead of UTC, no local day anywhere is later than today there
+	maxUTCOffset = 14 * time.Hour
+	// defaultHistoryDays is the history window when the client does not pick one
+	defaultHistoryDays = 30
+	maxHistoryDays     = 366
+)
+
+var (
+	ErrSessionNotFound         = errors.New("session not found")
+	ErrTemplateNotFound        = errors.New("template not found")
+	ErrExerciseNotFound        = errors.New("exercise not found")
+	ErrSessionExerciseNotFound = errors.New("exercise is not part of this session")
+	ErrExerciseAlreadyAdded    = errors.New("exercise or position is already taken in this session")
+	ErrSetAlreadyRecorded      = errors.New("set number is already recorded for this exercise")
+	ErrFutureDate              = errors.New("performed date cannot be in the future")
+	ErrInvalidDateRange        = errors.New("invalid date range")
+	ErrInvalidTimes            = errors.New("session cannot finish before it started")
+)
+
+// ScoreRefresher keeps derived scores such as challenge standings in step with the sessions of a user.
+// It is called after training on the given local days changed and handles its own errors.
+type ScoreRefresher interface {
+	RefreshScores(ctx context.Context, userID int64, days ...date.Date)
+}
+
 type service struct {
 	templateRepo template.Repository
 	sessionRepo  session.Repository
 	txProvider   database.TxProvider
+	users        user.Service
+	scores       ScoreRefresher
 }
 
-func NewService(templateRepo template.Repository, sessionRepo session.Repository, txProvider database.TxProvider) Service {
-	return &service{templateRepo, sessionRepo, txProvider}
+// NewService reads the time zone of users through users to date their sessions
+func NewService(templateRepo template.Repository, sessionRepo session.Repository, txProvider database.TxProvider, users user.Service, scores ScoreRefresher) Service {
+	return &service{templateRepo, sessionRepo, txProvider, users, scores}
 }
 
 func (s *service) CreateTemplate(ctx context.Context, userID int64, name, description string) (int64, error) {
@@ -65,19 +99,43 @@ func (s *service) AddExerciseToTemplate(ctx context.Context, templateID, exercis
 	return templateExerciseID, nil
 }
 
-func (s *service) StartSession(ctx context.Context, userId int64, name string, templateID *int64) (int64, error) {
-	var sessionID int64
+func (s *service) StartSession(ctx context.Context, userID int64, input StartSession) (*session.Session, error) {
+	now := time.Now()
+	performedDate, err := s.localDate(ctx, userID, now, input.UTCOffsetMinutes)
+	if err != nil {
+		return nil, err
+	}
+	if input.PerformedDate != nil {
+		if err := checkNotFuture(*input.PerformedDate, now); err != nil {
+			return nil, err
+		}
+		performedDate = *input.PerformedDate
+	}
 
-	err := s.txProvider.RunInTx(ctx, func(exec database.Executor) error {
+	var created session.Session
+	err = s.txProvider.RunInTx(ctx, func(exec database.Executor) error {
 		sessRepo := session.NewRepository(exec)
 		tmplRepo := template.NewRepository(exec)
 
+		if input.TemplateID != nil {
+			tmpl, err := tmplRepo.GetTemplateByID(ctx, *input.TemplateID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrTemplateNotFound
+			}
+			if err != nil {
+				return fmt.Errorf("get template: %w", err)
+			}
+			if tmpl.UserID != userID {
+				return ErrTemplateNotFound
+			}
+		}
+
 		newSession := &session.Session{
-			UserID:        userId,
-			Name:          name,
-			TemplateID:    templateID,
-			PerformedDate: time.Now(),
-			StartedAt:     utils.TimePtr(time.Now()),
+			UserID:        userID,
+			Name:          input.Name,
+			TemplateID:    input.TemplateID,
+			PerformedDate: performedDate,
+			StartedAt:     utils.TimePtr(now),
 		}
 
 		sessionID, err := sessRepo.CreateSession(ctx, *newSession)
@@ -85,8 +143,8 @@ func (s *service) StartSession(ctx context.Context, userId int64, name string, t
 			return fmt.Errorf("create session: %w", err)
 		}
 
-		if templateID != nil {
-			templateExercises, err := tmplRepo.GetTemplateExercises(ctx, *templateID)
+		if input.TemplateID != nil {
+			templateExercises, err := tmplRepo.GetTemplateExercises(ctx, *input.TemplateID)
 			if err != nil {
 				return fmt.Errorf("get template exercises: %w", err)
 			}
@@ -101,17 +159,78 @@ func (s *service) StartSession(ctx context.Context, userId int64, name string, t
 				}
 			}
 		}
+
+		created, err = sessRepo.GetUserSession(ctx, userID, sessionID)
+		if err != nil {
+			return fmt.Errorf("get session: %w", err)
+		}
 		return nil
 	})
 
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (s *service) GetSession(ctx context.Context, userID, sessionID int64) (*session.Session, error) {
+	sess, err := s.userSession(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	exercises, err := s.sessionRepo.GetSessionExercises(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("get session exercises: %w", err)
 	}
+	sets, err := s.sessionRepo.GetSessionSets(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("get session sets: %w", err)
+	}
+
+	setsByExercise := make(map[int64][]session.ExerciseSet)
+	for _, set := range sets {
+		setsByExercise[set.SessionExerciseID] = append(setsByExercise[set.SessionExerciseID], set)
+	}
+	for i := range exercises {
+		exercises[i].Sets = setsByExercise[exercises[i].ID]
+		if exercises[i].Sets == nil {
+			exercises[i].Sets = []session.ExerciseSet{}
+		}
+	}
+	sess.Exercises = exercises
+	return sess, nil
+}
 
-	return sessionID, nil
+func (s *service) ListSessions(ctx context.Context, userID int64, from, to *date.Date) ([]session.Session, error) {
+	if from == nil || to == nil {
+		today, err := s.localDate(ctx, userID, time.Now(), nil)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case from == nil && to == nil:
+			to = &today
+			from = utils.Ptr(today.AddDays(-(defaultHistoryDays - 1)))
+		case from == nil:
+			from = utils.Ptr(to.AddDays(-(defaultHistoryDays - 1)))
+		default:
+			to = &today
+		}
+	}
+
+	if span := from.DaysUntil(*to); span < 0 || span >= maxHistoryDays {
+		return nil, ErrInvalidDateRange
+	}
+	return s.sessionRepo.ListUserSessions(ctx, userID, *from, *to)
 }
 
-func (s *service) AddExerciseToSession(ctx context.Context, sessionID, exerciseID int64, orderIndex int) (int64, error) {
+func (s *service) AddExerciseToSession(ctx context.Context, userID, sessionID, exerciseID int64, orderIndex int) (int64, error) {
+	if _, err := s.userSession(ctx, userID, sessionID); err != nil {
+		return 0, err
+	}
+
 	sessionExercise := &session.Exercise{
 		SessionID:  sessionID,
 		ExerciseID: exerciseID,
@@ -127,31 +246,200 @@ func (s *service) AddExerciseToSession(ctx context.Context, sessionID, exerciseI
 	}
 
 	sessionExerciseID, err := s.sessionRepo.CreateSessionExercise(ctx, *sessionExercise)
+	switch pqErrorCode(err) {
+	case uniqueViolation:
+		return 0, ErrExerciseAlreadyAdded
+	case foreignKeyViolation:
+		return 0, ErrExerciseNotFound
+	}
 	if err != nil {
 		return 0, fmt.Errorf("create session exercise: %w", err)
 	}
 	return sessionExerciseID, nil
 }
 
-func (s *service) SetSessionFinishTime(ctx context.Context, sessionID int64, finishedAt *time.Time) error {
-	return s.sessionRepo.UpdateSessionFinishTime(ctx, sessionID, finishedAt)
+func (s *service) SetSessionFinishTime(ctx context.Context, userID, sessionID int64, finishedAt *time.Time) error {
+	sess, err := s.userSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if finishedAt == nil {
+		finishedAt = utils.TimePtr(time.Now())
+	}
+	if sess.StartedAt != nil && finishedAt.Before(*sess.StartedAt) {
+		return ErrInvalidTimes
+	}
+	if err := s.sessionRepo.UpdateSessionFinishTime(ctx, sessionID, finishedAt); err != nil {
+		return err
+	}
+	s.scores.RefreshScores(ctx, userID, sess.PerformedDate)
+	return nil
 }
 
-func (s *service) UpdateSession(ctx context.Context, session UpdateSession) error {
-	return s.sessionRepo.UpdateSession(ctx, session.ID, session.Name, session.Notes, session.PerformedDate, session.StartedAt)
+func (s *service) UpdateSession(ctx context.Context, userID int64, input UpdateSession) error {
+	sess, err := s.userSession(ctx, userID, input.ID)
+	if err != nil {
+		return err
+	}
+	if input.PerformedDate != nil {
+		if err := checkNotFuture(*input.PerformedDate, time.Now()); err != nil {
+			return err
+		}
+	}
+	if input.StartedAt != nil && sess.FinishedAt != nil && sess.FinishedAt.Before(*input.StartedAt) {
+		return ErrInvalidTimes
+	}
+	if err := s.sessionRepo.UpdateSession(ctx, input.ID, input.Name, input.Notes, input.PerformedDate, input.StartedAt); err != nil {
+		return err
+	}
+	if input.PerformedDate != nil && !input.PerformedDate.Equal(sess.PerformedDate.Time) {
+		s.scores.RefreshScores(ctx, userID, sess.PerformedDate, *input.PerformedDate)
+	}
+	return nil
 }
 
-func (s *service) RecordSetToSessionExercise(ctx context.Context, sessionExerciseID int64, setNumber, reps int, weight float64, weightUnit session.WeightUnit) (int64, error) {
+func (s *service) RecordSetToSessionExercise(ctx context.Context, userID, sessionID int64, input RecordSet) (*RecordedSet, error) {
+	sess, err := s.userSession(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.sessionRepo.GetSessionExercise(ctx, sessionID, input.SessionExerciseID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionExerciseNotFound
+		}
+		return nil, fmt.Errorf("get session exercise: %w", err)
+	}
+
 	performedSet := &session.ExerciseSet{
-		SessionExerciseID: sessionExerciseID,
-		SetNumber:         setNumber,
-		Reps:              reps,
-		Weight:            weight,
-		WeightUnit:        weightUnit,
+		SessionExerciseID: input.SessionExerciseID,
+		SetNumber:         input.SetNumber,
+		Reps:              input.Reps,
+		Weight:            input.Weight,
+		WeightUnit:        input.WeightUnit,
+	}
+	if input.SetNumber == 0 {
+		last, err := s.sessionRepo.GetMaxSetNumber(ctx, input.SessionExerciseID)
+		if err != nil {
+			return nil, fmt.Errorf("get max set number: %w", err)
+		}
+		performedSet.SetNumber = last + 1
+	}
+
+	recorded := &RecordedSet{}
+	err = s.txProvider.RunInTx(ctx, func(exec database.Executor) error {
+		sessRepo := session.NewRepository(exec)
+
+		var err error
+		recorded.ID, err = sessRepo.CreateSet(ctx, *performedSet)
+		if pqErrorCode(err) == uniqueViolation {
+			return ErrSetAlreadyRecorded
+		}
+		if err != nil {
+			return fmt.Errorf("create exercise set: %w", err)
+		}
+		if recorded.PersonalRecord, err = sessRepo.RecordPersonalRecord(ctx, recorded.ID); err != nil {
+			return fmt.Errorf("record personal record: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.scores.RefreshScores(ctx, userID, sess.PerformedDate)
+	return recorded, nil
+}
+
+func (s *service) Stats(ctx context.Context, userID int64, weeks int) (*Stats, error) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	today := date.New(time.Now().In(u.Location()))
+
+	streaks, err := s.sessionRepo.ListStreaks(ctx, userID, today)
+	if err != nil {
+		return nil, fmt.Errorf("list streaks: %w", err)
+	}
+	stats := &Stats{TimeZone: u.Location().String(), Today: today}
+	for i, streak := range streaks {
+		// a streak is still alive until a whole local day passes without a session
+		if i == 0 && streak.EndDate.DaysUntil(today) <= 1 {
+			stats.CurrentStreak = streak.Days
+		}
+		stats.LongestStreak = max(stats.LongestStreak, streak.Days)
+	}
+
+	// weeks start on Monday, Go counts weekdays from Sunday
+	currentWeek := today.AddDays(-((int(today.Weekday()) + 6) % 7))
+	firstWeek := currentWeek.AddDays(-7 * (weeks - 1))
+	summaries, err := s.sessionRepo.ListWeekSummaries(ctx, userID, firstWeek, today)
+	if err != nil {
+		return nil, fmt.Errorf("list week summaries: %w", err)
+	}
+
+	// fill weeks without sessions so clients can chart the result as is
+	stats.Weeks = make([]session.WeekSummary, weeks)
+	for i := range stats.Weeks {
+		stats.Weeks[i].WeekStart = firstWeek.AddDays(7 * i)
+	}
+	for _, summary := range summaries {
+		if i := firstWeek.DaysUntil(summary.WeekStart) / 7; i >= 0 && i < weeks {
+			stats.Weeks[i] = summary
+		}
+	}
+	return stats, nil
+}
+
+// CloseStaleSessions runs from the stale session job, there is no user to check ownership for
+func (s *service) CloseStaleSessions(ctx context.Context, startedBefore time.Time) (int64, error) {
+	closed, err := s.sessionRepo.CloseStaleSessions(ctx, startedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("close stale sessions: %w", err)
+	}
+	return closed, nil
+}
+
+// userSession hides sessions of other users behind ErrSessionNotFound
+func (s *service) userSession(ctx context.Context, userID, sessionID int64) (*session.Session, error) {
+	sess, err := s.sessionRepo.GetUserSession(ctx, userID, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
 	}
-	performedSetID, err := s.sessionRepo.CreateSet(ctx, *performedSet)
 	if err != nil {
-		return 0, fmt.Errorf("create exercise set: %w", err)
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+	return &sess, nil
+}
+
+// localDate returns the calendar day of now for the user. A client offset wins over the profile time zone,
+// the profile can be stale while travelling.
+func (s *service) localDate(ctx context.Context, userID int64, now time.Time, utcOffsetMinutes *int) (date.Date, error) {
+	if utcOffsetMinutes != nil {
+		return date.New(now.In(time.FixedZone("", *utcOffsetMinutes*60))), nil
+	}
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return date.Date{}, fmt.Errorf("get user: %w", err)
+	}
+	return date.New(now.In(u.Location())), nil
+}
+
+func checkNotFuture(d date.Date, now time.Time) error {
+	if d.After(date.New(now.UTC().Add(maxUTCOffset)).Time) {
+		return ErrFutureDate
+	}
+	return nil
+}
+
+const (
+	uniqueViolation     pq.ErrorCode = "23505"
+	foreignKeyViolation pq.ErrorCode = "23503"
+)
+
+func pqErrorCode(err error) pq.ErrorCode {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code
 	}
-	return performedSetID, nil
+	return ""
 }
@@ -0,0 +1,91 @@
+package workout
+
+import (
+	"context"
+	"github.com/Uranury/WorkoutTracker/internal/user"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"github.com/Uranury/WorkoutTracker/pkg/utils"
+	"testing"
+	"time"
+	// zone rules must not depend on the machine running the tests
+	_ "time/tzdata"
+)
+
+// fakeUsers serves users that only have a time zone
+type fakeUsers struct {
+	user.Service
+	timeZone string
+}
+
+func (u *fakeUsers) GetByID(_ context.Context, id int64) (*user.User, error) {
+	return &user.User{ID: id, TimeZone: u.timeZone}, nil
+}
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatalf("time.Parse(%q): %v", s, err)
+	}
+	return ts
+}
+
+func TestLocalDateAcrossTimeZones(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeZone string
+		now      string
+		offset   *int
+		want     string
+	}{
+		{name: "UTC", timeZone: "UTC", now: "2026-03-01T23:30:00Z", want: "2026-03-01"},
+		{name: "ahead of UTC is already tomorrow", timeZone: "Asia/Tokyo", now: "2026-03-01T23:30:00Z", want: "2026-03-02"},
+		{name: "behind UTC is still today", timeZone: "America/New_York", now: "2026-03-02T03:30:00Z", want: "2026-03-01"},
+		{name: "furthest ahead", timeZone: "Pacific/Kiritimati", now: "2026-03-01T10:00:00Z", want: "2026-03-02"},
+		{name: "furthest behind", timeZone: "Pacific/Pago_Pago", now: "2026-03-02T10:59:00Z", want: "2026-03-01"},
+		{name: "half hour zone before midnight", timeZone: "Asia/Kolkata", now: "2026-03-01T18:29:00Z", want: "2026-03-01"},
+		{name: "half hour zone after midnight", timeZone: "Asia/Kolkata", now: "2026-03-01T18:30:00Z", want: "2026-03-02"},
+		{name: "daylight saving time", timeZone: "America/Los_Angeles", now: "2026-07-02T06:30:00Z", want: "2026-07-01"},
+		{name: "standard time", timeZone: "America/Los_Angeles", now: "2026-01-02T07:30:00Z", want: "2026-01-01"},
+		{name: "unknown zone falls back to UTC", timeZone: "Mars/Olympus_Mons", now: "2026-03-01T23:30:00Z", want: "2026-03-01"},
+		{name: "client offset wins over the profile", timeZone: "Asia/Tokyo", now: "2026-03-01T23:30:00Z", offset: utils.Ptr(-300), want: "2026-03-01"},
+		{name: "client offset ahead", timeZone: "UTC", now: "2026-03-01T23:30:00Z", offset: utils.Ptr(60), want: "2026-03-02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{users: &fakeUsers{timeZone: tt.timeZone}}
+			got, err := s.localDate(context.Background(), 1, mustTime(t, tt.now), tt.offset)
+			if err != nil {
+				t.Fatalf("localDate: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("localDate = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckNotFuture(t *testing.T) {
+	now := mustTime(t, "2026-03-01T10:00:00Z")
+	tests := []struct {
+		day     string
+		wantErr bool
+	}{
+		{day: "2026-02-28"},
+		{day: "2026-03-01"},
+		// already today in UTC+14
+		{day: "2026-03-02"},
+		{day: "2026-03-03", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		d, err := date.Parse(tt.day)
+		if err != nil {
+			t.Fatalf("date.Parse: %v", err)
+		}
+		if err := checkNotFuture(d, now); (err != nil) != tt.wantErr {
+			t.Errorf("checkNotFuture(%s) = %v, want error %v", tt.day, err, tt.wantErr)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package session
 
 import (
 	"context"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
 	"time"
 )
 
@@ -9,10 +10,36 @@ type Repository interface {
 	CreateSession(ctx context.Context, session Session) (int64, error)
 	CreateSessionExercise(ctx context.Context, session Exercise) (int64, error)
 	GetSessionByID(ctx context.Context, sessionID int64) (Session, error)
+	// GetUserSession returns a session of userID, sql.ErrNoRows when it does not exist or belongs to someone else
+	GetUserSession(ctx context.Context, userID, sessionID int64) (Session, error)
+	// ListUserSessions returns sessions performed between from and to inclusive, newest first
+	ListUserSessions(ctx context.Context, userID int64, from, to date.Date) ([]Session, error)
 	GetSessionByTemplateID(ctx context.Context, templateID int64) (Session, error)
 	GetSessionMaxOrderIndex(ctx context.Context, sessionID int64) (int, error)
-	UpdateSession(ctx context.Context, id int64, name, notes *string, performedDate *time.Time, startedAt *time.Time) error
+	GetSessionExercise(ctx context.Context, sessionID, sessionExerciseID int64) (Exercise, error)
+	GetSessionExercises(ctx context.Context, sessionID int64) ([]Exercise, error)
+	GetSessionSets(ctx context.Context, sessionID int64) ([]ExerciseSet, error)
+	GetMaxSetNumber(ctx context.Context, sessionExerciseID int64) (int, error)
+	UpdateSession(ctx context.Context, id int64, name, notes *string, performedDate *date.Date, startedAt *time.Time) error
 	UpdateSessionFinishTime(ctx context.Context, sessionID int64, finishedAt *time.Time) error
+	// CloseStaleSessions marks unfinished sessions started before startedBefore as abandoned without finishing them
+	CloseStaleSessions(ctx context.Context, startedBefore time.Time) (int64, error)
 
 	CreateSet(ctx context.Context, excSet ExerciseSet) (int64, error)
+	// RecordPersonalRecord stores the set as a personal record if it is heavier than every earlier set of the
+	// exercise by the same user. The first set of an exercise sets the baseline and is not a record.
+	RecordPersonalRecord(ctx context.Context, setID int64) (bool, error)
+
+	// ListFinishedSummaries returns the latest finished sessions of a user, most recently finished first
+	ListFinishedSummaries(ctx context.Context, userID int64, limit int) ([]Summary, error)
+	// ListSummariesByIDs returns the summaries of the given sessions in no particular order
+	ListSummariesByIDs(ctx context.Context, ids []int64) ([]Summary, error)
+	CountFinishedSessions(ctx context.Context, userID int64) (int, error)
+	// ListPersonalRecords returns the record of every exercise the user lifted weight in, by exercise name
+	ListPersonalRecords(ctx context.Context, userID int64) ([]PersonalRecord, error)
+
+	// ListStreaks returns runs of consecutive session days up to through, latest first
+	ListStreaks(ctx context.Context, userID int64, through date.Date) ([]Streak, error)
+	// ListWeekSummaries returns totals of weeks between from and to that have sessions, oldest first
+	ListWeekSummaries(ctx context.Context, userID int64, from, to date.Date) ([]WeekSummary, error)
 }
@@ -1,27 +1,31 @@
 package session
 
 import (
+	"github.com/Uranury/WorkoutTracker/pkg/date"
 	"time"
 )
 
 type Session struct {
-	ID            int64      `json:"id" db:"id"`
-	UserID        int64      `json:"user_id" db:"user_id"`
-	TemplateID    *int64     `json:"template_id" db:"template_id"`
-	PerformedDate time.Time  `json:"performed_date" db:"performed_date"`
+	ID         int64  `json:"id" db:"id"`
+	UserID     int64  `json:"user_id" db:"user_id"`
+	TemplateID *int64 `json:"template_id" db:"template_id"`
+	// PerformedDate is the calendar day in the user's time zone, not a UTC day
+	PerformedDate date.Date  `json:"performed_date" db:"performed_date" swaggertype:"string" format:"date"`
 	StartedAt     *time.Time `json:"started_at" db:"started_at"`
 	FinishedAt    *time.Time `json:"finished_at" db:"finished_at"`
-	Name          string     `json:"name" db:"name"`   // ← "Push Day A", "Legs", etc.
-	Notes         string     `json:"notes" db:"notes"` // ← "Felt tired", "New gym"
+	AbandonedAt   *time.Time `json:"abandoned_at,omitempty" db:"abandoned_at"` // ← left open too long, never finished
+	Name          string     `json:"name" db:"name"`                           // ← "Push Day A", "Legs", etc.
+	Notes         *string    `json:"notes" db:"notes"`                         // ← "Felt tired", "New gym"
 	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
-	Exercises     []Exercise `json:"exercises" db:"-"` // ← Won't map directly from DB
+	Exercises     []Exercise `json:"exercises,omitempty" db:"-"` // ← Won't map directly from DB
 }
 
 type Exercise struct {
-	ID         int64 `json:"id" db:"id"`
-	SessionID  int64 `json:"session_id" db:"session_id"`
-	ExerciseID int64 `json:"exercise_id" db:"exercise_id"`
-	OrderIndex int   `json:"order_index" db:"order_index"`
+	ID         int64         `json:"id" db:"id"`
+	SessionID  int64         `json:"session_id" db:"session_id"`
+	ExerciseID int64         `json:"exercise_id" db:"exercise_id"`
+	OrderIndex int           `json:"order_index" db:"order_index"`
+	Sets       []ExerciseSet `json:"sets" db:"-"`
 }
 
 type ExerciseSet struct {
@@ -39,3 +43,43 @@ var (
 	Kilograms WeightUnit = "kg"
 	Pounds    WeightUnit = "lbs"
 )
+
+// Summary describes a session by its totals without exercises and sets, e.g. for profiles
+type Summary struct {
+	ID            int64      `json:"id" db:"id"`
+	UserID        int64      `json:"user_id" db:"user_id"`
+	Name          string     `json:"name" db:"name"`
+	PerformedDate date.Date  `json:"performed_date" db:"performed_date" swaggertype:"string" format:"date"`
+	StartedAt     *time.Time `json:"started_at" db:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at" db:"finished_at"`
+	Exercises     int        `json:"exercises" db:"exercises"`
+	Sets          int        `json:"sets" db:"sets"`
+	VolumeKG      float64    `json:"volume_kg" db:"volume_kg"`
+	Reactions     int        `json:"reactions" db:"reactions"`
+	Comments      int        `json:"comments" db:"comments"`
+}
+
+// PersonalRecord is the heaviest set of an exercise, ties go to more reps and then to the earlier session
+type PersonalRecord struct {
+	ExerciseID    int64     `json:"exercise_id" db:"exercise_id"`
+	Exercise      string    `json:"exercise" db:"exercise"`
+	WeightKG      float64   `json:"weight_kg" db:"weight_kg"`
+	Reps          int       `json:"reps" db:"reps"`
+	SessionID     int64     `json:"session_id" db:"session_id"`
+	PerformedDate date.Date `json:"performed_date" db:"performed_date" swaggertype:"string" format:"date"`
+}
+
+// Streak is a run of consecutive days with at least one session
+type Streak struct {
+	StartDate date.Date `json:"start_date" db:"start_date" swaggertype:"string" format:"date"`
+	EndDate   date.Date `json:"end_date" db:"end_date" swaggertype:"string" format:"date"`
+	Days      int       `json:"days" db:"days"`
+}
+
+// WeekSummary totals the sessions of a week starting on Monday. Volume is reps times weight with pounds converted to kilograms.
+type WeekSummary struct {
+	WeekStart date.Date `json:"week_start" db:"week_start" swaggertype:"string" format:"date"`
+	Sessions  int       `json:"sessions" db:"sessions"`
+	Sets      int       `json:"sets" db:"sets"`
+	VolumeKG  float64   `json:"volume_kg" db:"volume_kg"`
+}
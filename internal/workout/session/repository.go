@@ -4,9 +4,19 @@ import (
 	"context"
 	"fmt"
 	"github.com/Uranury/WorkoutTracker/pkg/database"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"github.com/lib/pq"
 	"time"
 )
 
+const sessionColumns = "id, user_id, template_id, performed_date, started_at, finished_at, abandoned_at, name, notes, created_at"
+
+// weightKG and volumeKG normalize sets of workout_session_sets ss to kilograms so units can be compared and summed
+const (
+	weightKG = "ss.weight * CASE WHEN ss.weight_unit = 'lbs' THEN 0.45359237 ELSE 1 END"
+	volumeKG = "ss.reps * " + weightKG
+)
+
 type repository struct {
 	executor database.Executor
 }
@@ -38,6 +48,24 @@ func (r *repository) GetSessionByID(ctx context.Context, sessionID int64) (Sessi
 	return session, nil
 }
 
+func (r *repository) GetUserSession(ctx context.Context, userID, sessionID int64) (Session, error) {
+	var session Session
+	query := "SELECT " + sessionColumns + " FROM workout_sessions WHERE id = $1 AND user_id = $2"
+	if err := r.executor.GetContext(ctx, &session, query, sessionID, userID); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+func (r *repository) ListUserSessions(ctx context.Context, userID int64, from, to date.Date) ([]Session, error) {
+	sessions := []Session{}
+	query := "SELECT " + sessionColumns + ` FROM workout_sessions
+              WHERE user_id = $1 AND performed_date BETWEEN $2 AND $3
+              ORDER BY performed_date DESC, started_at DESC NULLS LAST, id DESC`
+	err := r.executor.SelectContext(ctx, &sessions, query, userID, from, to)
+	return sessions, err
+}
+
 func (r *repository) GetSessionMaxOrderIndex(ctx context.Context, sessionID int64) (int, error) {
 	query := `SELECT COALESCE(MAX(order_index), 0) FROM workout_session_exercises WHERE session_id = $1`
 	var order int
@@ -56,7 +84,43 @@ func (r *repository) GetSessionByTemplateID(ctx context.Context, templateID int6
 	return session, nil
 }
 
-func (r *repository) UpdateSession(ctx context.Context, id int64, name, notes *string, performedDate *time.Time, startedAt *time.Time) error {
+func (r *repository) GetSessionExercise(ctx context.Context, sessionID, sessionExerciseID int64) (Exercise, error) {
+	var se Exercise
+	query := `SELECT id, session_id, exercise_id, order_index FROM workout_session_exercises WHERE id = $1 AND session_id = $2`
+	if err := r.executor.GetContext(ctx, &se, query, sessionExerciseID, sessionID); err != nil {
+		return Exercise{}, err
+	}
+	return se, nil
+}
+
+func (r *repository) GetSessionExercises(ctx context.Context, sessionID int64) ([]Exercise, error) {
+	exercises := []Exercise{}
+	query := `SELECT id, session_id, exercise_id, order_index FROM workout_session_exercises WHERE session_id = $1 ORDER BY order_index`
+	err := r.executor.SelectContext(ctx, &exercises, query, sessionID)
+	return exercises, err
+}
+
+func (r *repository) GetSessionSets(ctx context.Context, sessionID int64) ([]ExerciseSet, error) {
+	sets := []ExerciseSet{}
+	query := `SELECT ss.id, ss.session_exercise_id, ss.set_number, ss.reps, ss.weight, ss.weight_unit
+              FROM workout_session_sets ss
+              JOIN workout_session_exercises se ON se.id = ss.session_exercise_id
+              WHERE se.session_id = $1
+              ORDER BY ss.session_exercise_id, ss.set_number`
+	err := r.executor.SelectContext(ctx, &sets, query, sessionID)
+	return sets, err
+}
+
+func (r *repository) GetMaxSetNumber(ctx context.Context, sessionExerciseID int64) (int, error) {
+	query := `SELECT COALESCE(MAX(set_number), 0) FROM workout_session_sets WHERE session_exercise_id = $1`
+	var number int
+	if err := r.executor.QueryRowxContext(ctx, query, sessionExerciseID).Scan(&number); err != nil {
+		return 0, err
+	}
+	return number, nil
+}
+
+func (r *repository) UpdateSession(ctx context.Context, id int64, name, notes *string, performedDate *date.Date, startedAt *time.Time) error {
 	query := `UPDATE workout_sessions
               SET 
               name = COALESCE($1, name),
@@ -69,7 +133,7 @@ func (r *repository) UpdateSession(ctx context.Context, id int64, name, notes *s
 }
 
 func (r *repository) UpdateSessionFinishTime(ctx context.Context, id int64, finishedAt *time.Time) error {
-	query := `UPDATE workout_sessions SET finished_at = $1 WHERE id = $2`
+	query := `UPDATE workout_sessions SET finished_at = $1, abandoned_at = NULL WHERE id = $2`
 
 	res, err := r.executor.ExecContext(ctx, query, finishedAt, id)
 	if err != nil {
@@ -81,9 +145,127 @@ func (r *repository) UpdateSessionFinishTime(ctx context.Context, id int64, fini
 	return nil
 }
 
+func (r *repository) CloseStaleSessions(ctx context.Context, startedBefore time.Time) (int64, error) {
+	query := `UPDATE workout_sessions SET abandoned_at = NOW() WHERE finished_at IS NULL AND abandoned_at IS NULL AND started_at < $1`
+
+	res, err := r.executor.ExecContext(ctx, query, startedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (r *repository) CreateSet(ctx context.Context, excSet ExerciseSet) (int64, error) {
 	query := `INSERT INTO workout_session_sets (session_exercise_id, set_number, reps, weight, weight_unit) VALUES ($1, $2, $3, $4, $5) RETURNING id`
 	var id int64
 	err := r.executor.QueryRowxContext(ctx, query, excSet.SessionExerciseID, excSet.SetNumber, excSet.Reps, excSet.Weight, excSet.WeightUnit).Scan(&id)
 	return id, err
 }
+
+const summarySelect = `SELECT s.id, s.user_id, s.name, s.performed_date, s.started_at, s.finished_at,
+                     COUNT(DISTINCT se.id) AS exercises,
+                     COUNT(ss.id) AS sets,
+                     COALESCE(SUM(` + volumeKG + `), 0) AS volume_kg,
+                     (SELECT COUNT(*) FROM session_reactions r WHERE r.session_id = s.id) AS reactions,
+                     (SELECT COUNT(*) FROM session_comments c WHERE c.session_id = s.id AND c.deleted_at IS NULL) AS comments
+              FROM workout_sessions s
+              LEFT JOIN workout_session_exercises se ON se.session_id = s.id
+              LEFT JOIN workout_session_sets ss ON ss.session_exercise_id = se.id`
+
+func (r *repository) ListFinishedSummaries(ctx context.Context, userID int64, limit int) ([]Summary, error) {
+	summaries := []Summary{}
+	query := summarySelect + `
+              WHERE s.user_id = $1 AND s.finished_at IS NOT NULL
+              GROUP BY s.id
+              ORDER BY s.finished_at DESC, s.id DESC
+              LIMIT $2`
+	err := r.executor.SelectContext(ctx, &summaries, query, userID, limit)
+	return summaries, err
+}
+
+func (r *repository) ListSummariesByIDs(ctx context.Context, ids []int64) ([]Summary, error) {
+	summaries := []Summary{}
+	query := summarySelect + `
+              WHERE s.id = ANY($1)
+              GROUP BY s.id`
+	err := r.executor.SelectContext(ctx, &summaries, query, pq.Array(ids))
+	return summaries, err
+}
+
+func (r *repository) CountFinishedSessions(ctx context.Context, userID int64) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM workout_sessions WHERE user_id = $1 AND finished_at IS NOT NULL`
+	err := r.executor.QueryRowxContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+func (r *repository) ListPersonalRecords(ctx context.Context, userID int64) ([]PersonalRecord, error) {
+	records := []PersonalRecord{}
+	query := `SELECT * FROM (
+                  SELECT DISTINCT ON (se.exercise_id)
+                         se.exercise_id, e.name AS exercise, ` + weightKG + ` AS weight_kg, ss.reps,
+                         s.id AS session_id, s.performed_date
+                  FROM workout_session_sets ss
+                  JOIN workout_session_exercises se ON se.id = ss.session_exercise_id
+                  JOIN workout_sessions s ON s.id = se.session_id
+                  JOIN exercises e ON e.id = se.exercise_id
+                  WHERE s.user_id = $1 AND ss.weight > 0
+                  ORDER BY se.exercise_id, weight_kg DESC, ss.reps DESC, s.performed_date, ss.id
+              ) records
+              ORDER BY exercise`
+	err := r.executor.SelectContext(ctx, &records, query, userID)
+	return records, err
+}
+
+func (r *repository) RecordPersonalRecord(ctx context.Context, setID int64) (bool, error) {
+	query := `INSERT INTO personal_records (user_id, exercise_id, session_id, set_id, weight_kg, reps)
+              SELECT s.user_id, se.exercise_id, s.id, ss.id, ` + weightKG + `, ss.reps
+              FROM workout_session_sets ss
+              JOIN workout_session_exercises se ON se.id = ss.session_exercise_id
+              JOIN workout_sessions s ON s.id = se.session_id
+              WHERE ss.id = $1 AND ss.weight > 0 AND ` + weightKG + ` > (
+                  SELECT MAX(prev.weight * CASE WHEN prev.weight_unit = 'lbs' THEN 0.45359237 ELSE 1 END)
+                  FROM workout_session_sets prev
+                  JOIN workout_session_exercises pse ON pse.id = prev.session_exercise_id
+                  JOIN workout_sessions ps ON ps.id = pse.session_id
+                  WHERE ps.user_id = s.user_id AND pse.exercise_id = se.exercise_id AND prev.id <> ss.id
+              )`
+	res, err := r.executor.ExecContext(ctx, query, setID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows > 0, err
+}
+
+// ListStreaks groups session days into islands: consecutive days minus their row number share the same anchor day
+func (r *repository) ListStreaks(ctx context.Context, userID int64, through date.Date) ([]Streak, error) {
+	streaks := []Streak{}
+	query := `WITH days AS (
+                  SELECT DISTINCT performed_date AS day FROM workout_sessions WHERE user_id = $1 AND performed_date <= $2
+              ), islands AS (
+                  SELECT day, day - (ROW_NUMBER() OVER (ORDER BY day))::INT AS anchor FROM days
+              )
+              SELECT MIN(day) AS start_date, MAX(day) AS end_date, COUNT(*) AS days
+              FROM islands
+              GROUP BY anchor
+              ORDER BY end_date DESC`
+	err := r.executor.SelectContext(ctx, &streaks, query, userID, through)
+	return streaks, err
+}
+
+func (r *repository) ListWeekSummaries(ctx context.Context, userID int64, from, to date.Date) ([]WeekSummary, error) {
+	weeks := []WeekSummary{}
+	query := `SELECT date_trunc('week', s.performed_date::TIMESTAMP)::DATE AS week_start,
+                     COUNT(DISTINCT s.id) AS sessions,
+                     COUNT(ss.id) AS sets,
+                     COALESCE(SUM(` + volumeKG + `), 0) AS volume_kg
+              FROM workout_sessions s
+              LEFT JOIN workout_session_exercises se ON se.session_id = s.id
+              LEFT JOIN workout_session_sets ss ON ss.session_exercise_id = se.id
+              WHERE s.user_id = $1 AND s.performed_date BETWEEN $2 AND $3
+              GROUP BY week_start
+              ORDER BY week_start`
+	err := r.executor.SelectContext(ctx, &weeks, query, userID, from, to)
+	return weeks, err
+}
@@ -0,0 +1,126 @@
+package session
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Uranury/WorkoutTracker/pkg/date"
+	"github.com/jmoiron/sqlx"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newMockRepository returns a repository on sqlmock and a pointer to the last SQL it ran
+func newMockRepository(t *testing.T) (Repository, sqlmock.Sqlmock, *string) {
+	t.Helper()
+	var executed string
+	matcher := sqlmock.QueryMatcherFunc(func(expected, actual string) error {
+		executed = actual
+		return sqlmock.QueryMatcherRegexp.Match(expected, actual)
+	})
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(matcher))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return NewRepository(sqlx.NewDb(db, "postgres")), mock, &executed
+}
+
+func mustDate(t *testing.T, s string) date.Date {
+	t.Helper()
+	d, err := date.Parse(s)
+	if err != nil {
+		t.Fatalf("date.Parse(%q): %v", s, err)
+	}
+	return d
+}
+
+func TestListWeekSummaries(t *testing.T) {
+	repo, mock, executed := newMockRepository(t)
+	from, to := mustDate(t, "2026-03-02"), mustDate(t, "2026-03-15")
+
+	mock.ExpectQuery(regexp.QuoteMeta("GROUP BY week_start")).
+		WithArgs(int64(7), from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"week_start", "sessions", "sets", "volume_kg"}).
+			AddRow("2026-03-02", 3, 24, 5120.5).
+			AddRow("2026-03-09", 1, 6, 900.0))
+
+	weeks, err := repo.ListWeekSummaries(context.Background(), 7, from, to)
+	if err != nil {
+		t.Fatalf("ListWeekSummaries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(weeks) != 2 {
+		t.Fatalf("got %d weeks, want 2", len(weeks))
+	}
+	if got := weeks[0].WeekStart.String(); got != "2026-03-02" {
+		t.Errorf("WeekStart = %s, want 2026-03-02", got)
+	}
+	if weeks[0].Sessions != 3 || weeks[0].Sets != 24 || weeks[0].VolumeKG != 5120.5 {
+		t.Errorf("unexpected first week %+v", weeks[0])
+	}
+
+	// the query groups by week only, Postgres rejects per-session expressions such as correlated subqueries on s.id
+	if strings.Contains(*executed, "= s.id)") {
+		t.Errorf("weekly summaries must not correlate on a single session:\n%s", *executed)
+	}
+}
+
+func TestListFinishedSummariesIncludesSocialCounts(t *testing.T) {
+	repo, mock, _ := newMockRepository(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("GROUP BY s.id")).
+		WithArgs(int64(7), 10).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "user_id", "name", "performed_date", "started_at", "finished_at",
+			"exercises", "sets", "volume_kg", "reactions", "comments",
+		}).AddRow(1, 7, "Legs", "2026-03-02", nil, nil, 2, 8, 1200.0, 4, 2))
+
+	summaries, err := repo.ListFinishedSummaries(context.Background(), 7, 10)
+	if err != nil {
+		t.Fatalf("ListFinishedSummaries: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].Reactions != 4 || summaries[0].Comments != 2 {
+		t.Errorf("unexpected summaries %+v", summaries)
+	}
+}
+
+func TestCloseStaleSessionsAbandonsWithoutFinishing(t *testing.T) {
+	repo, mock, executed := newMockRepository(t)
+	before := time.Date(2026, 3, 2, 6, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta("SET abandoned_at = NOW() WHERE finished_at IS NULL AND abandoned_at IS NULL AND started_at < $1")).
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	closed, err := repo.CloseStaleSessions(context.Background(), before)
+	if err != nil {
+		t.Fatalf("CloseStaleSessions: %v", err)
+	}
+	if closed != 2 {
+		t.Errorf("closed = %d, want 2", closed)
+	}
+	if strings.Contains(*executed, "finished_at =") {
+		t.Errorf("stale sessions must not get a finish time, ran %s", *executed)
+	}
+}
+
+func TestFinishingClearsAbandoned(t *testing.T) {
+	repo, mock, _ := newMockRepository(t)
+	finishedAt := time.Date(2026, 3, 2, 18, 30, 0, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta("SET finished_at = $1, abandoned_at = NULL WHERE id = $2")).
+		WithArgs(&finishedAt, int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := repo.UpdateSessionFinishTime(context.Background(), 9, &finishedAt); err != nil {
+		t.Fatalf("UpdateSessionFinishTime: %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import "context"
 type Repository interface {
 	CreateTemplate(ctx context.Context, template Template) (int64, error)
 	CreateTemplateExercise(ctx context.Context, template Exercise) (int64, error)
+	GetTemplateByID(ctx context.Context, templateID int64) (Template, error)
 	GetTemplateExercises(ctx context.Context, templateID int64) ([]Exercise, error)
 	GetTemplateMaxOrderIndex(ctx context.Context, templateID int64) (int, error)
 	UpdateTemplate(ctx context.Context, templateID int64, name, description string) (Template, error)
@@ -45,6 +45,13 @@ func (r *repository) GetTemplateExercises(ctx context.Context, templateID int64)
 	return exercises, err
 }
 
+func (r *repository) GetTemplateByID(ctx context.Context, templateID int64) (Template, error) {
+	query := `SELECT id, user_id, name, COALESCE(description, '') AS description, created_at FROM workout_templates WHERE id = $1`
+	var tmpl Template
+	err := r.executor.GetContext(ctx, &tmpl, query, templateID)
+	return tmpl, err
+}
+
 func (r *repository) GetTemplateMaxOrderIndex(ctx context.Context, templateID int64) (int, error) {
 	query := `SELECT COALESCE(MAX(order_index), 0) FROM workout_template_exercises WHERE template_id = $1`
 	var order int
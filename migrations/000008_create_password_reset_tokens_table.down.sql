@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP INDEX IF EXISTS idx_password_reset_tokens_user_id;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS audit_log;
+DROP INDEX IF EXISTS idx_audit_log_target_user_id, idx_audit_log_actor_id;
\ No newline at end of file
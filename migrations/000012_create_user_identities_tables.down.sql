@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS user_identities, oidc_auth_requests;
+
+-- fails while accounts created through external providers without age or gender exist
+ALTER TABLE users
+    ALTER COLUMN age SET NOT NULL,
+    ALTER COLUMN gender SET NOT NULL;
\ No newline at end of file
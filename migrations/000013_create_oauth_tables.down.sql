@@ -0,0 +1 @@
+DROP TABLE IF EXISTS oauth_consents, oauth_refresh_tokens, oauth_authorization_codes, oauth_clients;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS device_alert_tokens;
+DROP TABLE IF EXISTS known_devices;
\ No newline at end of file
@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+
+DROP INDEX IF EXISTS idx_audit_log_request_id;
+DROP INDEX IF EXISTS idx_audit_log_created_at;
+DROP INDEX IF EXISTS idx_audit_log_action;
+
+ALTER TABLE audit_log
+DROP COLUMN IF EXISTS ip,
+DROP COLUMN IF EXISTS request_id,
+DROP COLUMN IF EXISTS changes;
\ No newline at end of file
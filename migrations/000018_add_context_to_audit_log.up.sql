@@ -0,0 +1,31 @@
+ALTER TABLE audit_log
+ADD COLUMN IF NOT EXISTS changes JSONB NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS request_id VARCHAR(64) NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS ip VARCHAR(45) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_audit_log_action ON audit_log (action, created_at DESC);
+CREATE INDEX idx_audit_log_created_at ON audit_log (created_at DESC);
+CREATE INDEX idx_audit_log_request_id ON audit_log (request_id) WHERE request_id <> '';
+
+-- Entries can never be changed or removed. The only allowed update is the ON DELETE SET NULL of a deleted user.
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND NEW.id = OLD.id
+        AND NEW.action = OLD.action
+        AND NEW.details = OLD.details
+        AND NEW.changes = OLD.changes
+        AND NEW.request_id = OLD.request_id
+        AND NEW.ip = OLD.ip
+        AND NEW.created_at = OLD.created_at
+        AND (NEW.actor_id IS NULL OR NEW.actor_id = OLD.actor_id)
+        AND (NEW.target_user_id IS NULL OR NEW.target_user_id = OLD.target_user_id) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
\ No newline at end of file
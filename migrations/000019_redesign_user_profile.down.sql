@@ -0,0 +1,13 @@
+ALTER TABLE users
+DROP CONSTRAINT IF EXISTS users_gender_check,
+ADD COLUMN IF NOT EXISTS age INT CHECK (age >= 13 AND age <= 120);
+
+UPDATE users SET age = LEAST(GREATEST(date_part('year', age(birthdate))::INT, 13), 120) WHERE birthdate IS NOT NULL;
+UPDATE users SET gender = NULL WHERE gender NOT IN ('male', 'female');
+
+ALTER TABLE users
+ADD CONSTRAINT users_gender_check CHECK (gender IN ('male', 'female')),
+DROP COLUMN IF EXISTS time_zone,
+DROP COLUMN IF EXISTS activity_level,
+DROP COLUMN IF EXISTS height_cm,
+DROP COLUMN IF EXISTS birthdate;
\ No newline at end of file
@@ -0,0 +1,16 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS birthdate DATE,
+ADD COLUMN IF NOT EXISTS height_cm DOUBLE PRECISION CHECK (height_cm > 0 AND height_cm < 300),
+ADD COLUMN IF NOT EXISTS activity_level VARCHAR(20) CHECK (activity_level IN ('sedentary', 'light', 'moderate', 'active', 'very_active')),
+ADD COLUMN IF NOT EXISTS time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- age was entered at signup and never changed, so it is counted back from the signup date.
+-- The birthday is unknown, half a year back is the middle of the possible range.
+UPDATE users
+SET birthdate = (COALESCE(created_at, NOW()) - make_interval(years => age) - INTERVAL '6 months')::DATE
+WHERE age IS NOT NULL AND birthdate IS NULL;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS age,
+DROP CONSTRAINT IF EXISTS users_gender_check,
+ADD CONSTRAINT users_gender_check CHECK (gender IN ('female', 'male', 'non_binary', 'other', 'prefer_not_to_say'));
\ No newline at end of file
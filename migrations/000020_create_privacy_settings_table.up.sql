@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS privacy_settings (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    visibility VARCHAR(20) NOT NULL DEFAULT 'private' CHECK (visibility IN ('private', 'followers', 'public')),
+    show_weight BOOLEAN NOT NULL DEFAULT FALSE,
+    show_age BOOLEAN NOT NULL DEFAULT FALSE,
+    show_sessions BOOLEAN NOT NULL DEFAULT TRUE,
+    show_records BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_sessions_user_finished;
+DROP TABLE IF EXISTS personal_records;
+DROP TABLE IF EXISTS follows;
\ No newline at end of file
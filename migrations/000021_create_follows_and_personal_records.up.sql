@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'accepted')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    accepted_at TIMESTAMPTZ,
+
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX idx_follows_followee ON follows(followee_id, status, created_at DESC);
+
+-- personal_records is written when a set beats the heaviest earlier set of the same exercise, feeds read it
+-- instead of recomputing records over all sets
+CREATE TABLE IF NOT EXISTS personal_records (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    exercise_id BIGINT NOT NULL REFERENCES exercises(id) ON DELETE CASCADE,
+    session_id BIGINT NOT NULL REFERENCES workout_sessions(id) ON DELETE CASCADE,
+    set_id BIGINT NOT NULL UNIQUE REFERENCES workout_session_sets(id) ON DELETE CASCADE,
+    weight_kg DOUBLE PRECISION NOT NULL,
+    reps INT NOT NULL,
+    achieved_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_personal_records_user_achieved ON personal_records(user_id, achieved_at DESC, id DESC);
+CREATE INDEX idx_sessions_user_finished ON workout_sessions(user_id, finished_at DESC, id DESC) WHERE finished_at IS NOT NULL;
\ No newline at end of file
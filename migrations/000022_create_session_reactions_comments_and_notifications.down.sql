@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS session_comments;
+DROP TABLE IF EXISTS session_reactions;
\ No newline at end of file
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS session_reactions (
+    session_id BIGINT NOT NULL REFERENCES workout_sessions(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction VARCHAR(20) NOT NULL CHECK (reaction IN ('like', 'fire', 'strong', 'clap')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (session_id, user_id)
+);
+
+-- comments are soft deleted so replies keep their place in the thread
+CREATE TABLE IF NOT EXISTS session_comments (
+    id BIGSERIAL PRIMARY KEY,
+    session_id BIGINT NOT NULL REFERENCES workout_sessions(id) ON DELETE CASCADE,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    parent_id BIGINT REFERENCES session_comments(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    edited_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+
+    CHECK (deleted_at IS NOT NULL OR char_length(body) BETWEEN 1 AND 2000)
+);
+
+CREATE INDEX idx_session_comments_session ON session_comments(session_id, created_at, id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(30) NOT NULL CHECK (type IN ('session_reaction', 'session_comment', 'comment_reply')),
+    session_id BIGINT REFERENCES workout_sessions(id) ON DELETE CASCADE,
+    comment_id BIGINT REFERENCES session_comments(id) ON DELETE CASCADE,
+    read_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_notifications_user ON notifications(user_id, created_at DESC, id DESC);
+CREATE INDEX idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS challenges (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    metric VARCHAR(20) NOT NULL CHECK (metric IN ('total_volume', 'session_count', 'relative_lift')),
+    exercise_id BIGINT REFERENCES exercises(id) ON DELETE RESTRICT,
+    -- local days of the participants, like workout_sessions.performed_date
+    starts_on DATE NOT NULL,
+    ends_on DATE NOT NULL,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CHECK (starts_on <= ends_on),
+    CHECK (metric <> 'relative_lift' OR exercise_id IS NOT NULL),
+    CHECK (metric <> 'session_count' OR exercise_id IS NULL)
+);
+
+CREATE INDEX idx_challenges_window ON challenges(ends_on, starts_on);
+
+-- score is maintained by the application whenever the participant's training in the window changes
+CREATE TABLE IF NOT EXISTS challenge_participants (
+    challenge_id BIGINT NOT NULL REFERENCES challenges(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    scored_at TIMESTAMPTZ,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (challenge_id, user_id)
+);
+
+CREATE INDEX idx_challenge_participants_user ON challenge_participants(user_id);
+CREATE INDEX idx_challenge_participants_rank ON challenge_participants(challenge_id, score DESC, scored_at);
\ No newline at end of file
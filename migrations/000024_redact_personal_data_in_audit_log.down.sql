@@ -0,0 +1 @@
+-- redacted values are gone, there is nothing to restore
\ No newline at end of file
@@ -0,0 +1,19 @@
+-- Profile updates used to keep old and new personal data, only the names of the changed fields are kept now.
+-- audit_log is append-only, the trigger is lifted for this one rewrite.
+ALTER TABLE audit_log DISABLE TRIGGER audit_log_append_only;
+
+UPDATE audit_log
+SET changes = (
+    SELECT jsonb_object_agg(
+        key,
+        CASE WHEN key IN ('username', 'email', 'birthdate', 'gender', 'weight', 'height_cm', 'time_zone')
+            THEN '{"from": null, "to": null, "redacted": true}'::JSONB
+            ELSE value
+        END
+    )
+    FROM jsonb_each(changes)
+)
+WHERE action = 'user.profile_updated'
+  AND changes ?| ARRAY['username', 'email', 'birthdate', 'gender', 'weight', 'height_cm', 'time_zone'];
+
+ALTER TABLE audit_log ENABLE TRIGGER audit_log_append_only;
\ No newline at end of file
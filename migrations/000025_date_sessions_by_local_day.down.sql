@@ -0,0 +1 @@
+-- local days cannot be told apart from dates picked by users, the redated sessions are kept
\ No newline at end of file
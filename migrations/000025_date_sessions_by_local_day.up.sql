@@ -0,0 +1,9 @@
+-- Sessions used to be dated by the UTC day they were created on. Redate the ones that still carry that day
+-- to the local day of their owner, dates the owner picked differ from it and are kept.
+UPDATE workout_sessions s
+SET performed_date = (COALESCE(s.started_at, s.created_at) AT TIME ZONE u.time_zone)::DATE
+FROM users u
+WHERE u.id = s.user_id
+  AND u.time_zone <> 'UTC'
+  AND u.time_zone IN (SELECT name FROM pg_timezone_names)
+  AND s.performed_date = (s.created_at AT TIME ZONE 'UTC')::DATE;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- one row per background job, claimed by whichever replica runs the job next
+CREATE TABLE IF NOT EXISTS scheduled_job_runs (
+    name VARCHAR(100) PRIMARY KEY,
+    last_run_at TIMESTAMPTZ NOT NULL
+);
\ No newline at end of file
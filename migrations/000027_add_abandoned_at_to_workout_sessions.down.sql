@@ -0,0 +1 @@
+ALTER TABLE workout_sessions DROP COLUMN IF EXISTS abandoned_at;
\ No newline at end of file
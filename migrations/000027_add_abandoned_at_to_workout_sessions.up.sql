@@ -0,0 +1,3 @@
+-- set by the stale session job instead of a finish time, so abandoned sessions stay out of durations,
+-- the feed, profile stats and challenge scores. Finishing the session clears it.
+ALTER TABLE workout_sessions ADD COLUMN IF NOT EXISTS abandoned_at TIMESTAMPTZ;
\ No newline at end of file
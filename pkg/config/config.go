@@ -1,17 +1,34 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
+	"time"
 )
 
 type Config struct {
 	DBConfig
-	RedisAddr      string `yaml:"redis_addr" env:"REDIS_ADDR" env-default:":6379"`
+	JobsConfig
+	RateLimitConfig
+	BruteForceConfig
+	OIDCConfig
+	PasswordHashConfig
+	PasswordPolicyConfig
+	CookieConfig
+	DataExportConfig
+	RedisAddr      string `yaml:"redis_addr" env:"REDIS_ADDR" env-default:""`
 	MigrationsPath string `yaml:"migrations_path" env:"MIGRATIONS_PATH" env-required:"true"`
 	ListenAddr     string `yaml:"listen_addr" env:"LISTEN_ADDR" env-default:":8080"`
-	JWTKey         string `yaml:"jwt_key" env:"JWT_KEY" env-required:"true"`
-	ResendAPIKey   string `yaml:"resend_api_key" env:"RESEND_API_KEY" env-default:""`
+	JWTConfig
+	TOTPIssuer string `yaml:"totp_issuer" env:"TOTP_ISSUER" env-default:"WorkoutTracker"`
+	// NewDeviceAlerts emails users when their account is signed in to from a device not seen before
+	NewDeviceAlerts bool   `yaml:"new_device_alerts" env:"NEW_DEVICE_ALERTS" env-default:"true"`
+	ResendAPIKey    string `yaml:"resend_api_key" env:"RESEND_API_KEY" env-default:""`
+	EmailFrom       string `yaml:"email_from" env:"EMAIL_FROM" env-default:"WorkoutTracker <noreply@workouttracker.app>"`
+	AppBaseURL      string `yaml:"app_base_url" env:"APP_BASE_URL" env-default:"http://localhost:5173"`
+	// OAuthAuthorizeURL is the consent screen of the app that third-party clients send users to
+	OAuthAuthorizeURL string `yaml:"oauth_authorize_url" env:"OAUTH_AUTHORIZE_URL" env-default:"http://localhost:5173/oauth/authorize"`
 }
 
 type DBConfig struct {
@@ -24,6 +41,120 @@ type DBConfig struct {
 	Password string `yaml:"password" env:"DB_PASSWORD" env-required:"true"`
 }
 
+// JWTConfig selects how access tokens are signed. JWTKey is the legacy HS256 secret: it signs tokens
+// only when no signing key file is set, otherwise it is kept for verifying tokens issued before the switch.
+type JWTConfig struct {
+	JWTKey                  string   `yaml:"jwt_key" env:"JWT_KEY" env-default:""`
+	JWTSigningKeyFile       string   `yaml:"jwt_signing_key_file" env:"JWT_SIGNING_KEY_FILE" env-default:""`
+	JWTVerificationKeyFiles []string `yaml:"jwt_verification_key_files" env:"JWT_VERIFICATION_KEY_FILES" env-separator:"," env-default:""`
+	JWTIssuer               string   `yaml:"jwt_issuer" env:"JWT_ISSUER" env-default:"workout-tracker"`
+	// RevocationFailOpen accepts access tokens when the revocation store is unreachable instead of responding 503
+	RevocationFailOpen bool `yaml:"revocation_fail_open" env:"REVOCATION_FAIL_OPEN" env-default:"false"`
+}
+
+// OIDCConfig lists external identity providers. OIDC_PROVIDERS is a JSON array, e.g.
+// [{"name":"google","issuer":"https://accounts.google.com","client_id":"...","client_secret":"..."}].
+// Each provider must allow {API_BASE_URL}/auth/oidc/{name}/callback as a redirect URI.
+type OIDCConfig struct {
+	OIDCProviders   OIDCProviders `yaml:"oidc_providers" env:"OIDC_PROVIDERS" env-default:"[]"`
+	APIBaseURL      string        `yaml:"api_base_url" env:"API_BASE_URL" env-default:"http://localhost:8080"`
+	OIDCCompleteURL string        `yaml:"oidc_complete_url" env:"OIDC_COMPLETE_URL" env-default:"http://localhost:5173/oidc/callback"`
+}
+
+type OIDCProvider struct {
+	Name         string   `yaml:"name" json:"name"`
+	Issuer       string   `yaml:"issuer" json:"issuer"`
+	ClientID     string   `yaml:"client_id" json:"client_id"`
+	ClientSecret string   `yaml:"client_secret" json:"client_secret"`
+	Scopes       []string `yaml:"scopes" json:"scopes"`
+}
+
+type OIDCProviders []OIDCProvider
+
+// SetValue parses OIDC_PROVIDERS from JSON
+func (p *OIDCProviders) SetValue(s string) error {
+	if err := json.Unmarshal([]byte(s), p); err != nil {
+		return fmt.Errorf("invalid OIDC_PROVIDERS: %w", err)
+	}
+	return nil
+}
+
+// CookieConfig controls the attributes of cookies set by the API and which browser origins may call it.
+// Secure cookies still work on http://localhost, so only turn COOKIE_SECURE off for other plain HTTP hosts.
+type CookieConfig struct {
+	CookieSecure       bool     `yaml:"cookie_secure" env:"COOKIE_SECURE" env-default:"true"`
+	CookieDomain       string   `yaml:"cookie_domain" env:"COOKIE_DOMAIN" env-default:""`
+	CookieSameSite     string   `yaml:"cookie_samesite" env:"COOKIE_SAMESITE" env-default:"strict"`
+	RefreshCookiePath  string   `yaml:"refresh_cookie_path" env:"REFRESH_COOKIE_PATH" env-default:"/"`
+	CSRFEnabled        bool     `yaml:"csrf_enabled" env:"CSRF_ENABLED" env-default:"true"`
+	CORSAllowedOrigins []string `yaml:"cors_allowed_origins" env:"CORS_ALLOWED_ORIGINS" env-separator:"," env-default:"http://localhost:5173"`
+}
+
+// DataExportConfig controls personal data exports. DataExportSigningSecret signs download links, without it
+// links only work on the replica that built the archive and until it restarts.
+type DataExportConfig struct {
+	DataExportSigningSecret string        `yaml:"data_export_signing_secret" env:"DATA_EXPORT_SIGNING_SECRET" env-default:""`
+	DataExportTTL           time.Duration `yaml:"data_export_ttl" env:"DATA_EXPORT_TTL" env-default:"168h"`
+}
+
+// PasswordHashConfig selects how new passwords are hashed. Existing hashes of the other algorithm or
+// with older parameters keep working and are upgraded on the next successful login.
+// bcrypt only hashes the first 72 bytes, so selecting it also caps new passwords at 72 bytes.
+type PasswordHashConfig struct {
+	PasswordHashAlgorithm string `yaml:"password_hash_algorithm" env:"PASSWORD_HASH_ALGORITHM" env-default:"argon2id"`
+	Argon2Memory          uint32 `yaml:"argon2_memory" env:"ARGON2_MEMORY" env-default:"65536"`
+	Argon2Iterations      uint32 `yaml:"argon2_iterations" env:"ARGON2_ITERATIONS" env-default:"3"`
+	Argon2Parallelism     uint8  `yaml:"argon2_parallelism" env:"ARGON2_PARALLELISM" env-default:"4"`
+	BcryptCost            int    `yaml:"bcrypt_cost" env:"BCRYPT_COST" env-default:"12"`
+}
+
+// PasswordPolicyConfig applies to passwords chosen at signup, reset and change. BreachedPasswordsPath points
+// at a SHA-1 list in the Have I Been Pwned format, either one file sorted by hash or a directory of range files.
+type PasswordPolicyConfig struct {
+	PasswordMinLength           int    `yaml:"password_min_length" env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+	PasswordMaxLength           int    `yaml:"password_max_length" env:"PASSWORD_MAX_LENGTH" env-default:"128"`
+	PasswordMinCharacterClasses int    `yaml:"password_min_character_classes" env:"PASSWORD_MIN_CHARACTER_CLASSES" env-default:"2"`
+	PasswordDisallowPersonal    bool   `yaml:"password_disallow_personal" env:"PASSWORD_DISALLOW_PERSONAL" env-default:"true"`
+	BreachedPasswordsPath       string `yaml:"breached_passwords_path" env:"BREACHED_PASSWORDS_PATH"`
+}
+
+type JobsConfig struct {
+	JobsEnabled             bool          `yaml:"jobs_enabled" env:"JOBS_ENABLED" env-default:"true"`
+	JobsJitter              time.Duration `yaml:"jobs_jitter" env:"JOBS_JITTER" env-default:"30s"`
+	TokenPurgeInterval      time.Duration `yaml:"token_purge_interval" env:"TOKEN_PURGE_INTERVAL" env-default:"1h"`
+	RevokedTokenRetention   time.Duration `yaml:"revoked_token_retention" env:"REVOKED_TOKEN_RETENTION" env-default:"168h"`
+	StaleSessionInterval    time.Duration `yaml:"stale_session_interval" env:"STALE_SESSION_INTERVAL" env-default:"15m"`
+	StaleSessionAfter       time.Duration `yaml:"stale_session_after" env:"STALE_SESSION_AFTER" env-default:"6h"`
+	SecurityEventInterval   time.Duration `yaml:"security_event_interval" env:"SECURITY_EVENT_INTERVAL" env-default:"24h"`
+	SecurityEventRetention  time.Duration `yaml:"security_event_retention" env:"SECURITY_EVENT_RETENTION" env-default:"2160h"`
+	DataExportInterval      time.Duration `yaml:"data_export_interval" env:"DATA_EXPORT_INTERVAL" env-default:"1m"`
+	AccountDeletionInterval time.Duration `yaml:"account_deletion_interval" env:"ACCOUNT_DELETION_INTERVAL" env-default:"1h"`
+	// ChallengeScoreInterval reconciles challenge scores with changes that are not scored right away
+	ChallengeScoreInterval time.Duration `yaml:"challenge_score_interval" env:"CHALLENGE_SCORE_INTERVAL" env-default:"1h"`
+}
+
+type RateLimitConfig struct {
+	RateLimitWindow  time.Duration `yaml:"rate_limit_window" env:"RATE_LIMIT_WINDOW" env-default:"1m"`
+	LoginRateLimit   int           `yaml:"login_rate_limit" env:"LOGIN_RATE_LIMIT" env-default:"10"`
+	SignupRateLimit  int           `yaml:"signup_rate_limit" env:"SIGNUP_RATE_LIMIT" env-default:"5"`
+	RefreshRateLimit int           `yaml:"refresh_rate_limit" env:"REFRESH_RATE_LIMIT" env-default:"30"`
+	APIRateLimit     int           `yaml:"api_rate_limit" env:"API_RATE_LIMIT" env-default:"300"`
+}
+
+type BruteForceConfig struct {
+	LoginMaxAttempts       int           `yaml:"login_max_attempts" env:"LOGIN_MAX_ATTEMPTS" env-default:"5"`
+	LoginBaseLockout       time.Duration `yaml:"login_base_lockout" env:"LOGIN_BASE_LOCKOUT" env-default:"1m"`
+	LoginMaxLockout        time.Duration `yaml:"login_max_lockout" env:"LOGIN_MAX_LOCKOUT" env-default:"24h"`
+	LoginIPMaxFailures     int           `yaml:"login_ip_max_failures" env:"LOGIN_IP_MAX_FAILURES" env-default:"50"`
+	LoginIPUserMaxFailures int           `yaml:"login_ip_user_max_failures" env:"LOGIN_IP_USER_MAX_FAILURES" env-default:"10"`
+	LoginFailureWindow     time.Duration `yaml:"login_failure_window" env:"LOGIN_FAILURE_WINDOW" env-default:"15m"`
+	LoginChallengeEnabled  bool          `yaml:"login_challenge_enabled" env:"LOGIN_CHALLENGE_ENABLED" env-default:"false"`
+	LoginChallengeBits     int           `yaml:"login_challenge_bits" env:"LOGIN_CHALLENGE_BITS" env-default:"20"`
+	LoginChallengeTTL      time.Duration `yaml:"login_challenge_ttl" env:"LOGIN_CHALLENGE_TTL" env-default:"2m"`
+	LoginChallengeSecret   string        `yaml:"login_challenge_secret" env:"LOGIN_CHALLENGE_SECRET" env-default:""`
+	LoginLockoutNotify     bool          `yaml:"login_lockout_notify" env:"LOGIN_LOCKOUT_NOTIFY" env-default:"true"`
+}
+
 func (cfg DBConfig) DSN() string {
 	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Name, cfg.SSLMode)
 }
@@ -33,5 +164,35 @@ func Load() (*Config, error) {
 	if err := cleanenv.ReadEnv(&cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.JobsConfig.validate(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
+
+// validate rejects schedules that would run a job in a tight loop
+func (cfg JobsConfig) validate() error {
+	if !cfg.JobsEnabled {
+		return nil
+	}
+	if cfg.JobsJitter < 0 {
+		return fmt.Errorf("JOBS_JITTER must not be negative, got %s", cfg.JobsJitter)
+	}
+	intervals := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"TOKEN_PURGE_INTERVAL", cfg.TokenPurgeInterval},
+		{"STALE_SESSION_INTERVAL", cfg.StaleSessionInterval},
+		{"SECURITY_EVENT_INTERVAL", cfg.SecurityEventInterval},
+		{"DATA_EXPORT_INTERVAL", cfg.DataExportInterval},
+		{"ACCOUNT_DELETION_INTERVAL", cfg.AccountDeletionInterval},
+		{"CHALLENGE_SCORE_INTERVAL", cfg.ChallengeScoreInterval},
+	}
+	for _, interval := range intervals {
+		if interval.value <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", interval.name, interval.value)
+		}
+	}
+	return nil
+}
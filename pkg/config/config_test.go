@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func validJobsConfig() JobsConfig {
+	return JobsConfig{
+		JobsEnabled:             true,
+		JobsJitter:              30 * time.Second,
+		TokenPurgeInterval:      time.Hour,
+		StaleSessionInterval:    15 * time.Minute,
+		SecurityEventInterval:   24 * time.Hour,
+		DataExportInterval:      time.Minute,
+		AccountDeletionInterval: time.Hour,
+		ChallengeScoreInterval:  time.Hour,
+	}
+}
+
+func TestJobsConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*JobsConfig)
+		wantErr bool
+	}{
+		{"defaults", func(*JobsConfig) {}, false},
+		{"no jitter", func(c *JobsConfig) { c.JobsJitter = 0 }, false},
+		{"negative jitter", func(c *JobsConfig) { c.JobsJitter = -time.Second }, true},
+		{"zero interval", func(c *JobsConfig) { c.DataExportInterval = 0 }, true},
+		{"negative interval", func(c *JobsConfig) { c.StaleSessionInterval = -time.Minute }, true},
+		{"jobs disabled", func(c *JobsConfig) { c.JobsEnabled = false; c.TokenPurgeInterval = 0 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validJobsConfig()
+			tt.modify(&cfg)
+			if err := cfg.validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Package cookie issues every cookie the API sets, so the Secure, Domain and SameSite attributes come
+// from one place and can follow the deployment instead of being hardcoded per handler.
+package cookie
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	RefreshToken = "refresh_token"
+	// CSRFToken is readable by scripts so the app can echo it in CSRFHeader (double-submit)
+	CSRFToken  = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+type Settings struct {
+	Secure   bool
+	Domain   string
+	SameSite http.SameSite
+	// RefreshPath limits where browsers send the refresh token, it must cover /auth/refresh and /auth/logout
+	RefreshPath string
+}
+
+// ParseSameSite accepts lax, strict or none. None is only allowed for secure cookies, browsers reject it otherwise.
+func ParseSameSite(value string, secure bool) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		if !secure {
+			return 0, fmt.Errorf("SameSite=None cookies must be Secure")
+		}
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown SameSite mode %q, expected lax, strict or none", value)
+	}
+}
+
+type Options struct {
+	Path string
+	// MaxAge of zero makes a session cookie
+	MaxAge time.Duration
+	// Readable leaves out HttpOnly so scripts can read the cookie
+	Readable bool
+	// SameSite overrides the configured mode, e.g. Lax for cookies that must survive a cross-site redirect
+	SameSite http.SameSite
+}
+
+type Jar struct {
+	settings Settings
+}
+
+func NewJar(settings Settings) *Jar {
+	if settings.RefreshPath == "" {
+		settings.RefreshPath = "/"
+	}
+	return &Jar{settings: settings}
+}
+
+func (j *Jar) Set(w http.ResponseWriter, name, value string, opts Options) {
+	sameSite := j.settings.SameSite
+	if opts.SameSite != 0 {
+		sameSite = opts.SameSite
+	}
+	path := opts.Path
+	if path == "" {
+		path = "/"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   j.settings.Domain,
+		MaxAge:   int(opts.MaxAge.Seconds()),
+		HttpOnly: !opts.Readable,
+		Secure:   j.settings.Secure,
+		SameSite: sameSite,
+	})
+}
+
+// Delete expires a cookie, opts must carry the path it was set with
+func (j *Jar) Delete(w http.ResponseWriter, name string, opts Options) {
+	opts.MaxAge = -time.Second
+	j.Set(w, name, "", opts)
+}
+
+// SetSession stores the refresh token together with a new CSRF token, which is also sent in the CSRFHeader
+// response header for apps on another domain that cannot read the cookie.
+func (j *Jar) SetSession(w http.ResponseWriter, refreshToken string, ttl time.Duration) error {
+	j.Set(w, RefreshToken, refreshToken, Options{Path: j.settings.RefreshPath, MaxAge: ttl})
+	_, err := j.SetCSRF(w, ttl)
+	return err
+}
+
+func (j *Jar) ClearSession(w http.ResponseWriter) {
+	j.Delete(w, RefreshToken, Options{Path: j.settings.RefreshPath})
+	j.Delete(w, CSRFToken, Options{Readable: true})
+}
+
+// SetCSRF issues a new CSRF token for the double-submit check and returns it
+func (j *Jar) SetCSRF(w http.ResponseWriter, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate csrf token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	j.Set(w, CSRFToken, token, Options{MaxAge: ttl, Readable: true})
+	w.Header().Set(CSRFHeader, token)
+	return token, nil
+}
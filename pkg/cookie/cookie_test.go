@@ -0,0 +1,117 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func cookiesByName(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := make(map[string]*http.Cookie)
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	return cookies
+}
+
+func TestParseSameSite(t *testing.T) {
+	tests := []struct {
+		value   string
+		secure  bool
+		want    http.SameSite
+		wantErr bool
+	}{
+		{"lax", false, http.SameSiteLaxMode, false},
+		{"Strict", false, http.SameSiteStrictMode, false},
+		{"none", true, http.SameSiteNoneMode, false},
+		{"none", false, 0, true},
+		{"sometimes", true, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSameSite(tt.value, tt.secure)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSameSite(%q, %v) = %v, %v, want %v, error %v", tt.value, tt.secure, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSetAppliesSettings(t *testing.T) {
+	jar := NewJar(Settings{Secure: true, Domain: "example.com", SameSite: http.SameSiteStrictMode})
+	w := httptest.NewRecorder()
+
+	jar.Set(w, "plain", "a", Options{})
+	jar.Set(w, "scoped", "b", Options{Path: "/auth", MaxAge: time.Hour, Readable: true, SameSite: http.SameSiteLaxMode})
+	cookies := cookiesByName(w)
+
+	plain := cookies["plain"]
+	if plain.Path != "/" || plain.Domain != "example.com" || !plain.Secure || !plain.HttpOnly || plain.SameSite != http.SameSiteStrictMode || plain.MaxAge != 0 {
+		t.Fatalf("plain cookie = %+v, want a secure HttpOnly session cookie following the settings", plain)
+	}
+	scoped := cookies["scoped"]
+	if scoped.Path != "/auth" || scoped.MaxAge != 3600 || scoped.HttpOnly || scoped.SameSite != http.SameSiteLaxMode || !scoped.Secure {
+		t.Fatalf("scoped cookie = %+v, want the options to override path, max age, HttpOnly and SameSite", scoped)
+	}
+}
+
+func TestDeleteExpiresCookie(t *testing.T) {
+	jar := NewJar(Settings{})
+	w := httptest.NewRecorder()
+
+	jar.Delete(w, "gone", Options{Path: "/auth"})
+	gone := cookiesByName(w)["gone"]
+	if gone == nil || gone.MaxAge >= 0 || gone.Value != "" || gone.Path != "/auth" {
+		t.Fatalf("deleted cookie = %+v, want an expired empty cookie on the same path", gone)
+	}
+}
+
+func TestSetSessionIssuesCSRFToken(t *testing.T) {
+	jar := NewJar(Settings{Secure: true, RefreshPath: "/auth"})
+	w := httptest.NewRecorder()
+
+	if err := jar.SetSession(w, "refresh", time.Hour); err != nil {
+		t.Fatalf("SetSession: %v", err)
+	}
+	cookies := cookiesByName(w)
+
+	refresh := cookies[RefreshToken]
+	if refresh == nil || refresh.Value != "refresh" || refresh.Path != "/auth" || !refresh.HttpOnly || refresh.MaxAge != 3600 {
+		t.Fatalf("refresh cookie = %+v, want an HttpOnly cookie limited to the refresh path", refresh)
+	}
+	csrf := cookies[CSRFToken]
+	if csrf == nil || csrf.Value == "" || csrf.HttpOnly || csrf.Path != "/" {
+		t.Fatalf("csrf cookie = %+v, want a cookie scripts can read", csrf)
+	}
+	if header := w.Header().Get(CSRFHeader); header != csrf.Value {
+		t.Fatalf("%s header = %q, want the cookie value %q", CSRFHeader, header, csrf.Value)
+	}
+}
+
+func TestSetCSRFIssuesNewTokens(t *testing.T) {
+	jar := NewJar(Settings{})
+	first, err := jar.SetCSRF(httptest.NewRecorder(), time.Hour)
+	if err != nil {
+		t.Fatalf("SetCSRF: %v", err)
+	}
+	second, err := jar.SetCSRF(httptest.NewRecorder(), time.Hour)
+	if err != nil {
+		t.Fatalf("SetCSRF: %v", err)
+	}
+	if len(first) < 43 || first == second {
+		t.Fatalf("tokens %q and %q, want distinct tokens of 32 random bytes", first, second)
+	}
+}
+
+func TestClearSession(t *testing.T) {
+	jar := NewJar(Settings{RefreshPath: "/auth"})
+	w := httptest.NewRecorder()
+
+	jar.ClearSession(w)
+	cookies := cookiesByName(w)
+	if refresh := cookies[RefreshToken]; refresh == nil || refresh.MaxAge >= 0 || refresh.Path != "/auth" {
+		t.Fatalf("refresh cookie = %+v, want it expired on the refresh path", refresh)
+	}
+	if csrf := cookies[CSRFToken]; csrf == nil || csrf.MaxAge >= 0 {
+		t.Fatalf("csrf cookie = %+v, want it expired", csrf)
+	}
+}
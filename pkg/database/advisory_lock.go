@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// AdvisoryLocker keeps a job from running on two replicas at the same time using Postgres session-level
+// advisory locks. The lock is held on a dedicated connection, so it is released automatically if the replica dies.
+type AdvisoryLocker struct {
+	db        *sqlx.DB
+	namespace string
+}
+
+func NewAdvisoryLocker(db *sqlx.DB, namespace string) *AdvisoryLocker {
+	return &AdvisoryLocker{db: db, namespace: namespace}
+}
+
+func (l *AdvisoryLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := l.db.Connx(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := l.namespace + ":" + name
+	var acquired bool
+	if err := conn.QueryRowxContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", key).Scan(&acquired); err != nil {
+		_ = conn.Close()
+		return nil, false, err
+	}
+	if !acquired {
+		_ = conn.Close()
+		return nil, false, nil
+	}
+
+	release := func() {
+		// the job context may already be cancelled on shutdown, unlock regardless
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, _ = conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock(hashtext($1))", key)
+		_ = conn.Close()
+	}
+	return release, true, nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// JobRunLog records when each background job last ran in the scheduled_job_runs table. Claims use the
+// database clock, so replicas with skewed clocks still agree on whether a job is due.
+type JobRunLog struct {
+	db *sqlx.DB
+}
+
+func NewJobRunLog(db *sqlx.DB) *JobRunLog {
+	return &JobRunLog{db: db}
+}
+
+// Claim records a run of the job unless one was recorded less than interval ago. The upsert is atomic,
+// of several replicas claiming the same run only one succeeds.
+func (l *JobRunLog) Claim(ctx context.Context, name string, interval time.Duration) (bool, error) {
+	query := `
+		INSERT INTO scheduled_job_runs (name, last_run_at) VALUES ($1, NOW())
+		ON CONFLICT (name) DO UPDATE SET last_run_at = NOW()
+		WHERE scheduled_job_runs.last_run_at <= NOW() - make_interval(secs => $2)
+		RETURNING name
+	`
+	var claimed string
+	err := l.db.QueryRowxContext(ctx, query, name, interval.Seconds()).Scan(&claimed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"testing"
+	"time"
+)
+
+func TestJobRunLogClaim(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	runs := NewJobRunLog(sqlx.NewDb(db, "postgres"))
+
+	claim := `INSERT INTO scheduled_job_runs .* ON CONFLICT \(name\) DO UPDATE SET last_run_at = NOW\(\) WHERE scheduled_job_runs.last_run_at <= NOW\(\) - make_interval\(secs => \$2\)`
+	mock.ExpectQuery(claim).WithArgs("purge", float64(3600)).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("purge"))
+	mock.ExpectQuery(claim).WithArgs("purge", float64(3600)).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	claimed, err := runs.Claim(context.Background(), "purge", time.Hour)
+	if err != nil || !claimed {
+		t.Fatalf("first claim = %v, %v, want true", claimed, err)
+	}
+	claimed, err = runs.Claim(context.Background(), "purge", time.Hour)
+	if err != nil || claimed {
+		t.Fatalf("claim within the interval = %v, %v, want false", claimed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,69 @@
+package date
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestNewKeepsTheLocalDay(t *testing.T) {
+	instant := time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC)
+	for zone, want := range map[string]string{
+		"UTC":              "2026-03-01",
+		"Asia/Tokyo":       "2026-03-02",
+		"America/New_York": "2026-03-01",
+		"Pacific/Auckland": "2026-03-02",
+	} {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			t.Fatalf("LoadLocation(%s): %v", zone, err)
+		}
+		if got := New(instant.In(loc)); got.String() != want {
+			t.Errorf("New in %s = %s, want %s", zone, got, want)
+		}
+		if got := New(instant.In(loc)); got.Location() != time.UTC || got.Hour() != 0 {
+			t.Errorf("New in %s kept a time of day or zone: %v", zone, got.Time)
+		}
+	}
+}
+
+func TestDayArithmetic(t *testing.T) {
+	// 2026-03-08 is the start of daylight saving time in the US, dates must not notice
+	d, _ := Parse("2026-03-07")
+	if got := d.AddDays(2).String(); got != "2026-03-09" {
+		t.Errorf("AddDays(2) = %s, want 2026-03-09", got)
+	}
+	if got := d.AddDays(-7).String(); got != "2026-02-28" {
+		t.Errorf("AddDays(-7) = %s, want 2026-02-28", got)
+	}
+	end, _ := Parse("2026-04-01")
+	if got := d.DaysUntil(end); got != 25 {
+		t.Errorf("DaysUntil = %d, want 25", got)
+	}
+	if got := end.DaysUntil(d); got != -25 {
+		t.Errorf("DaysUntil backwards = %d, want -25", got)
+	}
+}
+
+func TestRoundTrips(t *testing.T) {
+	d, _ := Parse("2026-03-01")
+
+	b, err := json.Marshal(d)
+	if err != nil || string(b) != `"2026-03-01"` {
+		t.Fatalf("MarshalJSON = %s, %v", b, err)
+	}
+	var fromJSON Date
+	if err := json.Unmarshal(b, &fromJSON); err != nil || !fromJSON.Equal(d.Time) {
+		t.Fatalf("UnmarshalJSON = %v, %v", fromJSON, err)
+	}
+
+	// lib/pq scans DATE columns as midnight UTC timestamps
+	var scanned Date
+	if err := scanned.Scan(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)); err != nil || scanned.String() != "2026-03-01" {
+		t.Fatalf("Scan = %v, %v", scanned, err)
+	}
+	if v, err := d.Value(); err != nil || v != "2026-03-01" {
+		t.Fatalf("Value = %v, %v", v, err)
+	}
+}
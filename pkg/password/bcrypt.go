@@ -0,0 +1,50 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// BcryptMaxBytes is the longest password bcrypt hashes, it ignores everything past it
+const BcryptMaxBytes = 72
+
+type BcryptParams struct {
+	Cost int
+}
+
+func (p BcryptParams) validate() error {
+	if p.Cost < bcrypt.MinCost || p.Cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return nil
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func hashBcrypt(password string, p BcryptParams) (string, error) {
+	if len(password) > BcryptMaxBytes {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), p.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func verifyBcrypt(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func bcryptNeedsRehash(encoded string, want BcryptParams) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != want.Cost
+}
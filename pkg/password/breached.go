@@ -0,0 +1,243 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sha1HexLength   = 40
+	rangePrefixSize = 5
+	// probeSize is enough to reach past the end of the line a probe lands in and read the next hash
+	probeSize = 256
+)
+
+// BreachedList is an offline set of known leaked passwords, stored as SHA-1 hashes in the format of the
+// Have I Been Pwned range API, so the plain passwords never have to be kept anywhere. The list stays on
+// disk and is searched on every lookup, the full corpus is far too large to hold in memory.
+type BreachedList struct {
+	path string
+	// file is set for a single sorted list, otherwise path is a directory of range files
+	file *os.File
+	size int64
+	// rangeExt is the extension shared by the range files, usually ".txt"
+	rangeExt string
+}
+
+// LoadBreachedList opens a breached password list at path. A file holds one "<SHA-1>:<count>" line per
+// password sorted by hash, as produced by the HIBP downloader, and is binary searched. A directory holds
+// range files named by their 5 character hash prefix, each listing "<suffix>:<count>" lines exactly as
+// the range API returns them, and only the file for the password's prefix is read.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	if info.IsDir() {
+		return loadRangeDir(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	list := &BreachedList{path: path, file: f, size: info.Size()}
+	if err := list.checkSorted(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return list, nil
+}
+
+// loadRangeDir only looks for the first range file, a full download has a million of them
+func loadRangeDir(path string) (*BreachedList, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer dir.Close()
+
+	for {
+		entries, err := dir.ReadDir(100)
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if !entry.IsDir() && isRangePrefix(strings.TrimSuffix(entry.Name(), ext)) {
+				return &BreachedList{path: path, rangeExt: ext}, nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: no range files found in breached password list", path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read breached password list: %w", err)
+		}
+	}
+}
+
+// checkSorted catches lists that can't be binary searched by comparing the first and last hash. It can't
+// prove the whole file is sorted without reading all of it, but it does catch unsorted or empty downloads.
+func (l *BreachedList) checkSorted() error {
+	first, ok, err := l.hashAt(0)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("breached password list is empty")
+	}
+	last, ok, err := l.hashAt(l.size - probeSize)
+	if err != nil || !ok {
+		return err
+	}
+	for {
+		next, ok, err := l.hashAt(last.start + 1)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		last = next
+	}
+	if bytes.Compare(first.sum[:], last.sum[:]) > 0 {
+		return errors.New("breached password list must be sorted by hash")
+	}
+	return nil
+}
+
+// Close releases the list file. Contains must not be called afterwards.
+func (l *BreachedList) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Contains reports whether password is on the list. Errors come from reading the list and mean the
+// password could not be checked.
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	if l.file == nil {
+		return l.rangeContains(sum)
+	}
+
+	// find the first line whose hash is not below sum, every probe lands on the next full line
+	lo, hi := int64(0), l.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, ok, err := l.hashAt(mid)
+		if err != nil {
+			return false, fmt.Errorf("failed to search breached password list: %w", err)
+		}
+		if !ok || bytes.Compare(line.sum[:], sum[:]) >= 0 {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	line, ok, err := l.hashAt(lo)
+	if err != nil {
+		return false, fmt.Errorf("failed to search breached password list: %w", err)
+	}
+	return ok && line.sum == sum, nil
+}
+
+// Path is where the list was loaded from
+func (l *BreachedList) Path() string {
+	return l.path
+}
+
+type listedHash struct {
+	sum [sha1.Size]byte
+	// start is the offset of the line holding the hash
+	start int64
+}
+
+// hashAt returns the hash of the first line starting at or after offset. A line starts at the beginning
+// of the file or right after a newline. ok is false when no line starts at or after offset.
+func (l *BreachedList) hashAt(offset int64) (listedHash, bool, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	// read from one byte earlier to tell whether offset itself starts a line
+	readFrom := offset - 1
+	if readFrom < 0 {
+		readFrom = 0
+	}
+	buf := make([]byte, probeSize)
+	n, err := l.file.ReadAt(buf, readFrom)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return listedHash{}, false, err
+	}
+	buf = buf[:n]
+
+	start := 0
+	if offset > 0 {
+		newline := bytes.IndexByte(buf, '\n')
+		if newline < 0 {
+			return listedHash{}, false, nil
+		}
+		start = newline + 1
+	}
+	rest := buf[start:]
+	// blank trailing lines end the list
+	if len(bytes.TrimSpace(rest)) == 0 {
+		return listedHash{}, false, nil
+	}
+	if len(rest) < sha1HexLength {
+		return listedHash{}, false, fmt.Errorf("offset %d: expected a SHA-1 hash", readFrom+int64(start))
+	}
+	var line listedHash
+	if _, err := hex.Decode(line.sum[:], rest[:sha1HexLength]); err != nil {
+		return listedHash{}, false, fmt.Errorf("offset %d: %w", readFrom+int64(start), err)
+	}
+	line.start = readFrom + int64(start)
+	return line, true, nil
+}
+
+// rangeContains reads the single range file the hash would be listed in. A missing range file means no
+// password with that prefix has been breached.
+func (l *BreachedList) rangeContains(sum [sha1.Size]byte) (bool, error) {
+	full := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := full[:rangePrefixSize], full[rangePrefixSize:]
+
+	f, err := os.Open(filepath.Join(l.path, prefix+l.rangeExt))
+	if errors.Is(err, fs.ErrNotExist) {
+		f, err = os.Open(filepath.Join(l.path, strings.ToLower(prefix)+l.rangeExt))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open breached password range: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		listed, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(listed, suffix) {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breached password range: %w", err)
+	}
+	return false, nil
+}
+
+func isRangePrefix(s string) bool {
+	if len(s) != rangePrefixSize {
+		return false
+	}
+	_, err := hex.DecodeString(s + "0")
+	return err == nil
+}
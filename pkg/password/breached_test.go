@@ -0,0 +1,136 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func hashHex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// breachedPasswords returns n listed passwords, enough lines to make the binary search take many probes
+func breachedPasswords(n int) []string {
+	passwords := make([]string, n)
+	for i := range passwords {
+		passwords[i] = fmt.Sprintf("leaked-%d", i)
+	}
+	return passwords
+}
+
+func writeSortedList(t *testing.T, passwords []string, newline string) string {
+	t.Helper()
+	lines := make([]string, len(passwords))
+	for i, password := range passwords {
+		lines[i] = fmt.Sprintf("%s:%d", hashHex(password), i+1)
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords-sha1-ordered-by-hash.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, newline)+newline), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func loadTestList(t *testing.T, path string) *BreachedList {
+	t.Helper()
+	list, err := LoadBreachedList(path)
+	if err != nil {
+		t.Fatalf("LoadBreachedList: %v", err)
+	}
+	t.Cleanup(func() { _ = list.Close() })
+	return list
+}
+
+func assertContains(t *testing.T, list *BreachedList, password string, want bool) {
+	t.Helper()
+	got, err := list.Contains(password)
+	if err != nil {
+		t.Fatalf("Contains(%q): %v", password, err)
+	}
+	if got != want {
+		t.Fatalf("Contains(%q) = %v, want %v", password, got, want)
+	}
+}
+
+func TestSortedBreachedList(t *testing.T) {
+	passwords := breachedPasswords(2000)
+	for _, newline := range []string{"\n", "\r\n"} {
+		list := loadTestList(t, writeSortedList(t, passwords, newline))
+		for _, password := range passwords {
+			assertContains(t, list, password, true)
+		}
+		for i := range 200 {
+			assertContains(t, list, fmt.Sprintf("not-leaked-%d", i), false)
+		}
+	}
+}
+
+func TestSortedBreachedListWithOneEntry(t *testing.T) {
+	list := loadTestList(t, writeSortedList(t, []string{"hunter2"}, "\n"))
+	assertContains(t, list, "hunter2", true)
+	assertContains(t, list, "hunter3", false)
+}
+
+func TestRangeDirBreachedList(t *testing.T) {
+	passwords := breachedPasswords(300)
+	ranges := make(map[string][]string)
+	for i, password := range passwords {
+		full := hashHex(password)
+		ranges[full[:rangePrefixSize]] = append(ranges[full[:rangePrefixSize]], fmt.Sprintf("%s:%d", full[rangePrefixSize:], i+1))
+	}
+	dir := t.TempDir()
+	for prefix, lines := range ranges {
+		if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(strings.Join(lines, "\r\n")), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a range file"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	list := loadTestList(t, dir)
+	for _, password := range passwords {
+		assertContains(t, list, password, true)
+	}
+	for i := range 50 {
+		assertContains(t, list, fmt.Sprintf("not-leaked-%d", i), false)
+	}
+}
+
+func TestLoadBreachedListRejectsUnusableLists(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		return path
+	}
+
+	low, high := hashHex("a"), hashHex("b")
+	if low > high {
+		low, high = high, low
+	}
+	tests := map[string]string{
+		"missing":  filepath.Join(dir, "missing.txt"),
+		"empty":    write("empty.txt", "\n"),
+		"not sha1": write("plain.txt", "password123\n"),
+		"unsorted": write("unsorted.txt", high+":1\n"+low+":1\n"),
+		"no range": t.TempDir(),
+	}
+	for name, path := range tests {
+		if list, err := LoadBreachedList(path); err == nil {
+			_ = list.Close()
+			t.Errorf("%s: LoadBreachedList succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Package password hashes passwords into self-describing strings, so the algorithm and its
+// parameters can change while hashes produced by earlier settings keep verifying.
+package password
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unrecognized password hash format")
+	// ErrPasswordTooLong is returned by Hash when the algorithm can't hash the whole password
+	ErrPasswordTooLong = errors.New("password is too long for the hash algorithm")
+)
+
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded. Hashes of every supported algorithm are accepted.
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was produced by another algorithm or with other parameters
+	NeedsRehash(encoded string) bool
+}
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+type hasher struct {
+	algorithm string
+	argon2    Argon2Params
+	bcrypt    BcryptParams
+}
+
+// NewHasher hashes new passwords with algorithm and verifies hashes of any supported algorithm
+func NewHasher(algorithm string, argon2 Argon2Params, bcrypt BcryptParams) (Hasher, error) {
+	if algorithm != AlgorithmArgon2id && algorithm != AlgorithmBcrypt {
+		return nil, errors.New("password hash algorithm must be argon2id or bcrypt")
+	}
+	if err := argon2.validate(); err != nil {
+		return nil, err
+	}
+	if err := bcrypt.validate(); err != nil {
+		return nil, err
+	}
+	return &hasher{algorithm: algorithm, argon2: argon2, bcrypt: bcrypt}, nil
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgorithmBcrypt {
+		return hashBcrypt(password, h.bcrypt)
+	}
+	return hashArgon2id(password, h.argon2)
+}
+
+func (h *hasher) Verify(password, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return verifyArgon2id(password, encoded)
+	case isBcrypt(encoded):
+		return verifyBcrypt(password, encoded)
+	case encoded == "":
+		// accounts created through external identity providers have no password
+		return false, nil
+	default:
+		return false, ErrUnknownFormat
+	}
+}
+
+func (h *hasher) NeedsRehash(encoded string) bool {
+	if h.algorithm == AlgorithmBcrypt {
+		return !isBcrypt(encoded) || bcryptNeedsRehash(encoded, h.bcrypt)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$") {
+		return true
+	}
+	return argon2idNeedsRehash(encoded, h.argon2)
+}
@@ -0,0 +1,200 @@
+package password
+
+import (
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// testArgon2Params keep the tests fast, production uses DefaultArgon2Params
+var testArgon2Params = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newTestHasher(t *testing.T, algorithm string, argon2 Argon2Params, cost int) Hasher {
+	t.Helper()
+	h, err := NewHasher(algorithm, argon2, BcryptParams{Cost: cost})
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	return h
+}
+
+func assertVerify(t *testing.T, h Hasher, password, encoded string, want bool) {
+	t.Helper()
+	got, err := h.Verify(password, encoded)
+	if err != nil {
+		t.Fatalf("Verify(%q): %v", password, err)
+	}
+	if got != want {
+		t.Fatalf("Verify(%q) = %v, want %v", password, got, want)
+	}
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	h := newTestHasher(t, AlgorithmArgon2id, testArgon2Params, bcrypt.MinCost)
+
+	encoded, err := h.Hash("Correct-horse1")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash = %q, want the PHC string format", encoded)
+	}
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatalf("decodeArgon2id: %v", err)
+	}
+	if params != testArgon2Params || len(salt) != 16 || len(key) != 32 {
+		t.Fatalf("decoded %+v with %d byte salt and %d byte key, want %+v", params, len(salt), len(key), testArgon2Params)
+	}
+
+	assertVerify(t, h, "Correct-horse1", encoded, true)
+	assertVerify(t, h, "Correct-horse2", encoded, false)
+
+	again, err := h.Hash("Correct-horse1")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if again == encoded {
+		t.Fatal("two hashes of the same password are equal, the salt is not random")
+	}
+}
+
+func TestArgon2idVerifiesWithEncodedParameters(t *testing.T) {
+	old := newTestHasher(t, AlgorithmArgon2id, testArgon2Params, bcrypt.MinCost)
+	encoded, err := old.Hash("Correct-horse1")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+	h := newTestHasher(t, AlgorithmArgon2id, stronger, bcrypt.MinCost)
+	assertVerify(t, h, "Correct-horse1", encoded, true)
+}
+
+func TestVerifyRejectsMalformedHashes(t *testing.T) {
+	h := newTestHasher(t, AlgorithmArgon2id, testArgon2Params, bcrypt.MinCost)
+
+	for _, encoded := range []string{
+		"plaintext",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=64$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$",
+	} {
+		if ok, err := h.Verify("Correct-horse1", encoded); ok || err == nil {
+			t.Errorf("Verify(%q) = %v, %v, want an error", encoded, ok, err)
+		}
+	}
+	if ok, err := h.Verify("Correct-horse1", "plaintext"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Verify(plaintext) = %v, %v, want ErrUnknownFormat", ok, err)
+	}
+	// accounts from external identity providers have no password to match
+	assertVerify(t, h, "", "", false)
+}
+
+func TestVerifiesLegacyBcryptHashes(t *testing.T) {
+	h := newTestHasher(t, AlgorithmArgon2id, testArgon2Params, bcrypt.MinCost)
+
+	for _, version := range []string{"$2a$", "$2b$", "$2y$"} {
+		legacy, err := bcrypt.GenerateFromPassword([]byte("Correct-horse1"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("GenerateFromPassword: %v", err)
+		}
+		encoded := version + strings.TrimPrefix(string(legacy), "$2a$")
+		assertVerify(t, h, "Correct-horse1", encoded, true)
+		assertVerify(t, h, "Correct-horse2", encoded, false)
+		if !h.NeedsRehash(encoded) {
+			t.Errorf("NeedsRehash(%s...) = false, want bcrypt hashes upgraded to argon2id", version)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	argon2Hasher := newTestHasher(t, AlgorithmArgon2id, testArgon2Params, 5)
+	bcryptHasher := newTestHasher(t, AlgorithmBcrypt, testArgon2Params, 5)
+
+	current, err := argon2Hasher.Hash("Correct-horse1")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	bcryptCurrent, err := bcryptHasher.Hash("Correct-horse1")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	bcryptCheaper, err := bcrypt.GenerateFromPassword([]byte("Correct-horse1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		hasher  Hasher
+		params  func(*Argon2Params)
+		encoded string
+		want    bool
+	}{
+		{"argon2id with current parameters", argon2Hasher, nil, current, false},
+		{"argon2id with more memory wanted", argon2Hasher, func(p *Argon2Params) { p.Memory = 128 }, current, true},
+		{"argon2id with more iterations wanted", argon2Hasher, func(p *Argon2Params) { p.Iterations = 2 }, current, true},
+		{"argon2id with more parallelism wanted", argon2Hasher, func(p *Argon2Params) { p.Parallelism = 2 }, current, true},
+		{"argon2id with a longer key wanted", argon2Hasher, func(p *Argon2Params) { p.KeyLength = 64 }, current, true},
+		{"argon2id with a longer salt wanted", argon2Hasher, func(p *Argon2Params) { p.SaltLength = 32 }, current, true},
+		{"malformed argon2id", argon2Hasher, nil, "$argon2id$v=19$garbage", true},
+		{"bcrypt while argon2id is selected", argon2Hasher, nil, bcryptCurrent, true},
+		{"bcrypt with current cost", bcryptHasher, nil, bcryptCurrent, false},
+		{"bcrypt with a lower cost", bcryptHasher, nil, string(bcryptCheaper), true},
+		{"argon2id while bcrypt is selected", bcryptHasher, nil, current, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.hasher
+			if tt.params != nil {
+				params := testArgon2Params
+				tt.params(&params)
+				h = newTestHasher(t, AlgorithmArgon2id, params, 5)
+			}
+			if got := h.NeedsRehash(tt.encoded); got != tt.want {
+				t.Fatalf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBcryptRejectsPasswordsItWouldTruncate(t *testing.T) {
+	h := newTestHasher(t, AlgorithmBcrypt, testArgon2Params, bcrypt.MinCost)
+
+	longest := strings.Repeat("a", BcryptMaxBytes)
+	encoded, err := h.Hash(longest)
+	if err != nil {
+		t.Fatalf("Hash(%d bytes): %v", BcryptMaxBytes, err)
+	}
+	assertVerify(t, h, longest, encoded, true)
+
+	if _, err := h.Hash(longest + "b"); !errors.Is(err, ErrPasswordTooLong) {
+		t.Fatalf("Hash(%d bytes) = %v, want ErrPasswordTooLong", BcryptMaxBytes+1, err)
+	}
+}
+
+func TestNewHasherRejectsInvalidSettings(t *testing.T) {
+	weak := testArgon2Params
+	weak.KeyLength = 8
+
+	tests := []struct {
+		name      string
+		algorithm string
+		argon2    Argon2Params
+		cost      int
+	}{
+		{"unknown algorithm", "md5", testArgon2Params, 10},
+		{"short argon2id key", AlgorithmArgon2id, weak, 10},
+		{"bcrypt cost", AlgorithmBcrypt, testArgon2Params, 2},
+	}
+	for _, tt := range tests {
+		if _, err := NewHasher(tt.algorithm, tt.argon2, BcryptParams{Cost: tt.cost}); err == nil {
+			t.Errorf("%s: NewHasher succeeded, want an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy describes which new passwords are acceptable. Existing passwords are never re-checked.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes caps the encoded length for hash algorithms with a byte limit, see BcryptMaxBytes
+	MaxBytes int
+	// MinCharacterClasses is how many of lowercase, uppercase, digits and symbols must appear
+	MinCharacterClasses int
+	// DisallowPersonalInfo rejects passwords containing the username or the email address
+	DisallowPersonalInfo bool
+	// Breached is consulted when set
+	Breached *BreachedList
+}
+
+// PolicyError lists every rule a password broke, in a form that can be shown to the user
+type PolicyError struct {
+	Violations []string
+}
+
+func (e *PolicyError) Error() string {
+	return "password " + strings.Join(e.Violations, ", ")
+}
+
+// minPersonalInfoLength keeps very short usernames from rejecting unrelated passwords
+const minPersonalInfoLength = 3
+
+// Check validates password against the policy. personal holds values the password must not contain,
+// such as the username and email address. It returns a *PolicyError when any rule is broken, any other
+// error means the breached password list could not be read.
+func (p Policy) Check(password string, personal ...string) error {
+	var violations []string
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters long", p.MaxLength))
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long, non-ASCII characters take up to 4", p.MaxBytes))
+	}
+	if characterClasses(password) < p.MinCharacterClasses {
+		violations = append(violations, fmt.Sprintf("must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinCharacterClasses))
+	}
+	if p.DisallowPersonalInfo && containsPersonalInfo(password, personal) {
+		violations = append(violations, "must not contain your username or email address")
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, "has appeared in a data breach, choose a different one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+func containsPersonalInfo(password string, personal []string) bool {
+	lowered := strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		// the local part is what people reuse, the domain is usually too generic to matter
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			value = local
+		}
+		if utf8.RuneCountInString(value) >= minPersonalInfoLength && strings.Contains(lowered, value) {
+			return true
+		}
+	}
+	return false
+}
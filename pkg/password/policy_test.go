@@ -0,0 +1,104 @@
+package password
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := Policy{
+		MinLength:            8,
+		MaxLength:            16,
+		MinCharacterClasses:  3,
+		DisallowPersonalInfo: true,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"acceptable", "Correct-horse1", nil},
+		{"too short", "Ab1!", []string{"must be at least 8 characters long"}},
+		{"too long", "Correct-horse-battery1", []string{"must be at most 16 characters long"}},
+		{"counts characters not bytes", "Пароль-ёжик-12", nil},
+		{"too few classes", "correcthorse", []string{"must mix at least 3 of lowercase letters, uppercase letters, digits and symbols"}},
+		{"contains username", "Xx-alice-9000", []string{"must not contain your username or email address"}},
+		{"contains email local part", "Bob.Smith-1", []string{"must not contain your username or email address"}},
+		{"only email domain", "Example.com-1", nil},
+		{"every violation", "alice", []string{
+			"must be at least 8 characters long",
+			"must mix at least 3 of lowercase letters, uppercase letters, digits and symbols",
+			"must not contain your username or email address",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, "Alice", "bob.smith@example.com")
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Check(%q) = %v, want nil", tt.password, err)
+				}
+				return
+			}
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Check(%q) = %v, want a *PolicyError", tt.password, err)
+			}
+			if !reflect.DeepEqual(policyErr.Violations, tt.want) {
+				t.Fatalf("Check(%q) violations = %q, want %q", tt.password, policyErr.Violations, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckCapsBytesForBcrypt(t *testing.T) {
+	policy := Policy{MaxLength: 128, MaxBytes: BcryptMaxBytes}
+
+	if err := policy.Check(strings.Repeat("a", BcryptMaxBytes)); err != nil {
+		t.Fatalf("Check(%d ASCII characters) = %v, want nil", BcryptMaxBytes, err)
+	}
+	// 40 characters fit MaxLength but take 80 bytes, bcrypt would ignore the last 8
+	var policyErr *PolicyError
+	if err := policy.Check(strings.Repeat("ё", 40)); !errors.As(err, &policyErr) {
+		t.Fatalf("Check(80 bytes) = %v, want a *PolicyError", err)
+	}
+	if want := []string{"must be at most 72 bytes long, non-ASCII characters take up to 4"}; !reflect.DeepEqual(policyErr.Violations, want) {
+		t.Fatalf("violations = %q, want %q", policyErr.Violations, want)
+	}
+}
+
+func TestPolicyCheckIgnoresShortPersonalInfo(t *testing.T) {
+	policy := Policy{DisallowPersonalInfo: true}
+	if err := policy.Check("Jo-correct-horse", "jo"); err != nil {
+		t.Fatalf("Check = %v, want nil for a username shorter than %d characters", err, minPersonalInfoLength)
+	}
+}
+
+func TestPolicyCheckRejectsBreachedPasswords(t *testing.T) {
+	policy := Policy{Breached: loadTestList(t, writeSortedList(t, []string{"Summer2024!"}, "\n"))}
+
+	var policyErr *PolicyError
+	if err := policy.Check("Summer2024!"); !errors.As(err, &policyErr) {
+		t.Fatalf("Check = %v, want a *PolicyError", err)
+	}
+	if want := []string{"has appeared in a data breach, choose a different one"}; !reflect.DeepEqual(policyErr.Violations, want) {
+		t.Fatalf("violations = %q, want %q", policyErr.Violations, want)
+	}
+	if err := policy.Check("Winter2024!"); err != nil {
+		t.Fatalf("Check = %v, want nil for an unlisted password", err)
+	}
+}
+
+func TestPolicyCheckFailsWhenBreachedListIsUnreadable(t *testing.T) {
+	list := loadTestList(t, writeSortedList(t, []string{"Summer2024!"}, "\n"))
+	_ = list.Close()
+
+	var policyErr *PolicyError
+	err := Policy{Breached: list}.Check("Winter2024!")
+	if err == nil || errors.As(err, &policyErr) {
+		t.Fatalf("Check = %v, want a read error", err)
+	}
+}
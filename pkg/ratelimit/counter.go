@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// Counter is a fixed-window counter: the window starts at the first increment of a key
+type Counter interface {
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+	Get(ctx context.Context, key string) (int64, error)
+	Reset(ctx context.Context, key string) error
+}
+
+var incrScript = redis.NewScript(`
+local v = redis.call('INCR', KEYS[1])
+if v == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return v
+`)
+
+type redisCounter struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisCounter(client *redis.Client, prefix string) Counter {
+	return &redisCounter{client: client, prefix: prefix}
+}
+
+func (c *redisCounter) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return incrScript.Run(ctx, c.client, []string{c.prefix + key}, window.Milliseconds()).Int64()
+}
+
+func (c *redisCounter) Get(ctx context.Context, key string) (int64, error) {
+	v, err := c.client.Get(ctx, c.prefix+key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return v, err
+}
+
+func (c *redisCounter) Reset(ctx context.Context, key string) error {
+	return c.client.Del(ctx, c.prefix+key).Err()
+}
+
+type memoryCounter struct {
+	mu        sync.Mutex
+	entries   map[string]*counterEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type counterEntry struct {
+	value     int64
+	expiresAt time.Time
+}
+
+func NewMemoryCounter() Counter {
+	return &memoryCounter{entries: make(map[string]*counterEntry), lastSweep: time.Now(), now: time.Now}
+}
+
+func (c *memoryCounter) Incr(_ context.Context, key string, window time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entry := c.live(key, now)
+	if entry == nil {
+		c.sweep(now)
+		entry = &counterEntry{expiresAt: now.Add(window)}
+		c.entries[key] = entry
+	}
+	entry.value++
+	return entry.value, nil
+}
+
+func (c *memoryCounter) Get(_ context.Context, key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry := c.live(key, c.now()); entry != nil {
+		return entry.value, nil
+	}
+	return 0, nil
+}
+
+func (c *memoryCounter) Reset(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+	return nil
+}
+
+func (c *memoryCounter) live(key string, now time.Time) *counterEntry {
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		return nil
+	}
+	return entry
+}
+
+// sweep drops expired keys at most once a minute so the map doesn't grow without bound
+func (c *memoryCounter) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Minute {
+		return
+	}
+	c.lastSweep = now
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
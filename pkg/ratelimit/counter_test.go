@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCounters(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	server, client := newTestRedis(t)
+
+	memory := NewMemoryCounter().(*memoryCounter)
+	memory.now = clock.Now
+	counters := map[string]struct {
+		counter Counter
+		advance func(time.Duration)
+	}{
+		"memory": {memory, clock.Advance},
+		"redis":  {NewRedisCounter(client, "bruteforce:"), server.FastForward},
+	}
+
+	for name, tc := range counters {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mustGet := func(key string) int64 {
+				t.Helper()
+				v, err := tc.counter.Get(ctx, key)
+				if err != nil {
+					t.Fatalf("Get: %v", err)
+				}
+				return v
+			}
+
+			if v := mustGet("acct:7"); v != 0 {
+				t.Fatalf("unknown key = %d, want 0", v)
+			}
+			for want := int64(1); want <= 3; want++ {
+				v, err := tc.counter.Incr(ctx, "acct:7", time.Minute)
+				if err != nil {
+					t.Fatalf("Incr: %v", err)
+				}
+				if v != want {
+					t.Fatalf("Incr = %d, want %d", v, want)
+				}
+			}
+			if v := mustGet("acct:7"); v != 3 {
+				t.Fatalf("Get = %d, want 3", v)
+			}
+
+			// the window is fixed from the first increment, later increments don't extend it
+			tc.advance(59 * time.Second)
+			if _, err := tc.counter.Incr(ctx, "acct:7", time.Minute); err != nil {
+				t.Fatalf("Incr: %v", err)
+			}
+			tc.advance(2 * time.Second)
+			if v := mustGet("acct:7"); v != 0 {
+				t.Fatalf("after the window Get = %d, want 0", v)
+			}
+
+			if _, err := tc.counter.Incr(ctx, "acct:8", time.Minute); err != nil {
+				t.Fatalf("Incr: %v", err)
+			}
+			if err := tc.counter.Reset(ctx, "acct:8"); err != nil {
+				t.Fatalf("Reset: %v", err)
+			}
+			if v := mustGet("acct:8"); v != 0 {
+				t.Fatalf("after Reset Get = %d, want 0", v)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+// fakeClock is shared by a limiter and its test so windows can slide without sleeping
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return server, client
+}
+
+// limiters returns every Limiter implementation driven by clock
+func limiters(t *testing.T, clock *fakeClock) map[string]Limiter {
+	_, client := newTestRedis(t)
+
+	memory := NewMemoryLimiter().(*memoryLimiter)
+	memory.now = clock.Now
+	redisLim := NewRedisLimiter(client, "ratelimit:").(*redisLimiter)
+	redisLim.now = clock.Now
+
+	return map[string]Limiter{"memory": memory, "redis": redisLim}
+}
+
+func TestLimiterAllowsUpToLimit(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	for name, limiter := range limiters(t, clock) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i := 1; i <= 3; i++ {
+				res, err := limiter.Allow(ctx, "login:ip:1.2.3.4", 3, time.Minute)
+				if err != nil {
+					t.Fatalf("Allow: %v", err)
+				}
+				if !res.Allowed || res.Remaining != 3-i || res.Limit != 3 {
+					t.Fatalf("request %d: got %+v, want allowed with %d remaining", i, res, 3-i)
+				}
+				if res.RetryAfter != 0 {
+					t.Errorf("request %d: RetryAfter = %v on an allowed request", i, res.RetryAfter)
+				}
+			}
+
+			res, err := limiter.Allow(ctx, "login:ip:1.2.3.4", 3, time.Minute)
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+			if res.Allowed || res.Remaining != 0 {
+				t.Fatalf("4th request: got %+v, want rejected", res)
+			}
+			if res.RetryAfter != time.Minute || res.ResetAfter != time.Minute {
+				t.Errorf("4th request: RetryAfter %v ResetAfter %v, want 1m", res.RetryAfter, res.ResetAfter)
+			}
+		})
+	}
+}
+
+func TestLimiterWindowSlides(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	for name, limiter := range limiters(t, clock) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			allow := func() Result {
+				t.Helper()
+				res, err := limiter.Allow(ctx, "api:user:7", 2, time.Minute)
+				if err != nil {
+					t.Fatalf("Allow: %v", err)
+				}
+				return res
+			}
+
+			allow()
+			clock.Advance(30 * time.Second)
+			allow()
+
+			clock.Advance(10 * time.Second)
+			if res := allow(); res.Allowed || res.RetryAfter != 20*time.Second {
+				t.Fatalf("at 40s: got %+v, want rejected until the first hit leaves the window in 20s", res)
+			}
+
+			// a sliding window frees one slot once the first hit is older than the window, not both
+			clock.Advance(21 * time.Second)
+			if res := allow(); !res.Allowed || res.Remaining != 0 {
+				t.Fatalf("at 61s: got %+v, want allowed with 0 remaining", res)
+			}
+			if res := allow(); res.Allowed {
+				t.Fatalf("at 61s: second request allowed, the hit at 30s is still in the window")
+			}
+		})
+	}
+}
+
+func TestLimiterKeysAreIndependent(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	for name, limiter := range limiters(t, clock) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if res, _ := limiter.Allow(ctx, "a", 1, time.Minute); !res.Allowed {
+				t.Fatal("first request of a rejected")
+			}
+			if res, _ := limiter.Allow(ctx, "a", 1, time.Minute); res.Allowed {
+				t.Fatal("second request of a allowed")
+			}
+			if res, _ := limiter.Allow(ctx, "b", 1, time.Minute); !res.Allowed {
+				t.Fatal("b was limited by requests of a")
+			}
+		})
+	}
+}
+
+func TestRedisLimiterKeysExpire(t *testing.T) {
+	server, client := newTestRedis(t)
+	limiter := NewRedisLimiter(client, "ratelimit:")
+
+	if _, err := limiter.Allow(context.Background(), "signup:ip:1.2.3.4", 5, time.Minute); err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if !server.Exists("ratelimit:signup:ip:1.2.3.4") {
+		t.Fatalf("expected prefixed key, have %v", server.Keys())
+	}
+	if ttl := server.TTL("ratelimit:signup:ip:1.2.3.4"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL = %v, want the window", ttl)
+	}
+
+	server.FastForward(time.Minute + time.Second)
+	if server.Exists("ratelimit:signup:ip:1.2.3.4") {
+		t.Error("idle key was not expired")
+	}
+}
+
+func TestRedisLimiterUnavailable(t *testing.T) {
+	server, client := newTestRedis(t)
+	limiter := NewRedisLimiter(client, "ratelimit:")
+	server.Close()
+
+	if _, err := limiter.Allow(context.Background(), "k", 1, time.Minute); err == nil {
+		t.Fatal("expected an error when Redis is down")
+	}
+}
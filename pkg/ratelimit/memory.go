@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryLimiter is a per-process fallback used when Redis is not configured.
+// Limits are not shared between replicas.
+type memoryLimiter struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryEntry struct {
+	hits   []time.Time
+	window time.Duration
+}
+
+func NewMemoryLimiter() Limiter {
+	return &memoryLimiter{entries: make(map[string]*memoryEntry), lastSweep: time.Now(), now: time.Now}
+}
+
+func (l *memoryLimiter) Allow(_ context.Context, key string, limit int, window time.Duration) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	entry, ok := l.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		l.entries[key] = entry
+	}
+	entry.window = window
+	entry.hits = prune(entry.hits, now.Add(-window))
+
+	allowed := len(entry.hits) < limit
+	if allowed {
+		entry.hits = append(entry.hits, now)
+	}
+
+	reset := window
+	if len(entry.hits) > 0 {
+		reset = entry.hits[0].Add(window).Sub(now)
+	}
+
+	result := Result{
+		Allowed:    allowed,
+		Limit:      limit,
+		Remaining:  max(limit-len(entry.hits), 0),
+		ResetAfter: reset,
+	}
+	if !allowed {
+		result.RetryAfter = reset
+	}
+	return result, nil
+}
+
+// sweep drops idle keys at most once a minute so the map doesn't grow without bound
+func (l *memoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	for key, entry := range l.entries {
+		if len(entry.hits) == 0 || entry.hits[len(entry.hits)-1].Before(now.Add(-entry.window)) {
+			delete(l.entries, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func prune(hits []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+	return hits[i:]
+}
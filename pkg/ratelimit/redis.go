@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// slidingWindowScript keeps one sorted set entry per request scored by its timestamp in ms.
+// Returns {allowed, remaining, reset_ms, retry_ms}.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local member = ARGV[4]
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+local allowed = count < limit
+if allowed then
+	redis.call('ZADD', key, now, member)
+	redis.call('PEXPIRE', key, window)
+	count = count + 1
+end
+
+local reset = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+
+if allowed then
+	return {1, limit - count, reset, 0}
+end
+return {0, 0, reset, reset}
+`)
+
+type redisLimiter struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+func NewRedisLimiter(client *redis.Client, prefix string) Limiter {
+	return &redisLimiter{client: client, prefix: prefix, now: time.Now}
+}
+
+func (l *redisLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	member, err := randomMember()
+	if err != nil {
+		return Result{}, err
+	}
+
+	now := l.now().UnixMilli()
+	res, err := slidingWindowScript.Run(ctx, l.client, []string{l.prefix + key}, now, window.Milliseconds(), limit, member).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("rate limit script: %w", err)
+	}
+	if len(res) != 4 {
+		return Result{}, fmt.Errorf("rate limit script: unexpected reply %v", res)
+	}
+
+	return Result{
+		Allowed:    res[0] == 1,
+		Limit:      limit,
+		Remaining:  int(res[1]),
+		ResetAfter: time.Duration(res[2]) * time.Millisecond,
+		RetryAfter: time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
+
+// randomMember keeps sorted set members unique when two requests land in the same millisecond
+func randomMember() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
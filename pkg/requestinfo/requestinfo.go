@@ -0,0 +1,26 @@
+// Package requestinfo carries details about the client of the current request through a context, so
+// services can record where an action came from without every method taking them as arguments.
+package requestinfo
+
+import "context"
+
+// Header carries the request ID, clients and proxies may set it to correlate their logs with ours
+const Header = "X-Request-ID"
+
+type Info struct {
+	RequestID string
+	IP        string
+	UserAgent string
+}
+
+type contextKey struct{}
+
+func With(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// From returns the zero Info outside of a request, e.g. in background jobs
+func From(ctx context.Context) Info {
+	info, _ := ctx.Value(contextKey{}).(Info)
+	return info
+}
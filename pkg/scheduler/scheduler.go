@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Job is a unit of periodic work run by the Scheduler. Run gets a logger that already names the job.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Jitter   time.Duration
+	Run      func(ctx context.Context, logger *slog.Logger) error
+}
+
+// Locker keeps a job from running on two replicas at the same time.
+// TryLock returns acquired=false without error when another replica holds the lock.
+type Locker interface {
+	TryLock(ctx context.Context, name string) (release func(), acquired bool, err error)
+}
+
+// RunLog is shared by all replicas and makes a job run once per interval across the deployment
+// rather than once per replica.
+type RunLog interface {
+	// Claim records a run of the job and reports true, or reports false when it ran less than interval ago
+	Claim(ctx context.Context, name string, interval time.Duration) (bool, error)
+}
+
+type Scheduler struct {
+	jobs   []Job
+	locker Locker
+	runs   RunLog
+	logger *slog.Logger
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(locker Locker, runs RunLog, logger *slog.Logger) *Scheduler {
+	return &Scheduler{locker: locker, runs: runs, logger: logger}
+}
+
+// Register adds a job. Jobs must be registered before Start is called.
+// A job needs a positive Interval, a zero one would run it in a tight loop.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return errors.New("job name and run function are required")
+	}
+	if job.Interval <= 0 {
+		return fmt.Errorf("job %s: interval must be positive, got %s", job.Name, job.Interval)
+	}
+	if job.Jitter < 0 {
+		return fmt.Errorf("job %s: jitter must not be negative, got %s", job.Name, job.Jitter)
+	}
+	s.jobs = append(s.jobs, job)
+	return nil
+}
+
+// Start launches one goroutine per registered job. Each job waits Interval plus
+// a random Jitter before its next run, so replicas don't hammer the database in lockstep.
+// A replica whose turn comes while the job ran recently elsewhere skips that turn.
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+
+	s.logger.Info("Scheduler started", "jobs", len(s.jobs))
+}
+
+// Stop cancels all jobs and waits for in-flight runs to return or ctx to expire
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.logger.Info("Scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return errors.New("scheduler stop timed out waiting for running jobs")
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+	logger := s.logger.With("job", job.Name)
+
+	timer := time.NewTimer(nextDelay(job))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			s.runOnce(ctx, job, logger)
+			timer.Reset(nextDelay(job))
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, job Job, logger *slog.Logger) {
+	release, acquired, err := s.locker.TryLock(ctx, job.Name)
+	if err != nil {
+		logger.Error("Failed to acquire job lock", "error", err)
+		return
+	}
+	if !acquired {
+		logger.Debug("Job is running on another replica, skipping")
+		return
+	}
+	defer release()
+
+	// every replica wakes up once per interval, only the first one to claim the run does the work
+	claimed, err := s.runs.Claim(ctx, job.Name, job.Interval)
+	if err != nil {
+		logger.Error("Failed to claim job run", "error", err)
+		return
+	}
+	if !claimed {
+		logger.Debug("Job already ran on another replica within its interval, skipping")
+		return
+	}
+
+	started := time.Now()
+	if err := job.Run(ctx, logger); err != nil {
+		logger.Error("Job failed", "duration", time.Since(started), "error", err)
+		return
+	}
+	logger.Info("Job completed", "duration", time.Since(started))
+}
+
+func nextDelay(job Job) time.Duration {
+	if job.Jitter <= 0 {
+		return job.Interval
+	}
+	return job.Interval + rand.N(job.Jitter)
+}
@@ -0,0 +1,252 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeLocker stands in for the database lock shared by all replicas
+type fakeLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+	err  error
+}
+
+func newFakeLocker() *fakeLocker {
+	return &fakeLocker{held: make(map[string]bool)}
+}
+
+func (l *fakeLocker) TryLock(_ context.Context, name string) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return nil, false, l.err
+	}
+	if l.held[name] {
+		return nil, false, nil
+	}
+	l.held[name] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, name)
+	}, true, nil
+}
+
+// fakeRunLog stands in for the run table shared by all replicas
+type fakeRunLog struct {
+	mu   sync.Mutex
+	now  time.Time
+	last map[string]time.Time
+}
+
+func newFakeRunLog() *fakeRunLog {
+	return &fakeRunLog{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), last: make(map[string]time.Time)}
+}
+
+func (l *fakeRunLog) Claim(_ context.Context, name string, interval time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if last, ok := l.last[name]; ok && l.now.Sub(last) < interval {
+		return false, nil
+	}
+	l.last[name] = l.now
+	return true, nil
+}
+
+func (l *fakeRunLog) advance(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = l.now.Add(d)
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestJobRunsOncePerIntervalAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	locker, runs := newFakeLocker(), newFakeRunLog()
+	replicas := []*Scheduler{New(locker, runs, testLogger()), New(locker, runs, testLogger())}
+
+	var count atomic.Int32
+	job := Job{Name: "purge", Interval: time.Hour, Run: func(context.Context, *slog.Logger) error {
+		count.Add(1)
+		return nil
+	}}
+
+	// both replicas wake up every interval, one after the other
+	for interval := 1; interval <= 3; interval++ {
+		for _, s := range replicas {
+			s.runOnce(ctx, job, testLogger())
+		}
+		if got := count.Load(); got != int32(interval) {
+			t.Fatalf("after %d intervals the job ran %d times, want %d", interval, got, interval)
+		}
+		runs.advance(time.Hour)
+	}
+}
+
+func TestJobDoesNotOverlapAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	locker, runs := newFakeLocker(), newFakeRunLog()
+	leader, follower := New(locker, runs, testLogger()), New(locker, runs, testLogger())
+
+	var count atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	job := Job{Name: "purge", Interval: time.Minute, Run: func(context.Context, *slog.Logger) error {
+		if count.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return nil
+	}}
+
+	done := make(chan struct{})
+	go func() {
+		leader.runOnce(ctx, job, testLogger())
+		close(done)
+	}()
+	<-started
+
+	// the run takes longer than the interval, the follower must still wait for it
+	runs.advance(2 * time.Minute)
+	follower.runOnce(ctx, job, testLogger())
+	if got := count.Load(); got != 1 {
+		t.Fatalf("runs while the leader holds the lock = %d, want 1", got)
+	}
+
+	close(release)
+	<-done
+	follower.runOnce(ctx, job, testLogger())
+	if got := count.Load(); got != 2 {
+		t.Fatalf("runs after the leader finished = %d, want 2", got)
+	}
+}
+
+func TestRunOnceSkipsWhenClaimFails(t *testing.T) {
+	s := New(newFakeLocker(), failingRunLog{}, testLogger())
+
+	ran := false
+	s.runOnce(context.Background(), Job{Name: "purge", Interval: time.Minute, Run: func(context.Context, *slog.Logger) error {
+		ran = true
+		return nil
+	}}, testLogger())
+	if ran {
+		t.Fatal("a job must not run when its run cannot be claimed")
+	}
+}
+
+type failingRunLog struct{}
+
+func (failingRunLog) Claim(context.Context, string, time.Duration) (bool, error) {
+	return false, errors.New("database is down")
+}
+
+func TestRunOnceSkipsWhenLockFails(t *testing.T) {
+	locker := newFakeLocker()
+	locker.err = errors.New("database is down")
+	s := New(locker, newFakeRunLog(), testLogger())
+
+	ran := false
+	s.runOnce(context.Background(), Job{Name: "purge", Interval: time.Minute, Run: func(context.Context, *slog.Logger) error {
+		ran = true
+		return nil
+	}}, testLogger())
+	if ran {
+		t.Fatal("a job must not run without the lock")
+	}
+}
+
+func TestRunOnceReleasesLockAfterFailure(t *testing.T) {
+	locker := newFakeLocker()
+	s := New(locker, newFakeRunLog(), testLogger())
+
+	s.runOnce(context.Background(), Job{Name: "purge", Interval: time.Minute, Run: func(context.Context, *slog.Logger) error {
+		return errors.New("boom")
+	}}, testLogger())
+	if locker.held["purge"] {
+		t.Fatal("the lock must be released when the job fails")
+	}
+}
+
+func TestNextDelayStaysWithinJitter(t *testing.T) {
+	job := Job{Name: "purge", Interval: time.Minute, Jitter: 10 * time.Second}
+	for range 1000 {
+		d := nextDelay(job)
+		if d < job.Interval || d >= job.Interval+job.Jitter {
+			t.Fatalf("nextDelay = %s, want within [%s, %s)", d, job.Interval, job.Interval+job.Jitter)
+		}
+	}
+
+	job.Jitter = 0
+	if d := nextDelay(job); d != job.Interval {
+		t.Fatalf("nextDelay without jitter = %s, want %s", d, job.Interval)
+	}
+}
+
+func TestRegisterRejectsInvalidJobs(t *testing.T) {
+	run := func(context.Context, *slog.Logger) error { return nil }
+	tests := []struct {
+		name string
+		job  Job
+	}{
+		{"zero interval", Job{Name: "purge", Run: run}},
+		{"negative interval", Job{Name: "purge", Interval: -time.Second, Run: run}},
+		{"negative jitter", Job{Name: "purge", Interval: time.Minute, Jitter: -time.Second, Run: run}},
+		{"no name", Job{Interval: time.Minute, Run: run}},
+		{"no run", Job{Name: "purge", Interval: time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(newFakeLocker(), newFakeRunLog(), testLogger())
+			if err := s.Register(tt.job); err == nil {
+				t.Fatal("Register accepted an invalid job")
+			}
+			if len(s.jobs) != 0 {
+				t.Fatal("an invalid job must not be registered")
+			}
+		})
+	}
+
+	s := New(newFakeLocker(), newFakeRunLog(), testLogger())
+	if err := s.Register(Job{Name: "purge", Interval: time.Minute, Run: run}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+}
+
+func TestStartRunsJobsUntilStopped(t *testing.T) {
+	s := New(newFakeLocker(), newFakeRunLog(), testLogger())
+	ran := make(chan struct{}, 1)
+	err := s.Register(Job{Name: "tick", Interval: time.Millisecond, Run: func(context.Context, *slog.Logger) error {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	s.Start(context.Background())
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("job did not run")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+}
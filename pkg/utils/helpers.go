@@ -5,3 +5,7 @@ import "time"
 func TimePtr(t time.Time) *time.Time {
 	return &t
 }
+
+func Ptr[T any](v T) *T {
+	return &v
+}